@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+)
+
+const usage = `Usage: enigma-admin <command> [flags]
+
+Commands:
+  argon-calibrate   benchmarks argon2id on this host and recommends the ARGON_* params
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "argon-calibrate":
+		argonCalibrate(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func argonCalibrate(args []string) {
+	parallelism := runtime.NumCPU()
+	if parallelism > 255 {
+		parallelism = 255
+	}
+
+	fs := flag.NewFlagSet("argon-calibrate", flag.ExitOnError)
+	target := fs.Duration("target", 500*time.Millisecond, "how long hashing a password should take at most")
+	memory := fs.Uint("memory", 64*1024, "memory budget of every hash in KiB")
+	threads := fs.Uint("parallelism", uint(parallelism), "threads used by every hash")
+	samples := fs.Int("samples", 3, "times each set of params is measured")
+	env := fs.Bool("env", false, "print the params as env lines")
+	fs.Parse(args) // nolint
+
+	if *threads == 0 || *threads > 255 || *memory > 1<<32-1 {
+		fmt.Fprintln(os.Stderr, "parallelism must be between 1 and 255 and memory fit in 32 bits")
+		os.Exit(2)
+	}
+
+	p, took, err := encryption.CalibrateArgonParams(encryption.ArgonCalibration{
+		TargetDuration: *target,
+		MaxMemory:      uint32(*memory),
+		Parallelism:    uint8(*threads),
+		Samples:        *samples,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if !*env {
+		fmt.Printf("Hashing with m=%d KiB, t=%d, p=%d takes %v on this host (target %v)\n\n", p.Memory, p.Iterations, p.Parallelism, took.Round(time.Millisecond), *target)
+	}
+	fmt.Printf("ARGON_MEMORY=%d\n", p.Memory)
+	fmt.Printf("ARGON_ITERATIONS=%d\n", p.Iterations)
+	fmt.Printf("ARGON_PARALLELISM=%d\n", p.Parallelism)
+	fmt.Printf("ARGON_SALT_LENGTH=%d\n", p.SaltLength)
+	fmt.Printf("ARGON_KEY_LENGTH=%d\n", p.KeyLength)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
 	"github.com/CienciaArgentina/go-enigma/internal/http/rest"
 )
@@ -8,6 +10,11 @@ import (
 func main() {
 	clog.SetLogLevel(clog.DebugLevel)
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(os.Args[2:])
+		return
+	}
+
 	if err := rest.InitRouter().Run(); err != nil {
 		clog.Panic("Error starting app", "main", err, nil)
 	}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/migrations"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
+)
+
+const migrateUsage = `Usage: enigma-server migrate <command>
+
+Commands:
+  up       applies every pending migration
+  down     reverts the latest applied migration
+  status   lists the migrations and whether they were applied
+`
+
+// migrate Runs the schema migrations against the database configured for the server
+func migrate(args []string) {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	opts, err := config.NewDatabaseOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	db, err := storage.Open(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer db.Close() // nolint
+
+	m, err := migrations.NewMigrator(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up()
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if len(applied) == 0 {
+			fmt.Println("the schema is up to date")
+		}
+	case "down":
+		reverted, err := m.Down()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if reverted == nil {
+			fmt.Println("there are no migrations to revert")
+			return
+		}
+		fmt.Printf("reverted %04d_%s\n", reverted.Version, reverted.Name)
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range status {
+			applied := "pending"
+			if s.Applied {
+				applied = s.DateApplied
+			}
+			if s.Unknown {
+				applied += " (unknown to this release)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush() // nolint
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"encoding/base64"
 	"errors"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
@@ -12,6 +14,8 @@ import (
 
 const (
 	envPasswordHashing  = "PASSWORD_HASHING_KEY"
+	envMFAEncryptionKey = "MFA_ENCRYPTION_KEY"
+	envPasswordPeppers  = "PASSWORD_PEPPER_KEYS"
 	envArgonMemory      = "ARGON_MEMORY"
 	envArgonIterations  = "ARGON_ITERATIONS"
 	envArgonParallelism = "ARGON_PARALLELISM"
@@ -24,7 +28,72 @@ const (
 	defaultArgonSaltLength  = 32
 	defaultArgonKeyLength   = 32
 
-	envJwtSign = "JWT_SIGN"
+	envJwtSign        = "JWT_SIGN"
+	envJwtSigningKeys = "JWT_SIGNING_KEYS"
+
+	envJwtIssuer                 = "JWT_ISSUER"
+	envJwtAudience               = "JWT_AUDIENCE"
+	envJwtAccessTokenDuration    = "JWT_ACCESS_TOKEN_DURATION"
+	envJwtRefreshTokenDuration   = "JWT_REFRESH_TOKEN_DURATION"
+	envJwtKeyRetirementPeriod    = "JWT_KEY_RETIREMENT_PERIOD"
+	envJwtMFATokenDuration       = "JWT_MFA_TOKEN_DURATION"
+	envMagicLinkDuration         = "MAGIC_LINK_DURATION"
+	envPasswordResetDuration     = "PASSWORD_RESET_DURATION"
+	envEmailVerificationDuration = "EMAIL_VERIFICATION_DURATION"
+
+	defaultJwtIssuer                 = "https://auth.cienciaargentina.dev"
+	defaultJwtAudience               = "ciencia-argentina"
+	defaultJwtAccessTokenDuration    = 15 * time.Minute
+	defaultJwtRefreshTokenDuration   = 30 * 24 * time.Hour
+	defaultJwtKeyRetirementPeriod    = 24 * time.Hour
+	defaultJwtMFATokenDuration       = 5 * time.Minute
+	defaultMagicLinkDuration         = 15 * time.Minute
+	defaultPasswordResetDuration     = time.Hour
+	defaultEmailVerificationDuration = 24 * time.Hour
+
+	// AES-256
+	mfaEncryptionKeyLength = 32
+
+	envTokenRevocationStore = "TOKEN_REVOCATION_STORE"
+
+	envPasswordHasher = "PASSWORD_HASHER"
+
+	envWebAuthnRPID    = "WEBAUTHN_RP_ID"
+	envWebAuthnOrigins = "WEBAUTHN_ORIGINS"
+
+	defaultWebAuthnRPID    = "cienciaargentina.dev"
+	defaultWebAuthnRPName  = "Ciencia Argentina"
+	defaultWebAuthnOrigins = "https://cienciaargentina.dev"
+
+	RevocationStoreSQL    = "sql"
+	RevocationStoreMemory = "memory"
+
+	PasswordHasherArgon2id = "argon2id"
+	PasswordHasherBcrypt   = "bcrypt"
+	PasswordHasherPBKDF2   = "pbkdf2_sha256"
+	PasswordHasherScrypt   = "scrypt"
+
+	envDBDriver   = "DB_DRIVER"
+	envDBDSN      = "DB_DSN"
+	envDBUsername = "DB_USERNAME"
+	envDBPassword = "DB_PASSWORD"
+	envDBHostname = "DB_HOSTNAME"
+	envDBPort     = "DB_PORT"
+	envDBName     = "DB_NAME"
+
+	DatabaseDriverMySQL    = "mysql"
+	DatabaseDriverPostgres = "postgres"
+	DatabaseDriverSQLite   = "sqlite3"
+
+	envQueryTimeout       = "DB_QUERY_TIMEOUT"
+	envRolesTimeout       = "ROLES_TIMEOUT"
+	envProfileTimeout     = "PROFILE_TIMEOUT"
+	envEmailSenderTimeout = "EMAIL_SENDER_TIMEOUT"
+
+	defaultQueryTimeout       = 5 * time.Second
+	defaultRolesTimeout       = 10 * time.Second
+	defaultProfileTimeout     = 10 * time.Second
+	defaultEmailSenderTimeout = 10 * time.Second
 )
 
 type EnigmaConfig struct {
@@ -32,8 +101,20 @@ type EnigmaConfig struct {
 	ArgonParams     *ArgonParams
 	RegisterOptions *RegisterOptions
 	LoginOptions    *LoginOptions
+	TokenOptions    *TokenOptions
+	WebAuthnOptions *WebAuthnOptions
+	DatabaseOptions *DatabaseOptions
+	// Not a pointer so the services can read it from a config built by hand, where the zero values mean no limit
+	TimeoutOptions TimeoutOptions
 	Microservices
 	JwtSign string
+	// PEM private key file, or directory of them, used to sign tokens. JwtSign is only used when this is empty
+	JwtSigningKeysPath string
+	// Where the jti of revoked access tokens are kept, RevocationStoreSQL or RevocationStoreMemory
+	RevocationStore string
+	// Algorithm new password hashes are generated with. Hashes of the other ones are still verified, so imported users
+	// can log in, and upgraded on login. Empty means PasswordHasherArgon2id
+	PasswordHasher string
 }
 
 type Server struct {
@@ -42,6 +123,13 @@ type Server struct {
 
 type Keys struct {
 	PasswordHashingKey string
+	// Encrypts the TOTP secrets of the users, they have to be read back so they can't be hashed
+	MFAEncryptionKey []byte
+	// Keys the password pepper is derived from by version. New hashes use PasswordPepperVersion, the other versions
+	// are kept so the hashes peppered with them keep verifying until their users log in again. Empty when
+	// PASSWORD_PEPPER_KEYS isn't set, then the passwords aren't peppered
+	PasswordPeppers       map[int]string
+	PasswordPepperVersion int
 }
 
 type Microservices struct {
@@ -69,6 +157,60 @@ type ArgonParams struct {
 	KeyLength   uint32
 }
 
+type TokenOptions struct {
+	// Who issues the tokens (iss claim)
+	Issuer string
+	// Who the tokens are intended for (aud claim)
+	Audience string
+	// How long an access token (JWT) is valid
+	AccessTokenDuration time.Duration
+	// How long a refresh token can be used to obtain a new access token
+	RefreshTokenDuration time.Duration
+	// How long a signing key keeps verifying tokens after a newer key replaced it
+	KeyRetirementPeriod time.Duration
+	// How long the user has to enter the second factor after entering the password
+	MFATokenDuration time.Duration
+	// How long a login link sent by email can be used
+	MagicLinkDuration time.Duration
+	// How long a password reset link sent by email can be used
+	PasswordResetDuration time.Duration
+	// How long the email verification token lasts, resending the email generates a new one
+	EmailVerificationDuration time.Duration
+}
+
+type WebAuthnOptions struct {
+	// Domain passkeys are bound to, the origins must be on it or on a subdomain
+	RPID string
+	// Shown by the browser when the user creates a passkey
+	RPName string
+	// Origins (scheme://host[:port]) allowed to run the WebAuthn ceremonies
+	Origins []string
+}
+
+// TimeoutOptions How long each operation can take before it's cancelled, on top of the request being cancelled when the
+// client goes away. Zero means no limit
+type TimeoutOptions struct {
+	// Every database query, a transaction gets it for each of its statements
+	Query time.Duration
+	// The calls to the roles, profile and email sender services
+	Roles       time.Duration
+	Profile     time.Duration
+	EmailSender time.Duration
+}
+
+type DatabaseOptions struct {
+	// DatabaseDriverMySQL, DatabaseDriverPostgres or DatabaseDriverSQLite
+	Driver string
+	// Connection string passed to the driver as is. When it's empty it's built from the fields below
+	DSN      string
+	Username string
+	Password string
+	Hostname string
+	Port     string
+	// Database name, or the file of the database for SQLite
+	Name string
+}
+
 type RegisterOptions struct {
 	UserOptions struct {
 		// Set the allowed characters in username - Use a regex
@@ -76,6 +218,8 @@ type RegisterOptions struct {
 		// Email should not be registered on the database
 		RequireUniqueEmail bool
 		// How long the email verification token lasts
+		//
+		// Deprecated: use TokenOptions.EmailVerificationDuration. When set it's used in its place
 		EmailVerificationExpiryDuration time.Duration
 	}
 	PasswordOptions struct {
@@ -114,13 +258,53 @@ func NewEnigmaConfig() (*EnigmaConfig, error) {
 		clog.Panic(err.Error(), "get-password-hashing-key", err, nil)
 		return nil, err
 	}
+	cfg.Keys.MFAEncryptionKey, err = getMFAEncryptionKey()
+	if err != nil {
+		clog.Panic(err.Error(), "get-mfa-encryption-key", err, nil)
+		return nil, err
+	}
+	cfg.Keys.PasswordPeppers, cfg.Keys.PasswordPepperVersion, err = getPasswordPeppers()
+	if err != nil {
+		clog.Panic(err.Error(), "get-password-peppers", err, nil)
+		return nil, err
+	}
 	cfg.ArgonParams = &ArgonParams{}
 	cfg.ArgonParams, err = cfg.getArgonParams()
 	if err != nil {
 		return nil, err
 	}
 
-	cfg.JwtSign, err = getJwtSign()
+	cfg.JwtSigningKeysPath = os.Getenv(envJwtSigningKeys)
+	if cfg.JwtSigningKeysPath == "" {
+		cfg.JwtSign, err = getJwtSign()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.TokenOptions, err = getTokenOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.RevocationStore, err = getRevocationStore()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.PasswordHasher, err = getPasswordHasher()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.WebAuthnOptions = getWebAuthnOptions()
+
+	cfg.TimeoutOptions, err = getTimeoutOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.DatabaseOptions, err = NewDatabaseOptions()
 	if err != nil {
 		return nil, err
 	}
@@ -128,6 +312,15 @@ func NewEnigmaConfig() (*EnigmaConfig, error) {
 	return cfg, nil
 }
 
+// EmailVerificationDuration Returns how long the email verification token lasts, the deprecated
+// RegisterOptions.UserOptions.EmailVerificationExpiryDuration takes precedence when it's set
+func (e *EnigmaConfig) EmailVerificationDuration() time.Duration {
+	if e.RegisterOptions != nil && e.RegisterOptions.UserOptions.EmailVerificationExpiryDuration > 0 {
+		return e.RegisterOptions.UserOptions.EmailVerificationExpiryDuration
+	}
+	return e.TokenOptions.EmailVerificationDuration
+}
+
 func (e *EnigmaConfig) getPasswordHashingKey() (string, error) {
 	hash := os.Getenv(envPasswordHashing)
 	if hash == "" {
@@ -139,6 +332,58 @@ func (e *EnigmaConfig) getPasswordHashingKey() (string, error) {
 	return hash, nil
 }
 
+// getPasswordPeppers The keys are a comma separated list of version:key, the highest version is the one new hashes
+// use. When there are none the passwords aren't peppered, the version 0.
+func getPasswordPeppers() (map[int]string, int, error) {
+	keys := os.Getenv(envPasswordPeppers)
+	if keys == "" {
+		return nil, 0, nil
+	}
+
+	peppers := map[int]string{}
+	current := 0
+	for _, entry := range strings.Split(keys, ",") {
+		vals := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(vals) != 2 || vals[1] == "" {
+			return nil, 0, errors.New("password pepper keys must be version:key")
+		}
+
+		version, err := strconv.Atoi(vals[0])
+		if err != nil || version <= 0 {
+			return nil, 0, errors.New("password pepper versions must be positive numbers")
+		}
+		if _, ok := peppers[version]; ok {
+			return nil, 0, errors.New("password pepper versions must be unique")
+		}
+
+		peppers[version] = vals[1]
+		if version > current {
+			current = version
+		}
+	}
+
+	return peppers, current, nil
+}
+
+// getMFAEncryptionKey The key is 32 random bytes encoded in base64 (ex. openssl rand -base64 32).
+func getMFAEncryptionKey() ([]byte, error) {
+	encoded := os.Getenv(envMFAEncryptionKey)
+	if encoded == "" {
+		return nil, errors.New("mfa encryption key is empty")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != mfaEncryptionKeyLength {
+		return nil, errors.New("mfa encryption key must be 32 bytes long")
+	}
+
+	return key, nil
+}
+
 func (e *EnigmaConfig) getArgonParams() (*ArgonParams, error) {
 	params := &ArgonParams{}
 
@@ -211,3 +456,194 @@ func getJwtSign() (string, error) {
 
 	return sign, nil
 }
+
+func getTokenOptions() (*TokenOptions, error) {
+	opts := &TokenOptions{
+		Issuer:                    os.Getenv(envJwtIssuer),
+		Audience:                  os.Getenv(envJwtAudience),
+		AccessTokenDuration:       defaultJwtAccessTokenDuration,
+		RefreshTokenDuration:      defaultJwtRefreshTokenDuration,
+		KeyRetirementPeriod:       defaultJwtKeyRetirementPeriod,
+		MFATokenDuration:          defaultJwtMFATokenDuration,
+		MagicLinkDuration:         defaultMagicLinkDuration,
+		PasswordResetDuration:     defaultPasswordResetDuration,
+		EmailVerificationDuration: defaultEmailVerificationDuration,
+	}
+
+	if opts.Issuer == "" {
+		opts.Issuer = defaultJwtIssuer
+	}
+
+	if opts.Audience == "" {
+		opts.Audience = defaultJwtAudience
+	}
+
+	var err error
+	if access := os.Getenv(envJwtAccessTokenDuration); access != "" {
+		opts.AccessTokenDuration, err = time.ParseDuration(access)
+		if err != nil {
+			clog.Panic("Access token duration cannot be parsed", "get-token-options", err, map[string]string{"duration": access})
+			return nil, err
+		}
+	}
+
+	if refresh := os.Getenv(envJwtRefreshTokenDuration); refresh != "" {
+		opts.RefreshTokenDuration, err = time.ParseDuration(refresh)
+		if err != nil {
+			clog.Panic("Refresh token duration cannot be parsed", "get-token-options", err, map[string]string{"duration": refresh})
+			return nil, err
+		}
+	}
+
+	if retirement := os.Getenv(envJwtKeyRetirementPeriod); retirement != "" {
+		opts.KeyRetirementPeriod, err = time.ParseDuration(retirement)
+		if err != nil {
+			clog.Panic("Key retirement period cannot be parsed", "get-token-options", err, map[string]string{"duration": retirement})
+			return nil, err
+		}
+	}
+
+	if mfa := os.Getenv(envJwtMFATokenDuration); mfa != "" {
+		opts.MFATokenDuration, err = time.ParseDuration(mfa)
+		if err != nil {
+			clog.Panic("MFA token duration cannot be parsed", "get-token-options", err, map[string]string{"duration": mfa})
+			return nil, err
+		}
+	}
+
+	if magicLink := os.Getenv(envMagicLinkDuration); magicLink != "" {
+		opts.MagicLinkDuration, err = time.ParseDuration(magicLink)
+		if err != nil {
+			clog.Panic("Magic link duration cannot be parsed", "get-token-options", err, map[string]string{"duration": magicLink})
+			return nil, err
+		}
+	}
+
+	if passwordReset := os.Getenv(envPasswordResetDuration); passwordReset != "" {
+		opts.PasswordResetDuration, err = time.ParseDuration(passwordReset)
+		if err != nil {
+			clog.Panic("Password reset duration cannot be parsed", "get-token-options", err, map[string]string{"duration": passwordReset})
+			return nil, err
+		}
+	}
+
+	if verification := os.Getenv(envEmailVerificationDuration); verification != "" {
+		opts.EmailVerificationDuration, err = time.ParseDuration(verification)
+		if err != nil {
+			clog.Panic("Email verification duration cannot be parsed", "get-token-options", err, map[string]string{"duration": verification})
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+func getRevocationStore() (string, error) {
+	store := os.Getenv(envTokenRevocationStore)
+	switch store {
+	case "":
+		return RevocationStoreSQL, nil
+	case RevocationStoreSQL, RevocationStoreMemory:
+		return store, nil
+	default:
+		err := errors.New("unknown token revocation store")
+		clog.Panic(err.Error(), "get-revocation-store", err, map[string]string{"store": store})
+		return "", err
+	}
+}
+
+func getPasswordHasher() (string, error) {
+	hasher := os.Getenv(envPasswordHasher)
+	switch hasher {
+	case "":
+		return PasswordHasherArgon2id, nil
+	case PasswordHasherArgon2id, PasswordHasherBcrypt, PasswordHasherPBKDF2, PasswordHasherScrypt:
+		return hasher, nil
+	default:
+		err := errors.New("unknown password hasher")
+		clog.Panic(err.Error(), "get-password-hasher", err, map[string]string{"hasher": hasher})
+		return "", err
+	}
+}
+
+func getWebAuthnOptions() *WebAuthnOptions {
+	opts := &WebAuthnOptions{
+		RPID:   os.Getenv(envWebAuthnRPID),
+		RPName: defaultWebAuthnRPName,
+	}
+
+	if opts.RPID == "" {
+		opts.RPID = defaultWebAuthnRPID
+	}
+
+	origins := os.Getenv(envWebAuthnOrigins)
+	if origins == "" {
+		origins = defaultWebAuthnOrigins
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			opts.Origins = append(opts.Origins, origin)
+		}
+	}
+
+	return opts
+}
+
+func getTimeoutOptions() (TimeoutOptions, error) {
+	opts := TimeoutOptions{
+		Query:       defaultQueryTimeout,
+		Roles:       defaultRolesTimeout,
+		Profile:     defaultProfileTimeout,
+		EmailSender: defaultEmailSenderTimeout,
+	}
+
+	for env, timeout := range map[string]*time.Duration{
+		envQueryTimeout:       &opts.Query,
+		envRolesTimeout:       &opts.Roles,
+		envProfileTimeout:     &opts.Profile,
+		envEmailSenderTimeout: &opts.EmailSender,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+
+		var err error
+		*timeout, err = time.ParseDuration(value)
+		if err != nil || *timeout < 0 {
+			if err == nil {
+				err = errors.New("timeouts can't be negative")
+			}
+			clog.Panic("Timeout cannot be parsed", "get-timeout-options", err, map[string]string{env: value})
+			return TimeoutOptions{}, err
+		}
+	}
+
+	return opts, nil
+}
+
+// NewDatabaseOptions Reads the database connection from the environment, it's separate from the rest of the config so
+// the migrations can run without the keys
+func NewDatabaseOptions() (*DatabaseOptions, error) {
+	opts := &DatabaseOptions{
+		Driver:   os.Getenv(envDBDriver),
+		DSN:      os.Getenv(envDBDSN),
+		Username: os.Getenv(envDBUsername),
+		Password: os.Getenv(envDBPassword),
+		Hostname: os.Getenv(envDBHostname),
+		Port:     os.Getenv(envDBPort),
+		Name:     os.Getenv(envDBName),
+	}
+
+	switch opts.Driver {
+	case "":
+		opts.Driver = DatabaseDriverMySQL
+	case DatabaseDriverMySQL, DatabaseDriverPostgres, DatabaseDriverSQLite:
+	default:
+		err := errors.New("unknown database driver")
+		clog.Panic(err.Error(), "get-database-options", err, map[string]string{"driver": opts.Driver})
+		return nil, err
+	}
+
+	return opts, nil
+}
@@ -1,6 +1,6 @@
 module github.com/CienciaArgentina/go-enigma
 
-go 1.14
+go 1.16
 
 require (
 	github.com/CienciaArgentina/go-backend-commons v0.0.20
@@ -11,6 +11,8 @@ require (
 	github.com/go-resty/resty/v2 v2.3.0
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/jmoiron/sqlx v1.2.0
+	github.com/lib/pq v1.10.9
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
+	modernc.org/sqlite v1.14.8
 )
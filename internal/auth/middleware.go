@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/pkg/enigmaauth"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Same answers consumers get from enigmaauth.Middleware.
+	ErrInvalidAccessToken     = enigmaauth.ErrUnauthorized
+	ErrInvalidAccessTokenCode = enigmaauth.ErrUnauthorizedCode
+	ErrRevokedAccessTokenCode = enigmaauth.ErrRevokedCode
+
+	claimsKey    = "enigma_access_token_claims"
+	bearerPrefix = "Bearer "
+)
+
+// NewMiddleware Requires a valid access token issued by us, see Verifier. Its claims are available to the handlers
+// through GetClaims.
+func NewMiddleware(v *Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, bearerPrefix) {
+			abortUnauthorized(c, ErrInvalidAccessTokenCode)
+			return
+		}
+
+		claims, err := v.Verify(c.Request.Context(), strings.TrimPrefix(header, bearerPrefix))
+		if err != nil {
+			if err == ErrTokenNotValid || err == ErrTokenRevoked {
+				// Their messages are the error codes.
+				abortUnauthorized(c, err.Error())
+				return
+			}
+			clog.Error("Error verifying access token", "auth-middleware", err, nil)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode))
+			return
+		}
+
+		SetClaims(c, claims)
+		c.Next()
+	}
+}
+
+// SetClaims Stores the claims of a validated access token in the request context
+func SetClaims(c *gin.Context, claims *encryption.AccessTokenClaims) {
+	c.Set(claimsKey, claims)
+}
+
+// GetClaims Returns the claims of the access token validated by the middleware
+func GetClaims(c *gin.Context) (*encryption.AccessTokenClaims, bool) {
+	value, ok := c.Get(claimsKey)
+	if !ok {
+		return nil, false
+	}
+
+	claims, ok := value.(*encryption.AccessTokenClaims)
+	return claims, ok
+}
+
+func abortUnauthorized(c *gin.Context, code string) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, ErrInvalidAccessToken, apierror.NewErrorCause(ErrInvalidAccessToken, code)))
+}
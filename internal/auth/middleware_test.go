@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/internal/revocation"
+	"github.com/gin-gonic/gin"
+)
+
+func testConfig() *config.EnigmaConfig {
+	return &config.EnigmaConfig{
+		JwtSign: "sign",
+		TokenOptions: &config.TokenOptions{
+			Issuer:              "issuer",
+			Audience:            "audience",
+			AccessTokenDuration: time.Minute,
+		},
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	cfg := testConfig()
+	signer, err := encryption.NewKeyRing(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations := revocation.NewMemoryStore()
+
+	sign := func(cfg *config.EnigmaConfig) (string, *encryption.AccessTokenClaims) {
+		claims, err := encryption.NewAccessTokenClaims(123, "test@test.com", "session", nil, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := signer.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token, claims
+	}
+
+	valid, _ := sign(cfg)
+	revoked, revokedClaims := sign(cfg)
+	_ = revocations.Revoke(context.Background(), revokedClaims.Id, time.Unix(revokedClaims.ExpiresAt, 0))
+	otherAudience := testConfig()
+	otherAudience.TokenOptions.Audience = "other"
+	wrongAudience, _ := sign(otherAudience)
+
+	tests := []struct {
+		name           string
+		header         string
+		expectedStatus int
+	}{
+		{name: "no_header", header: "", expectedStatus: http.StatusUnauthorized},
+		{name: "not_bearer", header: "Basic dXNlcjpwYXNz", expectedStatus: http.StatusUnauthorized},
+		{name: "bad_signature", header: "Bearer " + valid + "x", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong_audience", header: "Bearer " + wrongAudience, expectedStatus: http.StatusUnauthorized},
+		{name: "revoked", header: "Bearer " + revoked, expectedStatus: http.StatusUnauthorized},
+		{name: "ok", header: "Bearer " + valid, expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/", NewMiddleware(NewVerifier(cfg, signer, revocations)), func(c *gin.Context) {
+				claims, ok := GetClaims(c)
+				if !ok || claims.AuthId != 123 {
+					t.Errorf("GetClaims() = %v, %v", claims, ok)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("[Middleware] Expected status code = %v, got %v", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
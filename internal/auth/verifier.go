@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/internal/revocation"
+)
+
+var (
+	// ErrTokenNotValid The token is malformed, expired, wasn't signed by us or isn't meant for us.
+	ErrTokenNotValid = errors.New(ErrInvalidAccessTokenCode)
+	// ErrTokenRevoked The token is valid but it was revoked before expiring.
+	ErrTokenRevoked = errors.New(ErrRevokedAccessTokenCode)
+)
+
+// Verifier Validates the access tokens issued by us.
+type Verifier struct {
+	cfg         *config.EnigmaConfig
+	signer      encryption.Signer
+	revocations revocation.Store
+}
+
+func NewVerifier(cfg *config.EnigmaConfig, signer encryption.Signer, revocations revocation.Store) *Verifier {
+	return &Verifier{cfg: cfg, signer: signer, revocations: revocations}
+}
+
+// Verify Returns the claims of the token if it was signed with one of our keys, carries our issuer and audience and
+// isn't in the revocation list. Any error other than ErrTokenNotValid and ErrTokenRevoked means the check couldn't be done.
+func (v *Verifier) Verify(ctx context.Context, token string) (*encryption.AccessTokenClaims, error) {
+	claims := &encryption.AccessTokenClaims{}
+	if _, err := v.signer.Parse(token, claims); err != nil {
+		return nil, ErrTokenNotValid
+	}
+
+	if !claims.VerifyIssuer(v.cfg.TokenOptions.Issuer, true) || !claims.VerifyAudience(v.cfg.TokenOptions.Audience, true) {
+		return nil, ErrTokenNotValid
+	}
+
+	revoked, err := v.revocations.IsRevoked(ctx, claims.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
@@ -20,6 +20,9 @@ const (
 
 	// General.
 	ErrUnexpectedError = "Ocurrió un error en el sistema, por favor, ponete en contacto con sistemas"
+
+	// Email sender templates that aren't in go-email-sender/defines, they have to exist in the email sender too.
+	MagicLinkTemplate = "magiclink"
 )
 
 func GetRolesBaseURL() string {
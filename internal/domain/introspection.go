@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"database/sql"
+)
+
+// OAuthClient A service allowed to introspect tokens. Only the hash of its secret is persisted.
+type OAuthClient struct {
+	ClientId         string       `json:"client_id" db:"client_id"`
+	ClientSecretHash string       `json:"-" db:"client_secret_hash"`
+	Name             string       `json:"name" db:"name"`
+	DateCreated      string       `json:"date_created" db:"date_created"`
+	DateDeleted      sql.NullTime `json:"date_deleted" db:"date_deleted"`
+}
+
+// IntrospectionResponse RFC 7662 response. When the token isn't active nothing but active is returned.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Nbf       int64  `json:"nbf,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	Roles     []Role `json:"roles,omitempty"`
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"database/sql"
+)
+
+// UserMFA TOTP second factor of a user. The secret is encrypted with Keys.MFAEncryptionKey, the factor is only enabled
+// once the user confirmed it by entering a first code.
+type UserMFA struct {
+	UserId          int64        `json:"user_id" db:"user_id"`
+	EncryptedSecret string       `json:"-" db:"totp_secret"`
+	LastUsedStep    int64        `json:"-" db:"last_used_step"`
+	DateCreated     string       `json:"date_created" db:"date_created"`
+	DateConfirmed   sql.NullTime `json:"date_confirmed" db:"date_confirmed"`
+}
+
+// MFAEnrollment What the user needs to add Enigma to an authenticator app, the URI is usually shown as a QR code.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type MFACodeDTO struct {
+	Code string `json:"code"`
+}
+
+type MFALoginDTO struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// RecoveryCode Single use code that replaces the TOTP code when the user lost their authenticator. Only its hash is
+// persisted.
+type RecoveryCode struct {
+	RecoveryCodeId int64        `json:"recovery_code_id" db:"recovery_code_id"`
+	UserId         int64        `json:"user_id" db:"user_id"`
+	CodeHash       string       `json:"-" db:"code_hash"`
+	DateCreated    string       `json:"date_created" db:"date_created"`
+	DateUsed       sql.NullTime `json:"date_used" db:"date_used"`
+}
+
+// RecoveryCodes The codes are only shown once, when they're generated.
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
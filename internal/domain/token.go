@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"database/sql"
+)
+
+// RefreshToken Opaque token that allows a client to obtain a new access token. Only its hash is persisted.
+type RefreshToken struct {
+	RefreshTokenId int64        `json:"refresh_token_id" db:"refresh_token_id"`
+	UserId         int64        `json:"user_id" db:"user_id"`
+	FamilyId       string       `json:"family_id" db:"family_id"`
+	TokenHash      string       `json:"-" db:"token_hash"`
+	ExpiryDate     sql.NullTime `json:"expiry_date" db:"expiry_date"`
+	DateCreated    string       `json:"date_created" db:"date_created"`
+	DateRevoked    sql.NullTime `json:"date_revoked" db:"date_revoked"`
+	// jti and expiry of the access token issued along with this refresh token, so it can be revoked on logout
+	AccessTokenId         string       `json:"-" db:"access_token_id"`
+	AccessTokenExpiryDate sql.NullTime `json:"-" db:"access_token_expiry_date"`
+}
+
+// TokenResponse Tokens handed to the client after a successful login or refresh. When the user has two-factor
+// authentication enabled the login only returns MFARequired and the MFAToken to send along with the code.
+type TokenResponse struct {
+	AccessToken  string `json:"jwt,omitempty"`
+	TokenType    string `json:"token_type,omitempty"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+}
+
+type RefreshTokenDTO struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Session A login of the user on a device. Its ID is the ID of the refresh token family, the sid claim of the tokens.
+type Session struct {
+	SessionId       string       `json:"session_id" db:"session_id"`
+	UserId          int64        `json:"-" db:"user_id"`
+	UserAgent       string       `json:"user_agent" db:"user_agent"`
+	IPAddress       string       `json:"ip_address" db:"ip_address"`
+	DateCreated     string       `json:"date_created" db:"date_created"`
+	DateLastRefresh string       `json:"date_last_refresh" db:"date_last_refresh"`
+	DateRevoked     sql.NullTime `json:"-" db:"date_revoked"`
+	// Whether it's the session of the token that asked for the list
+	Current bool `json:"current" db:"-"`
+}
+
+// ClientInfo Who is logging in, stored with the session.
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// MagicLink Single use link emailed to log in without the password. Only the hash of its token is persisted.
+type MagicLink struct {
+	MagicLinkId int64        `json:"magic_link_id" db:"magic_link_id"`
+	UserId      int64        `json:"user_id" db:"user_id"`
+	TokenHash   string       `json:"-" db:"token_hash"`
+	ExpiryDate  sql.NullTime `json:"expiry_date" db:"expiry_date"`
+	DateCreated string       `json:"date_created" db:"date_created"`
+	DateUsed    sql.NullTime `json:"date_used" db:"date_used"`
+}
+
+// PasswordReset Single use link emailed to set a new password. Only the hash of its token is persisted.
+type PasswordReset struct {
+	PasswordResetId int64        `json:"password_reset_id" db:"password_reset_id"`
+	UserId          int64        `json:"user_id" db:"user_id"`
+	TokenHash       string       `json:"-" db:"token_hash"`
+	ExpiryDate      sql.NullTime `json:"expiry_date" db:"expiry_date"`
+	DateCreated     string       `json:"date_created" db:"date_created"`
+	DateUsed        sql.NullTime `json:"date_used" db:"date_used"`
+}
+
+type MagicLinkDTO struct {
+	Email string `json:"email"`
+}
+
+type MagicLinkLoginDTO struct {
+	Token string `json:"token"`
+}
@@ -3,8 +3,6 @@ package domain
 import (
 	"database/sql"
 	"time"
-
-	"github.com/go-sql-driver/mysql"
 )
 
 type User struct {
@@ -13,7 +11,7 @@ type User struct {
 	NormalizedUsername  string         `json:"normalized_username" db:"normalized_username"`
 	PasswordHash        string         `json:"password_hash" db:"password_hash"`
 	LockoutEnabled      bool           `json:"lockout_enabled" db:"lockout_enabled"`
-	LockoutDate         mysql.NullTime `json:"lockout_date" db:"lockout_date"`
+	LockoutDate         sql.NullTime   `json:"lockout_date" db:"lockout_date"`
 	FailedLoginAttempts int            `json:"failed_login_attempts" db:"failed_login_attempts"`
 	DateCreated         string         `json:"date_created" db:"date_created"`
 	SecurityToken       sql.NullString `json:"security_token" db:"security_token"`
@@ -28,6 +26,7 @@ type UserSignupDTO struct {
 }
 
 type UserLoginDTO struct {
+	// Username or email
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
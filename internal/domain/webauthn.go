@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"database/sql"
+)
+
+// WebAuthnCredential A passkey of the user. The public key is the COSE key the authenticator generated, the sign count
+// helps detecting cloned authenticators.
+type WebAuthnCredential struct {
+	CredentialId string       `json:"credential_id" db:"credential_id"`
+	UserId       int64        `json:"-" db:"user_id"`
+	PublicKey    []byte       `json:"-" db:"public_key"`
+	SignCount    int64        `json:"-" db:"sign_count"`
+	Name         string       `json:"name" db:"name"`
+	DateCreated  string       `json:"date_created" db:"date_created"`
+	DateLastUsed sql.NullTime `json:"-" db:"date_last_used"`
+}
+
+// The types below follow the JSON serialization of WebAuthn Level 3, binary fields are base64url encoded. They can be
+// passed to PublicKeyCredential.parseCreationOptionsFromJSON / parseRequestOptionsFromJSON and the credentials
+// returned by the browser serialized with toJSON().
+
+type RelyingParty struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type WebAuthnUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CredentialCreationOptions Options to create a passkey with navigator.credentials.create().
+type CredentialCreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   WebAuthnUser           `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// CredentialRequestOptions Options to log in with a passkey with navigator.credentials.get().
+type CredentialRequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type RegistrationCredentialDTO struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+	} `json:"response"`
+	// Chosen by the user to tell their passkeys apart
+	Name string `json:"name"`
+}
+
+type AssertionCredentialDTO struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
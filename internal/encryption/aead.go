@@ -0,0 +1,53 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+)
+
+const errInvalidCiphertext = "el texto cifrado no es válido"
+
+// Encrypt Encrypts with AES-GCM, the key must be 16, 24 or 32 bytes long. The random nonce is prepended to the result.
+func Encrypt(plaintext, key []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := generateRandomBytes(uint32(gcm.NonceSize()))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawStdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Decrypt Reverts Encrypt, it fails if the ciphertext was tampered with.
+func Decrypt(ciphertext string, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := base64.RawStdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < gcm.NonceSize() {
+		return nil, errors.New(errInvalidCiphertext)
+	}
+
+	return gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,29 @@
+package encryption
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := make([]byte, 32)
+
+	first, err := Encrypt([]byte("secret"), key)
+	require.NoError(t, err)
+	second, err := Encrypt([]byte("secret"), key)
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+
+	plaintext, err := Decrypt(first, key)
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), plaintext)
+
+	other := make([]byte, 32)
+	other[0] = 1
+	_, err = Decrypt(first, other)
+	require.Error(t, err)
+
+	_, err = Decrypt("c2hvcnQ", key)
+	require.Error(t, err)
+}
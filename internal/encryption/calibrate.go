@@ -0,0 +1,92 @@
+package encryption
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	calibrationSaltLength = 16
+	calibrationKeyLength  = 32
+	// The minimum memory argon2 allows is 8 KiB per lane, below a few MiB it's not worth hashing with it
+	minCalibrationMemory     = 8 * 1024
+	maxCalibrationIterations = 64
+)
+
+// ArgonCalibration What the argon2id params are calibrated against
+type ArgonCalibration struct {
+	// How long hashing a password should take at most
+	TargetDuration time.Duration
+	// Memory budget of every hash in KiB, it's lowered when a single iteration with it takes longer than the target
+	MaxMemory   uint32
+	Parallelism uint8
+	// How many times each set of params is measured, the median is kept
+	Samples int
+}
+
+// CalibrateArgonParams Finds the most iterations that hash in the target duration on this host with the memory budget,
+// as recommended by https://tools.ietf.org/html/draft-irtf-cfrg-argon2-04#section-4. It returns the measured duration.
+func CalibrateArgonParams(c ArgonCalibration) (*config.ArgonParams, time.Duration, error) {
+	return calibrateArgonParams(c, measureArgonParams)
+}
+
+func calibrateArgonParams(c ArgonCalibration, measure func(p *config.ArgonParams) time.Duration) (*config.ArgonParams, time.Duration, error) {
+	if c.TargetDuration <= 0 || c.Parallelism == 0 || c.Samples <= 0 {
+		return nil, 0, errors.New("the target duration, parallelism and samples must be positive")
+	}
+	if c.MaxMemory < minCalibrationMemory {
+		return nil, 0, errors.New("the memory budget must be at least 8 MiB")
+	}
+
+	p := &config.ArgonParams{
+		Memory:      c.MaxMemory,
+		Iterations:  1,
+		Parallelism: c.Parallelism,
+		SaltLength:  calibrationSaltLength,
+		KeyLength:   calibrationKeyLength,
+	}
+
+	median := func() time.Duration {
+		samples := make([]time.Duration, c.Samples)
+		for i := range samples {
+			samples[i] = measure(p)
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		return samples[len(samples)/2]
+	}
+
+	// Memory is what makes cracking expensive, so it's only lowered when not even one iteration fits
+	took := median()
+	for took > c.TargetDuration && p.Memory/2 >= minCalibrationMemory {
+		p.Memory /= 2
+		took = median()
+	}
+	if took > c.TargetDuration {
+		return nil, 0, errors.New("the target duration is too low for this host")
+	}
+
+	for p.Iterations < maxCalibrationIterations {
+		p.Iterations++
+		next := median()
+		if next > c.TargetDuration {
+			p.Iterations--
+			break
+		}
+		took = next
+	}
+
+	return p, took, nil
+}
+
+func measureArgonParams(p *config.ArgonParams) time.Duration {
+	password := make([]byte, 16)
+	salt := make([]byte, p.SaltLength)
+
+	start := time.Now()
+	argon2.IDKey(password, salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return time.Since(start)
+}
@@ -0,0 +1,52 @@
+package encryption
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeArgonDuration Hashing takes 1ms per MiB per iteration
+func fakeArgonDuration(p *config.ArgonParams) time.Duration {
+	return time.Duration(p.Memory/1024*p.Iterations) * time.Millisecond
+}
+
+func TestCalibrateArgonParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     time.Duration
+		memory     uint32
+		wantMemory uint32
+		wantIter   uint32
+		wantErr    bool
+	}{
+		{name: "iterations_fit_budget", target: 500 * time.Millisecond, memory: 64 * 1024, wantMemory: 64 * 1024, wantIter: 7},
+		{name: "exact_target", target: 128 * time.Millisecond, memory: 64 * 1024, wantMemory: 64 * 1024, wantIter: 2},
+		{name: "memory_lowered", target: 40 * time.Millisecond, memory: 64 * 1024, wantMemory: 32 * 1024, wantIter: 1},
+		{name: "target_too_low", target: time.Millisecond, memory: 64 * 1024, wantErr: true},
+		{name: "memory_too_low", target: time.Second, memory: 1024, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, took, err := calibrateArgonParams(ArgonCalibration{TargetDuration: tt.target, MaxMemory: tt.memory, Parallelism: 2, Samples: 3}, fakeArgonDuration)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantMemory, p.Memory)
+			require.Equal(t, tt.wantIter, p.Iterations)
+			require.Equal(t, uint8(2), p.Parallelism)
+			require.Equal(t, fakeArgonDuration(p), took)
+			require.LessOrEqual(t, int64(took), int64(tt.target))
+		})
+	}
+}
+
+func TestCalibrateArgonParams_host(t *testing.T) {
+	p, _, err := CalibrateArgonParams(ArgonCalibration{TargetDuration: 100 * time.Millisecond, MaxMemory: 8 * 1024, Parallelism: 1, Samples: 1})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, p.Iterations, uint32(1))
+}
@@ -0,0 +1,355 @@
+package encryption
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
+	"github.com/CienciaArgentina/go-enigma/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	errUnknownHashFormat = "el hash no corresponde a ningún algoritmo conocido"
+	errUnknownHasher     = "algoritmo de hash desconocido"
+
+	// The params of the algorithms that aren't argon2id are fixed, they are mostly there to verify imported hashes.
+	bcryptCost       = 12
+	pbkdf2Iterations = 600000
+	pbkdf2KeyLength  = 32
+	scryptLogN       = 15
+	scryptR          = 8
+	scryptP          = 1
+	scryptKeyLength  = 32
+	legacySaltLength = 16
+)
+
+// PasswordHasher An algorithm the password hashes can be stored with, recognized by the prefix of the encoded hash.
+type PasswordHasher interface {
+	// Hash Encodes the password with the params of the algorithm, the encoded hash starts with the registered prefix
+	Hash(password string, cfg *config.EnigmaConfig) (string, error)
+	// Verify Checks the password against a hash of the algorithm, using the params stored in the hash
+	Verify(password, encodedHash string, cfg *config.EnigmaConfig) (bool, error)
+	// NeedsRehash Whether the hash was generated with other params than the current ones
+	NeedsRehash(encodedHash string, cfg *config.EnigmaConfig) (bool, error)
+}
+
+type registeredHasher struct {
+	name     string
+	prefixes []string
+	hasher   PasswordHasher
+}
+
+var hashers []registeredHasher
+
+func init() {
+	RegisterHasher(config.PasswordHasherArgon2id, argon2idHasher{}, "$argon2id$")
+	RegisterHasher(config.PasswordHasherBcrypt, bcryptHasher{}, "$2y$", "$2a$", "$2b$")
+	RegisterHasher(config.PasswordHasherPBKDF2, pbkdf2Hasher{}, "pbkdf2_sha256$")
+	RegisterHasher(config.PasswordHasherScrypt, scryptHasher{}, "$scrypt$")
+}
+
+// RegisterHasher Adds an algorithm the hashes starting with any of the prefixes are verified with. It isn't safe to
+// call it concurrently, algorithms have to be registered before the server starts.
+func RegisterHasher(name string, hasher PasswordHasher, prefixes ...string) {
+	hashers = append(hashers, registeredHasher{name: name, prefixes: prefixes, hasher: hasher})
+}
+
+func hasherByName(name string) (*registeredHasher, error) {
+	if name == "" {
+		name = config.PasswordHasherArgon2id
+	}
+	for i := range hashers {
+		if hashers[i].name == name {
+			return &hashers[i], nil
+		}
+	}
+
+	err := errors.New(errUnknownHasher)
+	clog.Error(errUnknownHasher, "hasher-by-name", err, map[string]string{"name": name})
+	return nil, err
+}
+
+func hasherByHash(encodedHash string) (*registeredHasher, error) {
+	for i := range hashers {
+		for _, prefix := range hashers[i].prefixes {
+			if strings.HasPrefix(encodedHash, prefix) {
+				return &hashers[i], nil
+			}
+		}
+	}
+
+	err := errors.New(errUnknownHashFormat)
+	clog.Error(errUnknownHashFormat, "hasher-by-hash", err, nil)
+	return nil, err
+}
+
+// GenerateEncodedHash Hashes the password with the configured algorithm.
+func GenerateEncodedHash(pw string, cfg *config.EnigmaConfig) (string, error) {
+	h, err := hasherByName(cfg.PasswordHasher)
+	if err != nil {
+		return "", err
+	}
+
+	encodedHash, err := h.hasher.Hash(pw, cfg)
+	if err != nil {
+		clog.Error("Error generating encoded hash", "generate-encoded-hash", err, map[string]string{"hasher": h.name})
+		return "", err
+	}
+
+	return encodedHash, nil
+}
+
+// CompareEncodedHash Checks the secret against a hash of any of the registered algorithms, picked by its prefix.
+func CompareEncodedHash(secret, encodedHash string, cfg *config.EnigmaConfig) (bool, error) {
+	h, err := hasherByHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	return h.hasher.Verify(secret, encodedHash, cfg)
+}
+
+// NeedsRehash Whether the hash was generated with another algorithm or other params than the configured ones, which
+// happens after they are changed or for imported users. Hashes are only upgraded when the user logs in since it takes
+// the password to rehash it.
+func NeedsRehash(encodedHash string, cfg *config.EnigmaConfig) (bool, error) {
+	h, err := hasherByHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := hasherByName(cfg.PasswordHasher)
+	if err != nil {
+		return false, err
+	}
+	if h.name != current.name {
+		return true, nil
+	}
+
+	return h.hasher.NeedsRehash(encodedHash, cfg)
+}
+
+// https://www.alexedwards.net/blog/how-to-hash-and-verify-passwords-with-argon2-in-go
+// For guidance and an outline process for choosing appropriate parameters see https://tools.ietf.org/html/draft-irtf-cfrg-argon2-04#section-4.
+type argon2idHasher struct{}
+
+func (argon2idHasher) Hash(password string, cfg *config.EnigmaConfig) (string, error) {
+	return generateFromPassword(password, cfg)
+}
+
+func (argon2idHasher) Verify(password, encodedHash string, cfg *config.EnigmaConfig) (bool, error) {
+	// Extract the parameters, salt and derived key from the encoded password
+	// hash.
+	p, pepperVersion, salt, hash, err := DecodeHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	peppered, err := pepperPassword(password, pepperVersion, cfg)
+	if err != nil {
+		return false, err
+	}
+
+	// Derive the key from the other password using the same parameters.
+	otherHash := argon2.IDKey(peppered, salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	// Check that the contents of the hashed passwords are identical. Note
+	// that we are using the subtle.ConstantTimeCompare() function for this
+	// to help prevent timing attacks.
+	return subtle.ConstantTimeCompare(hash, otherHash) == 1, nil
+}
+
+func (argon2idHasher) NeedsRehash(encodedHash string, cfg *config.EnigmaConfig) (bool, error) {
+	p, pepperVersion, _, _, err := DecodeHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	return *p != *cfg.ArgonParams || pepperVersion != currentPepperVersion(cfg), nil
+}
+
+// bcryptHasher Verifies the hashes of PHP's password_hash ($2y$) as well as the ones of most other libraries ($2a$, $2b$).
+type bcryptHasher struct{}
+
+func (bcryptHasher) Hash(password string, _ *config.EnigmaConfig) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (bcryptHasher) Verify(password, encodedHash string, _ *config.EnigmaConfig) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		clog.Error("Error comparing bcrypt hash", "bcrypt-verify", err, nil)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (bcryptHasher) NeedsRehash(encodedHash string, _ *config.EnigmaConfig) (bool, error) {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	if err != nil {
+		return false, err
+	}
+
+	return cost != bcryptCost, nil
+}
+
+// pbkdf2Hasher Uses Django's format, pbkdf2_sha256$<iterations>$<salt>$<base64 hash>.
+type pbkdf2Hasher struct{}
+
+func (pbkdf2Hasher) Hash(password string, _ *config.EnigmaConfig) (string, error) {
+	salt, err := generateRandomBytes(legacySaltLength)
+	if err != nil {
+		return "", err
+	}
+	// Django salts are used as they are, so they can't have a $
+	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
+
+	hash := pbkdf2.Key([]byte(password), []byte(b64Salt), pbkdf2Iterations, pbkdf2KeyLength, sha256.New)
+
+	return fmt.Sprintf("pbkdf2_sha256$%d$%s$%s", pbkdf2Iterations, b64Salt, base64.StdEncoding.EncodeToString(hash)), nil
+}
+
+func decodePBKDF2Hash(encodedHash string) (iterations int, salt, hash []byte, err error) {
+	vals := strings.Split(encodedHash, "$")
+	if len(vals) != 4 {
+		msg := "encoded pbkdf2 hash string is not 4"
+		clog.Error(msg, "decode-pbkdf2-hash", errors.New(msg), map[string]string{"len": strconv.Itoa(len(vals))})
+		return 0, nil, nil, errors.New(msg)
+	}
+
+	iterations, err = strconv.Atoi(vals[1])
+	if err != nil || iterations <= 0 {
+		msg := "invalid pbkdf2 iterations"
+		clog.Error(msg, "decode-pbkdf2-hash", errors.New(msg), map[string]string{"iterations": vals[1]})
+		return 0, nil, nil, errors.New(msg)
+	}
+
+	hash, err = base64.StdEncoding.DecodeString(vals[3])
+	if err != nil {
+		clog.Error("Error decoding hash base64 string", "decode-pbkdf2-hash", err, nil)
+		return 0, nil, nil, err
+	}
+
+	return iterations, []byte(vals[2]), hash, nil
+}
+
+func (pbkdf2Hasher) Verify(password, encodedHash string, _ *config.EnigmaConfig) (bool, error) {
+	iterations, salt, hash, err := decodePBKDF2Hash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	otherHash := pbkdf2.Key([]byte(password), salt, iterations, len(hash), sha256.New)
+
+	return subtle.ConstantTimeCompare(hash, otherHash) == 1, nil
+}
+
+func (pbkdf2Hasher) NeedsRehash(encodedHash string, _ *config.EnigmaConfig) (bool, error) {
+	iterations, _, _, err := decodePBKDF2Hash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	return iterations != pbkdf2Iterations, nil
+}
+
+// scryptHasher Uses the PHC format, $scrypt$ln=<log2 N>,r=<r>,p=<p>$<salt>$<hash>. Passlib's hashes, which use . instead
+// of + in the base64, are accepted too.
+type scryptHasher struct{}
+
+type scryptParams struct {
+	logN int
+	r    int
+	p    int
+}
+
+func (scryptHasher) Hash(password string, _ *config.EnigmaConfig) (string, error) {
+	salt, err := generateRandomBytes(legacySaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := scrypt.Key([]byte(password), salt, 1<<scryptLogN, scryptR, scryptP, scryptKeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", scryptLogN, scryptR, scryptP, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+func decodeScryptHash(encodedHash string) (p *scryptParams, salt, hash []byte, err error) {
+	vals := strings.Split(encodedHash, "$")
+	if len(vals) != 5 {
+		msg := "encoded scrypt hash string is not 5"
+		clog.Error(msg, "decode-scrypt-hash", errors.New(msg), map[string]string{"len": strconv.Itoa(len(vals))})
+		return nil, nil, nil, errors.New(msg)
+	}
+
+	p = &scryptParams{}
+	_, err = fmt.Sscanf(vals[2], "ln=%d,r=%d,p=%d", &p.logN, &p.r, &p.p)
+	if err != nil {
+		clog.Error("Error scanning params", "decode-scrypt-hash", err, nil)
+		return nil, nil, nil, err
+	}
+	if p.logN <= 0 || p.logN >= 32 {
+		msg := "invalid scrypt cost"
+		clog.Error(msg, "decode-scrypt-hash", errors.New(msg), map[string]string{"ln": strconv.Itoa(p.logN)})
+		return nil, nil, nil, errors.New(msg)
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(strings.ReplaceAll(vals[3], ".", "+"))
+	if err != nil {
+		clog.Error("Error decoding salt base64 string", "decode-scrypt-hash", err, nil)
+		return nil, nil, nil, err
+	}
+
+	hash, err = base64.RawStdEncoding.DecodeString(strings.ReplaceAll(vals[4], ".", "+"))
+	if err != nil {
+		clog.Error("Error decoding hash base64 string", "decode-scrypt-hash", err, nil)
+		return nil, nil, nil, err
+	}
+
+	return p, salt, hash, nil
+}
+
+func (scryptHasher) Verify(password, encodedHash string, _ *config.EnigmaConfig) (bool, error) {
+	p, salt, hash, err := decodeScryptHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	otherHash, err := scrypt.Key([]byte(password), salt, 1<<p.logN, p.r, p.p, len(hash))
+	if err != nil {
+		clog.Error("Error deriving scrypt key", "scrypt-verify", err, nil)
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(hash, otherHash) == 1, nil
+}
+
+func (scryptHasher) NeedsRehash(encodedHash string, _ *config.EnigmaConfig) (bool, error) {
+	p, _, _, err := decodeScryptHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	return *p != scryptParams{logN: scryptLogN, r: scryptR, p: scryptP}, nil
+}
@@ -0,0 +1,89 @@
+package encryption
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/stretchr/testify/require"
+)
+
+// Hashes generated by other implementations, as they would be imported
+const (
+	phpBcryptHash = "$2y$10$.vGA1O9wmRjrwAVXD98HNOgsNpDczlqm3Jq7KnEd1rVAGv3Fykk1a"
+	djangoHash    = "pbkdf2_sha256$1000$seasalt123$QyPx1TDAOaDNwb93SOg3GO2TmEvU8pJStDRifrAU5tI="
+	scryptHash    = "$scrypt$ln=10,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$y+7TNPgMTpUVMJq508LfHJw8N1MWNWKTE0OfMvHrgeM"
+)
+
+func testArgonParams() *config.ArgonParams {
+	return &config.ArgonParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16}
+}
+
+func TestCompareEncodedHash_imported(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+	}{
+		{name: "bcrypt_php", password: "rasmuslerdorf", hash: phpBcryptHash},
+		{name: "pbkdf2_django", password: "contraseña", hash: djangoHash},
+		{name: "scrypt", password: "contraseña", hash: scryptHash},
+		{name: "scrypt_passlib", password: "contraseña", hash: strings.ReplaceAll(scryptHash, "+", ".")},
+	}
+	cfg := &config.EnigmaConfig{ArgonParams: testArgonParams()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := CompareEncodedHash(tt.password, tt.hash, cfg)
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			ok, err = CompareEncodedHash("other", tt.hash, cfg)
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			rehash, err := NeedsRehash(tt.hash, cfg)
+			require.NoError(t, err)
+			require.True(t, rehash)
+		})
+	}
+}
+
+func TestGenerateEncodedHash_hasher(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher string
+		prefix string
+	}{
+		{name: "default", hasher: "", prefix: "$argon2id$"},
+		{name: "argon2id", hasher: config.PasswordHasherArgon2id, prefix: "$argon2id$"},
+		{name: "bcrypt", hasher: config.PasswordHasherBcrypt, prefix: "$2a$"},
+		{name: "pbkdf2", hasher: config.PasswordHasherPBKDF2, prefix: "pbkdf2_sha256$"},
+		{name: "scrypt", hasher: config.PasswordHasherScrypt, prefix: "$scrypt$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.EnigmaConfig{ArgonParams: testArgonParams(), PasswordHasher: tt.hasher}
+			hash, err := GenerateEncodedHash("secret", cfg)
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(hash, tt.prefix))
+
+			ok, err := CompareEncodedHash("secret", hash, cfg)
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			rehash, err := NeedsRehash(hash, cfg)
+			require.NoError(t, err)
+			require.False(t, rehash)
+		})
+	}
+
+	_, err := GenerateEncodedHash("secret", &config.EnigmaConfig{ArgonParams: testArgonParams(), PasswordHasher: "md5"})
+	require.Error(t, err)
+}
+
+func TestCompareEncodedHash_malformed(t *testing.T) {
+	for _, hash := range []string{"", "$md5$abc", "$2y$10$short", "pbkdf2_sha256$abc$salt$hash", "$scrypt$ln=99,r=8,p=1$c2FsdA$aGFzaA"} {
+		_, err := CompareEncodedHash("secret", hash, &config.EnigmaConfig{})
+		require.Error(t, err, hash)
+	}
+}
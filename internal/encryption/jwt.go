@@ -0,0 +1,52 @@
+package encryption
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/dgrijalva/jwt-go"
+)
+
+const jtiLength = 16
+
+// AccessTokenClaims Claims of the access tokens issued on login. The registered claims follow RFC 7519 so any JWT library
+// can validate them, auth_id is kept for consumers that still read it instead of sub. sid identifies the login (the
+// refresh token family) the token belongs to.
+type AccessTokenClaims struct {
+	jwt.StandardClaims
+	AuthId    int64         `json:"auth_id"`
+	Email     string        `json:"email"`
+	SessionId string        `json:"sid"`
+	Roles     []domain.Role `json:"roles"`
+}
+
+// NewAccessTokenClaims Builds the claims for a new access token using the issuer, audience and duration from config.
+func NewAccessTokenClaims(authID int64, email, sessionID string, roles []domain.Role, c *config.EnigmaConfig) (*AccessTokenClaims, error) {
+	jti, err := GenerateOpaqueToken(jtiLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if roles == nil {
+		roles = []domain.Role{}
+	}
+
+	now := time.Now()
+	return &AccessTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.FormatInt(authID, 10),
+			Issuer:    c.TokenOptions.Issuer,
+			Audience:  c.TokenOptions.Audience,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(c.TokenOptions.AccessTokenDuration).Unix(),
+			Id:        jti,
+		},
+		AuthId:    authID,
+		Email:     email,
+		SessionId: sessionID,
+		Roles:     roles,
+	}, nil
+}
@@ -0,0 +1,53 @@
+package encryption
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *config.EnigmaConfig {
+	return &config.EnigmaConfig{
+		JwtSign: "sign",
+		TokenOptions: &config.TokenOptions{
+			Issuer:              "issuer",
+			Audience:            "audience",
+			AccessTokenDuration: time.Minute,
+		},
+	}
+}
+
+func TestNewAccessTokenClaims(t *testing.T) {
+	claims, err := NewAccessTokenClaims(123, "test@test.com", "session", nil, testConfig())
+	require.NoError(t, err)
+
+	require.Equal(t, "123", claims.Subject)
+	require.Equal(t, int64(123), claims.AuthId)
+	require.Equal(t, "session", claims.SessionId)
+	require.Equal(t, "issuer", claims.Issuer)
+	require.Equal(t, "audience", claims.Audience)
+	require.Equal(t, claims.IssuedAt+60, claims.ExpiresAt)
+	require.NotEmpty(t, claims.Id)
+	require.NotNil(t, claims.Roles)
+}
+
+func TestSignAccessToken(t *testing.T) {
+	cfg := testConfig()
+	roles := []domain.Role{{ID: 1, Description: "admin", Claims: []domain.Claim{{ID: 2, Description: "write"}}}}
+	claims, err := NewAccessTokenClaims(123, "test@test.com", "session", roles, cfg)
+	require.NoError(t, err)
+
+	signer, err := NewKeyRing(cfg)
+	require.NoError(t, err)
+	token, err := signer.Sign(claims)
+	require.NoError(t, err)
+
+	parsed := &AccessTokenClaims{}
+	_, err = signer.Parse(token, parsed)
+	require.NoError(t, err)
+	require.Equal(t, claims, parsed)
+	require.True(t, parsed.VerifyAudience("audience", true))
+}
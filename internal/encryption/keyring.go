@@ -0,0 +1,164 @@
+package encryption
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/dgrijalva/jwt-go"
+)
+
+const errNoActiveKey = "no hay ninguna clave de firma activa"
+
+// KeyRing Holds the signing keys ordered by activation date. The newest key that's already active signs new tokens, the
+// keys it replaced keep verifying until their retirement date so tokens signed before a rotation remain valid.
+type KeyRing struct {
+	mu               sync.RWMutex
+	keys             []*SigningKey
+	path             string
+	retirementPeriod time.Duration
+	now              func() time.Time
+}
+
+// NewKeyRing Returns a key ring with the asymmetric keys from JWT_SIGNING_KEYS, or the shared JWT_SIGN secret (HS256)
+// when there are none configured.
+func NewKeyRing(c *config.EnigmaConfig) (*KeyRing, error) {
+	k := &KeyRing{
+		path:             c.JwtSigningKeysPath,
+		retirementPeriod: c.TokenOptions.KeyRetirementPeriod,
+		now:              time.Now,
+	}
+
+	if k.path == "" {
+		k.setKeys([]*SigningKey{{Method: jwt.SigningMethodHS256, Private: []byte(c.JwtSign), Public: []byte(c.JwtSign)}})
+		return k, nil
+	}
+
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Reload Reads the keys again from disk. Adding a newer key file and reloading rotates the active key without a restart.
+// If the keys can't be loaded the current ones are kept.
+func (k *KeyRing) Reload() error {
+	if k.path == "" {
+		return nil
+	}
+
+	keys, err := LoadSigningKeys(k.path)
+	if err != nil {
+		return err
+	}
+
+	k.setKeys(keys)
+	return nil
+}
+
+// setKeys Each key retires a retirement period after the next one is activated.
+func (k *KeyRing) setKeys(keys []*SigningKey) {
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].ActivationDate.Before(keys[j].ActivationDate) })
+	for i := 0; i < len(keys)-1; i++ {
+		keys[i].RetirementDate = keys[i+1].ActivationDate.Add(k.retirementPeriod)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+}
+
+// ActiveKey Returns the key currently used to sign.
+func (k *KeyRing) ActiveKey() (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := k.now()
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		if !k.keys[i].ActivationDate.After(now) {
+			return k.keys[i], nil
+		}
+	}
+
+	return nil, errors.New(errNoActiveKey)
+}
+
+// verificationKey Returns the key with the given kid if it hasn't been retired yet.
+func (k *KeyRing) verificationKey(kid string) (*SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := k.now()
+	for _, key := range k.keys {
+		if key.ID == kid && !isRetired(key, now) {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	key, err := k.ActiveKey()
+	if err != nil {
+		clog.Error(errNoActiveKey, "sign", err, nil)
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+
+	tokenString, err := token.SignedString(key.Private)
+	if err != nil {
+		clog.Error("Error signing token", "sign", err, map[string]string{"kid": key.ID})
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+func (k *KeyRing) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.verificationKey(kid)
+		if !ok {
+			return nil, errors.New(errUnknownKid)
+		}
+
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New(errUnexpectedAlg)
+		}
+
+		return key.Public, nil
+	})
+}
+
+// JWKS Publishes every key that isn't retired, including the ones that aren't active yet so verifiers already have them
+// cached by the time they start signing.
+func (k *KeyRing) JWKS() *JSONWebKeySet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := k.now()
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range k.keys {
+		if isRetired(key, now) {
+			continue
+		}
+		if jwk, ok := publicJWK(key); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set
+}
+
+func isRetired(key *SigningKey, now time.Time) bool {
+	return !key.RetirementDate.IsZero() && !now.Before(key.RetirementDate)
+}
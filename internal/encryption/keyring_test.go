@@ -0,0 +1,100 @@
+package encryption
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyRing(t *testing.T, now time.Time, names ...string) (*KeyRing, string) {
+	dir, err := ioutil.TempDir("", "keys")
+	require.NoError(t, err)
+
+	for _, name := range names {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		writeKey(t, dir, name, key)
+	}
+
+	k, err := NewKeyRing(keyRingConfig(dir))
+	require.NoError(t, err)
+	k.now = func() time.Time { return now }
+
+	return k, dir
+}
+
+func kidOf(t *testing.T, k *KeyRing, token string) string {
+	parsed, err := k.Parse(token, &jwt.StandardClaims{})
+	require.NoError(t, err)
+	return parsed.Header["kid"].(string)
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 30, 0, 0, time.UTC)
+	k, dir := newTestKeyRing(t, now, "2020-01-01.pem")
+
+	oldToken, err := k.Sign(jwt.StandardClaims{})
+	require.NoError(t, err)
+	oldKid := kidOf(t, k, oldToken)
+
+	// A new key is dropped in the directory and picked up without restarting.
+	_, newKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeKey(t, dir, "2020-06-01.pem", newKey)
+	require.NoError(t, k.Reload())
+
+	newToken, err := k.Sign(jwt.StandardClaims{})
+	require.NoError(t, err)
+	require.NotEqual(t, oldKid, kidOf(t, k, newToken))
+
+	// The replaced key keeps verifying during the retirement period.
+	require.Equal(t, oldKid, kidOf(t, k, oldToken))
+	require.Len(t, k.JWKS().Keys, 2)
+
+	// And stops once it's retired.
+	k.now = func() time.Time { return now.Add(30 * time.Minute) }
+	_, err = k.Parse(oldToken, &jwt.StandardClaims{})
+	require.Error(t, err)
+	require.Len(t, k.JWKS().Keys, 1)
+	require.NotEqual(t, oldKid, k.JWKS().Keys[0].Kid)
+}
+
+func TestKeyRingPendingKey(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	k, _ := newTestKeyRing(t, now, "2020-01-01.pem", "2020-07-01.pem")
+
+	active, err := k.ActiveKey()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), active.ActivationDate)
+
+	// Keys that aren't active yet are already published.
+	require.Len(t, k.JWKS().Keys, 2)
+
+	k.now = func() time.Time { return time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC) }
+	active, err = k.ActiveKey()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), active.ActivationDate)
+}
+
+func TestKeyRingNoActiveKey(t *testing.T) {
+	k, _ := newTestKeyRing(t, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), "2020-01-01.pem")
+
+	_, err := k.Sign(jwt.StandardClaims{})
+	require.EqualError(t, err, errNoActiveKey)
+}
+
+func TestKeyRingReloadKeepsKeysOnError(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	k, dir := newTestKeyRing(t, now, "2020-01-01.pem")
+
+	require.NoError(t, ioutil.WriteFile(dir+"/invalid.pem", []byte("not a key"), 0600))
+	require.Error(t, k.Reload())
+
+	_, err := k.Sign(jwt.StandardClaims{})
+	require.NoError(t, err)
+}
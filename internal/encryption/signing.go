@@ -0,0 +1,238 @@
+package encryption
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
+	"github.com/CienciaArgentina/go-enigma/pkg/jwteddsa"
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	errNoSigningKeys      = "no se encontraron claves de firma"
+	errInvalidPEM         = "el archivo no contiene un bloque PEM"
+	errUnsupportedKeyType = "tipo de clave no soportado"
+	errUnknownKid         = "el token fue firmado con una clave desconocida"
+	errUnexpectedAlg      = "el algoritmo del token no coincide con el de la clave"
+	errInvalidKeyName     = "el nombre de la clave debe ser su fecha de activación (ej. 2020-10-01.pem)"
+
+	keyDateLayout = "2006-01-02"
+)
+
+// Signer Signs the tokens issued by Enigma and verifies them back.
+type Signer interface {
+	Sign(claims jwt.Claims) (string, error)
+	Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error)
+	JWKS() *JSONWebKeySet
+}
+
+// SigningKey A key used to sign tokens. ID is published as the kid header, it's empty for the shared HMAC secret.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+	// When the key starts signing tokens
+	ActivationDate time.Time
+	// When tokens signed with this key stop being accepted, zero while it's the newest key
+	RetirementDate time.Time
+}
+
+// JSONWebKey Public part of a signing key as described in RFC 7517.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet Set of public keys that verifiers can use to check our tokens.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// LoadSigningKeys Loads a PEM private key from path, or every *.pem file if path is a directory. Keys in a directory must
+// be named after the date they start signing (ex. 2020-10-01.pem). Keys are returned sorted by activation date.
+func LoadSigningKeys(path string) ([]*SigningKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		clog.Error("Error reading signing keys", "load-signing-keys", err, map[string]string{"path": path})
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	}
+
+	if len(files) == 0 {
+		err := errors.New(errNoSigningKeys)
+		clog.Error(errNoSigningKeys, "load-signing-keys", err, map[string]string{"path": path})
+		return nil, err
+	}
+
+	keys := make([]*SigningKey, 0, len(files))
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			clog.Error("Error reading signing key", "load-signing-keys", err, map[string]string{"file": file})
+			return nil, err
+		}
+
+		key, err := ParseSigningKey(b)
+		if err != nil {
+			clog.Error("Error parsing signing key", "load-signing-keys", err, map[string]string{"file": file})
+			return nil, err
+		}
+
+		if info.IsDir() {
+			key.ActivationDate, err = time.Parse(keyDateLayout, strings.TrimSuffix(filepath.Base(file), ".pem"))
+			if err != nil {
+				clog.Error(errInvalidKeyName, "load-signing-keys", err, map[string]string{"file": file})
+				return nil, errors.New(errInvalidKeyName)
+			}
+		}
+
+		keys = append(keys, key)
+	}
+
+	// File names are dates so sorting the files already sorted the keys.
+	return keys, nil
+}
+
+// ParseSigningKey Parses a PKCS#8, PKCS#1 (RSA) or SEC 1 (EC) PEM private key. The kid is the RFC 7638 thumbprint of the
+// public key.
+func ParseSigningKey(pemBytes []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New(errInvalidPEM)
+	}
+
+	var private interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{Private: private}
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		key.Public = &k.PublicKey
+		switch k.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.Method = jwt.SigningMethodES512
+		default:
+			return nil, errors.New(errUnsupportedKeyType)
+		}
+	case ed25519.PrivateKey:
+		key.Method, key.Public = jwteddsa.SigningMethod, k.Public()
+	default:
+		return nil, errors.New(errUnsupportedKeyType)
+	}
+
+	jwk, _ := publicJWK(key)
+	key.ID, err = thumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// publicJWK Returns false for symmetric keys, those must never be published.
+func publicJWK(key *SigningKey) (JSONWebKey, bool) {
+	jwk := JSONWebKey{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+	switch k := key.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(padLeft(k.X.Bytes(), size))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(padLeft(k.Y.Bytes(), size))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	default:
+		return jwk, false
+	}
+
+	return jwk, true
+}
+
+// thumbprint RFC 7638: SHA-256 of the required members in lexicographic order.
+func thumbprint(jwk JSONWebKey) (string, error) {
+	var members map[string]string
+	switch jwk.Kty {
+	case "RSA":
+		members = map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N}
+	case "EC":
+		members = map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X, "y": jwk.Y}
+	case "OKP":
+		members = map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X}
+	default:
+		return "", errors.New(errUnsupportedKeyType)
+	}
+
+	// encoding/json sorts map keys, which is exactly the canonical form the RFC asks for.
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func padLeft(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
@@ -0,0 +1,135 @@
+package encryption
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, dir, name string, key interface{}) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	b := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), b, 0600))
+}
+
+func keyRingConfig(path string) *config.EnigmaConfig {
+	return &config.EnigmaConfig{
+		JwtSign:            "sign",
+		JwtSigningKeysPath: path,
+		TokenOptions:       &config.TokenOptions{KeyRetirementPeriod: time.Hour},
+	}
+}
+
+func TestNewKeyRingHMACFallback(t *testing.T) {
+	signer, err := NewKeyRing(keyRingConfig(""))
+	require.NoError(t, err)
+
+	token, err := signer.Sign(jwt.StandardClaims{Subject: "123"})
+	require.NoError(t, err)
+
+	claims := &jwt.StandardClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) { return []byte("sign"), nil })
+	require.NoError(t, err)
+	require.Nil(t, parsed.Header["kid"])
+
+	_, err = signer.Parse(token, &jwt.StandardClaims{})
+	require.NoError(t, err)
+
+	require.Empty(t, signer.JWKS().Keys)
+}
+
+func TestNewKeyRingAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		key  interface{}
+		alg  string
+		kty  string
+	}{
+		{name: "rsa", key: rsaKey, alg: "RS256", kty: "RSA"},
+		{name: "ecdsa", key: ecKey, alg: "ES256", kty: "EC"},
+		{name: "ed25519", key: edKey, alg: "EdDSA", kty: "OKP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "keys")
+			require.NoError(t, err)
+			writeKey(t, dir, "key.pem", tt.key)
+
+			signer, err := NewKeyRing(keyRingConfig(filepath.Join(dir, "key.pem")))
+			require.NoError(t, err)
+
+			token, err := signer.Sign(jwt.StandardClaims{Subject: "123"})
+			require.NoError(t, err)
+
+			claims := &jwt.StandardClaims{}
+			parsed, err := signer.Parse(token, claims)
+			require.NoError(t, err)
+			require.Equal(t, "123", claims.Subject)
+			require.Equal(t, tt.alg, parsed.Method.Alg())
+
+			keys := signer.JWKS().Keys
+			require.Len(t, keys, 1)
+			require.Equal(t, tt.kty, keys[0].Kty)
+			require.Equal(t, tt.alg, keys[0].Alg)
+			require.Equal(t, parsed.Header["kid"], keys[0].Kid)
+		})
+	}
+}
+
+func TestSignerRejectsUnknownKeys(t *testing.T) {
+	hmacSigner, err := NewKeyRing(keyRingConfig(""))
+	require.NoError(t, err)
+	token, err := hmacSigner.Sign(jwt.StandardClaims{})
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "keys")
+	require.NoError(t, err)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeKey(t, dir, "2020-01-01.pem", key)
+
+	signer, err := NewKeyRing(keyRingConfig(dir))
+	require.NoError(t, err)
+
+	_, err = signer.Parse(token, &jwt.StandardClaims{})
+	require.Error(t, err)
+}
+
+func TestParseSigningKeyInvalid(t *testing.T) {
+	_, err := ParseSigningKey([]byte("not a pem"))
+	require.EqualError(t, err, errInvalidPEM)
+}
+
+func TestThumbprint(t *testing.T) {
+	// Example from RFC 7638 section 3.1.
+	kid, err := thumbprint(JSONWebKey{
+		Kty: "RSA",
+		E:   "AQAB",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMs" +
+			"tn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajr" +
+			"n1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", kid)
+}
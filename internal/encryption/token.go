@@ -1,8 +1,11 @@
 package encryption
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strconv"
@@ -17,8 +20,34 @@ import (
 
 const (
 	errIncompatibleVersion = "version de argon2 incompatible"
+	errInvalidMFAToken     = "el token de verificación en dos pasos no es válido"
+	errUnknownPepper       = "no se encontró el pepper del hash"
+
+	errInvalidVerificationToken = "el token de verificación no es válido"
+
+	mfaTokenPurpose = "mfa"
+
+	securityStampLength = 32
+	pepperPurpose       = "password-pepper"
+	pepperParam         = "pepper="
+
+	// Recovery codes are read and typed by people, they use the lowercase base32 alphabet which has no 0/O or 1/l.
+	recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	recoveryCodeLength   = 10
 )
 
+// MFATokenClaims Claims of the token handed out when the password was right but the user still has to enter the second
+// factor. It's signed with the password hashing key, not with the access token keys, so it can never pass as an access
+// token.
+type MFATokenClaims struct {
+	jwt.StandardClaims
+	AuthId  int64  `json:"auth_id"`
+	Purpose string `json:"purpose"`
+}
+
+// ErrVerificationTokenExpired The verification token is genuine but past its expiryDate, a new one has to be emailed.
+var ErrVerificationTokenExpired = errors.New("el token de verificación expiró")
+
 func GenerateVerificationToken(email string, expiry time.Duration, c *config.EnigmaConfig) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"email":      email,
@@ -34,21 +63,130 @@ func GenerateVerificationToken(email string, expiry time.Duration, c *config.Eni
 	return tokenString, nil
 }
 
-func GenerateSecurityToken(password string, c *config.EnigmaConfig) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"password":  password,
-		"timestamp": time.Now().Unix(),
+// ParseVerificationToken Checks the signature and expiry of a token from GenerateVerificationToken and returns the
+// email it was generated for.
+func ParseVerificationToken(tokenString string, c *config.EnigmaConfig) (string, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New(errInvalidVerificationToken)
+		}
+		return []byte(c.Keys.PasswordHashingKey), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	email, _ := claims["email"].(string)
+	expiry, ok := claims["expiryDate"].(float64)
+	if email == "" || !ok {
+		return "", errors.New(errInvalidVerificationToken)
+	}
+
+	if !time.Unix(int64(expiry), 0).After(time.Now()) {
+		return "", ErrVerificationTokenExpired
+	}
+
+	return email, nil
+}
+
+// GenerateSecurityStamp Returns a random value that changes every time the password or the email of the user do. It used
+// to be a JWT with the password in it.
+func GenerateSecurityStamp() (string, error) {
+	stamp, err := GenerateOpaqueToken(securityStampLength)
+	if err != nil {
+		clog.Error("Error generating security stamp", "generate-security-stamp", err, nil)
+		return "", err
+	}
+
+	return stamp, nil
+}
+
+// GenerateMFAToken Returns the token that identifies the user while they enter the second factor.
+func GenerateMFAToken(authID int64, c *config.EnigmaConfig) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &MFATokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.FormatInt(authID, 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(c.TokenOptions.MFATokenDuration).Unix(),
+		},
+		AuthId:  authID,
+		Purpose: mfaTokenPurpose,
 	})
 
 	tokenString, err := token.SignedString([]byte(c.Keys.PasswordHashingKey))
 	if err != nil {
-		clog.Error("Error generating security token", "generate-security-token", err, nil)
+		clog.Error("Error generating mfa token", "generate-mfa-token", err, nil)
 		return "", err
 	}
 
 	return tokenString, nil
 }
 
+// ParseMFAToken Returns the auth id of a valid, unexpired MFA token.
+func ParseMFAToken(tokenString string, c *config.EnigmaConfig) (int64, error) {
+	claims := &MFATokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New(errInvalidMFAToken)
+		}
+		return []byte(c.Keys.PasswordHashingKey), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if claims.Purpose != mfaTokenPurpose || claims.ExpiresAt == 0 {
+		return 0, errors.New(errInvalidMFAToken)
+	}
+
+	return claims.AuthId, nil
+}
+
+// GenerateOpaqueToken Returns a random URL-safe token built from n random bytes.
+func GenerateOpaqueToken(n uint32) (string, error) {
+	b, err := generateRandomBytes(n)
+	if err != nil {
+		clog.Error("Error generating opaque token", "generate-opaque-token", err, nil)
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashOpaqueToken Returns the hex encoded SHA-256 of an opaque token. Opaque tokens are random enough that a fast hash is
+// safe to store and lets us look them up by value.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateRecoveryCode Returns a random code like "k3bx7-q2mzt" (50 bits) to log in when the authenticator is lost.
+func GenerateRecoveryCode() (string, error) {
+	b, err := generateRandomBytes(recoveryCodeLength)
+	if err != nil {
+		return "", err
+	}
+
+	code := make([]byte, 0, recoveryCodeLength+1)
+	for i, v := range b {
+		if i == recoveryCodeLength/2 {
+			code = append(code, '-')
+		}
+		// 256 is a multiple of 32 so the modulo isn't biased.
+		code = append(code, recoveryCodeAlphabet[int(v)%len(recoveryCodeAlphabet)])
+	}
+
+	return string(code), nil
+}
+
+// NormalizeRecoveryCode Codes are hashed without the dash, so they match however the user typed them.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
 func generateFromPassword(password string, cfg *config.EnigmaConfig) (string, error) {
 	// Generate a cryptographically secure random salt.
 	salt, err := generateRandomBytes(cfg.ArgonParams.SaltLength)
@@ -56,18 +194,66 @@ func generateFromPassword(password string, cfg *config.EnigmaConfig) (string, er
 		return "", err
 	}
 
-	hash := argon2.IDKey([]byte(password), salt, cfg.ArgonParams.Iterations, cfg.ArgonParams.Memory, cfg.ArgonParams.Parallelism, cfg.ArgonParams.KeyLength)
+	pepperVersion := currentPepperVersion(cfg)
+	peppered, err := pepperPassword(password, pepperVersion, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey(peppered, salt, cfg.ArgonParams.Iterations, cfg.ArgonParams.Memory, cfg.ArgonParams.Parallelism, cfg.ArgonParams.KeyLength)
 
 	// Base64 encode the salt and hashed password.
 	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
 	b64Hash := base64.RawStdEncoding.EncodeToString(hash)
 
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", cfg.ArgonParams.Memory, cfg.ArgonParams.Iterations, cfg.ArgonParams.Parallelism)
+	if pepperVersion > 0 {
+		params += fmt.Sprintf(",%s%d", pepperParam, pepperVersion)
+	}
+
 	// Return a string using the standard encoded hash representation.
-	encodedHash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, cfg.ArgonParams.Memory, cfg.ArgonParams.Iterations, cfg.ArgonParams.Parallelism, b64Salt, b64Hash)
+	encodedHash := fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", argon2.Version, params, b64Salt, b64Hash)
 
 	return encodedHash, nil
 }
 
+// currentPepperVersion The version new hashes are peppered with, 0 when there are no peppers configured.
+func currentPepperVersion(cfg *config.EnigmaConfig) int {
+	if cfg.Keys == nil || len(cfg.Keys.PasswordPeppers) == 0 {
+		return 0
+	}
+
+	return cfg.Keys.PasswordPepperVersion
+}
+
+// pepperPassword HMACs the password with a key derived from the pepper of the version before it's hashed, so the hashes
+// can't be cracked with the database alone. The version 0 are the hashes made before the pepper, which are left as is.
+func pepperPassword(password string, version int, cfg *config.EnigmaConfig) ([]byte, error) {
+	if version == 0 {
+		return []byte(password), nil
+	}
+
+	var key string
+	var ok bool
+	if cfg.Keys != nil {
+		key, ok = cfg.Keys.PasswordPeppers[version]
+	}
+	if !ok {
+		err := errors.New(errUnknownPepper)
+		clog.Error(errUnknownPepper, "pepper-password", err, map[string]string{"version": strconv.Itoa(version)})
+		return nil, err
+	}
+
+	// The pepper is derived from the key instead of using it as is, so it's bound to this purpose
+	derive := hmac.New(sha256.New, []byte(key))
+	derive.Write([]byte(pepperPurpose)) // nolint
+
+	mac := hmac.New(sha256.New, derive.Sum(nil))
+	mac.Write([]byte(password)) // nolint
+
+	return mac.Sum(nil), nil
+}
+
 func generateRandomBytes(n uint32) ([]byte, error) {
 	b := make([]byte, n)
 	_, err := rand.Read(b)
@@ -79,58 +265,58 @@ func generateRandomBytes(n uint32) ([]byte, error) {
 	return b, nil
 }
 
-// https://www.alexedwards.net/blog/how-to-hash-and-verify-passwords-with-argon2-in-go
-// For guidance and an outline process for choosing appropriate parameters see https://tools.ietf.org/html/draft-irtf-cfrg-argon2-04#section-4.
-func GenerateEncodedHash(pw string, cfg *config.EnigmaConfig) (string, error) {
-	encodedHash, err := generateFromPassword(pw, cfg)
-	if err != nil {
-		clog.Error("Error generating encoded hash", "generate-encoded-hash", err, nil)
-		return "", err
-	}
-
-	return encodedHash, nil
-}
-
-func DecodeHash(encodedHash string) (p *config.ArgonParams, salt, hash []byte, err error) {
+// DecodeHash Splits an argon2id hash in its params, the version of the pepper (0 if it has none), salt and hash.
+func DecodeHash(encodedHash string) (p *config.ArgonParams, pepperVersion int, salt, hash []byte, err error) {
 	vals := strings.Split(encodedHash, "$")
 	if len(vals) != 6 {
 		msg := "encoded hash string is not 6"
 		clog.Error(msg, "decode-hash", errors.New(msg), map[string]string{"len": strconv.Itoa(len(vals))})
-		return nil, nil, nil, errors.New(msg)
+		return nil, 0, nil, nil, errors.New(msg)
 	}
 
 	var version int
 	_, err = fmt.Sscanf(vals[2], "v=%d", &version)
 	if err != nil {
 		clog.Error("Error finding arguments in string", "decode-hash", err, nil)
-		return nil, nil, nil, err
+		return nil, 0, nil, nil, err
 	}
 	if version != argon2.Version {
 		err := errors.New(errIncompatibleVersion)
 		clog.Error(errIncompatibleVersion, "decode-hash", err, map[string]string{"version": strconv.Itoa(version)})
-		return nil, nil, nil, err
+		return nil, 0, nil, nil, err
+	}
+
+	params := vals[3]
+	if i := strings.Index(params, ","+pepperParam); i >= 0 {
+		pepperVersion, err = strconv.Atoi(params[i+len(pepperParam)+1:])
+		if err != nil || pepperVersion <= 0 {
+			msg := "invalid pepper version"
+			clog.Error(msg, "decode-hash", errors.New(msg), map[string]string{"params": params})
+			return nil, 0, nil, nil, errors.New(msg)
+		}
+		params = params[:i]
 	}
 
 	p = &config.ArgonParams{}
-	_, err = fmt.Sscanf(vals[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	_, err = fmt.Sscanf(params, "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
 	if err != nil {
 		clog.Error("Error scanning params", "decode-hash", err, nil)
-		return nil, nil, nil, err
+		return nil, 0, nil, nil, err
 	}
 
 	salt, err = base64.RawStdEncoding.DecodeString(vals[4])
 	if err != nil {
 		clog.Error("Error decoding salt base64 string", "decode-hash", err, nil)
-		return nil, nil, nil, err
+		return nil, 0, nil, nil, err
 	}
 	p.SaltLength = uint32(len(salt))
 
 	hash, err = base64.RawStdEncoding.DecodeString(vals[5])
 	if err != nil {
 		clog.Error("Error decoding hash base64 string", "decode-hash", err, nil)
-		return nil, nil, nil, err
+		return nil, 0, nil, nil, err
 	}
 	p.KeyLength = uint32(len(hash))
 
-	return p, salt, hash, nil
+	return p, pepperVersion, salt, hash, nil
 }
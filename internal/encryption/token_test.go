@@ -2,7 +2,9 @@ package encryption
 
 import (
 	"testing"
+	"time"
 
+	"github.com/CienciaArgentina/go-enigma/config"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,3 +19,198 @@ func TestGenerateRandomBytesNotPanics(t *testing.T) {
 	})
 }
 
+func TestGenerateOpaqueToken(t *testing.T) {
+	first, err := GenerateOpaqueToken(32)
+	require.NoError(t, err)
+	second, err := GenerateOpaqueToken(32)
+	require.NoError(t, err)
+
+	require.Len(t, first, 43)
+	require.NotEqual(t, first, second)
+}
+
+func TestParseVerificationToken(t *testing.T) {
+	cfg := &config.EnigmaConfig{Keys: &config.Keys{PasswordHashingKey: "key"}}
+	other := &config.EnigmaConfig{Keys: &config.Keys{PasswordHashingKey: "other"}}
+
+	token, err := GenerateVerificationToken("test@test.com", time.Hour, cfg)
+	require.NoError(t, err)
+	email, err := ParseVerificationToken(token, cfg)
+	require.NoError(t, err)
+	require.Equal(t, "test@test.com", email)
+
+	_, err = ParseVerificationToken(token, other)
+	require.Error(t, err)
+	require.NotEqual(t, ErrVerificationTokenExpired, err)
+
+	expired, err := GenerateVerificationToken("test@test.com", -time.Minute, cfg)
+	require.NoError(t, err)
+	_, err = ParseVerificationToken(expired, cfg)
+	require.Equal(t, ErrVerificationTokenExpired, err)
+
+	_, err = ParseVerificationToken("token", cfg)
+	require.Error(t, err)
+}
+
+func TestGenerateSecurityStamp(t *testing.T) {
+	stamp, err := GenerateSecurityStamp()
+	require.NoError(t, err)
+	other, err := GenerateSecurityStamp()
+	require.NoError(t, err)
+
+	require.NotEqual(t, stamp, other)
+	require.NotContains(t, stamp, ".")
+}
+
+func TestHashOpaqueToken(t *testing.T) {
+	require.Equal(t, HashOpaqueToken("token"), HashOpaqueToken("token"))
+	require.NotEqual(t, HashOpaqueToken("token"), HashOpaqueToken("other"))
+	require.Len(t, HashOpaqueToken("token"), 64)
+}
+
+func TestMFAToken(t *testing.T) {
+	cfg := testConfig()
+	cfg.Keys = &config.Keys{PasswordHashingKey: "key"}
+	cfg.TokenOptions.MFATokenDuration = time.Minute
+
+	token, err := GenerateMFAToken(123, cfg)
+	require.NoError(t, err)
+
+	authID, err := ParseMFAToken(token, cfg)
+	require.NoError(t, err)
+	require.Equal(t, int64(123), authID)
+
+	other := testConfig()
+	other.Keys = &config.Keys{PasswordHashingKey: "other"}
+	_, err = ParseMFAToken(token, other)
+	require.Error(t, err)
+
+	// An access token is not an MFA token even if both were signed with the same secret.
+	cfg.JwtSign = "key"
+	signer, err := NewKeyRing(cfg)
+	require.NoError(t, err)
+	claims, err := NewAccessTokenClaims(123, "test@test.com", "session", nil, cfg)
+	require.NoError(t, err)
+	accessToken, err := signer.Sign(claims)
+	require.NoError(t, err)
+	_, err = ParseMFAToken(accessToken, cfg)
+	require.Error(t, err)
+
+	cfg.TokenOptions.MFATokenDuration = -time.Minute
+	expired, err := GenerateMFAToken(123, cfg)
+	require.NoError(t, err)
+	_, err = ParseMFAToken(expired, cfg)
+	require.Error(t, err)
+}
+
+func TestRecoveryCode(t *testing.T) {
+	code, err := GenerateRecoveryCode()
+	require.NoError(t, err)
+	require.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+
+	other, err := GenerateRecoveryCode()
+	require.NoError(t, err)
+	require.NotEqual(t, code, other)
+
+	require.Equal(t, "abcdefghij", NormalizeRecoveryCode(" ABCDE-fghij "))
+	require.Equal(t, "abcdefghij", NormalizeRecoveryCode("abcde fghij"))
+}
+
+func TestCompareEncodedHash(t *testing.T) {
+	cfg := &config.EnigmaConfig{ArgonParams: &config.ArgonParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16}}
+	hash, err := GenerateEncodedHash("secret", cfg)
+	require.NoError(t, err)
+
+	ok, err := CompareEncodedHash("secret", hash, cfg)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = CompareEncodedHash("other", hash, cfg)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = CompareEncodedHash("secret", "invalid", cfg)
+	require.Error(t, err)
+}
+
+func TestNeedsRehash(t *testing.T) {
+	params := config.ArgonParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16}
+	hash, err := GenerateEncodedHash("secret", &config.EnigmaConfig{ArgonParams: &params})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		change func(p *config.ArgonParams)
+		want   bool
+	}{
+		{name: "same_params", change: func(p *config.ArgonParams) {}, want: false},
+		{name: "memory", change: func(p *config.ArgonParams) { p.Memory = 2048 }, want: true},
+		{name: "iterations", change: func(p *config.ArgonParams) { p.Iterations = 2 }, want: true},
+		{name: "parallelism", change: func(p *config.ArgonParams) { p.Parallelism = 2 }, want: true},
+		{name: "salt_length", change: func(p *config.ArgonParams) { p.SaltLength = 32 }, want: true},
+		{name: "key_length", change: func(p *config.ArgonParams) { p.KeyLength = 32 }, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := params
+			tt.change(&current)
+
+			got, err := NeedsRehash(hash, &config.EnigmaConfig{ArgonParams: &current})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err = NeedsRehash("invalid", &config.EnigmaConfig{ArgonParams: &params})
+	require.Error(t, err)
+}
+
+func TestGenerateEncodedHash_pepper(t *testing.T) {
+	params := config.ArgonParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16}
+	unpeppered := &config.EnigmaConfig{ArgonParams: &params}
+	first := &config.EnigmaConfig{ArgonParams: &params, Keys: &config.Keys{PasswordPeppers: map[int]string{1: "first"}, PasswordPepperVersion: 1}}
+	rotated := &config.EnigmaConfig{ArgonParams: &params, Keys: &config.Keys{PasswordPeppers: map[int]string{1: "first", 2: "second"}, PasswordPepperVersion: 2}}
+	leaked := &config.EnigmaConfig{ArgonParams: &params, Keys: &config.Keys{PasswordPeppers: map[int]string{1: "guess"}, PasswordPepperVersion: 1}}
+
+	oldHash, err := GenerateEncodedHash("secret", unpeppered)
+	require.NoError(t, err)
+	require.NotContains(t, oldHash, "pepper=")
+
+	hash, err := GenerateEncodedHash("secret", first)
+	require.NoError(t, err)
+	require.Contains(t, hash, ",pepper=1$")
+
+	tests := []struct {
+		name    string
+		hash    string
+		cfg     *config.EnigmaConfig
+		want    bool
+		rehash  bool
+		wantErr bool
+	}{
+		{name: "unpeppered_hash", hash: oldHash, cfg: first, want: true, rehash: true},
+		{name: "current_pepper", hash: hash, cfg: first, want: true, rehash: false},
+		{name: "rotated_pepper", hash: hash, cfg: rotated, want: true, rehash: true},
+		{name: "other_pepper_key", hash: hash, cfg: leaked, want: false, rehash: false},
+		{name: "missing_pepper", hash: hash, cfg: unpeppered, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := CompareEncodedHash("secret", tt.hash, tt.cfg)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, ok)
+
+			rehash, err := NeedsRehash(tt.hash, tt.cfg)
+			require.NoError(t, err)
+			require.Equal(t, tt.rehash, rehash)
+		})
+	}
+
+	rotatedHash, err := GenerateEncodedHash("secret", rotated)
+	require.NoError(t, err)
+	require.Contains(t, rotatedHash, ",pepper=2$")
+}
@@ -0,0 +1,85 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" // nolint RFC 6238 authenticator apps only support SHA-1 reliably
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	totpSecretLength = 20
+	totpDigits       = 6
+	totpPeriod       = 30
+	// Codes from the previous and next period are accepted too, clocks drift.
+	totpSkew = 1
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret Returns a random secret for RFC 6238 TOTP.
+func GenerateTOTPSecret() ([]byte, error) {
+	return generateRandomBytes(totpSecretLength)
+}
+
+// EncodeTOTPSecret Returns the secret as the base32 string authenticator apps expect.
+func EncodeTOTPSecret(secret []byte) string {
+	return base32NoPadding.EncodeToString(secret)
+}
+
+// TOTPURI Returns the otpauth:// URI authenticator apps read from QR codes.
+func TOTPURI(issuer, account string, secret []byte) string {
+	v := url.Values{}
+	v.Set("secret", EncodeTOTPSecret(secret))
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprintf("%d", totpDigits))
+	v.Set("period", fmt.Sprintf("%d", totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// TOTPCode Returns the code for the period t falls in.
+func TOTPCode(secret []byte, t time.Time) string {
+	return hotp(secret, uint64(t.Unix()/totpPeriod))
+}
+
+// ValidateTOTP Checks the code against the periods around t. Codes from a period up to lastStep are rejected so a code
+// can't be used twice. Returns the period the code belongs to, which should be stored as the new lastStep.
+func ValidateTOTP(secret []byte, code string, t time.Time, lastStep int64) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := t.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, uint64(step))), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// hotp RFC 4226.
+func hotp(secret []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
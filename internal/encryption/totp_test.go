@@ -0,0 +1,66 @@
+package encryption
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from RFC 6238 appendix B (SHA-1), truncated to 6 digits.
+func TestTOTPCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.code, TOTPCode(secret, time.Unix(tt.unix, 0)))
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	now := time.Unix(1600000000, 0)
+	step := now.Unix() / totpPeriod
+
+	got, ok := ValidateTOTP(secret, TOTPCode(secret, now), now, 0)
+	require.True(t, ok)
+	require.Equal(t, step, got)
+
+	// Clock drift of one period either way is fine.
+	_, ok = ValidateTOTP(secret, TOTPCode(secret, now.Add(-totpPeriod*time.Second)), now, 0)
+	require.True(t, ok)
+	_, ok = ValidateTOTP(secret, TOTPCode(secret, now.Add(totpPeriod*time.Second)), now, 0)
+	require.True(t, ok)
+	_, ok = ValidateTOTP(secret, TOTPCode(secret, now.Add(-2*totpPeriod*time.Second)), now, 0)
+	require.False(t, ok)
+
+	// A code can't be used twice.
+	_, ok = ValidateTOTP(secret, TOTPCode(secret, now), now, step)
+	require.False(t, ok)
+
+	_, ok = ValidateTOTP(secret, "12345", now, 0)
+	require.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Ciencia Argentina", "test@test.com", []byte("12345678901234567890"))
+
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", u.Scheme)
+	require.Equal(t, "totp", u.Host)
+	require.Equal(t, "/Ciencia Argentina:test@test.com", u.Path)
+	require.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", u.Query().Get("secret"))
+	require.Equal(t, "Ciencia Argentina", u.Query().Get("issuer"))
+}
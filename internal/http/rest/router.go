@@ -4,16 +4,25 @@ import (
 	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 
-	config2 "github.com/CienciaArgentina/go-backend-commons/config"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
-	"github.com/CienciaArgentina/go-backend-commons/pkg/injector"
 	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/auth"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/internal/introspection"
+	"github.com/CienciaArgentina/go-enigma/internal/jwks"
 	"github.com/CienciaArgentina/go-enigma/internal/login"
+	"github.com/CienciaArgentina/go-enigma/internal/mfa"
 	"github.com/CienciaArgentina/go-enigma/internal/recovery"
 	"github.com/CienciaArgentina/go-enigma/internal/register"
+	"github.com/CienciaArgentina/go-enigma/internal/revocation"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
+	"github.com/CienciaArgentina/go-enigma/internal/users"
+	"github.com/CienciaArgentina/go-enigma/internal/webauthn"
 	"github.com/gin-gonic/gin"
 )
 
@@ -29,11 +38,6 @@ func InitRouter() *gin.Engine {
 }
 
 func MapRoutes(r *gin.Engine) {
-	injector.Initilize()
-
-	dbname := os.Getenv(config2.EnvDBName)
-	db := injector.GetDB(dbname).Database
-
 	enigmaConfig, err := config.NewEnigmaConfig()
 	if err != nil {
 		msg := "error building enigma config"
@@ -41,24 +45,87 @@ func MapRoutes(r *gin.Engine) {
 		return
 	}
 
-	loginRepo := login.NewRepository(db)
-	loginSvc := login.NewService(enigmaConfig, loginRepo)
+	db, err := storage.Open(enigmaConfig.DatabaseOptions)
+	if err != nil {
+		msg := "error connecting to the database"
+		clog.Panic(msg, "map-routes", err, nil)
+		return
+	}
+
+	signer, err := encryption.NewKeyRing(enigmaConfig)
+	if err != nil {
+		msg := "error loading signing keys"
+		clog.Panic(msg, "map-routes", err, nil)
+		return
+	}
+	reloadKeysOnSignal(signer)
+
+	queryTimeout := enigmaConfig.TimeoutOptions.Query
+
+	revocations := revocation.NewRepository(db, queryTimeout)
+	if enigmaConfig.RevocationStore == config.RevocationStoreMemory {
+		revocations = revocation.NewMemoryStore()
+	}
+	revocationCtrl := revocation.NewController(revocations)
+	verifier := auth.NewVerifier(enigmaConfig, signer, revocations)
+	requireAuth := auth.NewMiddleware(verifier)
+
+	mfaRepo := mfa.NewRepository(db, queryTimeout)
+	mfaSvc := mfa.NewService(enigmaConfig, mfaRepo)
+	mfaCtrl := mfa.NewController(mfaSvc)
+
+	webauthnRepo := webauthn.NewRepository(db, queryTimeout)
+	webauthnSvc := webauthn.NewService(enigmaConfig, webauthnRepo)
+	webauthnCtrl := webauthn.NewController(webauthnSvc)
+
+	userStore := users.NewRepository(db, queryTimeout)
+
+	loginRepo := login.NewRepository(db, queryTimeout)
+	loginSvc := login.NewService(enigmaConfig, loginRepo, userStore, signer, revocations, mfaSvc, webauthnSvc)
 	loginCtrl := login.NewController(loginSvc)
 
-	recoveryRepo := recovery.NewRepository(db)
-	recoverySvc := recovery.NewService(enigmaConfig, recoveryRepo)
+	recoveryRepo := recovery.NewRepository(db, queryTimeout)
+	recoverySvc := recovery.NewService(enigmaConfig, recoveryRepo, userStore)
 	recoveryCtrl := recovery.NewController(recoverySvc)
 
-	registerRepo := register.NewRepository(db)
-	registerSvc := register.NewService(enigmaConfig, db, registerRepo, recoverySvc)
+	registerRepo := register.NewRepository(db, queryTimeout)
+	registerSvc := register.NewService(enigmaConfig, db, registerRepo, userStore, recoverySvc)
 	registerCtrl := register.NewController(registerSvc)
 
+	jwksCtrl := jwks.NewController(signer)
+
+	introspectionRepo := introspection.NewRepository(db, queryTimeout)
+	introspectionSvc := introspection.NewService(introspectionRepo, userStore, verifier)
+	introspectionCtrl := introspection.NewController(introspectionSvc)
+
 	r.GET("/ping", Ping)
+	r.GET("/.well-known/jwks.json", jwksCtrl.GetJWKS)
+	r.GET("/tokens/revoked/:jti", revocationCtrl.IsRevoked)
+	r.POST("/oauth/introspect", introspectionCtrl.Introspect)
+
+	sessions := r.Group("/sessions", requireAuth)
+	{
+		sessions.GET("", loginCtrl.GetSessions)
+		sessions.DELETE("/:session_id", loginCtrl.RevokeSession)
+	}
 
 	user := r.Group("/users")
 	{
 		user.POST("/", registerCtrl.SignUp)
 		user.POST("/login", loginCtrl.Login)
+		user.POST("/login/mfa", loginCtrl.LoginMFA)
+		user.POST("/login/webauthn/options", webauthnCtrl.LoginOptions)
+		user.POST("/login/webauthn", loginCtrl.LoginWebAuthn)
+		user.POST("/login/magic_link", loginCtrl.SendMagicLink)
+		user.POST("/login/magic_link/consume", loginCtrl.LoginMagicLink)
+		user.POST("/mfa/totp", requireAuth, mfaCtrl.Enroll)
+		user.POST("/mfa/totp/confirm", requireAuth, mfaCtrl.Confirm)
+		user.POST("/mfa/recovery_codes", requireAuth, mfaCtrl.RegenerateRecoveryCodes)
+		user.POST("/webauthn/register/options", requireAuth, webauthnCtrl.RegistrationOptions)
+		user.POST("/webauthn/register", requireAuth, webauthnCtrl.Register)
+		user.POST("/token/refresh", loginCtrl.RefreshToken)
+		user.POST("/logout", requireAuth, loginCtrl.Logout)
+		user.POST("/logout_all", requireAuth, loginCtrl.LogoutAll)
 		user.POST("/confirm_password_reset", recoveryCtrl.ConfirmPasswordReset)
 		user.GET("/:firstpath", func(c *gin.Context) {
 			GetSingleHandler(c, recoveryCtrl)
@@ -101,6 +168,22 @@ func GetSecondHandler(c *gin.Context, rc recovery.RecoveryController) {
 	}
 }
 
+// reloadKeysOnSignal Reloads the signing keys on every SIGHUP so keys can be rotated without restarting the service.
+func reloadKeysOnSignal(keys *encryption.KeyRing) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			if err := keys.Reload(); err != nil {
+				clog.Error("Error reloading signing keys", "reload-keys", err, nil)
+				continue
+			}
+			clog.Info("Signing keys reloaded", "reload-keys", nil)
+		}
+	}()
+}
+
 func Ping(c *gin.Context) {
 	c.JSON(http.StatusOK, "pong")
 }
@@ -0,0 +1,62 @@
+package introspection
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/performance"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/rest"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type introspectionController struct {
+	svc Service
+}
+
+func NewController(s Service) Controller {
+	return &introspectionController{svc: s}
+}
+
+// Introspect RFC 7662 token introspection. The client authenticates with HTTP Basic or with client_id and client_secret
+// in the form, and sends the token in the token form field.
+func (i *introspectionController) Introspect(c *gin.Context) {
+	// middleware.GetContextInformation expects a Bearer token in the Authorization header, here it carries the client
+	// credentials.
+	info := &middleware.ContextInformation{RequestID: c.Writer.Header().Get(rest.RequestIDHeader), TransactionName: "Introspect"}
+
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+	if ok {
+		// RFC 6749 section 2.3.1: the credentials are form encoded before being put in the header.
+		clientID, clientSecret = formDecode(clientID), formDecode(clientSecret)
+	} else {
+		clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	var resp *domain.IntrospectionResponse
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "Introspect", info, func() {
+		resp, apierr = i.svc.Introspect(c.Request.Context(), clientID, clientSecret, c.PostForm("token"), info)
+	})
+	if apierr != nil {
+		if apierr.Status() == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", `Basic realm="enigma"`)
+		}
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+func formDecode(s string) string {
+	decoded, err := url.QueryUnescape(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
@@ -0,0 +1,95 @@
+package introspection
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type MockService struct {
+	Response *domain.IntrospectionResponse
+	Error    apierror.ApiError
+
+	ClientID, ClientSecret, Token string
+}
+
+func (m *MockService) Introspect(ctx context.Context, clientID, clientSecret, token string, info *middleware.ContextInformation) (*domain.IntrospectionResponse, apierror.ApiError) {
+	m.ClientID, m.ClientSecret, m.Token = clientID, clientSecret, token
+	return m.Response, m.Error
+}
+
+func Test_introspectionController_Introspect(t *testing.T) {
+	tests := []struct {
+		name           string
+		svc            *MockService
+		basicAuth      bool
+		form           url.Values
+		expectedStatus int
+		expectedBody   string
+		expectedSecret string
+	}{
+		{
+			name:           "invalid_client",
+			svc:            &MockService{Error: apierror.New(http.StatusUnauthorized, ErrInvalidClient, apierror.NewErrorCause(ErrInvalidClient, ErrInvalidClientCode))},
+			form:           url.Values{"client_id": {"roles"}, "client_secret": {"wrong"}, "token": {"token"}},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":401,"message":"` + ErrInvalidClient + `","errors":[{"detail":"` + ErrInvalidClient + `","code":"invalid_client"}]}`,
+			expectedSecret: "wrong",
+		},
+		{
+			name:           "inactive_form_credentials",
+			svc:            &MockService{Response: &domain.IntrospectionResponse{Active: false}},
+			form:           url.Values{"client_id": {"roles"}, "client_secret": {"secret"}, "token": {"token"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"active":false}`,
+			expectedSecret: "secret",
+		},
+		{
+			name:           "active_basic_auth",
+			svc:            &MockService{Response: &domain.IntrospectionResponse{Active: true, Sub: "123"}},
+			basicAuth:      true,
+			form:           url.Values{"token": {"token"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"active":true,"sub":"123"}`,
+			expectedSecret: "se cret",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(tt.form.Encode()))
+			c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.basicAuth {
+				c.Request.SetBasicAuth("roles", url.QueryEscape("se cret"))
+			}
+
+			NewController(tt.svc).Introspect(c)
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[Introspect] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body)
+			if buf.String() != tt.expectedBody {
+				t.Errorf("[Introspect] Expected body = %v, got %v", tt.expectedBody, buf.String())
+			}
+
+			if tt.svc.ClientID != "roles" || tt.svc.ClientSecret != tt.expectedSecret || tt.svc.Token != "token" {
+				t.Errorf("[Introspect] Unexpected arguments %v, %v, %v", tt.svc.ClientID, tt.svc.ClientSecret, tt.svc.Token)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package introspection
+
+import (
+	"context"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type Repository interface {
+	GetClient(ctx context.Context, clientID string) (*domain.OAuthClient, error)
+}
+
+// UserStore The lookup of users.UserStore that introspection needs
+type UserStore interface {
+	GetUser(ctx context.Context, userID int64) (*domain.User, error)
+}
+
+type Service interface {
+	Introspect(ctx context.Context, clientID, clientSecret, token string, info *middleware.ContextInformation) (*domain.IntrospectionResponse, apierror.ApiError)
+}
+
+type Controller interface {
+	Introspect(c *gin.Context)
+}
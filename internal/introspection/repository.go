@@ -0,0 +1,39 @@
+package introspection
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+type introspectionRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewRepository Returns new introspection repository, whose queries give up after timeout
+func NewRepository(db *sqlx.DB, timeout time.Duration) Repository {
+	return &introspectionRepository{db: db, timeout: timeout}
+}
+
+// GetClient Returns the client with the given ID, nil if it doesn't exist
+func (i *introspectionRepository) GetClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	ctx, cancel := storage.WithTimeout(ctx, i.timeout)
+	defer cancel()
+
+	var client domain.OAuthClient
+
+	err := i.db.GetContext(ctx, &client, i.db.Rebind("SELECT * FROM oauth_client WHERE client_id = ?"), clientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &client, nil
+}
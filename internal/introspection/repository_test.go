@@ -0,0 +1,71 @@
+package introspection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_introspectionRepository_GetClient(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "SELECT * FROM oauth_client WHERE client_id = ?"
+
+	tests := []struct {
+		name     string
+		expected *domain.OAuthClient
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: &domain.OAuthClient{ClientId: "roles", ClientSecretHash: "hash"},
+			mockFunc: func() {
+				rows := sqlmock.NewRows([]string{"client_id", "client_secret_hash"}).AddRow("roles", "hash")
+				mock.ExpectQuery(query).WithArgs("roles").WillReturnRows(rows)
+			},
+		},
+		{
+			name: "not_found",
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("roles").WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("roles").WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			client, err := r.GetClient(context.Background(), "roles")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("introspectionRepository.GetClient() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(client, tt.expected) {
+				t.Errorf("introspectionRepository.GetClient() got = %v, expected %v", client, tt.expected)
+			}
+		})
+	}
+}
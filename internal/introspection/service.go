@@ -0,0 +1,137 @@
+package introspection
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/performance"
+	"github.com/CienciaArgentina/go-enigma/internal/auth"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/internal/users"
+)
+
+const (
+	ErrInvalidClient     = "Las credenciales del cliente no son válidas"
+	ErrInvalidClientCode = "invalid_client"
+
+	ErrMissingToken     = "Falta el token a inspeccionar"
+	ErrMissingTokenCode = "invalid_request"
+
+	tokenType = "Bearer"
+)
+
+type introspectionService struct {
+	repository Repository
+	users      UserStore
+	verifier   *auth.Verifier
+}
+
+func NewService(r Repository, u UserStore, v *auth.Verifier) Service {
+	return &introspectionService{repository: r, users: u, verifier: v}
+}
+
+// Introspect Tells an authenticated client whether the token is active and who it belongs to. A token is active when it's
+// valid, it wasn't revoked and its user isn't deleted or locked out.
+func (i *introspectionService) Introspect(ctx context.Context, clientID, clientSecret, token string, info *middleware.ContextInformation) (*domain.IntrospectionResponse, apierror.ApiError) {
+	if apierr := i.authenticateClient(ctx, clientID, clientSecret, info); apierr != nil {
+		return nil, apierr
+	}
+
+	if token == "" {
+		return nil, apierror.New(http.StatusBadRequest, ErrMissingToken, apierror.NewErrorCause(ErrMissingToken, ErrMissingTokenCode))
+	}
+
+	inactive := &domain.IntrospectionResponse{Active: false}
+
+	var claims *encryption.AccessTokenClaims
+	var err error
+	performance.TrackTime(time.Now(), "VerifyToken", info, func() {
+		claims, err = i.verifier.Verify(ctx, token)
+	})
+	if err == auth.ErrTokenNotValid || err == auth.ErrTokenRevoked {
+		return inactive, nil
+	}
+	if err != nil {
+		clog.Error("Error verifying token", "introspect", err, map[string]string{"client_id": clientID})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	var user *domain.User
+	performance.TrackTime(time.Now(), "GetUser", info, func() {
+		user, err = i.users.GetUser(ctx, claims.AuthId)
+	})
+	if users.IsNotFound(err) {
+		return inactive, nil
+	}
+	if err != nil {
+		clog.Error("Error fetching user", "introspect", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if user.DateDeleted != nil || isLockedOut(user) {
+		return inactive, nil
+	}
+
+	scopes := make([]string, 0, len(claims.Roles))
+	for _, r := range claims.Roles {
+		scopes = append(scopes, r.Description)
+	}
+
+	return &domain.IntrospectionResponse{
+		Active: true,
+		Scope:  strings.Join(scopes, " "),
+		// Our tokens aren't requested by OAuth clients, they're issued to the audience configured in JWT_AUDIENCE.
+		ClientId:  claims.Audience,
+		Username:  user.Username,
+		TokenType: tokenType,
+		Exp:       claims.ExpiresAt,
+		Iat:       claims.IssuedAt,
+		Nbf:       claims.NotBefore,
+		Sub:       claims.Subject,
+		Aud:       claims.Audience,
+		Iss:       claims.Issuer,
+		Jti:       claims.Id,
+		Roles:     claims.Roles,
+	}, nil
+}
+
+func (i *introspectionService) authenticateClient(ctx context.Context, clientID, clientSecret string, info *middleware.ContextInformation) apierror.ApiError {
+	invalid := apierror.New(http.StatusUnauthorized, ErrInvalidClient, apierror.NewErrorCause(ErrInvalidClient, ErrInvalidClientCode))
+	if clientID == "" || clientSecret == "" {
+		return invalid
+	}
+
+	var client *domain.OAuthClient
+	var err error
+	performance.TrackTime(time.Now(), "GetClient", info, func() {
+		client, err = i.repository.GetClient(ctx, clientID)
+	})
+	if err != nil {
+		clog.Error("Error fetching client", "introspect", err, map[string]string{"client_id": clientID})
+		return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if client == nil || client.DateDeleted.Valid {
+		return invalid
+	}
+
+	hash := encryption.HashOpaqueToken(clientSecret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(client.ClientSecretHash)) != 1 {
+		return invalid
+	}
+
+	return nil
+}
+
+// isLockedOut lockout_date is when the lock ends, see login.LockAccount.
+func isLockedOut(user *domain.User) bool {
+	return user.LockoutEnabled && (!user.LockoutDate.Valid || user.LockoutDate.Time.After(time.Now()))
+}
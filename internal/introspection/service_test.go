@@ -0,0 +1,203 @@
+package introspection
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"database/sql"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/auth"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/internal/revocation"
+	"github.com/CienciaArgentina/go-enigma/internal/users"
+)
+
+const (
+	GetClientMockID = iota
+	GetUserMockID
+)
+
+type MockRepository struct {
+	Responses map[int]interface{}
+	Errors    map[int]error
+}
+
+func (m *MockRepository) GetClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	client, _ := m.Responses[GetClientMockID].(*domain.OAuthClient)
+	return client, m.Errors[GetClientMockID]
+}
+
+func (m *MockRepository) GetUser(ctx context.Context, userID int64) (*domain.User, error) {
+	user, _ := m.Responses[GetUserMockID].(*domain.User)
+	if user == nil && m.Errors[GetUserMockID] == nil {
+		return nil, users.ErrUserNotFound
+	}
+	return user, m.Errors[GetUserMockID]
+}
+
+func testConfig() *config.EnigmaConfig {
+	return &config.EnigmaConfig{
+		JwtSign: "sign",
+		TokenOptions: &config.TokenOptions{
+			Issuer:              "issuer",
+			Audience:            "audience",
+			AccessTokenDuration: time.Minute,
+		},
+	}
+}
+
+func Test_introspectionService_Introspect(t *testing.T) {
+	cfg := testConfig()
+	signer, err := encryption.NewKeyRing(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations := revocation.NewMemoryStore()
+
+	roles := []domain.Role{{ID: 1, Description: "admin"}, {ID: 2, Description: "editor"}}
+	claims, _ := encryption.NewAccessTokenClaims(123, "test@test.com", "session", roles, cfg)
+	token, _ := signer.Sign(claims)
+	revokedClaims, _ := encryption.NewAccessTokenClaims(123, "test@test.com", "session", roles, cfg)
+	revokedToken, _ := signer.Sign(revokedClaims)
+	_ = revocations.Revoke(context.Background(), revokedClaims.Id, time.Unix(revokedClaims.ExpiresAt, 0))
+
+	client := &domain.OAuthClient{ClientId: "roles", ClientSecretHash: encryption.HashOpaqueToken("secret")}
+	user := &domain.User{AuthId: 123, Username: "test"}
+	invalidClient := apierror.New(http.StatusUnauthorized, ErrInvalidClient, apierror.NewErrorCause(ErrInvalidClient, ErrInvalidClientCode))
+	inactive := &domain.IntrospectionResponse{Active: false}
+
+	tests := []struct {
+		name       string
+		secret     string
+		token      string
+		repository *MockRepository
+		want       *domain.IntrospectionResponse
+		want1      apierror.ApiError
+	}{
+		{
+			name:       "unknown_client",
+			secret:     "secret",
+			token:      token,
+			repository: &MockRepository{},
+			want1:      invalidClient,
+		},
+		{
+			name:       "wrong_secret",
+			secret:     "other",
+			token:      token,
+			repository: &MockRepository{Responses: map[int]interface{}{GetClientMockID: client}},
+			want1:      invalidClient,
+		},
+		{
+			name:   "deleted_client",
+			secret: "secret",
+			token:  token,
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetClientMockID: &domain.OAuthClient{ClientSecretHash: client.ClientSecretHash, DateDeleted: sql.NullTime{Valid: true}},
+			}},
+			want1: invalidClient,
+		},
+		{
+			name:       "missing_token",
+			secret:     "secret",
+			repository: &MockRepository{Responses: map[int]interface{}{GetClientMockID: client}},
+			want1:      apierror.New(http.StatusBadRequest, ErrMissingToken, apierror.NewErrorCause(ErrMissingToken, ErrMissingTokenCode)),
+		},
+		{
+			name:       "invalid_token",
+			secret:     "secret",
+			token:      "invalid",
+			repository: &MockRepository{Responses: map[int]interface{}{GetClientMockID: client}},
+			want:       inactive,
+		},
+		{
+			name:       "revoked_token",
+			secret:     "secret",
+			token:      revokedToken,
+			repository: &MockRepository{Responses: map[int]interface{}{GetClientMockID: client, GetUserMockID: user}},
+			want:       inactive,
+		},
+		{
+			name:   "user_fetch_error",
+			secret: "secret",
+			token:  token,
+			repository: &MockRepository{
+				Responses: map[int]interface{}{GetClientMockID: client},
+				Errors:    map[int]error{GetUserMockID: errors.New("error")},
+			},
+			want1: apierror.NewInternalServerApiError(domain.ErrUnexpectedError, errors.New("error"), domain.ErrInternalCode),
+		},
+		{
+			name:       "user_not_found",
+			secret:     "secret",
+			token:      token,
+			repository: &MockRepository{Responses: map[int]interface{}{GetClientMockID: client}},
+			want:       inactive,
+		},
+		{
+			name:   "deleted_user",
+			secret: "secret",
+			token:  token,
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetClientMockID: client,
+				GetUserMockID:   &domain.User{AuthId: 123, DateDeleted: &time.Time{}},
+			}},
+			want: inactive,
+		},
+		{
+			name:   "locked_user",
+			secret: "secret",
+			token:  token,
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetClientMockID: client,
+				GetUserMockID:   &domain.User{AuthId: 123, LockoutEnabled: true, LockoutDate: sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}},
+			}},
+			want: inactive,
+		},
+		{
+			name:   "lockout_ended",
+			secret: "secret",
+			token:  token,
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetClientMockID: client,
+				GetUserMockID:   &domain.User{AuthId: 123, Username: "test", LockoutEnabled: true, LockoutDate: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}},
+			}},
+			want: &domain.IntrospectionResponse{
+				Active: true, Scope: "admin editor", ClientId: "audience", Username: "test", TokenType: "Bearer",
+				Exp: claims.ExpiresAt, Iat: claims.IssuedAt, Nbf: claims.NotBefore, Sub: "123", Aud: "audience", Iss: "issuer",
+				Jti: claims.Id, Roles: roles,
+			},
+		},
+		{
+			name:       "active",
+			secret:     "secret",
+			token:      token,
+			repository: &MockRepository{Responses: map[int]interface{}{GetClientMockID: client, GetUserMockID: user}},
+			want: &domain.IntrospectionResponse{
+				Active: true, Scope: "admin editor", ClientId: "audience", Username: "test", TokenType: "Bearer",
+				Exp: claims.ExpiresAt, Iat: claims.IssuedAt, Nbf: claims.NotBefore, Sub: "123", Aud: "audience", Iss: "issuer",
+				Jti: claims.Id, Roles: roles,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService(tt.repository, tt.repository, auth.NewVerifier(cfg, signer, revocations))
+
+			got, got1 := s.Introspect(context.Background(), "roles", tt.secret, tt.token, &middleware.ContextInformation{})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("introspectionService.Introspect(context.Background(), ) got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("introspectionService.Introspect(context.Background(), ) got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
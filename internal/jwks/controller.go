@@ -0,0 +1,25 @@
+package jwks
+
+import (
+	"net/http"
+
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/gin-gonic/gin"
+)
+
+// cacheControl Verifiers may cache the keys for a while, new keys are published before they're used to sign.
+const cacheControl = "public, max-age=300"
+
+type jwksController struct {
+	signer encryption.Signer
+}
+
+func NewController(s encryption.Signer) Controller {
+	return &jwksController{signer: s}
+}
+
+// GetJWKS Publishes the public keys used to sign tokens
+func (j *jwksController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", cacheControl)
+	c.JSON(http.StatusOK, j.signer.JWKS())
+}
@@ -0,0 +1,80 @@
+package jwks
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+type MockSigner struct {
+	Keys *encryption.JSONWebKeySet
+}
+
+func (m *MockSigner) Sign(claims jwt.Claims) (string, error) {
+	return "", nil
+}
+
+func (m *MockSigner) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return nil, nil
+}
+
+func (m *MockSigner) JWKS() *encryption.JSONWebKeySet {
+	return m.Keys
+}
+
+func Test_jwksController_GetJWKS(t *testing.T) {
+	tests := []struct {
+		name         string
+		keys         *encryption.JSONWebKeySet
+		expectedBody string
+	}{
+		{
+			name:         "no_keys",
+			keys:         &encryption.JSONWebKeySet{Keys: []encryption.JSONWebKey{}},
+			expectedBody: `{"keys":[]}`,
+		},
+		{
+			name: "ok",
+			keys: &encryption.JSONWebKeySet{Keys: []encryption.JSONWebKey{
+				{Kty: "OKP", Kid: "kid", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: "x"},
+			}},
+			expectedBody: `{"keys":[{"kty":"OKP","kid":"kid","use":"sig","alg":"EdDSA","crv":"Ed25519","x":"x"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+
+			NewController(&MockSigner{Keys: tt.keys}).GetJWKS(c)
+
+			response := w.Result()
+			if response.StatusCode != http.StatusOK {
+				t.Errorf("[GetJWKS] Expected status code = %v, got %v", http.StatusOK, response.StatusCode)
+				return
+			}
+
+			if response.Header.Get("Cache-Control") != cacheControl {
+				t.Errorf("[GetJWKS] Expected Cache-Control = %v, got %v", cacheControl, response.Header.Get("Cache-Control"))
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body)
+
+			var got, expected interface{}
+			json.Unmarshal(buf.Bytes(), &got)
+			json.Unmarshal([]byte(tt.expectedBody), &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("[GetJWKS] Expected body = %v, got %v", tt.expectedBody, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package jwks
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+type Controller interface {
+	GetJWKS(c *gin.Context)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/performance"
+	"github.com/CienciaArgentina/go-enigma/internal/auth"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
 	"github.com/gin-gonic/gin"
 )
@@ -21,22 +22,234 @@ func NewController(s Service) Controller {
 
 func (l *loginController) Login(c *gin.Context) {
 	var usr domain.UserLoginDTO
-	ctx := middleware.GetContextInformation("login", c)
+	info := middleware.GetContextInformation("login", c)
 
 	if err := c.ShouldBindJSON(&usr); err != nil {
 		c.JSON(http.StatusBadRequest, apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)))
 		return
 	}
 
-	var jwt string
+	var tokens *domain.TokenResponse
 	var apierr apierror.ApiError
-	performance.TrackTime(time.Now(), "CompleteLogin", ctx, func() {
-		jwt, apierr = l.svc.LoginUser(&usr, ctx)
+	performance.TrackTime(time.Now(), "CompleteLogin", info, func() {
+		tokens, apierr = l.svc.LoginUser(c.Request.Context(), &usr, clientInfo(c), info)
 	})
 	if apierr != nil {
 		c.JSON(apierr.Status(), apierr)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"jwt": jwt})
+	c.JSON(http.StatusOK, tokens)
+}
+
+// LoginMFA Second step of the login for users with two-factor authentication
+func (l *loginController) LoginMFA(c *gin.Context) {
+	var dto domain.MFALoginDTO
+	info := middleware.GetContextInformation("LoginMFA", c)
+
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)))
+		return
+	}
+
+	var tokens *domain.TokenResponse
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "LoginMFA", info, func() {
+		tokens, apierr = l.svc.LoginMFA(c.Request.Context(), &dto, clientInfo(c), info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// LoginWebAuthn Passwordless login with a passkey
+func (l *loginController) LoginWebAuthn(c *gin.Context) {
+	var dto domain.AssertionCredentialDTO
+	info := middleware.GetContextInformation("LoginWebAuthn", c)
+
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)))
+		return
+	}
+
+	var tokens *domain.TokenResponse
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "LoginWebAuthn", info, func() {
+		tokens, apierr = l.svc.LoginWebAuthn(c.Request.Context(), &dto, clientInfo(c), info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// SendMagicLink Emails the user a link to log in without the password
+func (l *loginController) SendMagicLink(c *gin.Context) {
+	var dto domain.MagicLinkDTO
+	info := middleware.GetContextInformation("SendMagicLink", c)
+
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)))
+		return
+	}
+
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "SendMagicLink", info, func() {
+		apierr = l.svc.SendMagicLink(c.Request.Context(), dto.Email, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// LoginMagicLink Exchanges the token of the emailed link for the tokens
+func (l *loginController) LoginMagicLink(c *gin.Context) {
+	var dto domain.MagicLinkLoginDTO
+	info := middleware.GetContextInformation("LoginMagicLink", c)
+
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)))
+		return
+	}
+
+	var tokens *domain.TokenResponse
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "LoginMagicLink", info, func() {
+		tokens, apierr = l.svc.LoginMagicLink(c.Request.Context(), dto.Token, clientInfo(c), info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (l *loginController) RefreshToken(c *gin.Context) {
+	var dto domain.RefreshTokenDTO
+	info := middleware.GetContextInformation("RefreshToken", c)
+
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)))
+		return
+	}
+
+	var tokens *domain.TokenResponse
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "RefreshToken", info, func() {
+		tokens, apierr = l.svc.RefreshToken(c.Request.Context(), dto.RefreshToken, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout Ends the session the access token belongs to, revoking its refresh token and every access token issued with it
+func (l *loginController) Logout(c *gin.Context) {
+	info := middleware.GetContextInformation("Logout", c)
+
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode)))
+		return
+	}
+
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "Logout", info, func() {
+		apierr = l.svc.Logout(c.Request.Context(), claims, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// LogoutAll Ends every session of the user
+func (l *loginController) LogoutAll(c *gin.Context) {
+	info := middleware.GetContextInformation("LogoutAll", c)
+
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode)))
+		return
+	}
+
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "LogoutAll", info, func() {
+		apierr = l.svc.LogoutAll(c.Request.Context(), claims, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// GetSessions Lists the sessions of the user
+func (l *loginController) GetSessions(c *gin.Context) {
+	info := middleware.GetContextInformation("GetSessions", c)
+
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode)))
+		return
+	}
+
+	var sessions []domain.Session
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "GetSessions", info, func() {
+		sessions, apierr = l.svc.GetSessions(c.Request.Context(), claims, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession Revokes one of the user's sessions, logging that device out
+func (l *loginController) RevokeSession(c *gin.Context) {
+	info := middleware.GetContextInformation("RevokeSession", c)
+
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode)))
+		return
+	}
+
+	sessionID := c.Param("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, apierror.NewBadRequestApiError(domain.ErrEmptyField))
+		return
+	}
+
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "RevokeSession", info, func() {
+		apierr = l.svc.RevokeSession(c.Request.Context(), claims, sessionID, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func clientInfo(c *gin.Context) *domain.ClientInfo {
+	return &domain.ClientInfo{UserAgent: c.Request.UserAgent(), IPAddress: c.ClientIP()}
 }
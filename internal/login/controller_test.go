@@ -2,6 +2,7 @@ package login
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -11,14 +12,27 @@ import (
 	"testing"
 
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
-	"github.com/CienciaArgentina/go-backend-commons/pkg/rest"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-enigma/internal/auth"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/internal/mfa"
+	"github.com/CienciaArgentina/go-enigma/internal/webauthn"
 	"github.com/gin-gonic/gin"
 )
 
 const (
 	LoginUserMockID = iota
 	UserCanLoginMockID
+	RefreshTokenMockID
+	LogoutMockID
+	LogoutAllMockID
+	GetSessionsMockID
+	RevokeSessionServiceMockID
+	LoginMFAMockID
+	LoginWebAuthnMockID
+	SendMagicLinkMockID
+	LoginMagicLinkMockID
 )
 
 type MockService struct {
@@ -26,14 +40,54 @@ type MockService struct {
 	Errors    map[int]apierror.ApiError
 }
 
-func (m *MockService) LoginUser(user *domain.UserLoginDTO, ctx *rest.ContextInformation) (string, apierror.ApiError) {
-	return m.Responses[LoginUserMockID].(string), m.Errors[LoginUserMockID]
+func (m *MockService) LoginUser(ctx context.Context, user *domain.UserLoginDTO, client *domain.ClientInfo, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) {
+	return m.Responses[LoginUserMockID].(*domain.TokenResponse), m.Errors[LoginUserMockID]
+}
+
+func (m *MockService) LoginMFA(ctx context.Context, dto *domain.MFALoginDTO, client *domain.ClientInfo, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) {
+	tokens, _ := m.Responses[LoginMFAMockID].(*domain.TokenResponse)
+	return tokens, m.Errors[LoginMFAMockID]
+}
+
+func (m *MockService) LoginWebAuthn(ctx context.Context, dto *domain.AssertionCredentialDTO, client *domain.ClientInfo, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) {
+	tokens, _ := m.Responses[LoginWebAuthnMockID].(*domain.TokenResponse)
+	return tokens, m.Errors[LoginWebAuthnMockID]
+}
+
+func (m *MockService) SendMagicLink(ctx context.Context, email string, info *middleware.ContextInformation) apierror.ApiError {
+	return m.Errors[SendMagicLinkMockID]
+}
+
+func (m *MockService) LoginMagicLink(ctx context.Context, token string, client *domain.ClientInfo, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) {
+	tokens, _ := m.Responses[LoginMagicLinkMockID].(*domain.TokenResponse)
+	return tokens, m.Errors[LoginMagicLinkMockID]
 }
 
 func (m *MockService) UserCanLogin(user *domain.UserLoginDTO) apierror.ApiError {
 	return m.Errors[UserCanLoginMockID]
 }
 
+func (m *MockService) RefreshToken(ctx context.Context, refreshToken string, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) {
+	return m.Responses[RefreshTokenMockID].(*domain.TokenResponse), m.Errors[RefreshTokenMockID]
+}
+
+func (m *MockService) Logout(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) apierror.ApiError {
+	return m.Errors[LogoutMockID]
+}
+
+func (m *MockService) LogoutAll(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) apierror.ApiError {
+	return m.Errors[LogoutAllMockID]
+}
+
+func (m *MockService) GetSessions(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) ([]domain.Session, apierror.ApiError) {
+	sessions, _ := m.Responses[GetSessionsMockID].([]domain.Session)
+	return sessions, m.Errors[GetSessionsMockID]
+}
+
+func (m *MockService) RevokeSession(ctx context.Context, claims *encryption.AccessTokenClaims, sessionID string, info *middleware.ContextInformation) apierror.ApiError {
+	return m.Errors[RevokeSessionServiceMockID]
+}
+
 func Test_loginController_Login(t *testing.T) {
 	type fields struct {
 		svc Service
@@ -71,7 +125,7 @@ func Test_loginController_Login(t *testing.T) {
 			fields: fields{
 				svc: &MockService{
 					Responses: map[int]interface{}{
-						LoginUserMockID: "test",
+						LoginUserMockID: &domain.TokenResponse{AccessToken: "test"},
 					},
 					Errors: map[int]apierror.ApiError{
 						LoginUserMockID: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
@@ -87,7 +141,7 @@ func Test_loginController_Login(t *testing.T) {
 			fields: fields{
 				svc: &MockService{
 					Responses: map[int]interface{}{
-						LoginUserMockID: "test",
+						LoginUserMockID: &domain.TokenResponse{AccessToken: "test"},
 					},
 					Errors: map[int]apierror.ApiError{
 						LoginUserMockID: nil,
@@ -139,3 +193,500 @@ func Test_loginController_Login(t *testing.T) {
 		})
 	}
 }
+
+func Test_loginController_RefreshToken(t *testing.T) {
+	type fields struct {
+		svc Service
+	}
+	tests := []struct {
+		name           string
+		fields         fields
+		expectedBody   interface{}
+		expectedStatus int
+		requestBody    string
+	}{
+		{
+			name: "bad_request",
+			fields: fields{
+				svc: &MockService{},
+			},
+			requestBody:    `"}`,
+			expectedBody:   apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "invalid_refresh_token",
+			fields: fields{
+				svc: &MockService{
+					Responses: map[int]interface{}{
+						RefreshTokenMockID: (*domain.TokenResponse)(nil),
+					},
+					Errors: map[int]apierror.ApiError{
+						RefreshTokenMockID: apierror.New(http.StatusUnauthorized, ErrInvalidRefreshToken, apierror.NewErrorCause(ErrInvalidRefreshToken, ErrInvalidRefreshTokenCode)),
+					},
+				},
+			},
+			requestBody:    `{"refresh_token": "test"}`,
+			expectedBody:   apierror.New(http.StatusUnauthorized, ErrInvalidRefreshToken, apierror.NewErrorCause(ErrInvalidRefreshToken, ErrInvalidRefreshTokenCode)),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "ok",
+			fields: fields{
+				svc: &MockService{
+					Responses: map[int]interface{}{
+						RefreshTokenMockID: &domain.TokenResponse{AccessToken: "jwt", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"},
+					},
+					Errors: map[int]apierror.ApiError{
+						RefreshTokenMockID: nil,
+					},
+				},
+			},
+			requestBody:    `{"refresh_token": "test"}`,
+			expectedBody:   &domain.TokenResponse{AccessToken: "jwt", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			req, err := http.NewRequest(http.MethodPost, "/users/token/refresh", strings.NewReader(tt.requestBody))
+			if err != nil {
+				panic(err)
+			}
+			c.Request = req
+
+			ctr := NewController(tt.fields.svc)
+
+			ctr.RefreshToken(c)
+
+			response := w.Result()
+
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[RefreshToken] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body)
+			body := buf.String()
+
+			expected, _ := json.Marshal(tt.expectedBody)
+			if !reflect.DeepEqual(body, string(expected)) {
+				t.Errorf("[RefreshToken] Expected body = %v, got %v", string(expected), body)
+				return
+			}
+		})
+	}
+}
+
+func Test_loginController_LoginMFA(t *testing.T) {
+	invalidCode := apierror.New(http.StatusBadRequest, mfa.ErrInvalidMFACode, apierror.NewErrorCause(mfa.ErrInvalidMFACode, mfa.ErrInvalidMFACodeCode))
+
+	tests := []struct {
+		name           string
+		svc            *MockService
+		expectedBody   interface{}
+		expectedStatus int
+		requestBody    string
+	}{
+		{
+			name:           "bad_request",
+			svc:            &MockService{},
+			requestBody:    `"}`,
+			expectedBody:   apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid_code",
+			svc:            &MockService{Errors: map[int]apierror.ApiError{LoginMFAMockID: invalidCode}},
+			requestBody:    `{"mfa_token": "token", "code": "123456"}`,
+			expectedBody:   invalidCode,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "ok",
+			svc: &MockService{Responses: map[int]interface{}{
+				LoginMFAMockID: &domain.TokenResponse{AccessToken: "jwt", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"},
+			}},
+			requestBody:    `{"mfa_token": "token", "code": "123456"}`,
+			expectedBody:   &domain.TokenResponse{AccessToken: "jwt", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/users/login/mfa", strings.NewReader(tt.requestBody))
+
+			NewController(tt.svc).LoginMFA(c)
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[LoginMFA] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body) // nolint
+			if body := buf.String(); body != marshal(tt.expectedBody) {
+				t.Errorf("[LoginMFA] Expected body = %v, got %v", marshal(tt.expectedBody), body)
+			}
+		})
+	}
+}
+
+func Test_loginController_Logout(t *testing.T) {
+	unauthorized := apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode))
+	internal := apierror.NewInternalServerApiError(domain.ErrUnexpectedError, errors.New("error"), domain.ErrInternalCode)
+
+	tests := []struct {
+		name           string
+		svc            Service
+		claims         *encryption.AccessTokenClaims
+		all            bool
+		expectedBody   string
+		expectedStatus int
+	}{
+		{
+			name:           "no_claims",
+			svc:            &MockService{},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   marshal(unauthorized),
+		},
+		{
+			name:           "service_error",
+			svc:            &MockService{Errors: map[int]apierror.ApiError{LogoutMockID: internal}},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   marshal(internal),
+		},
+		{
+			name:           "ok",
+			svc:            &MockService{},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "all_service_error",
+			svc:            &MockService{Errors: map[int]apierror.ApiError{LogoutAllMockID: internal}},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			all:            true,
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   marshal(internal),
+		},
+		{
+			name:           "all_ok",
+			svc:            &MockService{},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			all:            true,
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/users/logout", nil)
+			if tt.claims != nil {
+				auth.SetClaims(c, tt.claims)
+			}
+
+			ctr := NewController(tt.svc)
+			if tt.all {
+				ctr.LogoutAll(c)
+			} else {
+				ctr.Logout(c)
+			}
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[Logout] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body)
+			if buf.String() != tt.expectedBody {
+				t.Errorf("[Logout] Expected body = %v, got %v", tt.expectedBody, buf.String())
+			}
+		})
+	}
+}
+
+func marshal(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func Test_loginController_GetSessions(t *testing.T) {
+	internal := apierror.NewInternalServerApiError(domain.ErrUnexpectedError, errors.New("error"), domain.ErrInternalCode)
+	sessions := []domain.Session{{SessionId: "family", UserAgent: "curl", IPAddress: "127.0.0.1", DateCreated: "2020-10-01 10:00:00", DateLastRefresh: "2020-10-01 10:15:00", Current: true}}
+
+	tests := []struct {
+		name           string
+		svc            Service
+		claims         *encryption.AccessTokenClaims
+		expectedBody   string
+		expectedStatus int
+	}{
+		{
+			name:           "no_claims",
+			svc:            &MockService{},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   marshal(apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode))),
+		},
+		{
+			name:           "service_error",
+			svc:            &MockService{Errors: map[int]apierror.ApiError{GetSessionsMockID: internal}},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   marshal(internal),
+		},
+		{
+			name:           "ok",
+			svc:            &MockService{Responses: map[int]interface{}{GetSessionsMockID: sessions}},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"session_id":"family","user_agent":"curl","ip_address":"127.0.0.1","date_created":"2020-10-01 10:00:00","date_last_refresh":"2020-10-01 10:15:00","current":true}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/sessions", nil)
+			if tt.claims != nil {
+				auth.SetClaims(c, tt.claims)
+			}
+
+			NewController(tt.svc).GetSessions(c)
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[GetSessions] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body)
+			if buf.String() != tt.expectedBody {
+				t.Errorf("[GetSessions] Expected body = %v, got %v", tt.expectedBody, buf.String())
+			}
+		})
+	}
+}
+
+func Test_loginController_RevokeSession(t *testing.T) {
+	notFound := apierror.New(http.StatusNotFound, ErrSessionNotFound, apierror.NewErrorCause(ErrSessionNotFound, ErrSessionNotFoundCode))
+
+	tests := []struct {
+		name           string
+		svc            Service
+		sessionID      string
+		expectedBody   string
+		expectedStatus int
+	}{
+		{
+			name:           "empty_session",
+			svc:            &MockService{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   marshal(apierror.NewBadRequestApiError(domain.ErrEmptyField)),
+		},
+		{
+			name:           "not_found",
+			svc:            &MockService{Errors: map[int]apierror.ApiError{RevokeSessionServiceMockID: notFound}},
+			sessionID:      "family",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   marshal(notFound),
+		},
+		{
+			name:           "ok",
+			svc:            &MockService{},
+			sessionID:      "family",
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodDelete, "/sessions/"+tt.sessionID, nil)
+			c.Params = gin.Params{{Key: "session_id", Value: tt.sessionID}}
+			auth.SetClaims(c, &encryption.AccessTokenClaims{AuthId: 123})
+
+			NewController(tt.svc).RevokeSession(c)
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[RevokeSession] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body)
+			if buf.String() != tt.expectedBody {
+				t.Errorf("[RevokeSession] Expected body = %v, got %v", tt.expectedBody, buf.String())
+			}
+		})
+	}
+}
+
+func Test_loginController_LoginWebAuthn(t *testing.T) {
+	invalid := apierror.New(http.StatusUnauthorized, webauthn.ErrInvalidCredential, apierror.NewErrorCause(webauthn.ErrInvalidCredential, webauthn.ErrInvalidCredentialCode))
+	assertion := `{"id": "id", "rawId": "id", "type": "public-key", "response": {"clientDataJSON": "e30", "authenticatorData": "", "signature": ""}}`
+
+	tests := []struct {
+		name           string
+		svc            *MockService
+		expectedBody   interface{}
+		expectedStatus int
+		requestBody    string
+	}{
+		{
+			name:           "bad_request",
+			svc:            &MockService{},
+			requestBody:    `"}`,
+			expectedBody:   apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid_credential",
+			svc:            &MockService{Errors: map[int]apierror.ApiError{LoginWebAuthnMockID: invalid}},
+			requestBody:    assertion,
+			expectedBody:   invalid,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "ok",
+			svc: &MockService{Responses: map[int]interface{}{
+				LoginWebAuthnMockID: &domain.TokenResponse{AccessToken: "jwt", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"},
+			}},
+			requestBody:    assertion,
+			expectedBody:   &domain.TokenResponse{AccessToken: "jwt", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/users/login/webauthn", strings.NewReader(tt.requestBody))
+
+			NewController(tt.svc).LoginWebAuthn(c)
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[LoginWebAuthn] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body) // nolint
+			if body := buf.String(); body != marshal(tt.expectedBody) {
+				t.Errorf("[LoginWebAuthn] Expected body = %v, got %v", marshal(tt.expectedBody), body)
+			}
+		})
+	}
+}
+
+func Test_loginController_SendMagicLink(t *testing.T) {
+	tests := []struct {
+		name           string
+		svc            *MockService
+		expectedStatus int
+		requestBody    string
+	}{
+		{
+			name:           "bad_request",
+			svc:            &MockService{},
+			requestBody:    `"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty_email",
+			svc:            &MockService{Errors: map[int]apierror.ApiError{SendMagicLinkMockID: apierror.NewBadRequestApiError(domain.ErrEmptyEmail)}},
+			requestBody:    `{"email": ""}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "ok",
+			svc:            &MockService{},
+			requestBody:    `{"email": "test@test.com"}`,
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/users/login/magic_link", strings.NewReader(tt.requestBody))
+
+			NewController(tt.svc).SendMagicLink(c)
+
+			if response := w.Result(); response.StatusCode != tt.expectedStatus {
+				t.Errorf("[SendMagicLink] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+			}
+		})
+	}
+}
+
+func Test_loginController_LoginMagicLink(t *testing.T) {
+	invalid := apierror.New(http.StatusUnauthorized, ErrInvalidMagicLink, apierror.NewErrorCause(ErrInvalidMagicLink, ErrInvalidMagicLinkCode))
+
+	tests := []struct {
+		name           string
+		svc            *MockService
+		expectedBody   interface{}
+		expectedStatus int
+		requestBody    string
+	}{
+		{
+			name:           "bad_request",
+			svc:            &MockService{},
+			requestBody:    `"}`,
+			expectedBody:   apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid_link",
+			svc:            &MockService{Errors: map[int]apierror.ApiError{LoginMagicLinkMockID: invalid}},
+			requestBody:    `{"token": "token"}`,
+			expectedBody:   invalid,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "ok",
+			svc: &MockService{Responses: map[int]interface{}{
+				LoginMagicLinkMockID: &domain.TokenResponse{AccessToken: "jwt", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"},
+			}},
+			requestBody:    `{"token": "token"}`,
+			expectedBody:   &domain.TokenResponse{AccessToken: "jwt", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/users/login/magic_link/consume", strings.NewReader(tt.requestBody))
+
+			NewController(tt.svc).LoginMagicLink(c)
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[LoginMagicLink] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body) // nolint
+			if body := buf.String(); body != marshal(tt.expectedBody) {
+				t.Errorf("[LoginMagicLink] Expected body = %v, got %v", marshal(tt.expectedBody), body)
+			}
+		})
+	}
+}
@@ -1,27 +1,71 @@
 package login
 
 import (
+	"context"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
 	"time"
 
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
 	domain2 "github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
 	"github.com/gin-gonic/gin"
 )
 
 type Repository interface {
-	GetUserByUsername(username string) (*domain2.User, *domain2.UserEmail, apierror.ApiError)
-	IncrementLoginFailAttempt(userID int64) error
-	ResetLoginFails(userID int64) error
-	UnlockAccount(userID int64) error
-	LockAccount(userID int64, duration time.Duration) error
+	IncrementLoginFailAttempt(ctx context.Context, userID int64) error
+	ResetLoginFails(ctx context.Context, userID int64) error
+	UnlockAccount(ctx context.Context, userID int64) error
+	LockAccount(ctx context.Context, userID int64, duration time.Duration) error
+	UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error
+	AddRefreshToken(ctx context.Context, token *domain2.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*domain2.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, refreshTokenID int64) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int64) error
+	GetFamilyAccessTokens(ctx context.Context, familyID string) ([]domain2.RefreshToken, error)
+	GetUserAccessTokens(ctx context.Context, userID int64) ([]domain2.RefreshToken, error)
+	AddSession(ctx context.Context, session *domain2.Session) error
+	UpdateSessionLastRefresh(ctx context.Context, sessionID string) error
+	GetSession(ctx context.Context, sessionID string) (*domain2.Session, error)
+	GetUserSessions(ctx context.Context, userID int64, activeSince time.Time) ([]domain2.Session, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeUserSessions(ctx context.Context, userID int64) error
+	AddMagicLink(ctx context.Context, link *domain2.MagicLink) error
+	GetMagicLink(ctx context.Context, tokenHash string) (*domain2.MagicLink, error)
+	UseMagicLink(ctx context.Context, magicLinkID int64) (bool, error)
+}
+
+// UserStore The lookups of users.UserStore that login needs
+type UserStore interface {
+	GetUser(ctx context.Context, userID int64) (*domain2.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*domain2.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain2.User, error)
+	GetEmail(ctx context.Context, userID int64) (*domain2.UserEmail, error)
 }
 
 type Service interface {
-	LoginUser(user *domain2.UserLoginDTO, ctx *middleware.ContextInformation) (string, apierror.ApiError)
+	LoginUser(ctx context.Context, user *domain2.UserLoginDTO, client *domain2.ClientInfo, info *middleware.ContextInformation) (*domain2.TokenResponse, apierror.ApiError)
+	LoginMFA(ctx context.Context, dto *domain2.MFALoginDTO, client *domain2.ClientInfo, info *middleware.ContextInformation) (*domain2.TokenResponse, apierror.ApiError)
+	LoginWebAuthn(ctx context.Context, dto *domain2.AssertionCredentialDTO, client *domain2.ClientInfo, info *middleware.ContextInformation) (*domain2.TokenResponse, apierror.ApiError)
+	SendMagicLink(ctx context.Context, email string, info *middleware.ContextInformation) apierror.ApiError
+	LoginMagicLink(ctx context.Context, token string, client *domain2.ClientInfo, info *middleware.ContextInformation) (*domain2.TokenResponse, apierror.ApiError)
 	UserCanLogin(user *domain2.UserLoginDTO) apierror.ApiError
+	RefreshToken(ctx context.Context, refreshToken string, info *middleware.ContextInformation) (*domain2.TokenResponse, apierror.ApiError)
+	Logout(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) apierror.ApiError
+	LogoutAll(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) apierror.ApiError
+	GetSessions(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) ([]domain2.Session, apierror.ApiError)
+	RevokeSession(ctx context.Context, claims *encryption.AccessTokenClaims, sessionID string, info *middleware.ContextInformation) apierror.ApiError
 }
 
 type Controller interface {
 	Login(c *gin.Context)
+	LoginMFA(c *gin.Context)
+	LoginWebAuthn(c *gin.Context)
+	SendMagicLink(c *gin.Context)
+	LoginMagicLink(c *gin.Context)
+	RefreshToken(c *gin.Context)
+	Logout(c *gin.Context)
+	LogoutAll(c *gin.Context)
+	GetSessions(c *gin.Context)
+	RevokeSession(c *gin.Context)
 }
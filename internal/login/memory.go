@@ -0,0 +1,325 @@
+package login
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	domain2 "github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage/memory"
+)
+
+type memoryRepository struct {
+	store *memory.Store
+}
+
+// NewMemoryRepository Returns a login repository that keeps the tokens and sessions in store
+func NewMemoryRepository(store *memory.Store) Repository {
+	return &memoryRepository{store: store}
+}
+
+func (m *memoryRepository) IncrementLoginFailAttempt(ctx context.Context, userID int64) error {
+	m.updateUser(userID, func(user *domain2.User) {
+		user.FailedLoginAttempts++
+	})
+	return nil
+}
+
+func (m *memoryRepository) ResetLoginFails(ctx context.Context, userID int64) error {
+	m.updateUser(userID, func(user *domain2.User) {
+		user.FailedLoginAttempts = 0
+	})
+	return nil
+}
+
+func (m *memoryRepository) UnlockAccount(ctx context.Context, userID int64) error {
+	m.updateUser(userID, func(user *domain2.User) {
+		user.LockoutEnabled = false
+		user.LockoutDate = sql.NullTime{}
+		user.FailedLoginAttempts = 0
+	})
+	return nil
+}
+
+func (m *memoryRepository) LockAccount(ctx context.Context, userID int64, duration time.Duration) error {
+	m.updateUser(userID, func(user *domain2.User) {
+		user.LockoutEnabled = true
+		user.LockoutDate = sql.NullTime{Time: time.Now().Add(duration), Valid: true}
+	})
+	return nil
+}
+
+func (m *memoryRepository) UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error {
+	m.updateUser(userID, func(user *domain2.User) {
+		user.PasswordHash = passwordHash
+	})
+	return nil
+}
+
+// updateUser Changes the user if they exist, an UPDATE that matches no rows isn't an error
+func (m *memoryRepository) updateUser(userID int64, update func(user *domain2.User)) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	user, ok := m.store.Users[userID]
+	if !ok {
+		return
+	}
+
+	update(&user)
+	m.store.Users[userID] = user
+}
+
+func (m *memoryRepository) AddRefreshToken(ctx context.Context, token *domain2.RefreshToken) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	if _, ok := m.store.Users[token.UserId]; !ok {
+		return memory.ErrForeignKeyViolation
+	}
+	for _, t := range m.store.RefreshTokens {
+		if t.TokenHash == token.TokenHash {
+			return memory.ErrUniqueViolation
+		}
+	}
+
+	token.RefreshTokenId = m.store.NextID("users_refresh_token")
+	m.store.RefreshTokens[token.RefreshTokenId] = domain2.RefreshToken{
+		RefreshTokenId:        token.RefreshTokenId,
+		UserId:                token.UserId,
+		FamilyId:              token.FamilyId,
+		TokenHash:             token.TokenHash,
+		ExpiryDate:            token.ExpiryDate,
+		DateCreated:           memory.Timestamp(time.Now()),
+		AccessTokenId:         token.AccessTokenId,
+		AccessTokenExpiryDate: token.AccessTokenExpiryDate,
+	}
+
+	return nil
+}
+
+func (m *memoryRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*domain2.RefreshToken, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	for _, token := range m.store.RefreshTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (m *memoryRepository) RevokeRefreshToken(ctx context.Context, refreshTokenID int64) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	token, ok := m.store.RefreshTokens[refreshTokenID]
+	if !ok || token.DateRevoked.Valid {
+		return false, nil
+	}
+
+	token.DateRevoked = sql.NullTime{Time: time.Now(), Valid: true}
+	m.store.RefreshTokens[refreshTokenID] = token
+	return true, nil
+}
+
+func (m *memoryRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	m.revokeRefreshTokens(func(token domain2.RefreshToken) bool { return token.FamilyId == familyID })
+	return nil
+}
+
+func (m *memoryRepository) RevokeUserRefreshTokens(ctx context.Context, userID int64) error {
+	m.revokeRefreshTokens(func(token domain2.RefreshToken) bool { return token.UserId == userID })
+	return nil
+}
+
+func (m *memoryRepository) revokeRefreshTokens(match func(token domain2.RefreshToken) bool) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	now := time.Now()
+	for id, token := range m.store.RefreshTokens {
+		if match(token) && !token.DateRevoked.Valid {
+			token.DateRevoked = sql.NullTime{Time: now, Valid: true}
+			m.store.RefreshTokens[id] = token
+		}
+	}
+}
+
+func (m *memoryRepository) GetFamilyAccessTokens(ctx context.Context, familyID string) ([]domain2.RefreshToken, error) {
+	return m.accessTokens(func(token domain2.RefreshToken) bool { return token.FamilyId == familyID }), nil
+}
+
+func (m *memoryRepository) GetUserAccessTokens(ctx context.Context, userID int64) ([]domain2.RefreshToken, error) {
+	return m.accessTokens(func(token domain2.RefreshToken) bool { return token.UserId == userID }), nil
+}
+
+// accessTokens Returns the matching refresh tokens whose access token hasn't expired, ordered by id
+func (m *memoryRepository) accessTokens(match func(token domain2.RefreshToken) bool) []domain2.RefreshToken {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	var tokens []domain2.RefreshToken
+	now := time.Now()
+	for _, token := range m.store.RefreshTokens {
+		if match(token) && token.AccessTokenExpiryDate.Valid && token.AccessTokenExpiryDate.Time.After(now) {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].RefreshTokenId < tokens[j].RefreshTokenId })
+
+	return tokens
+}
+
+func (m *memoryRepository) AddSession(ctx context.Context, session *domain2.Session) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	if _, ok := m.store.Users[session.UserId]; !ok {
+		return memory.ErrForeignKeyViolation
+	}
+	if _, ok := m.store.Sessions[session.SessionId]; ok {
+		return memory.ErrUniqueViolation
+	}
+
+	now := memory.Timestamp(time.Now())
+	m.store.Sessions[session.SessionId] = domain2.Session{
+		SessionId:       session.SessionId,
+		UserId:          session.UserId,
+		UserAgent:       session.UserAgent,
+		IPAddress:       session.IPAddress,
+		DateCreated:     now,
+		DateLastRefresh: now,
+	}
+
+	return nil
+}
+
+func (m *memoryRepository) UpdateSessionLastRefresh(ctx context.Context, sessionID string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	if session, ok := m.store.Sessions[sessionID]; ok {
+		session.DateLastRefresh = memory.Timestamp(time.Now())
+		m.store.Sessions[sessionID] = session
+	}
+
+	return nil
+}
+
+func (m *memoryRepository) GetSession(ctx context.Context, sessionID string) (*domain2.Session, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	session, ok := m.store.Sessions[sessionID]
+	if !ok {
+		return nil, nil
+	}
+
+	return &session, nil
+}
+
+func (m *memoryRepository) GetUserSessions(ctx context.Context, userID int64, activeSince time.Time) ([]domain2.Session, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	var sessions []domain2.Session
+	lastRefresh := map[string]time.Time{}
+	for _, session := range m.store.Sessions {
+		if session.UserId != userID || session.DateRevoked.Valid {
+			continue
+		}
+
+		refreshed, err := time.Parse(time.RFC3339Nano, session.DateLastRefresh)
+		if err != nil {
+			return nil, err
+		}
+		if refreshed.After(activeSince) {
+			sessions = append(sessions, session)
+			lastRefresh[session.SessionId] = refreshed
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return lastRefresh[sessions[i].SessionId].After(lastRefresh[sessions[j].SessionId])
+	})
+
+	return sessions, nil
+}
+
+func (m *memoryRepository) RevokeSession(ctx context.Context, sessionID string) error {
+	m.revokeSessions(func(session domain2.Session) bool { return session.SessionId == sessionID })
+	return nil
+}
+
+func (m *memoryRepository) RevokeUserSessions(ctx context.Context, userID int64) error {
+	m.revokeSessions(func(session domain2.Session) bool { return session.UserId == userID })
+	return nil
+}
+
+func (m *memoryRepository) revokeSessions(match func(session domain2.Session) bool) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	now := time.Now()
+	for id, session := range m.store.Sessions {
+		if match(session) && !session.DateRevoked.Valid {
+			session.DateRevoked = sql.NullTime{Time: now, Valid: true}
+			m.store.Sessions[id] = session
+		}
+	}
+}
+
+func (m *memoryRepository) AddMagicLink(ctx context.Context, link *domain2.MagicLink) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	if _, ok := m.store.Users[link.UserId]; !ok {
+		return memory.ErrForeignKeyViolation
+	}
+	for _, l := range m.store.MagicLinks {
+		if l.TokenHash == link.TokenHash {
+			return memory.ErrUniqueViolation
+		}
+	}
+
+	id := m.store.NextID("users_magic_link")
+	m.store.MagicLinks[id] = domain2.MagicLink{
+		MagicLinkId: id,
+		UserId:      link.UserId,
+		TokenHash:   link.TokenHash,
+		ExpiryDate:  link.ExpiryDate,
+		DateCreated: memory.Timestamp(time.Now()),
+	}
+
+	return nil
+}
+
+func (m *memoryRepository) GetMagicLink(ctx context.Context, tokenHash string) (*domain2.MagicLink, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	for _, link := range m.store.MagicLinks {
+		if link.TokenHash == tokenHash {
+			return &link, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (m *memoryRepository) UseMagicLink(ctx context.Context, magicLinkID int64) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	link, ok := m.store.MagicLinks[magicLinkID]
+	if !ok || link.DateUsed.Valid {
+		return false, nil
+	}
+
+	link.DateUsed = sql.NullTime{Time: time.Now(), Valid: true}
+	m.store.MagicLinks[magicLinkID] = link
+	return true, nil
+}
@@ -1,65 +1,277 @@
 package login
 
 import (
+	"context"
 	"database/sql"
-	"net/http"
 	"time"
 
-	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
 	domain2 "github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
 	"github.com/jmoiron/sqlx"
 )
 
 type loginRepository struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	timeout time.Duration
 }
 
-// NewRepository Returns new login repository
-func NewRepository(db *sqlx.DB) Repository {
-	return &loginRepository{db: db}
+// NewRepository Returns new login repository, whose queries give up after timeout
+func NewRepository(db *sqlx.DB, timeout time.Duration) Repository {
+	return &loginRepository{db: db, timeout: timeout}
 }
 
-// GetUserByUsername Returns user with given username
-func (l *loginRepository) GetUserByUsername(username string) (*domain2.User, *domain2.UserEmail, apierror.ApiError) {
-	var user domain2.User
+func (l *loginRepository) IncrementLoginFailAttempt(ctx context.Context, userID int64) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
 
-	err := l.db.Get(&user, "SELECT * FROM users where username = ?", username)
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users SET failed_login_attempts = failed_login_attempts + 1 where user_id = ?"), userID)
+	return err
+}
+
+func (l *loginRepository) ResetLoginFails(ctx context.Context, userID int64) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users SET failed_login_attempts = 0 where user_id = ?"), userID)
+	return err
+}
+
+func (l *loginRepository) UnlockAccount(ctx context.Context, userID int64) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users SET lockout_enabled = FALSE, lockout_date = null, failed_login_attempts = 0 where user_id = ?"), userID)
+	return err
+}
+
+func (l *loginRepository) LockAccount(ctx context.Context, userID int64, duration time.Duration) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users SET lockout_enabled = TRUE, lockout_date = ? where user_id = ?"), time.Now().Add(duration), userID)
+	return err
+}
+
+// UpdatePasswordHash Replaces the hash of the password, used to upgrade it to the current hashing params
+func (l *loginRepository) UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users SET password_hash = ? WHERE user_id = ?"), passwordHash, userID)
+	return err
+}
+
+// AddRefreshToken Stores a new refresh token
+func (l *loginRepository) AddRefreshToken(ctx context.Context, token *domain2.RefreshToken) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	id, err := storage.InsertID(ctx, l.db, "refresh_token_id", "INSERT INTO users_refresh_token (user_id, family_id, token_hash, expiry_date, access_token_id, access_token_expiry_date, date_created) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)",
+		token.UserId, token.FamilyId, token.TokenHash, token.ExpiryDate, token.AccessTokenId, token.AccessTokenExpiryDate)
+	if err != nil {
+		return err
+	}
+
+	token.RefreshTokenId = id
+	return nil
+}
+
+// GetRefreshToken Returns the refresh token with the given hash, nil if it doesn't exist
+func (l *loginRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*domain2.RefreshToken, error) {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	var token domain2.RefreshToken
+
+	err := l.db.GetContext(ctx, &token, l.db.Rebind("SELECT * FROM users_refresh_token WHERE token_hash = ?"), tokenHash)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, nil, apierror.New(http.StatusBadRequest, ErrInvalidLogin, apierror.NewErrorCause(ErrInvalidLogin, ErrInvalidLoginCode))
+			return nil, nil
 		}
-		return nil, nil, apierror.New(http.StatusInternalServerError, ErrFailedTryingToLogin, apierror.NewErrorCause(err.Error(), ErrUserFetchFailed))
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// RevokeRefreshToken Revokes a refresh token. Returns false if it was already revoked, which means it's being reused
+func (l *loginRepository) RevokeRefreshToken(ctx context.Context, refreshTokenID int64) (bool, error) {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	res, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users_refresh_token SET date_revoked = CURRENT_TIMESTAMP WHERE refresh_token_id = ? AND date_revoked IS NULL"), refreshTokenID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// RevokeRefreshTokenFamily Revokes every refresh token that descends from the same login
+func (l *loginRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users_refresh_token SET date_revoked = CURRENT_TIMESTAMP WHERE family_id = ? AND date_revoked IS NULL"), familyID)
+	return err
+}
+
+// RevokeUserRefreshTokens Revokes every refresh token of the user, logging them out of every device
+func (l *loginRepository) RevokeUserRefreshTokens(ctx context.Context, userID int64) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users_refresh_token SET date_revoked = CURRENT_TIMESTAMP WHERE user_id = ? AND date_revoked IS NULL"), userID)
+	return err
+}
+
+// GetFamilyAccessTokens Returns the refresh tokens of a login whose access token hasn't expired yet
+func (l *loginRepository) GetFamilyAccessTokens(ctx context.Context, familyID string) ([]domain2.RefreshToken, error) {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	var tokens []domain2.RefreshToken
+
+	err := l.db.SelectContext(ctx, &tokens, l.db.Rebind("SELECT * FROM users_refresh_token WHERE family_id = ? AND access_token_expiry_date > CURRENT_TIMESTAMP"), familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetUserAccessTokens Returns the refresh tokens of the user whose access token hasn't expired yet
+func (l *loginRepository) GetUserAccessTokens(ctx context.Context, userID int64) ([]domain2.RefreshToken, error) {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	var tokens []domain2.RefreshToken
+
+	err := l.db.SelectContext(ctx, &tokens, l.db.Rebind("SELECT * FROM users_refresh_token WHERE user_id = ? AND access_token_expiry_date > CURRENT_TIMESTAMP"), userID)
+	if err != nil {
+		return nil, err
 	}
 
-	var userEmail domain2.UserEmail
+	return tokens, nil
+}
+
+// AddSession Stores a new session
+func (l *loginRepository) AddSession(ctx context.Context, session *domain2.Session) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
 
-	err = l.db.Get(&userEmail, "SELECT * FROM users_email WHERE user_id = ?", user.AuthId)
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("INSERT INTO users_session (session_id, user_id, user_agent, ip_address, date_created, date_last_refresh) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)"),
+		session.SessionId, session.UserId, session.UserAgent, session.IPAddress)
+	return err
+}
+
+// UpdateSessionLastRefresh Records that the session's refresh token was just rotated
+func (l *loginRepository) UpdateSessionLastRefresh(ctx context.Context, sessionID string) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users_session SET date_last_refresh = CURRENT_TIMESTAMP WHERE session_id = ?"), sessionID)
+	return err
+}
+
+// GetSession Returns the session with the given ID, nil if it doesn't exist
+func (l *loginRepository) GetSession(ctx context.Context, sessionID string) (*domain2.Session, error) {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	var session domain2.Session
+
+	err := l.db.GetContext(ctx, &session, l.db.Rebind("SELECT * FROM users_session WHERE session_id = ?"), sessionID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, nil, apierror.New(http.StatusBadRequest, ErrInvalidLogin, apierror.NewErrorCause(ErrInvalidLogin, ErrInvalidLoginCode))
+			return nil, nil
 		}
-		return nil, nil, apierror.New(http.StatusInternalServerError, ErrFailedTryingToLogin, apierror.NewErrorCause(err.Error(), ErrEmailFetchFailed))
+		return nil, err
 	}
 
-	return &user, &userEmail, nil
+	return &session, nil
 }
 
-func (l *loginRepository) IncrementLoginFailAttempt(userID int64) error {
-	_, err := l.db.Exec("UPDATE users SET failed_login_attempts = failed_login_attempts + 1 where user_id = ?", userID)
-	return err
+// GetUserSessions Returns the sessions of the user that weren't revoked and were refreshed after activeSince
+func (l *loginRepository) GetUserSessions(ctx context.Context, userID int64, activeSince time.Time) ([]domain2.Session, error) {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	var sessions []domain2.Session
+
+	err := l.db.SelectContext(ctx, &sessions, l.db.Rebind("SELECT * FROM users_session WHERE user_id = ? AND date_revoked IS NULL AND date_last_refresh > ? ORDER BY date_last_refresh DESC"), userID, activeSince)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
 }
 
-func (l *loginRepository) ResetLoginFails(userID int64) error {
-	_, err := l.db.Exec("UPDATE users SET failed_login_attempts = 0 where user_id = ?", userID)
+// RevokeSession Marks the session as revoked
+func (l *loginRepository) RevokeSession(ctx context.Context, sessionID string) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users_session SET date_revoked = CURRENT_TIMESTAMP WHERE session_id = ? AND date_revoked IS NULL"), sessionID)
 	return err
 }
 
-func (l *loginRepository) UnlockAccount(userID int64) error {
-	_, err := l.db.Exec("UPDATE users SET lockout_enabled = 0, lockout_date = null, failed_login_attempts = 0 where user_id = ?", userID)
+// RevokeUserSessions Marks every session of the user as revoked
+func (l *loginRepository) RevokeUserSessions(ctx context.Context, userID int64) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users_session SET date_revoked = CURRENT_TIMESTAMP WHERE user_id = ? AND date_revoked IS NULL"), userID)
 	return err
 }
 
-func (l *loginRepository) LockAccount(userID int64, duration time.Duration) error {
-	_, err := l.db.Exec("UPDATE users SET lockout_enabled = 1, lockout_date = ? where user_id = ?", time.Now().Add(duration), userID)
+// AddMagicLink Stores a new login link
+func (l *loginRepository) AddMagicLink(ctx context.Context, link *domain2.MagicLink) error {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, l.db.Rebind("INSERT INTO users_magic_link (user_id, token_hash, expiry_date, date_created) VALUES (?, ?, ?, CURRENT_TIMESTAMP)"),
+		link.UserId, link.TokenHash, link.ExpiryDate)
 	return err
 }
+
+// GetMagicLink Returns the login link with the given hash, nil if it doesn't exist
+func (l *loginRepository) GetMagicLink(ctx context.Context, tokenHash string) (*domain2.MagicLink, error) {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	var link domain2.MagicLink
+
+	err := l.db.GetContext(ctx, &link, l.db.Rebind("SELECT * FROM users_magic_link WHERE token_hash = ?"), tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// UseMagicLink Marks the login link as used. Returns false if it was already used
+func (l *loginRepository) UseMagicLink(ctx context.Context, magicLinkID int64) (bool, error) {
+	ctx, cancel := storage.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	res, err := l.db.ExecContext(ctx, l.db.Rebind("UPDATE users_magic_link SET date_used = CURRENT_TIMESTAMP WHERE magic_link_id = ? AND date_used IS NULL"), magicLinkID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
@@ -1,9 +1,11 @@
 package login
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -46,7 +48,7 @@ func Test_registerRepository_LockAccount(t *testing.T) {
 			wantErr:  false,
 			expected: true,
 			mockFunc: func() {
-				query := "UPDATE users SET lockout_enabled = 1, lockout_date = ? where user_id = ?"
+				query := "UPDATE users SET lockout_enabled = TRUE, lockout_date = ? where user_id = ?"
 				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 		},
@@ -62,7 +64,7 @@ func Test_registerRepository_LockAccount(t *testing.T) {
 			wantErr:  true,
 			expected: false,
 			mockFunc: func() {
-				query := "UPDATE users SET lockout_enabled = 1, lockout_date = ? where user_id = ?"
+				query := "UPDATE users SET lockout_enabled = TRUE, lockout_date = ? where user_id = ?"
 				mock.ExpectExec(query).WillReturnError(errors.New("internal_error"))
 			},
 		},
@@ -72,9 +74,9 @@ func Test_registerRepository_LockAccount(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockFunc()
 
-			u := NewRepository(tt.fields.db)
+			u := NewRepository(tt.fields.db, time.Second)
 
-			err := u.LockAccount(tt.args.userID, 1)
+			err := u.LockAccount(context.Background(), tt.args.userID, 1)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -119,7 +121,7 @@ func Test_registerRepository_UnlockAccount(t *testing.T) {
 			wantErr:  false,
 			expected: true,
 			mockFunc: func() {
-				query := "UPDATE users SET lockout_enabled = 0, lockout_date = null, failed_login_attempts = 0 where user_id = ?"
+				query := "UPDATE users SET lockout_enabled = FALSE, lockout_date = null, failed_login_attempts = 0 where user_id = ?"
 				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 		},
@@ -135,7 +137,7 @@ func Test_registerRepository_UnlockAccount(t *testing.T) {
 			wantErr:  true,
 			expected: false,
 			mockFunc: func() {
-				query := "UPDATE users SET lockout_enabled = 0, lockout_date = null, failed_login_attempts = 0 where user_id = ?"
+				query := "UPDATE users SET lockout_enabled = FALSE, lockout_date = null, failed_login_attempts = 0 where user_id = ?"
 				mock.ExpectExec(query).WillReturnError(errors.New("internal_error"))
 			},
 		},
@@ -145,9 +147,9 @@ func Test_registerRepository_UnlockAccount(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockFunc()
 
-			u := NewRepository(tt.fields.db)
+			u := NewRepository(tt.fields.db, time.Second)
 
-			err := u.UnlockAccount(tt.args.userID)
+			err := u.UnlockAccount(context.Background(), tt.args.userID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -218,9 +220,9 @@ func Test_registerRepository_ResetLoginFails(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockFunc()
 
-			u := NewRepository(tt.fields.db)
+			u := NewRepository(tt.fields.db, time.Second)
 
-			err := u.ResetLoginFails(tt.args.userID)
+			err := u.ResetLoginFails(context.Background(), tt.args.userID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -291,9 +293,9 @@ func Test_registerRepository_IncrementLoginFailAttempt(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockFunc()
 
-			u := NewRepository(tt.fields.db)
+			u := NewRepository(tt.fields.db, time.Second)
 
-			err := u.IncrementLoginFailAttempt(tt.args.userID)
+			err := u.IncrementLoginFailAttempt(context.Background(), tt.args.userID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -302,133 +304,533 @@ func Test_registerRepository_IncrementLoginFailAttempt(t *testing.T) {
 	}
 }
 
-func Test_registerRepository_GetUserByUsername(t *testing.T) {
-	type fields struct {
-		db *sqlx.DB
+func Test_loginRepository_AddRefreshToken(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
 	}
+	defer db.Close()
 
-	type args struct {
-		username string
+	query := "INSERT INTO users_refresh_token (user_id, family_id, token_hash, expiry_date, access_token_id, access_token_expiry_date, date_created) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)"
+
+	tests := []struct {
+		name     string
+		wantErr  bool
+		wantID   int64
+		mockFunc func()
+	}{
+		{
+			name:   "ok",
+			wantID: 10,
+			mockFunc: func() {
+				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(10, 1))
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WillReturnError(errors.New("internal_error"))
+			},
+		},
 	}
 
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			token := &domain.RefreshToken{UserId: 123, FamilyId: "family", TokenHash: "hash"}
+			err := l.AddRefreshToken(context.Background(), token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.AddRefreshToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if token.RefreshTokenId != tt.wantID {
+				t.Errorf("loginRepository.AddRefreshToken() id = %v, expected %v", token.RefreshTokenId, tt.wantID)
+			}
+		})
+	}
+}
+
+func Test_loginRepository_GetRefreshToken(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
 
+	query := "SELECT * FROM users_refresh_token WHERE token_hash = ?"
+
 	tests := []struct {
-		name          string
-		fields        fields
-		args          args
-		expectedUser  *domain.User
-		expectedEmail *domain.UserEmail
-		wantErr       bool
-		mockFunc      func()
+		name     string
+		wantErr  bool
+		expected *domain.RefreshToken
+		mockFunc func()
 	}{
 		{
-			name: "ok",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
+			name:     "ok",
+			expected: &domain.RefreshToken{RefreshTokenId: 1, FamilyId: "family"},
+			mockFunc: func() {
+				table := sqlmock.NewRows([]string{"refresh_token_id", "family_id"})
+				table.AddRow(1, "family")
+				mock.ExpectQuery(query).WithArgs("hash").WillReturnRows(table)
 			},
-			args: args{
-				username: "test",
+		},
+		{
+			name: "not_found",
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("hash").WillReturnRows(sqlmock.NewRows([]string{"refresh_token_id"}))
 			},
-			wantErr:       false,
-			expectedEmail: &domain.UserEmail{UserId: 123},
-			expectedUser:  &domain.User{AuthId: 123},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users where username = ?"
+				mock.ExpectQuery(query).WithArgs("hash").WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
 
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
 
-				mock.ExpectQuery(query).WillReturnRows(table)
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			token, err := l.GetRefreshToken(context.Background(), "hash")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.GetRefreshToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(token, tt.expected) {
+				t.Errorf("loginRepository.GetRefreshToken() got = %v, expected %v", token, tt.expected)
+			}
+		})
+	}
+}
 
-				query = "SELECT * FROM users_email WHERE user_id = ?"
+func Test_loginRepository_RevokeRefreshToken(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
 
-				table = sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
+	query := "UPDATE users_refresh_token SET date_revoked = CURRENT_TIMESTAMP WHERE refresh_token_id = ? AND date_revoked IS NULL"
 
-				mock.ExpectQuery(query).WillReturnRows(table)
+	tests := []struct {
+		name     string
+		wantErr  bool
+		expected bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 		},
 		{
-			name: "user_not_found",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
+			name:     "already_revoked",
+			expected: false,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
 			},
-			args: args{
-				username: "test",
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(1).WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			revoked, err := l.RevokeRefreshToken(context.Background(), 1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.RevokeRefreshToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if revoked != tt.expected {
+				t.Errorf("loginRepository.RevokeRefreshToken() got = %v, expected %v", revoked, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_loginRepository_RevokeRefreshTokenFamily(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "UPDATE users_refresh_token SET date_revoked = CURRENT_TIMESTAMP WHERE family_id = ? AND date_revoked IS NULL"
+
+	tests := []struct {
+		name     string
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name: "ok",
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs("family").WillReturnResult(sqlmock.NewResult(0, 3))
 			},
+		},
+		{
+			name:    "internal_error",
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users where username = ?"
+				mock.ExpectExec(query).WithArgs("family").WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
 
-				table := sqlmock.NewRows([]string{"user_id"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
 
-				mock.ExpectQuery(query).WillReturnRows(table)
+			err := l.RevokeRefreshTokenFamily(context.Background(), "family")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.RevokeRefreshTokenFamily() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_loginRepository_RevokeUserRefreshTokens(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "UPDATE users_refresh_token SET date_revoked = CURRENT_TIMESTAMP WHERE user_id = ? AND date_revoked IS NULL"
+
+	tests := []struct {
+		name     string
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name: "ok",
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 3))
 			},
 		},
 		{
-			name: "user_internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(123).WillReturnError(errors.New("internal_error"))
 			},
-			args: args{
-				username: "test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			err := l.RevokeUserRefreshTokens(context.Background(), 123)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.RevokeUserRefreshTokens() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_loginRepository_GetFamilyAccessTokens(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "SELECT * FROM users_refresh_token WHERE family_id = ? AND access_token_expiry_date > CURRENT_TIMESTAMP"
+
+	tests := []struct {
+		name     string
+		expected []domain.RefreshToken
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: []domain.RefreshToken{{RefreshTokenId: 1, AccessTokenId: "jti1"}, {RefreshTokenId: 2, AccessTokenId: "jti2"}},
+			mockFunc: func() {
+				rows := sqlmock.NewRows([]string{"refresh_token_id", "access_token_id"}).AddRow(1, "jti1").AddRow(2, "jti2")
+				mock.ExpectQuery(query).WithArgs("family").WillReturnRows(rows)
 			},
+		},
+		{
+			name:    "internal_error",
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users where username = ?"
+				mock.ExpectQuery(query).WithArgs("family").WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			tokens, err := l.GetFamilyAccessTokens(context.Background(), "family")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.GetFamilyAccessTokens() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(tokens, tt.expected) {
+				t.Errorf("loginRepository.GetFamilyAccessTokens() got = %v, expected %v", tokens, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_loginRepository_GetUserAccessTokens(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
 
-				mock.ExpectQuery(query).WillReturnError(errors.New("internal_error"))
+	query := "SELECT * FROM users_refresh_token WHERE user_id = ? AND access_token_expiry_date > CURRENT_TIMESTAMP"
+
+	tests := []struct {
+		name     string
+		expected []domain.RefreshToken
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: []domain.RefreshToken{{RefreshTokenId: 1, AccessTokenId: "jti1"}},
+			mockFunc: func() {
+				rows := sqlmock.NewRows([]string{"refresh_token_id", "access_token_id"}).AddRow(1, "jti1")
+				mock.ExpectQuery(query).WithArgs(123).WillReturnRows(rows)
 			},
 		},
 		{
-			name: "email_not_found",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs(123).WillReturnError(errors.New("internal_error"))
 			},
-			args: args{
-				username: "test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			tokens, err := l.GetUserAccessTokens(context.Background(), 123)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.GetUserAccessTokens() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(tokens, tt.expected) {
+				t.Errorf("loginRepository.GetUserAccessTokens() got = %v, expected %v", tokens, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_loginRepository_AddSession(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "INSERT INTO users_session (session_id, user_id, user_agent, ip_address, date_created, date_last_refresh) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)"
+
+	tests := []struct {
+		name     string
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name: "ok",
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs("family", 123, "curl", "127.0.0.1").WillReturnResult(sqlmock.NewResult(0, 1))
 			},
+		},
+		{
+			name:    "internal_error",
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users where username = ?"
+				mock.ExpectExec(query).WithArgs("family", 123, "curl", "127.0.0.1").WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
 
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
 
-				mock.ExpectQuery(query).WillReturnRows(table)
+			err := l.AddSession(context.Background(), &domain.Session{SessionId: "family", UserId: 123, UserAgent: "curl", IPAddress: "127.0.0.1"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.AddSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
 
-				query = "SELECT * FROM users_email WHERE user_id = ?"
+func Test_loginRepository_GetUserSessions(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
 
-				table = sqlmock.NewRows([]string{"user_id"})
+	query := "SELECT * FROM users_session WHERE user_id = ? AND date_revoked IS NULL AND date_last_refresh > ? ORDER BY date_last_refresh DESC"
+	since := time.Now()
 
-				mock.ExpectQuery(query).WillReturnRows(table)
+	tests := []struct {
+		name     string
+		expected []domain.Session
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: []domain.Session{{SessionId: "family", UserId: 123, UserAgent: "curl"}},
+			mockFunc: func() {
+				rows := sqlmock.NewRows([]string{"session_id", "user_id", "user_agent"}).AddRow("family", 123, "curl")
+				mock.ExpectQuery(query).WithArgs(123, since).WillReturnRows(rows)
 			},
 		},
 		{
-			name: "email_internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs(123, since).WillReturnError(errors.New("internal_error"))
 			},
-			args: args{
-				username: "test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			sessions, err := l.GetUserSessions(context.Background(), 123, since)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.GetUserSessions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(sessions, tt.expected) {
+				t.Errorf("loginRepository.GetUserSessions() got = %v, expected %v", sessions, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_loginRepository_RevokeSession(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "UPDATE users_session SET date_revoked = CURRENT_TIMESTAMP WHERE session_id = ? AND date_revoked IS NULL"
+
+	tests := []struct {
+		name     string
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name: "ok",
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs("family").WillReturnResult(sqlmock.NewResult(0, 1))
 			},
+		},
+		{
+			name:    "internal_error",
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users where username = ?"
+				mock.ExpectExec(query).WithArgs("family").WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
 
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
 
-				mock.ExpectQuery(query).WillReturnRows(table)
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
 
-				query = "SELECT * FROM users_email WHERE user_id = ?"
+			err := l.RevokeSession(context.Background(), "family")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.RevokeSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
 
-				mock.ExpectQuery(query).WillReturnError(errors.New("internal_error"))
+func Test_loginRepository_GetMagicLink(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "SELECT * FROM users_magic_link WHERE token_hash = ?"
+
+	tests := []struct {
+		name     string
+		wantErr  bool
+		expected *domain.MagicLink
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: &domain.MagicLink{MagicLinkId: 1, UserId: 123},
+			mockFunc: func() {
+				table := sqlmock.NewRows([]string{"magic_link_id", "user_id"})
+				table.AddRow(1, 123)
+				mock.ExpectQuery(query).WithArgs("hash").WillReturnRows(table)
+			},
+		},
+		{
+			name: "not_found",
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("hash").WillReturnRows(sqlmock.NewRows([]string{"magic_link_id"}))
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("hash").WillReturnError(errors.New("internal_error"))
 			},
 		},
 	}
@@ -437,23 +839,88 @@ func Test_registerRepository_GetUserByUsername(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockFunc()
 
-			u := NewRepository(tt.fields.db)
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
 
-			user, email, err := u.GetUserByUsername(tt.args.username)
+			link, err := l.GetMagicLink(context.Background(), "hash")
 			if (err != nil) != tt.wantErr {
-				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("loginRepository.GetMagicLink() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
-			if !reflect.DeepEqual(user, tt.expectedUser) {
-				t.Errorf("registerRepository.AddUser() got = %v, expected %v", user, tt.expectedUser)
-				return
+			if !reflect.DeepEqual(link, tt.expected) {
+				t.Errorf("loginRepository.GetMagicLink() got = %v, expected %v", link, tt.expected)
 			}
+		})
+	}
+}
 
-			if !reflect.DeepEqual(email, tt.expectedEmail) {
-				t.Errorf("registerRepository.AddUser() got = %v, expected %v", email, tt.expectedEmail)
+func Test_loginRepository_UseMagicLink(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "UPDATE users_magic_link SET date_used = CURRENT_TIMESTAMP WHERE magic_link_id = ? AND date_used IS NULL"
+
+	tests := []struct {
+		name     string
+		wantErr  bool
+		expected bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "already_used",
+			expected: false,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(1).WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			l := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			used, err := l.UseMagicLink(context.Background(), 1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loginRepository.UseMagicLink() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+
+			if used != tt.expected {
+				t.Errorf("loginRepository.UseMagicLink() got = %v, expected %v", used, tt.expected)
+			}
 		})
 	}
 }
+
+func Test_loginRepository_UpdatePasswordHash(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE users SET password_hash = ? WHERE user_id = ?").WithArgs("hash", 123).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second).UpdatePasswordHash(context.Background(), 123, "hash"); err != nil {
+		t.Errorf("loginRepository.UpdatePasswordHash() error = %v", err)
+	}
+}
@@ -1,13 +1,14 @@
 package login
 
 import (
-	"crypto/subtle"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/CienciaArgentina/go-backend-commons/pkg/performance"
@@ -16,12 +17,16 @@ import (
 
 	"github.com/go-resty/resty/v2"
 
+	"database/sql"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-email-sender/commons"
 	"github.com/CienciaArgentina/go-enigma/config"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
 	"github.com/CienciaArgentina/go-enigma/internal/encryption"
-	"github.com/dgrijalva/jwt-go"
-	"golang.org/x/crypto/argon2"
+	"github.com/CienciaArgentina/go-enigma/internal/mfa"
+	"github.com/CienciaArgentina/go-enigma/internal/revocation"
+	"github.com/CienciaArgentina/go-enigma/internal/users"
+	"github.com/CienciaArgentina/go-enigma/internal/webauthn"
 )
 
 const (
@@ -53,19 +58,53 @@ const (
 	ErrUserFetchFailed = "user_fetch_failed"
 	// Email fetch failed.
 	ErrEmailFetchFailed = "email_fetch_failed"
+
+	// Refresh token.
+	ErrInvalidRefreshToken     = "La sesión expiró o no es válida, por favor volvé a loguearte"
+	ErrInvalidRefreshTokenCode = "invalid_refresh_token"
+	ErrRefreshTokenReusedCode  = "refresh_token_reused"
+
+	// Two-factor authentication.
+	ErrInvalidMFAToken     = "La verificación en dos pasos expiró, por favor volvé a loguearte"
+	ErrInvalidMFATokenCode = "invalid_mfa_token"
+
+	// Magic link.
+	ErrInvalidMagicLink     = "El link para ingresar no es válido o expiró, por favor pedí uno nuevo"
+	ErrInvalidMagicLinkCode = "invalid_magic_link"
+
+	// Sessions.
+	ErrSessionNotFound     = "La sesión no existe o ya fue cerrada"
+	ErrSessionNotFoundCode = "session_not_found"
+
+	errTokenGenerationCode = "failed_token_generation"
+
+	tokenType          = "Bearer"
+	refreshTokenLength = 32
+	magicLinkLength    = 32
+	maxUserAgentLength = 255
 )
 
 type loginService struct {
 	cfg          *config.EnigmaConfig
 	loginOptions *config.LoginOptions
 	repository   Repository
+	users        UserStore
+	signer       encryption.Signer
+	revocations  revocation.Store
+	mfa          mfa.Service
+	webauthn     webauthn.Service
 }
 
-func NewService(cfg *config.EnigmaConfig, r Repository) Service {
+func NewService(cfg *config.EnigmaConfig, r Repository, u UserStore, signer encryption.Signer, revocations revocation.Store, mfaSvc mfa.Service, webauthnSvc webauthn.Service) Service {
 	return &loginService{
 		cfg:          cfg,
 		loginOptions: setLoginOptions(),
 		repository:   r,
+		users:        u,
+		signer:       signer,
+		revocations:  revocations,
+		mfa:          mfaSvc,
+		webauthn:     webauthnSvc,
 	}
 }
 
@@ -80,112 +119,752 @@ func setLoginOptions() *config.LoginOptions {
 	return &o
 }
 
-func (l *loginService) LoginUser(u *domain.UserLoginDTO, ctx *middleware.ContextInformation) (string, apierror.ApiError) { // nolint
+func (l *loginService) LoginUser(ctx context.Context, u *domain.UserLoginDTO, client *domain.ClientInfo, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) { // nolint
 	var err error
 	var apierr apierror.ApiError
 	var user *domain.User
 	var userEmail *domain.UserEmail
 
-	performance.TrackTime(time.Now(), "UserCanLogin", ctx, func() {
+	performance.TrackTime(time.Now(), "UserCanLogin", info, func() {
 		apierr = l.UserCanLogin(u)
 	})
 
 	if apierr != nil {
-		return "", apierr
+		return nil, apierr
 	}
 
-	performance.TrackTime(time.Now(), "GetUserByUsername", ctx, func() {
-		user, userEmail, apierr = l.repository.GetUserByUsername(u.Username)
+	performance.TrackTime(time.Now(), "GetUserByIdentifier", info, func() {
+		user, userEmail, apierr = l.getUserByIdentifier(ctx, u.Username)
 	})
 	if apierr != nil {
 		clog.Error("Error al obtener el username", "login-user", err, nil)
-		return "", apierr
+		return nil, apierr
 	}
 
 	if user == nil || userEmail == nil {
-		return "", apierror.New(http.StatusBadRequest, ErrInvalidLogin, apierror.NewErrorCause(ErrInvalidLogin, ErrInvalidLoginCode))
+		return nil, apierror.New(http.StatusBadRequest, ErrInvalidLogin, apierror.NewErrorCause(ErrInvalidLogin, ErrInvalidLoginCode))
 	}
 
 	var verifyPassword bool
-	performance.TrackTime(time.Now(), "comparePasswordAndHash", ctx, func() {
-		verifyPassword, err = comparePasswordAndHash(u.Password, user.PasswordHash)
+	performance.TrackTime(time.Now(), "comparePasswordAndHash", info, func() {
+		verifyPassword, err = comparePasswordAndHash(u.Password, user.PasswordHash, l.cfg)
 	})
 	if err != nil {
 		// Return friendly message
 		clog.Error("Error comparing password", "login-user", err, nil)
-		return "", apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
-	}
-
-	if user.LockoutEnabled {
-		// If the register is locked but time is up we should unlock the account
-		if user.LockoutDate.Time.Add(l.loginOptions.LockoutOptions.LockoutTimeDuration).Before(time.Now()) {
-			user.FailedLoginAttempts = 0
-			user.LockoutEnabled = false
-			err := l.repository.UnlockAccount(user.AuthId)
-			if err != nil {
-				clog.Error("Can't unlock account", "login-user", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
-			}
-		} else {
-			friendlyMessage := fmt.Sprintf("La cuenta se encuentra bloqueada por %v minutos por intentos fallidos de login",
-				l.loginOptions.LockoutOptions.LockoutTimeDuration.Minutes())
-			return "", apierror.NewBadRequestApiError(friendlyMessage)
-		}
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if apierr := l.checkLockout(ctx, user); apierr != nil {
+		return nil, apierr
 	}
 
 	if !verifyPassword {
-		if user.FailedLoginAttempts >= l.loginOptions.LockoutOptions.MaxFailedAttempts {
-			err := l.repository.LockAccount(user.AuthId, l.loginOptions.LockoutOptions.LockoutTimeDuration)
-			if err != nil {
-				clog.Error("Can't lock account", "login-user", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
-			}
-			friendlyMsg := fmt.Sprintf("Debido a repetidos intentos tu cuenta fue bloqueada por %v minutos", l.loginOptions.LockoutOptions.LockoutTimeDuration.Minutes())
-			return "", apierror.NewBadRequestApiError(friendlyMsg)
+		if apierr := l.registerFailedAttempt(ctx, user); apierr != nil {
+			return nil, apierr
 		}
-		err := l.repository.IncrementLoginFailAttempt(user.AuthId)
+		return nil, apierror.New(http.StatusBadRequest, ErrInvalidLogin, apierror.NewErrorCause(ErrInvalidLogin, ErrInvalidLoginCode))
+	}
+
+	performance.TrackTime(time.Now(), "RehashPassword", info, func() {
+		l.rehashPassword(ctx, user, u.Password)
+	})
+
+	if apierr := l.checkConfirmedEmail(user, userEmail); apierr != nil {
+		return nil, apierr
+	}
+
+	var mfaEnabled bool
+	performance.TrackTime(time.Now(), "IsMFAEnabled", info, func() {
+		mfaEnabled, err = l.mfa.IsEnabled(ctx, user.AuthId)
+	})
+	if err != nil {
+		clog.Error("Error checking two-factor authentication", "login-user", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	// Failed attempts are only reset once the second factor is right too, otherwise entering the password would give
+	// unlimited tries at guessing the code.
+	if mfaEnabled {
+		return l.mfaChallenge(user)
+	}
+
+	l.resetLoginFails(ctx, user, info)
+
+	return l.issueTokens(ctx, user, userEmail, "", client, info)
+}
+
+// LoginMFA Second step of the login of users with two-factor authentication, exchanges the MFA token returned by
+// LoginUser and a code from their authenticator app for the tokens
+func (l *loginService) LoginMFA(ctx context.Context, dto *domain.MFALoginDTO, client *domain.ClientInfo, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) {
+	if dto.MFAToken == "" || dto.Code == "" {
+		return nil, apierror.NewBadRequestApiError(domain.ErrEmptyField)
+	}
+
+	invalidToken := apierror.New(http.StatusUnauthorized, ErrInvalidMFAToken, apierror.NewErrorCause(ErrInvalidMFAToken, ErrInvalidMFATokenCode))
+
+	authID, err := encryption.ParseMFAToken(dto.MFAToken, l.cfg)
+	if err != nil {
+		return nil, invalidToken
+	}
+
+	var user *domain.User
+	var userEmail *domain.UserEmail
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "GetUserByUserId", info, func() {
+		user, userEmail, apierr = l.getUserByID(ctx, authID)
+	})
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if user == nil || userEmail == nil || user.DateDeleted != nil {
+		return nil, invalidToken
+	}
+
+	if apierr := l.checkLockout(ctx, user); apierr != nil {
+		return nil, apierr
+	}
+
+	var valid bool
+	performance.TrackTime(time.Now(), "VerifyMFACode", info, func() {
+		valid, err = l.mfa.VerifyCode(ctx, user.AuthId, dto.Code)
+	})
+	if err != nil {
+		clog.Error("Error verifying two-factor code", "login-mfa", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if !valid {
+		if apierr := l.registerFailedAttempt(ctx, user); apierr != nil {
+			return nil, apierr
+		}
+		return nil, apierror.New(http.StatusBadRequest, mfa.ErrInvalidMFACode, apierror.NewErrorCause(mfa.ErrInvalidMFACode, mfa.ErrInvalidMFACodeCode))
+	}
+
+	l.resetLoginFails(ctx, user, info)
+
+	return l.issueTokens(ctx, user, userEmail, "", client, info)
+}
+
+// LoginWebAuthn Passwordless login with a passkey. The passkey is already something the user has verified with their
+// fingerprint or PIN, so it isn't followed by the TOTP code.
+func (l *loginService) LoginWebAuthn(ctx context.Context, dto *domain.AssertionCredentialDTO, client *domain.ClientInfo, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) {
+	var authID int64
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "VerifyAssertion", info, func() {
+		authID, apierr = l.webauthn.VerifyAssertion(ctx, dto, info)
+	})
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	var user *domain.User
+	var userEmail *domain.UserEmail
+	performance.TrackTime(time.Now(), "GetUserByUserId", info, func() {
+		user, userEmail, apierr = l.getUserByID(ctx, authID)
+	})
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if user == nil || userEmail == nil || user.DateDeleted != nil {
+		return nil, apierror.New(http.StatusUnauthorized, webauthn.ErrInvalidCredential, apierror.NewErrorCause(webauthn.ErrInvalidCredential, webauthn.ErrInvalidCredentialCode))
+	}
+
+	if apierr := l.checkLockout(ctx, user); apierr != nil {
+		return nil, apierr
+	}
+
+	if apierr := l.checkConfirmedEmail(user, userEmail); apierr != nil {
+		return nil, apierr
+	}
+
+	l.resetLoginFails(ctx, user, info)
+
+	return l.issueTokens(ctx, user, userEmail, "", client, info)
+}
+
+// SendMagicLink Emails the user a single use link to log in without the password. It doesn't tell whether the email is
+// registered, same as the other flows that email the user.
+func (l *loginService) SendMagicLink(ctx context.Context, email string, info *middleware.ContextInformation) apierror.ApiError {
+	if email == "" {
+		return apierror.NewBadRequestApiError(domain.ErrEmptyEmail)
+	}
+
+	var user *domain.User
+	var userEmail *domain.UserEmail
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "GetUserByEmail", info, func() {
+		user, userEmail, apierr = l.getUser(ctx, func() (*domain.User, error) { return l.users.GetUserByEmail(ctx, email) })
+	})
+	// getUser answers 400 when there's no user with that email
+	if apierr != nil && apierr.Status() != http.StatusBadRequest {
+		return apierr
+	}
+
+	if apierr != nil || user == nil || userEmail == nil || user.DateDeleted != nil {
+		return nil
+	}
+
+	token, err := encryption.GenerateOpaqueToken(magicLinkLength)
+	if err != nil {
+		return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, errTokenGenerationCode)
+	}
+
+	link := &domain.MagicLink{
+		UserId:     user.AuthId,
+		TokenHash:  encryption.HashOpaqueToken(token),
+		ExpiryDate: sql.NullTime{Time: time.Now().Add(l.cfg.TokenOptions.MagicLinkDuration), Valid: true},
+	}
+	performance.TrackTime(time.Now(), "AddMagicLink", info, func() {
+		err = l.repository.AddMagicLink(ctx, link)
+	})
+	if err != nil {
+		clog.Error("Error saving magic link", "send-magic-link", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+		return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	url := fmt.Sprintf("/login/magic_link?token=%s", token)
+
+	emailDto := commons.NewDTO([]string{userEmail.Email}, url, domain.MagicLinkTemplate)
+
+	var response *resty.Response
+	// TODO: Move this to a client
+	performance.TrackTime(time.Now(), "EmailSendAPICall", info, func() {
+		response, err = resty.New().SetHostURL(domain.GetEmailSenderBaseURL()).SetTimeout(l.cfg.TimeoutOptions.EmailSender).R().SetContext(ctx).SetBody(emailDto).Post("/email")
+	})
+
+	if err != nil {
+		clog.Error("Rest client err", "send-magic-link", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+		return apierror.NewInternalServerApiError(err.Error(), err, "cannot_email")
+	}
+
+	if response.IsError() {
+		clog.Error("Email sender status err", "send-magic-link", errors.New("cant send email"), map[string]string{"status": response.Status(), "auth_id": fmt.Sprintf("%d", user.AuthId)})
+		return apierror.NewInternalServerApiError("cant send email", errors.New("cant send email"), "cannot_email")
+	}
+
+	return nil
+}
+
+// LoginMagicLink Exchanges the token of a link sent by SendMagicLink for the tokens. Like a password, the link is only
+// one factor so users with two-factor authentication still get asked for their code.
+func (l *loginService) LoginMagicLink(ctx context.Context, token string, client *domain.ClientInfo, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) {
+	if token == "" {
+		return nil, apierror.NewBadRequestApiError(domain.ErrEmptyField)
+	}
+
+	invalid := apierror.New(http.StatusUnauthorized, ErrInvalidMagicLink, apierror.NewErrorCause(ErrInvalidMagicLink, ErrInvalidMagicLinkCode))
+
+	var link *domain.MagicLink
+	var err error
+	performance.TrackTime(time.Now(), "GetMagicLink", info, func() {
+		link, err = l.repository.GetMagicLink(ctx, encryption.HashOpaqueToken(token))
+	})
+	if err != nil {
+		clog.Error("Error fetching magic link", "login-magic-link", err, nil)
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if link == nil || link.DateUsed.Valid || !link.ExpiryDate.Time.After(time.Now()) {
+		return nil, invalid
+	}
+
+	var user *domain.User
+	var userEmail *domain.UserEmail
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "GetUserByUserId", info, func() {
+		user, userEmail, apierr = l.getUserByID(ctx, link.UserId)
+	})
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if user == nil || userEmail == nil || user.DateDeleted != nil {
+		return nil, invalid
+	}
+
+	if apierr := l.checkLockout(ctx, user); apierr != nil {
+		return nil, apierr
+	}
+
+	if apierr := l.checkConfirmedEmail(user, userEmail); apierr != nil {
+		return nil, apierr
+	}
+
+	var used bool
+	performance.TrackTime(time.Now(), "UseMagicLink", info, func() {
+		used, err = l.repository.UseMagicLink(ctx, link.MagicLinkId)
+	})
+	if err != nil {
+		clog.Error("Error using magic link", "login-magic-link", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	// Someone else used it between the fetch and now
+	if !used {
+		return nil, invalid
+	}
+
+	var mfaEnabled bool
+	performance.TrackTime(time.Now(), "IsMFAEnabled", info, func() {
+		mfaEnabled, err = l.mfa.IsEnabled(ctx, user.AuthId)
+	})
+	if err != nil {
+		clog.Error("Error checking two-factor authentication", "login-magic-link", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if mfaEnabled {
+		return l.mfaChallenge(user)
+	}
+
+	l.resetLoginFails(ctx, user, info)
+
+	return l.issueTokens(ctx, user, userEmail, "", client, info)
+}
+
+func (l *loginService) checkConfirmedEmail(user *domain.User, userEmail *domain.UserEmail) apierror.ApiError {
+	if !l.loginOptions.SignInOptions.RequireConfirmedEmail || userEmail.VerfiedEmail {
+		return nil
+	}
+
+	apierr := apierror.New(http.StatusBadRequest, ErrEmailNotVerified, apierror.NewErrorCause(userEmail.Email, ErrEmailNotVerifiedCode))
+	apierr.AddError(strconv.FormatInt(user.AuthId, 10), ErrEmailNotVerifiedCode)
+	return apierr
+}
+
+// mfaChallenge Response of a right password when the user still has to enter the second factor.
+func (l *loginService) mfaChallenge(user *domain.User) (*domain.TokenResponse, apierror.ApiError) {
+	token, err := encryption.GenerateMFAToken(user.AuthId, l.cfg)
+	if err != nil {
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, errTokenGenerationCode)
+	}
+
+	return &domain.TokenResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(l.cfg.TokenOptions.MFATokenDuration.Seconds()),
+	}, nil
+}
+
+// checkLockout Unlocks the account if its lockout is over, otherwise returns the error telling the user it's locked.
+func (l *loginService) checkLockout(ctx context.Context, user *domain.User) apierror.ApiError {
+	if !user.LockoutEnabled {
+		return nil
+	}
+
+	// If the register is locked but time is up we should unlock the account
+	if user.LockoutDate.Time.Add(l.loginOptions.LockoutOptions.LockoutTimeDuration).Before(time.Now()) {
+		user.FailedLoginAttempts = 0
+		user.LockoutEnabled = false
+		err := l.repository.UnlockAccount(ctx, user.AuthId)
+		if err != nil {
+			clog.Error("Can't unlock account", "login-user", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+		}
+		return nil
+	}
+
+	friendlyMessage := fmt.Sprintf("La cuenta se encuentra bloqueada por %v minutos por intentos fallidos de login",
+		l.loginOptions.LockoutOptions.LockoutTimeDuration.Minutes())
+	return apierror.NewBadRequestApiError(friendlyMessage)
+}
+
+// registerFailedAttempt Counts a failed password or code, returns an error if the account got locked because of it.
+func (l *loginService) registerFailedAttempt(ctx context.Context, user *domain.User) apierror.ApiError {
+	if user.FailedLoginAttempts >= l.loginOptions.LockoutOptions.MaxFailedAttempts {
+		err := l.repository.LockAccount(ctx, user.AuthId, l.loginOptions.LockoutOptions.LockoutTimeDuration)
 		if err != nil {
-			clog.Error("Can't increment login fail attemp", "login-user", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+			clog.Error("Can't lock account", "login-user", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
 		}
-		return "", apierror.New(http.StatusBadRequest, ErrInvalidLogin, apierror.NewErrorCause(ErrInvalidLogin, ErrInvalidLoginCode))
+		friendlyMsg := fmt.Sprintf("Debido a repetidos intentos tu cuenta fue bloqueada por %v minutos", l.loginOptions.LockoutOptions.LockoutTimeDuration.Minutes())
+		return apierror.NewBadRequestApiError(friendlyMsg)
 	}
 
-	if l.loginOptions.SignInOptions.RequireConfirmedEmail && !userEmail.VerfiedEmail {
-		apierr := apierror.New(http.StatusBadRequest, ErrEmailNotVerified, apierror.NewErrorCause(userEmail.Email, ErrEmailNotVerifiedCode))
-		apierr.AddError(strconv.FormatInt(user.AuthId, 10), ErrEmailNotVerifiedCode)
-		return "", apierr
+	err := l.repository.IncrementLoginFailAttempt(ctx, user.AuthId)
+	if err != nil {
+		clog.Error("Can't increment login fail attemp", "login-user", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
 	}
+	return nil
+}
 
-	performance.TrackTime(time.Now(), "ResetLoginFails", ctx, func() {
-		err = l.repository.ResetLoginFails(user.AuthId)
+func (l *loginService) resetLoginFails(ctx context.Context, user *domain.User, info *middleware.ContextInformation) {
+	var err error
+	performance.TrackTime(time.Now(), "ResetLoginFails", info, func() {
+		err = l.repository.ResetLoginFails(ctx, user.AuthId)
 	})
 	if err != nil {
 		clog.Error("can't reset login fails", "login-user", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
 	}
+}
+
+func (l *loginService) RefreshToken(ctx context.Context, refreshToken string, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) {
+	if refreshToken == "" {
+		return nil, apierror.NewBadRequestApiError(domain.ErrEmptyField)
+	}
+
+	var stored *domain.RefreshToken
+	var err error
+	performance.TrackTime(time.Now(), "GetRefreshToken", info, func() {
+		stored, err = l.repository.GetRefreshToken(ctx, encryption.HashOpaqueToken(refreshToken))
+	})
+	if err != nil {
+		clog.Error("Error fetching refresh token", "refresh-token", err, nil)
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if stored == nil {
+		return nil, apierror.New(http.StatusUnauthorized, ErrInvalidRefreshToken, apierror.NewErrorCause(ErrInvalidRefreshToken, ErrInvalidRefreshTokenCode))
+	}
+
+	// A revoked token being presented again means it was stolen or replayed, so nobody in that family can be trusted.
+	if stored.DateRevoked.Valid {
+		return nil, l.revokeFamily(ctx, stored, info)
+	}
+
+	if !stored.ExpiryDate.Valid || stored.ExpiryDate.Time.Before(time.Now()) {
+		return nil, apierror.New(http.StatusUnauthorized, ErrInvalidRefreshToken, apierror.NewErrorCause(ErrInvalidRefreshToken, ErrInvalidRefreshTokenCode))
+	}
+
+	var revoked bool
+	performance.TrackTime(time.Now(), "RevokeRefreshToken", info, func() {
+		revoked, err = l.repository.RevokeRefreshToken(ctx, stored.RefreshTokenId)
+	})
+	if err != nil {
+		clog.Error("Error revoking refresh token", "refresh-token", err, map[string]string{"auth_id": fmt.Sprintf("%d", stored.UserId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	// Someone else rotated this token between our read and our update.
+	if !revoked {
+		return nil, l.revokeFamily(ctx, stored, info)
+	}
+
+	var user *domain.User
+	var userEmail *domain.UserEmail
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "GetUserByUserId", info, func() {
+		user, userEmail, apierr = l.getUserByID(ctx, stored.UserId)
+	})
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if user == nil || userEmail == nil || user.DateDeleted != nil {
+		return nil, apierror.New(http.StatusUnauthorized, ErrInvalidRefreshToken, apierror.NewErrorCause(ErrInvalidRefreshToken, ErrInvalidRefreshTokenCode))
+	}
+
+	return l.issueTokens(ctx, user, userEmail, stored.FamilyId, nil, info)
+}
+
+func (l *loginService) revokeFamily(ctx context.Context, token *domain.RefreshToken, info *middleware.ContextInformation) apierror.ApiError {
+	clog.Warn("Refresh token reuse detected, revoking token family", "refresh-token", map[string]string{"auth_id": fmt.Sprintf("%d", token.UserId), "family_id": token.FamilyId})
+
+	if err := l.revokeSession(ctx, token.FamilyId, "", info); err != nil {
+		clog.Error("Error revoking refresh token family", "refresh-token", err, map[string]string{"family_id": token.FamilyId})
+	}
+
+	return apierror.New(http.StatusUnauthorized, ErrInvalidRefreshToken, apierror.NewErrorCause(ErrInvalidRefreshToken, ErrRefreshTokenReusedCode))
+}
 
+// Logout Revokes the session the access token belongs to
+func (l *loginService) Logout(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) apierror.ApiError {
+	if claims.SessionId != "" {
+		if err := l.revokeSession(ctx, claims.SessionId, claims.Id, info); err != nil {
+			clog.Error("Error revoking session", "logout", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+			return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+		}
+	}
+
+	return l.revokeCurrent(ctx, claims)
+}
+
+// LogoutAll Revokes every session of the user and every access token issued to them that hasn't expired yet
+func (l *loginService) LogoutAll(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) apierror.ApiError {
+	var tokens []domain.RefreshToken
+	var err error
+
+	performance.TrackTime(time.Now(), "RevokeUserSessions", info, func() {
+		err = l.repository.RevokeUserSessions(ctx, claims.AuthId)
+	})
+	if err != nil {
+		clog.Error("Error revoking sessions", "logout-all", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	performance.TrackTime(time.Now(), "RevokeUserRefreshTokens", info, func() {
+		err = l.repository.RevokeUserRefreshTokens(ctx, claims.AuthId)
+	})
+	if err != nil {
+		clog.Error("Error revoking refresh tokens", "logout-all", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	performance.TrackTime(time.Now(), "GetUserAccessTokens", info, func() {
+		tokens, err = l.repository.GetUserAccessTokens(ctx, claims.AuthId)
+	})
+	if err == nil {
+		err = l.revokeAccessTokens(ctx, tokens, claims.Id)
+	}
+	if err != nil {
+		clog.Error("Error revoking access tokens of the user", "logout-all", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	return l.revokeCurrent(ctx, claims)
+}
+
+// GetSessions Returns the sessions of the user that are still active
+func (l *loginService) GetSessions(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) ([]domain.Session, apierror.ApiError) {
+	var sessions []domain.Session
+	var err error
+
+	// A session whose last refresh token expired can't be used anymore.
+	activeSince := time.Now().Add(-l.cfg.TokenOptions.RefreshTokenDuration)
+	performance.TrackTime(time.Now(), "GetUserSessions", info, func() {
+		sessions, err = l.repository.GetUserSessions(ctx, claims.AuthId, activeSince)
+	})
+	if err != nil {
+		clog.Error("Error fetching sessions", "get-sessions", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if sessions == nil {
+		sessions = []domain.Session{}
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionId == claims.SessionId
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession Revokes one of the user's sessions
+func (l *loginService) RevokeSession(ctx context.Context, claims *encryption.AccessTokenClaims, sessionID string, info *middleware.ContextInformation) apierror.ApiError {
+	var session *domain.Session
+	var err error
+
+	performance.TrackTime(time.Now(), "GetSession", info, func() {
+		session, err = l.repository.GetSession(ctx, sessionID)
+	})
+	if err != nil {
+		clog.Error("Error fetching session", "revoke-session", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	// Sessions of other users are reported as not found so their IDs can't be probed.
+	if session == nil || session.UserId != claims.AuthId || session.DateRevoked.Valid {
+		return apierror.New(http.StatusNotFound, ErrSessionNotFound, apierror.NewErrorCause(ErrSessionNotFound, ErrSessionNotFoundCode))
+	}
+
+	if err := l.revokeSession(ctx, sessionID, "", info); err != nil {
+		clog.Error("Error revoking session", "revoke-session", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	return nil
+}
+
+// revokeSession Revokes the session, its refresh token family and every access token issued for it that hasn't expired
+// yet, but the one with the skip jti, which the caller revokes on its own.
+func (l *loginService) revokeSession(ctx context.Context, sessionID string, skip string, info *middleware.ContextInformation) error {
+	var tokens []domain.RefreshToken
+	var err error
+
+	performance.TrackTime(time.Now(), "RevokeSession", info, func() {
+		err = l.repository.RevokeSession(ctx, sessionID)
+	})
+	if err != nil {
+		return err
+	}
+
+	performance.TrackTime(time.Now(), "RevokeRefreshTokenFamily", info, func() {
+		err = l.repository.RevokeRefreshTokenFamily(ctx, sessionID)
+	})
+	if err != nil {
+		return err
+	}
+
+	performance.TrackTime(time.Now(), "GetFamilyAccessTokens", info, func() {
+		tokens, err = l.repository.GetFamilyAccessTokens(ctx, sessionID)
+	})
+	if err != nil {
+		return err
+	}
+
+	return l.revokeAccessTokens(ctx, tokens, skip)
+}
+
+// revokeCurrent The token used to log out is revoked explicitly, tokens issued before sid existed aren't linked to any
+// refresh token.
+func (l *loginService) revokeCurrent(ctx context.Context, claims *encryption.AccessTokenClaims) apierror.ApiError {
+	if err := l.revocations.Revoke(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		clog.Error("Error revoking access token", "logout", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	return nil
+}
+
+// revokeAccessTokens Revokes the access tokens issued with the refresh tokens once each, skipping the skip jti
+func (l *loginService) revokeAccessTokens(ctx context.Context, tokens []domain.RefreshToken, skip string) error {
+	revoked := map[string]bool{"": true, skip: true}
+	for _, t := range tokens {
+		if revoked[t.AccessTokenId] {
+			continue
+		}
+		revoked[t.AccessTokenId] = true
+		if err := l.revocations.Revoke(ctx, t.AccessTokenId, t.AccessTokenExpiryDate.Time); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// issueTokens Signs a new access token and stores a new refresh token. An empty familyID starts a new token family (a
+// new login, stored as a session of client), otherwise the refresh token is a rotation of an existing one.
+func (l *loginService) issueTokens(ctx context.Context, user *domain.User, userEmail *domain.UserEmail, familyID string, client *domain.ClientInfo, info *middleware.ContextInformation) (*domain.TokenResponse, apierror.ApiError) {
 	var role *domain.AssignedRole
 	var gErr error
-	performance.TrackTime(time.Now(), "getRole", ctx, func() {
-		role, gErr = getRole(user.AuthId, ctx)
+	performance.TrackTime(time.Now(), "getRole", info, func() {
+		role, gErr = l.getRole(ctx, user.AuthId, info)
 	})
 	if gErr != nil {
-		return "", apierror.NewInternalServerApiError("Cannot get role", gErr, "get_role")
+		return nil, apierror.NewInternalServerApiError("Cannot get role", gErr, "get_role")
+	}
+
+	var err error
+	if familyID == "" {
+		familyID, err = encryption.GenerateOpaqueToken(refreshTokenLength)
+		if err != nil {
+			return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, errTokenGenerationCode)
+		}
+
+		session := &domain.Session{SessionId: familyID, UserId: user.AuthId}
+		if client != nil {
+			session.UserAgent, session.IPAddress = truncate(client.UserAgent, maxUserAgentLength), client.IPAddress
+		}
+
+		performance.TrackTime(time.Now(), "AddSession", info, func() {
+			err = l.repository.AddSession(ctx, session)
+		})
+		if err != nil {
+			clog.Error("Error saving session", "issue-tokens", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+			return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, errTokenGenerationCode)
+		}
+	} else {
+		performance.TrackTime(time.Now(), "UpdateSessionLastRefresh", info, func() {
+			err = l.repository.UpdateSessionLastRefresh(ctx, familyID)
+		})
+		if err != nil {
+			clog.Error("Error updating session last refresh", "issue-tokens", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+		}
+	}
+
+	claims, err := encryption.NewAccessTokenClaims(user.AuthId, userEmail.Email, familyID, role.Roles, l.cfg)
+	if err != nil {
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, errTokenGenerationCode)
+	}
+
+	jwtString, err := l.signer.Sign(claims)
+	if err != nil {
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, errTokenGenerationCode)
+	}
+
+	refreshToken, err := encryption.GenerateOpaqueToken(refreshTokenLength)
+	if err != nil {
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, errTokenGenerationCode)
 	}
 
-	roleb, mErr := json.Marshal(role.Roles)
-	if mErr != nil {
-		return "", apierror.NewInternalServerApiError("Cannot get role", mErr, "marshal_role")
+	stored := &domain.RefreshToken{
+		UserId:     user.AuthId,
+		FamilyId:   familyID,
+		TokenHash:  encryption.HashOpaqueToken(refreshToken),
+		ExpiryDate: sql.NullTime{Time: time.Now().Add(l.cfg.TokenOptions.RefreshTokenDuration), Valid: true},
+
+		AccessTokenId:         claims.Id,
+		AccessTokenExpiryDate: sql.NullTime{Time: time.Unix(claims.ExpiresAt, 0), Valid: true},
 	}
 
-	jwt := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"auth_id":   user.AuthId,
-		"email":     userEmail.Email,
-		"timestamp": time.Now().Unix(),
-		"roles":      string(roleb),
+	performance.TrackTime(time.Now(), "AddRefreshToken", info, func() {
+		err = l.repository.AddRefreshToken(ctx, stored)
 	})
+	if err != nil {
+		clog.Error("Error saving refresh token", "issue-tokens", err, map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, errTokenGenerationCode)
+	}
+
+	return &domain.TokenResponse{
+		AccessToken:  jwtString,
+		TokenType:    tokenType,
+		ExpiresIn:    claims.ExpiresAt - claims.IssuedAt,
+		RefreshToken: refreshToken,
+	}, nil
+}
 
-	jwtString, _ := jwt.SignedString([]byte(l.cfg.JwtSign))
+// rehashPassword Upgrades the hash of the password to the current Argon2 params. Failing to do it doesn't stop the login,
+// it will be tried again the next time.
+func (l *loginService) rehashPassword(ctx context.Context, user *domain.User, password string) {
+	tags := map[string]string{"auth_id": fmt.Sprintf("%d", user.AuthId)}
+
+	rehash, err := encryption.NeedsRehash(user.PasswordHash, l.cfg)
+	if err != nil || !rehash {
+		return
+	}
 
-	return jwtString, nil
+	hash, err := encryption.GenerateEncodedHash(password, l.cfg)
+	if err != nil {
+		clog.Error("Can't rehash password", "rehash-password", err, tags)
+		return
+	}
+
+	if err := l.repository.UpdatePasswordHash(ctx, user.AuthId, hash); err != nil {
+		clog.Error("Can't update password hash", "rehash-password", err, tags)
+		return
+	}
+
+	user.PasswordHash = hash
+}
+
+// getUserByIdentifier Users can log in with their username or their email. Usernames can't have an @ so anything with
+// one is an email. Both lookups answer the same error when there's no such user, so the response doesn't tell which
+// identifiers exist.
+func (l *loginService) getUserByIdentifier(ctx context.Context, identifier string) (*domain.User, *domain.UserEmail, apierror.ApiError) {
+	if strings.Contains(identifier, "@") {
+		return l.getUser(ctx, func() (*domain.User, error) { return l.users.GetUserByEmail(ctx, identifier) })
+	}
+
+	return l.getUser(ctx, func() (*domain.User, error) { return l.users.GetUserByUsername(ctx, identifier) })
+}
 
+func (l *loginService) getUserByID(ctx context.Context, userID int64) (*domain.User, *domain.UserEmail, apierror.ApiError) {
+	return l.getUser(ctx, func() (*domain.User, error) { return l.users.GetUser(ctx, userID) })
+}
+
+// getUser Returns the user find looks up along with their email. Not finding either is answered like a wrong password.
+func (l *loginService) getUser(ctx context.Context, find func() (*domain.User, error)) (*domain.User, *domain.UserEmail, apierror.ApiError) {
+	user, err := find()
+	if err != nil {
+		return nil, nil, userError(err, ErrUserFetchFailed)
+	}
+
+	userEmail, err := l.users.GetEmail(ctx, user.AuthId)
+	if err != nil {
+		return nil, nil, userError(err, ErrEmailFetchFailed)
+	}
+
+	return user, userEmail, nil
+}
+
+func userError(err error, code string) apierror.ApiError {
+	if users.IsNotFound(err) {
+		return apierror.New(http.StatusBadRequest, ErrInvalidLogin, apierror.NewErrorCause(ErrInvalidLogin, ErrInvalidLoginCode))
+	}
+
+	return apierror.New(http.StatusInternalServerError, ErrFailedTryingToLogin, apierror.NewErrorCause(err.Error(), code))
 }
 
 func (l *loginService) UserCanLogin(u *domain.UserLoginDTO) apierror.ApiError {
@@ -200,27 +879,18 @@ func (l *loginService) UserCanLogin(u *domain.UserLoginDTO) apierror.ApiError {
 	return nil
 }
 
-func comparePasswordAndHash(password, encodedHash string) (bool, error) {
-	// Extract the parameters, salt and derived key from the encoded password
-	// hash.
-	p, salt, hash, err := encryption.DecodeHash(encodedHash)
-	if err != nil {
-		return false, err
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
 	}
+	return s[:length]
+}
 
-	// Derive the key from the other password using the same parameters.
-	otherHash := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
-
-	// Check that the contents of the hashed passwords are identical. Note
-	// that we are using the subtle.ConstantTimeCompare() function for this
-	// to help prevent timing attacks.
-	if subtle.ConstantTimeCompare(hash, otherHash) == 1 {
-		return true, nil
-	}
-	return false, nil
+func comparePasswordAndHash(password, encodedHash string, cfg *config.EnigmaConfig) (bool, error) {
+	return encryption.CompareEncodedHash(password, encodedHash, cfg)
 }
 
-func getRole(authid int64, ctx *middleware.ContextInformation) (*domain.AssignedRole, error) {
+func (l *loginService) getRole(ctx context.Context, authid int64, info *middleware.ContextInformation) (*domain.AssignedRole, error) {
 	var roleresp *domain.RoleResponse
 	role := &domain.AssignedRole{}
 	var res *resty.Response
@@ -229,12 +899,13 @@ func getRole(authid int64, ctx *middleware.ContextInformation) (*domain.Assigned
 	authstr := strconv.FormatInt(authid, 10)
 
 	// TODO: Move this to a client
-	performance.TrackTime(time.Now(), "GetRoleAPICall", ctx, func() {
-		res, err = resty.New().SetHostURL(baseURL).R().SetPathParams(map[string]string{"auth_id": authstr}).Get("/assign/{auth_id}")
+	performance.TrackTime(time.Now(), "GetRoleAPICall", info, func() {
+		res, err = resty.New().SetHostURL(baseURL).SetTimeout(l.cfg.TimeoutOptions.Roles).R().SetContext(ctx).SetPathParams(map[string]string{"auth_id": authstr}).Get("/assign/{auth_id}")
 	})
 
 	if err != nil {
 		clog.Error("Rest client error", "get-role", err, nil)
+		return nil, err
 	}
 	if res.IsError() {
 		clog.Error("Status error - GetRole", "get-role", errors.New("status error - GetRole"), map[string]string{"status": res.Status()})
@@ -246,6 +917,12 @@ func getRole(authid int64, ctx *middleware.ContextInformation) (*domain.Assigned
 		return nil, err
 	}
 
+	if roleresp == nil || len(roleresp.Results) == 0 {
+		err = errors.New("the user has no roles assigned")
+		clog.Error("Empty response - GetRole", "get-role", err, map[string]string{"auth_id": authstr})
+		return nil, err
+	}
+
 	role.AuthID = fmt.Sprintf("%d", roleresp.Results[0].AuthID)
 	for _, r := range roleresp.Results[0].Roles {
 		ur := domain.Role{}
@@ -1,15 +1,25 @@
 package login
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"reflect"
 	"testing"
 	"time"
 
+	"database/sql"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
-	"github.com/CienciaArgentina/go-backend-commons/pkg/rest"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
 	"github.com/CienciaArgentina/go-enigma/config"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/internal/mfa"
+	"github.com/CienciaArgentina/go-enigma/internal/revocation"
+	"github.com/CienciaArgentina/go-enigma/internal/users"
+	"github.com/CienciaArgentina/go-enigma/internal/webauthn"
+	"github.com/dgrijalva/jwt-go"
 )
 
 const (
@@ -18,50 +28,230 @@ const (
 	ResetLoginFailsMockID
 	UnlockAccountMockID
 	LockAccountMockID
+	GetUserByUserIdMockID
+	AddRefreshTokenMockID
+	GetRefreshTokenMockID
+	RevokeRefreshTokenMockID
+	RevokeRefreshTokenFamilyMockID
+	RevokeUserRefreshTokensMockID
+	GetFamilyAccessTokensMockID
+	GetUserAccessTokensMockID
+	AddSessionMockID
+	UpdateSessionLastRefreshMockID
+	GetSessionMockID
+	GetUserSessionsMockID
+	RevokeSessionMockID
+	RevokeUserSessionsMockID
+	GetUserByEmailMockID
+	AddMagicLinkMockID
+	GetMagicLinkMockID
+	UseMagicLinkMockID
+	UpdatePasswordHashMockID
 )
 
 type MockRepository struct {
 	Responses map[int]interface{}
-	Errors    map[int]apierror.ApiError
+	Errors    map[int]error
+
+	RevokedFamilies []string
+	RevokedSessions []string
+	FailedAttempts  int
+	Locks           int
+	Resets          int
+	MagicLinks      []*domain.MagicLink
+	PasswordHash    string
+
+	email *domain.UserEmail
+}
+
+type MockMFAService struct {
+	Enabled bool
+	Valid   bool
+	Error   error
+}
+
+func (m *MockMFAService) Enroll(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.MFAEnrollment, apierror.ApiError) {
+	return nil, nil
+}
+
+func (m *MockMFAService) Confirm(ctx context.Context, claims *encryption.AccessTokenClaims, code string, info *middleware.ContextInformation) (*domain.RecoveryCodes, apierror.ApiError) {
+	return nil, nil
+}
+
+func (m *MockMFAService) RegenerateRecoveryCodes(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.RecoveryCodes, apierror.ApiError) {
+	return nil, nil
+}
+
+func (m *MockMFAService) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	return m.Enabled, m.Error
+}
+
+func (m *MockMFAService) VerifyCode(ctx context.Context, userID int64, code string) (bool, error) {
+	return m.Valid, m.Error
+}
+
+type MockWebAuthnService struct {
+	UserID int64
+	Error  apierror.ApiError
+}
+
+func (m *MockWebAuthnService) RegistrationOptions(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.CredentialCreationOptions, apierror.ApiError) {
+	return nil, nil
+}
+
+func (m *MockWebAuthnService) Register(ctx context.Context, claims *encryption.AccessTokenClaims, dto *domain.RegistrationCredentialDTO, info *middleware.ContextInformation) (*domain.WebAuthnCredential, apierror.ApiError) {
+	return nil, nil
+}
+
+func (m *MockWebAuthnService) LoginOptions(ctx context.Context, info *middleware.ContextInformation) (*domain.CredentialRequestOptions, apierror.ApiError) {
+	return nil, nil
+}
+
+func (m *MockWebAuthnService) VerifyAssertion(ctx context.Context, dto *domain.AssertionCredentialDTO, info *middleware.ContextInformation) (int64, apierror.ApiError) {
+	return m.UserID, m.Error
 }
 
-func (m *MockRepository) GetUserByUsername(username string) (*domain.User, *domain.UserEmail, apierror.ApiError) {
-	return m.Responses[GetUserByUsernameMockID].([]interface{})[0].(*domain.User),
-		m.Responses[GetUserByUsernameMockID].([]interface{})[1].(*domain.UserEmail),
-		m.Errors[GetUserByUsernameMockID]
+func (m *MockRepository) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	return m.user(GetUserByUsernameMockID)
 }
 
-func (m *MockRepository) IncrementLoginFailAttempt(userID int64) error {
+func (m *MockRepository) IncrementLoginFailAttempt(ctx context.Context, userID int64) error {
+	m.FailedAttempts++
 	return m.Errors[IncrementLoginFailAttemptMockID]
 }
 
-func (m *MockRepository) ResetLoginFails(userID int64) error {
+func (m *MockRepository) ResetLoginFails(ctx context.Context, userID int64) error {
+	m.Resets++
 	return m.Errors[ResetLoginFailsMockID]
 }
 
-func (m *MockRepository) UnlockAccount(userID int64) error {
+func (m *MockRepository) UnlockAccount(ctx context.Context, userID int64) error {
 	return m.Errors[UnlockAccountMockID]
 }
 
-func (m *MockRepository) LockAccount(userID int64, duration time.Duration) error {
+func (m *MockRepository) LockAccount(ctx context.Context, userID int64, duration time.Duration) error {
+	m.Locks++
 	return m.Errors[LockAccountMockID]
 }
 
+func (m *MockRepository) GetUser(ctx context.Context, userID int64) (*domain.User, error) {
+	return m.user(GetUserByUserIdMockID)
+}
+
+func (m *MockRepository) UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error {
+	m.PasswordHash = passwordHash
+	return m.Errors[UpdatePasswordHashMockID]
+}
+
+func (m *MockRepository) AddRefreshToken(ctx context.Context, token *domain.RefreshToken) error {
+	return m.Errors[AddRefreshTokenMockID]
+}
+
+func (m *MockRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	return m.Responses[GetRefreshTokenMockID].(*domain.RefreshToken), m.Errors[GetRefreshTokenMockID]
+}
+
+func (m *MockRepository) RevokeRefreshToken(ctx context.Context, refreshTokenID int64) (bool, error) {
+	return m.Responses[RevokeRefreshTokenMockID].(bool), m.Errors[RevokeRefreshTokenMockID]
+}
+
+func (m *MockRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	m.RevokedFamilies = append(m.RevokedFamilies, familyID)
+	return m.Errors[RevokeRefreshTokenFamilyMockID]
+}
+
+func (m *MockRepository) RevokeUserRefreshTokens(ctx context.Context, userID int64) error {
+	return m.Errors[RevokeUserRefreshTokensMockID]
+}
+
+func (m *MockRepository) GetFamilyAccessTokens(ctx context.Context, familyID string) ([]domain.RefreshToken, error) {
+	tokens, _ := m.Responses[GetFamilyAccessTokensMockID].([]domain.RefreshToken)
+	return tokens, m.Errors[GetFamilyAccessTokensMockID]
+}
+
+func (m *MockRepository) GetUserAccessTokens(ctx context.Context, userID int64) ([]domain.RefreshToken, error) {
+	tokens, _ := m.Responses[GetUserAccessTokensMockID].([]domain.RefreshToken)
+	return tokens, m.Errors[GetUserAccessTokensMockID]
+}
+
+func (m *MockRepository) AddSession(ctx context.Context, session *domain.Session) error {
+	return m.Errors[AddSessionMockID]
+}
+
+func (m *MockRepository) UpdateSessionLastRefresh(ctx context.Context, sessionID string) error {
+	return m.Errors[UpdateSessionLastRefreshMockID]
+}
+
+func (m *MockRepository) GetSession(ctx context.Context, sessionID string) (*domain.Session, error) {
+	session, _ := m.Responses[GetSessionMockID].(*domain.Session)
+	return session, m.Errors[GetSessionMockID]
+}
+
+func (m *MockRepository) GetUserSessions(ctx context.Context, userID int64, activeSince time.Time) ([]domain.Session, error) {
+	sessions, _ := m.Responses[GetUserSessionsMockID].([]domain.Session)
+	return sessions, m.Errors[GetUserSessionsMockID]
+}
+
+func (m *MockRepository) RevokeSession(ctx context.Context, sessionID string) error {
+	m.RevokedSessions = append(m.RevokedSessions, sessionID)
+	return m.Errors[RevokeSessionMockID]
+}
+
+func (m *MockRepository) RevokeUserSessions(ctx context.Context, userID int64) error {
+	return m.Errors[RevokeUserSessionsMockID]
+}
+
+func (m *MockRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return m.user(GetUserByEmailMockID)
+}
+
+func (m *MockRepository) GetEmail(ctx context.Context, userID int64) (*domain.UserEmail, error) {
+	return m.email, nil
+}
+
+// user Returns the user and email set for the lookup, the email is kept for GetEmail
+func (m *MockRepository) user(id int) (*domain.User, error) {
+	user, _ := m.Responses[id].([]interface{})
+	if user == nil {
+		return nil, m.Errors[id]
+	}
+	m.email = user[1].(*domain.UserEmail)
+	return user[0].(*domain.User), m.Errors[id]
+}
+
+func (m *MockRepository) AddMagicLink(ctx context.Context, link *domain.MagicLink) error {
+	m.MagicLinks = append(m.MagicLinks, link)
+	return m.Errors[AddMagicLinkMockID]
+}
+
+func (m *MockRepository) GetMagicLink(ctx context.Context, tokenHash string) (*domain.MagicLink, error) {
+	link, _ := m.Responses[GetMagicLinkMockID].(*domain.MagicLink)
+	return link, m.Errors[GetMagicLinkMockID]
+}
+
+func (m *MockRepository) UseMagicLink(ctx context.Context, magicLinkID int64) (bool, error) {
+	used, ok := m.Responses[UseMagicLinkMockID].(bool)
+	if !ok {
+		used = true
+	}
+	return used, m.Errors[UseMagicLinkMockID]
+}
+
 func Test_loginService_LoginUser(t *testing.T) {
 	type fields struct {
 		cfg          *config.EnigmaConfig
 		loginOptions *config.LoginOptions
-		repository   Repository
+		repository   *MockRepository
 	}
 	type args struct {
-		u   *domain.UserLoginDTO
-		ctx *rest.ContextInformation
+		u    *domain.UserLoginDTO
+		info *middleware.ContextInformation
 	}
 	tests := []struct {
 		name   string
 		fields fields
 		args   args
-		want   string
+		want   *domain.TokenResponse
 		want1  apierror.ApiError
 	}{
 		{
@@ -71,9 +261,9 @@ func Test_loginService_LoginUser(t *testing.T) {
 					Username: "",
 					Password: "test",
 				},
-				ctx: &rest.ContextInformation{},
+				info: &middleware.ContextInformation{},
 			},
-			want:  "",
+			want:  nil,
 			want1: apierror.NewBadRequestApiError(domain.ErrEmptyUsername),
 		},
 		{
@@ -83,9 +273,9 @@ func Test_loginService_LoginUser(t *testing.T) {
 					Username: "test",
 					Password: "",
 				},
-				ctx: &rest.ContextInformation{},
+				info: &middleware.ContextInformation{},
 			},
-			want:  "",
+			want:  nil,
 			want1: apierror.NewBadRequestApiError(domain.ErrEmptyPassword),
 		},
 		{
@@ -95,7 +285,7 @@ func Test_loginService_LoginUser(t *testing.T) {
 					Username: "test",
 					Password: "test",
 				},
-				ctx: &rest.ContextInformation{},
+				info: &middleware.ContextInformation{},
 			},
 			fields: fields{
 				repository: &MockRepository{
@@ -105,13 +295,13 @@ func Test_loginService_LoginUser(t *testing.T) {
 							&domain.UserEmail{},
 						},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetUserByUsernameMockID: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+					Errors: map[int]error{
+						GetUserByUsernameMockID: errors.New("error"),
 					},
 				},
 			},
-			want:  "",
-			want1: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+			want:  nil,
+			want1: apierror.New(http.StatusInternalServerError, ErrFailedTryingToLogin, apierror.NewErrorCause("error", ErrUserFetchFailed)),
 		},
 		{
 			name: "password_mismatch",
@@ -120,7 +310,7 @@ func Test_loginService_LoginUser(t *testing.T) {
 					Username: "test",
 					Password: "test",
 				},
-				ctx: &rest.ContextInformation{},
+				info: &middleware.ContextInformation{},
 			},
 			fields: fields{
 				repository: &MockRepository{
@@ -132,13 +322,13 @@ func Test_loginService_LoginUser(t *testing.T) {
 							&domain.UserEmail{},
 						},
 					},
-					Errors: map[int]apierror.ApiError{
+					Errors: map[int]error{
 						GetUserByUsernameMockID: nil,
 					},
 				},
 			},
-			want:  "",
-			want1: apierror.NewInternalServerApiError(domain.ErrUnexpectedError, errors.New("encoded hash string is not 6"), domain.ErrInternalCode),
+			want:  nil,
+			want1: apierror.NewInternalServerApiError(domain.ErrUnexpectedError, errors.New("el hash no corresponde a ningún algoritmo conocido"), domain.ErrInternalCode),
 		},
 	}
 	for _, tt := range tests {
@@ -147,9 +337,10 @@ func Test_loginService_LoginUser(t *testing.T) {
 				cfg:          tt.fields.cfg,
 				loginOptions: tt.fields.loginOptions,
 				repository:   tt.fields.repository,
+				users:        tt.fields.repository,
 			}
-			got, got1 := l.LoginUser(tt.args.u, tt.args.ctx)
-			if got != tt.want {
+			got, got1 := l.LoginUser(context.Background(), tt.args.u, &domain.ClientInfo{}, tt.args.info)
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("loginService.LoginUser() got = %v, want %v", got, tt.want)
 			}
 			if !reflect.DeepEqual(got1, tt.want1) {
@@ -158,3 +349,851 @@ func Test_loginService_LoginUser(t *testing.T) {
 		})
 	}
 }
+
+func Test_loginService_LoginUser_mfaRequired(t *testing.T) {
+	cfg := &config.EnigmaConfig{
+		Keys:         &config.Keys{PasswordHashingKey: "key"},
+		ArgonParams:  &config.ArgonParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16},
+		TokenOptions: &config.TokenOptions{MFATokenDuration: 5 * time.Minute},
+	}
+	hash, err := encryption.GenerateEncodedHash("password", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repository := &MockRepository{Responses: map[int]interface{}{
+		GetUserByUsernameMockID: []interface{}{&domain.User{AuthId: 123, PasswordHash: hash}, &domain.UserEmail{VerfiedEmail: true}},
+	}}
+	l := &loginService{
+		cfg:          cfg,
+		loginOptions: setLoginOptions(),
+		repository:   repository,
+		users:        repository,
+		mfa:          &MockMFAService{Enabled: true},
+	}
+
+	got, apierr := l.LoginUser(context.Background(), &domain.UserLoginDTO{Username: "test", Password: "password"}, &domain.ClientInfo{}, &middleware.ContextInformation{})
+	if apierr != nil {
+		t.Fatalf("loginService.LoginUser() unexpected error %v", apierr)
+	}
+
+	if !got.MFARequired || got.AccessToken != "" || got.RefreshToken != "" || got.ExpiresIn != 300 {
+		t.Errorf("loginService.LoginUser() got = %+v, want only the mfa token", got)
+	}
+
+	if authID, err := encryption.ParseMFAToken(got.MFAToken, cfg); err != nil || authID != 123 {
+		t.Errorf("loginService.LoginUser() mfa token auth id = %v, err %v", authID, err)
+	}
+
+	if repository.Resets != 0 {
+		t.Errorf("loginService.LoginUser() failed attempts must not be reset before the second factor")
+	}
+}
+
+func Test_loginService_LoginUser_email(t *testing.T) {
+	cfg := &config.EnigmaConfig{
+		Keys:         &config.Keys{PasswordHashingKey: "key"},
+		ArgonParams:  &config.ArgonParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16},
+		TokenOptions: &config.TokenOptions{MFATokenDuration: 5 * time.Minute},
+	}
+	hash, err := encryption.GenerateEncodedHash("password", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notFound := apierror.New(http.StatusBadRequest, ErrInvalidLogin, apierror.NewErrorCause(ErrInvalidLogin, ErrInvalidLoginCode))
+
+	// Users with two-factor authentication stop at the challenge, before the tokens are issued
+	repository := &MockRepository{Responses: map[int]interface{}{
+		GetUserByEmailMockID: []interface{}{&domain.User{AuthId: 123, PasswordHash: hash}, &domain.UserEmail{VerfiedEmail: true}},
+	}}
+	l := &loginService{
+		cfg:          cfg,
+		loginOptions: setLoginOptions(),
+		repository:   repository,
+		users:        repository,
+		mfa:          &MockMFAService{Enabled: true},
+	}
+	got, apierr := l.LoginUser(context.Background(), &domain.UserLoginDTO{Username: "Test@Test.com", Password: "password"}, &domain.ClientInfo{}, &middleware.ContextInformation{})
+	if apierr != nil || !got.MFARequired {
+		t.Errorf("loginService.LoginUser() got = %+v, got1 = %v, want the user found by email", got, apierr)
+	}
+
+	// An unknown email and an unknown username get the same answer
+	for _, identifier := range []string{"nobody@test.com", "nobody"} {
+		repository := &MockRepository{Errors: map[int]error{GetUserByEmailMockID: users.ErrUserNotFound, GetUserByUsernameMockID: users.ErrUserNotFound}}
+		l.repository, l.users = repository, repository
+		_, apierr := l.LoginUser(context.Background(), &domain.UserLoginDTO{Username: identifier, Password: "password"}, &domain.ClientInfo{}, &middleware.ContextInformation{})
+		if !reflect.DeepEqual(apierr, notFound) {
+			t.Errorf("loginService.LoginUser(%v) got1 = %v, want %v", identifier, apierr, notFound)
+		}
+	}
+}
+
+func Test_loginService_LoginUser_rehash(t *testing.T) {
+	old := &config.EnigmaConfig{ArgonParams: &config.ArgonParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16}}
+	current := &config.EnigmaConfig{
+		Keys:         &config.Keys{PasswordHashingKey: "key"},
+		ArgonParams:  &config.ArgonParams{Memory: 2048, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		TokenOptions: &config.TokenOptions{MFATokenDuration: 5 * time.Minute},
+	}
+	oldHash, err := encryption.GenerateEncodedHash("password", old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentHash, err := encryption.GenerateEncodedHash("password", current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		rehashed bool
+	}{
+		{name: "old_params", hash: oldHash, password: "password", rehashed: true},
+		{name: "current_params", hash: currentHash, password: "password"},
+		{name: "wrong_password", hash: oldHash, password: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &MockRepository{Responses: map[int]interface{}{
+				GetUserByUsernameMockID: []interface{}{&domain.User{AuthId: 123, PasswordHash: tt.hash}, &domain.UserEmail{VerfiedEmail: true}},
+			}}
+			// Two-factor authentication stops the login before the tokens are issued
+			l := &loginService{cfg: current, loginOptions: setLoginOptions(), repository: repository, users: repository, mfa: &MockMFAService{Enabled: true}}
+
+			l.LoginUser(context.Background(), &domain.UserLoginDTO{Username: "test", Password: tt.password}, &domain.ClientInfo{}, &middleware.ContextInformation{}) // nolint
+
+			if (repository.PasswordHash != "") != tt.rehashed {
+				t.Fatalf("loginService.LoginUser() rehashed = %v, want %v", repository.PasswordHash != "", tt.rehashed)
+			}
+			if !tt.rehashed {
+				return
+			}
+
+			if ok, err := encryption.CompareEncodedHash("password", repository.PasswordHash, current); err != nil || !ok {
+				t.Errorf("loginService.LoginUser() new hash doesn't match the password")
+			}
+			if rehash, _ := encryption.NeedsRehash(repository.PasswordHash, current); rehash {
+				t.Errorf("loginService.LoginUser() new hash doesn't use the current params")
+			}
+		})
+	}
+}
+
+func Test_loginService_LoginMFA(t *testing.T) {
+	cfg := &config.EnigmaConfig{
+		Keys:         &config.Keys{PasswordHashingKey: "key"},
+		TokenOptions: &config.TokenOptions{MFATokenDuration: 5 * time.Minute},
+	}
+	token, err := encryption.GenerateMFAToken(123, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := func(failedAttempts int) []interface{} {
+		return []interface{}{&domain.User{AuthId: 123, FailedLoginAttempts: failedAttempts}, &domain.UserEmail{}}
+	}
+	lockedMsg := fmt.Sprintf("Debido a repetidos intentos tu cuenta fue bloqueada por %v minutos", setLoginOptions().LockoutOptions.LockoutTimeDuration.Minutes())
+
+	tests := []struct {
+		name           string
+		dto            *domain.MFALoginDTO
+		repository     *MockRepository
+		mfa            *MockMFAService
+		want1          apierror.ApiError
+		failedAttempts int
+		locks          int
+	}{
+		{
+			name:       "empty_code",
+			dto:        &domain.MFALoginDTO{MFAToken: token},
+			repository: &MockRepository{},
+			mfa:        &MockMFAService{},
+			want1:      apierror.NewBadRequestApiError(domain.ErrEmptyField),
+		},
+		{
+			name:       "invalid_token",
+			dto:        &domain.MFALoginDTO{MFAToken: "invalid", Code: "123456"},
+			repository: &MockRepository{},
+			mfa:        &MockMFAService{},
+			want1:      apierror.New(http.StatusUnauthorized, ErrInvalidMFAToken, apierror.NewErrorCause(ErrInvalidMFAToken, ErrInvalidMFATokenCode)),
+		},
+		{
+			name:           "invalid_code",
+			dto:            &domain.MFALoginDTO{MFAToken: token, Code: "123456"},
+			repository:     &MockRepository{Responses: map[int]interface{}{GetUserByUserIdMockID: user(0)}},
+			mfa:            &MockMFAService{Valid: false},
+			want1:          apierror.New(http.StatusBadRequest, mfa.ErrInvalidMFACode, apierror.NewErrorCause(mfa.ErrInvalidMFACode, mfa.ErrInvalidMFACodeCode)),
+			failedAttempts: 1,
+		},
+		{
+			name:       "too_many_attempts",
+			dto:        &domain.MFALoginDTO{MFAToken: token, Code: "123456"},
+			repository: &MockRepository{Responses: map[int]interface{}{GetUserByUserIdMockID: user(5)}},
+			mfa:        &MockMFAService{Valid: false},
+			want1:      apierror.NewBadRequestApiError(lockedMsg),
+			locks:      1,
+		},
+		{
+			name:       "verification_error",
+			dto:        &domain.MFALoginDTO{MFAToken: token, Code: "123456"},
+			repository: &MockRepository{Responses: map[int]interface{}{GetUserByUserIdMockID: user(0)}},
+			mfa:        &MockMFAService{Error: errors.New("error")},
+			want1:      apierror.NewInternalServerApiError(domain.ErrUnexpectedError, errors.New("error"), domain.ErrInternalCode),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &loginService{
+				cfg:          cfg,
+				loginOptions: setLoginOptions(),
+				repository:   tt.repository,
+				users:        tt.repository,
+				mfa:          tt.mfa,
+			}
+			got, got1 := l.LoginMFA(context.Background(), tt.dto, &domain.ClientInfo{}, &middleware.ContextInformation{})
+			if got != nil {
+				t.Errorf("loginService.LoginMFA() got = %v, want nil", got)
+			}
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("loginService.LoginMFA() got1 = %v, want %v", got1, tt.want1)
+			}
+			if tt.repository.FailedAttempts != tt.failedAttempts || tt.repository.Locks != tt.locks {
+				t.Errorf("loginService.LoginMFA() failed attempts = %v, locks = %v", tt.repository.FailedAttempts, tt.repository.Locks)
+			}
+		})
+	}
+}
+
+func Test_loginService_LoginWebAuthn(t *testing.T) {
+	invalid := apierror.New(http.StatusUnauthorized, webauthn.ErrInvalidCredential, apierror.NewErrorCause(webauthn.ErrInvalidCredential, webauthn.ErrInvalidCredentialCode))
+	notVerified := apierror.New(http.StatusBadRequest, ErrEmailNotVerified, apierror.NewErrorCause("test@test.com", ErrEmailNotVerifiedCode))
+	notVerified.AddError("123", ErrEmailNotVerifiedCode)
+	deleted := time.Now()
+
+	tests := []struct {
+		name       string
+		repository *MockRepository
+		webauthn   *MockWebAuthnService
+		want1      apierror.ApiError
+	}{
+		{
+			name:       "invalid_assertion",
+			repository: &MockRepository{},
+			webauthn:   &MockWebAuthnService{Error: invalid},
+			want1:      invalid,
+		},
+		{
+			name: "deleted_user",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetUserByUserIdMockID: []interface{}{&domain.User{AuthId: 123, DateDeleted: &deleted}, &domain.UserEmail{VerfiedEmail: true}},
+			}},
+			webauthn: &MockWebAuthnService{UserID: 123},
+			want1:    invalid,
+		},
+		{
+			name: "email_not_verified",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetUserByUserIdMockID: []interface{}{&domain.User{AuthId: 123}, &domain.UserEmail{Email: "test@test.com"}},
+			}},
+			webauthn: &MockWebAuthnService{UserID: 123},
+			want1:    notVerified,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &loginService{
+				loginOptions: setLoginOptions(),
+				repository:   tt.repository,
+				users:        tt.repository,
+				webauthn:     tt.webauthn,
+			}
+			got, got1 := l.LoginWebAuthn(context.Background(), &domain.AssertionCredentialDTO{}, &domain.ClientInfo{}, &middleware.ContextInformation{})
+			if got != nil {
+				t.Errorf("loginService.LoginWebAuthn() got = %v, want nil", got)
+			}
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("loginService.LoginWebAuthn() got1 = %v, want %v", got1, tt.want1)
+			}
+			if tt.repository.Resets != 0 {
+				t.Errorf("loginService.LoginWebAuthn() failed attempts must not be reset")
+			}
+		})
+	}
+}
+
+func Test_loginService_SendMagicLink(t *testing.T) {
+	deleted := time.Now()
+
+	tests := []struct {
+		name       string
+		email      string
+		repository *MockRepository
+		want       apierror.ApiError
+	}{
+		{
+			name:       "empty_email",
+			repository: &MockRepository{},
+			want:       apierror.NewBadRequestApiError(domain.ErrEmptyEmail),
+		},
+		{
+			// Nobody should be able to tell which emails are registered
+			name:       "not_registered",
+			email:      "test@test.com",
+			repository: &MockRepository{Errors: map[int]error{GetUserByEmailMockID: users.ErrUserNotFound}},
+		},
+		{
+			name:  "deleted_user",
+			email: "test@test.com",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetUserByEmailMockID: []interface{}{&domain.User{AuthId: 123, DateDeleted: &deleted}, &domain.UserEmail{Email: "test@test.com"}},
+			}},
+		},
+		{
+			name:       "fetch_error",
+			email:      "test@test.com",
+			repository: &MockRepository{Errors: map[int]error{GetUserByEmailMockID: errors.New("error")}},
+			want:       apierror.New(http.StatusInternalServerError, ErrFailedTryingToLogin, apierror.NewErrorCause("error", ErrUserFetchFailed)),
+		},
+		{
+			name:  "save_error",
+			email: "test@test.com",
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetUserByEmailMockID: []interface{}{&domain.User{AuthId: 123}, &domain.UserEmail{Email: "test@test.com"}},
+				},
+				Errors: map[int]error{
+					AddMagicLinkMockID: apierror.NewInternalServerApiError("error", errors.New("error"), "test"),
+				},
+			},
+			want: apierror.NewInternalServerApiError(domain.ErrUnexpectedError, apierror.NewInternalServerApiError("error", errors.New("error"), "test"), domain.ErrInternalCode),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &loginService{
+				cfg:          &config.EnigmaConfig{TokenOptions: &config.TokenOptions{MagicLinkDuration: 15 * time.Minute}},
+				loginOptions: setLoginOptions(),
+				repository:   tt.repository,
+				users:        tt.repository,
+			}
+			if got := l.SendMagicLink(context.Background(), tt.email, &middleware.ContextInformation{}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loginService.SendMagicLink() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The link is stored hashed and expires
+	repository := &MockRepository{
+		Responses: map[int]interface{}{
+			GetUserByEmailMockID: []interface{}{&domain.User{AuthId: 123}, &domain.UserEmail{Email: "test@test.com"}},
+		},
+		Errors: map[int]error{
+			AddMagicLinkMockID: apierror.NewInternalServerApiError("error", errors.New("error"), "test"),
+		},
+	}
+	l := &loginService{cfg: &config.EnigmaConfig{TokenOptions: &config.TokenOptions{MagicLinkDuration: 15 * time.Minute}}, repository: repository, users: repository}
+	l.SendMagicLink(context.Background(), "test@test.com", &middleware.ContextInformation{}) // nolint
+	if len(repository.MagicLinks) != 1 {
+		t.Fatalf("loginService.SendMagicLink() stored %v links, want 1", len(repository.MagicLinks))
+	}
+	link := repository.MagicLinks[0]
+	if link.UserId != 123 || len(link.TokenHash) == 0 || !link.ExpiryDate.Valid ||
+		link.ExpiryDate.Time.Before(time.Now().Add(14*time.Minute)) || link.ExpiryDate.Time.After(time.Now().Add(15*time.Minute)) {
+		t.Errorf("loginService.SendMagicLink() stored = %+v", link)
+	}
+}
+
+func Test_loginService_LoginMagicLink(t *testing.T) {
+	invalid := apierror.New(http.StatusUnauthorized, ErrInvalidMagicLink, apierror.NewErrorCause(ErrInvalidMagicLink, ErrInvalidMagicLinkCode))
+	notVerified := apierror.New(http.StatusBadRequest, ErrEmailNotVerified, apierror.NewErrorCause("test@test.com", ErrEmailNotVerifiedCode))
+	notVerified.AddError("123", ErrEmailNotVerifiedCode)
+	locked := fmt.Sprintf("La cuenta se encuentra bloqueada por %v minutos por intentos fallidos de login", setLoginOptions().LockoutOptions.LockoutTimeDuration.Minutes())
+	link := func(expiry time.Duration, used bool) *domain.MagicLink {
+		return &domain.MagicLink{
+			MagicLinkId: 1,
+			UserId:      123,
+			ExpiryDate:  sql.NullTime{Time: time.Now().Add(expiry), Valid: true},
+			DateUsed:    sql.NullTime{Valid: used},
+		}
+	}
+	user := func(u *domain.User, verified bool) []interface{} {
+		return []interface{}{u, &domain.UserEmail{Email: "test@test.com", VerfiedEmail: verified}}
+	}
+	cfg := &config.EnigmaConfig{
+		Keys:         &config.Keys{PasswordHashingKey: "key"},
+		TokenOptions: &config.TokenOptions{MFATokenDuration: 5 * time.Minute},
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		repository *MockRepository
+		mfa        *MockMFAService
+		want1      apierror.ApiError
+		wantMFA    bool
+	}{
+		{
+			name:       "empty_token",
+			repository: &MockRepository{},
+			want1:      apierror.NewBadRequestApiError(domain.ErrEmptyField),
+		},
+		{
+			name:       "not_found",
+			token:      "token",
+			repository: &MockRepository{},
+			want1:      invalid,
+		},
+		{
+			name:       "expired",
+			token:      "token",
+			repository: &MockRepository{Responses: map[int]interface{}{GetMagicLinkMockID: link(-time.Minute, false)}},
+			want1:      invalid,
+		},
+		{
+			name:       "already_used",
+			token:      "token",
+			repository: &MockRepository{Responses: map[int]interface{}{GetMagicLinkMockID: link(time.Minute, true)}},
+			want1:      invalid,
+		},
+		{
+			name:  "locked_account",
+			token: "token",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetMagicLinkMockID:    link(time.Minute, false),
+				GetUserByUserIdMockID: user(&domain.User{AuthId: 123, LockoutEnabled: true, LockoutDate: sql.NullTime{Time: time.Now(), Valid: true}}, true),
+			}},
+			want1: apierror.NewBadRequestApiError(locked),
+		},
+		{
+			name:  "email_not_verified",
+			token: "token",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetMagicLinkMockID:    link(time.Minute, false),
+				GetUserByUserIdMockID: user(&domain.User{AuthId: 123}, false),
+			}},
+			want1: notVerified,
+		},
+		{
+			name:  "used_concurrently",
+			token: "token",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetMagicLinkMockID:    link(time.Minute, false),
+				GetUserByUserIdMockID: user(&domain.User{AuthId: 123}, true),
+				UseMagicLinkMockID:    false,
+			}},
+			want1: invalid,
+		},
+		{
+			name:  "mfa_required",
+			token: "token",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetMagicLinkMockID:    link(time.Minute, false),
+				GetUserByUserIdMockID: user(&domain.User{AuthId: 123}, true),
+			}},
+			mfa:     &MockMFAService{Enabled: true},
+			wantMFA: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mfa == nil {
+				tt.mfa = &MockMFAService{}
+			}
+			l := &loginService{
+				cfg:          cfg,
+				loginOptions: setLoginOptions(),
+				repository:   tt.repository,
+				users:        tt.repository,
+				mfa:          tt.mfa,
+			}
+			got, got1 := l.LoginMagicLink(context.Background(), tt.token, &domain.ClientInfo{}, &middleware.ContextInformation{})
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("loginService.LoginMagicLink() got1 = %v, want %v", got1, tt.want1)
+			}
+			if tt.wantMFA != (got != nil && got.MFARequired) {
+				t.Errorf("loginService.LoginMagicLink() got = %+v, want mfa challenge %v", got, tt.wantMFA)
+			}
+			if tt.repository.Resets != 0 {
+				t.Errorf("loginService.LoginMagicLink() failed attempts must not be reset")
+			}
+		})
+	}
+}
+
+func Test_loginService_RefreshToken(t *testing.T) {
+	valid := func() *domain.RefreshToken {
+		return &domain.RefreshToken{
+			RefreshTokenId: 1,
+			UserId:         123,
+			FamilyId:       "family",
+			ExpiryDate:     sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+		}
+	}
+	invalid := apierror.New(http.StatusUnauthorized, ErrInvalidRefreshToken, apierror.NewErrorCause(ErrInvalidRefreshToken, ErrInvalidRefreshTokenCode))
+	reused := apierror.New(http.StatusUnauthorized, ErrInvalidRefreshToken, apierror.NewErrorCause(ErrInvalidRefreshToken, ErrRefreshTokenReusedCode))
+
+	tests := []struct {
+		name            string
+		token           string
+		repository      *MockRepository
+		want1           apierror.ApiError
+		revokedFamilies []string
+		revokedTokens   []string
+	}{
+		{
+			name:       "empty_token",
+			token:      "",
+			repository: &MockRepository{},
+			want1:      apierror.NewBadRequestApiError(domain.ErrEmptyField),
+		},
+		{
+			name:  "fetch_error",
+			token: "token",
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetRefreshTokenMockID: (*domain.RefreshToken)(nil),
+				},
+				Errors: map[int]error{
+					GetRefreshTokenMockID: apierror.NewInternalServerApiError("error", errors.New("error"), "test"),
+				},
+			},
+			want1: apierror.NewInternalServerApiError(domain.ErrUnexpectedError, apierror.NewInternalServerApiError("error", errors.New("error"), "test"), domain.ErrInternalCode),
+		},
+		{
+			name:  "not_found",
+			token: "token",
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetRefreshTokenMockID: (*domain.RefreshToken)(nil),
+				},
+			},
+			want1: invalid,
+		},
+		{
+			name:  "expired",
+			token: "token",
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetRefreshTokenMockID: &domain.RefreshToken{
+						FamilyId:   "family",
+						ExpiryDate: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+					},
+				},
+			},
+			want1: invalid,
+		},
+		{
+			name:  "reused_token_revokes_family",
+			token: "token",
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetRefreshTokenMockID: &domain.RefreshToken{
+						FamilyId:    "family",
+						ExpiryDate:  sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+						DateRevoked: sql.NullTime{Time: time.Now(), Valid: true},
+					},
+					GetFamilyAccessTokensMockID: []domain.RefreshToken{
+						{AccessTokenId: "jti", AccessTokenExpiryDate: sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}},
+					},
+				},
+			},
+			want1:           reused,
+			revokedFamilies: []string{"family"},
+			revokedTokens:   []string{"jti"},
+		},
+		{
+			name:  "concurrent_rotation_revokes_family",
+			token: "token",
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetRefreshTokenMockID:    valid(),
+					RevokeRefreshTokenMockID: false,
+				},
+			},
+			want1:           reused,
+			revokedFamilies: []string{"family"},
+		},
+		{
+			name:  "deleted_user",
+			token: "token",
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetRefreshTokenMockID:    valid(),
+					RevokeRefreshTokenMockID: true,
+					GetUserByUserIdMockID: []interface{}{
+						&domain.User{AuthId: 123, DateDeleted: &time.Time{}},
+						&domain.UserEmail{UserId: 123},
+					},
+				},
+			},
+			want1: invalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revocations := revocation.NewMemoryStore()
+			l := &loginService{
+				cfg:          &config.EnigmaConfig{},
+				loginOptions: setLoginOptions(),
+				repository:   tt.repository,
+				users:        tt.repository,
+				revocations:  revocations,
+			}
+			got, got1 := l.RefreshToken(context.Background(), tt.token, &middleware.ContextInformation{})
+			if got != nil {
+				t.Errorf("loginService.RefreshToken() got = %v, want nil", got)
+			}
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("loginService.RefreshToken() got1 = %v, want %v", got1, tt.want1)
+			}
+			if !reflect.DeepEqual(tt.repository.RevokedFamilies, tt.revokedFamilies) {
+				t.Errorf("loginService.RefreshToken() revoked families = %v, want %v", tt.repository.RevokedFamilies, tt.revokedFamilies)
+			}
+			for _, jti := range tt.revokedTokens {
+				if revoked, _ := revocations.IsRevoked(context.Background(), jti); !revoked {
+					t.Errorf("loginService.RefreshToken() expected %v to be revoked", jti)
+				}
+			}
+		})
+	}
+}
+
+// uniqueRevocations Fails when a jti is revoked twice, like the primary key of revoked_token did before Revoke ignored
+// the duplicates, so the tests catch the same token being revoked more than once
+type uniqueRevocations struct {
+	revocation.Store
+}
+
+func (u *uniqueRevocations) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	if revoked, _ := u.Store.IsRevoked(ctx, jti); revoked {
+		return fmt.Errorf("%s was already revoked", jti)
+	}
+	return u.Store.Revoke(ctx, jti, expiresAt)
+}
+
+func Test_loginService_Logout(t *testing.T) {
+	expiry := sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+	claims := &encryption.AccessTokenClaims{
+		StandardClaims: jwt.StandardClaims{Id: "current", ExpiresAt: time.Now().Add(time.Minute).Unix()},
+		AuthId:         123,
+		SessionId:      "family",
+	}
+	internal := apierror.NewInternalServerApiError(domain.ErrUnexpectedError, apierror.NewInternalServerApiError("error", errors.New("error"), "test"), domain.ErrInternalCode)
+
+	tests := []struct {
+		name            string
+		all             bool
+		repository      *MockRepository
+		want            apierror.ApiError
+		revoked         []string
+		notRevoked      []string
+		revokedFamilies []string
+	}{
+		{
+			name: "revoke_family_error",
+			repository: &MockRepository{
+				Errors: map[int]error{
+					RevokeRefreshTokenFamilyMockID: apierror.NewInternalServerApiError("error", errors.New("error"), "test"),
+				},
+			},
+			want:            internal,
+			notRevoked:      []string{"current"},
+			revokedFamilies: []string{"family"},
+		},
+		{
+			name: "ok",
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetFamilyAccessTokensMockID: []domain.RefreshToken{
+						{AccessTokenId: "previous", AccessTokenExpiryDate: expiry},
+						{AccessTokenId: "current", AccessTokenExpiryDate: expiry},
+					},
+				},
+			},
+			revoked:         []string{"current", "previous"},
+			revokedFamilies: []string{"family"},
+		},
+		{
+			name: "all_fetch_error",
+			all:  true,
+			repository: &MockRepository{
+				Errors: map[int]error{
+					GetUserAccessTokensMockID: apierror.NewInternalServerApiError("error", errors.New("error"), "test"),
+				},
+			},
+			want:       internal,
+			notRevoked: []string{"current"},
+		},
+		{
+			name: "all_ok",
+			all:  true,
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetUserAccessTokensMockID: []domain.RefreshToken{
+						{AccessTokenId: "other_device", AccessTokenExpiryDate: expiry},
+						{AccessTokenId: "current", AccessTokenExpiryDate: expiry},
+						{AccessTokenId: ""},
+					},
+				},
+			},
+			revoked: []string{"current", "other_device"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revocations := &uniqueRevocations{Store: revocation.NewMemoryStore()}
+			l := &loginService{
+				cfg:          &config.EnigmaConfig{},
+				loginOptions: setLoginOptions(),
+				repository:   tt.repository,
+				users:        tt.repository,
+				revocations:  revocations,
+			}
+
+			var got apierror.ApiError
+			if tt.all {
+				got = l.LogoutAll(context.Background(), claims, &middleware.ContextInformation{})
+			} else {
+				got = l.Logout(context.Background(), claims, &middleware.ContextInformation{})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loginService.Logout() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.repository.RevokedFamilies, tt.revokedFamilies) {
+				t.Errorf("loginService.Logout() revoked families = %v, want %v", tt.repository.RevokedFamilies, tt.revokedFamilies)
+			}
+			for _, jti := range tt.revoked {
+				if revoked, _ := revocations.IsRevoked(context.Background(), jti); !revoked {
+					t.Errorf("loginService.Logout() expected %v to be revoked", jti)
+				}
+			}
+			for _, jti := range tt.notRevoked {
+				if revoked, _ := revocations.IsRevoked(context.Background(), jti); revoked {
+					t.Errorf("loginService.Logout() expected %v not to be revoked", jti)
+				}
+			}
+		})
+	}
+}
+
+func Test_loginService_GetSessions(t *testing.T) {
+	claims := &encryption.AccessTokenClaims{AuthId: 123, SessionId: "current"}
+
+	tests := []struct {
+		name       string
+		repository *MockRepository
+		want       []domain.Session
+		want1      apierror.ApiError
+	}{
+		{
+			name: "fetch_error",
+			repository: &MockRepository{Errors: map[int]error{
+				GetUserSessionsMockID: apierror.NewInternalServerApiError("error", errors.New("error"), "test"),
+			}},
+			want1: apierror.NewInternalServerApiError(domain.ErrUnexpectedError, apierror.NewInternalServerApiError("error", errors.New("error"), "test"), domain.ErrInternalCode),
+		},
+		{
+			name:       "no_sessions",
+			repository: &MockRepository{},
+			want:       []domain.Session{},
+		},
+		{
+			name: "marks_current",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetUserSessionsMockID: []domain.Session{{SessionId: "current"}, {SessionId: "other"}},
+			}},
+			want: []domain.Session{{SessionId: "current", Current: true}, {SessionId: "other"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &loginService{
+				cfg:          &config.EnigmaConfig{TokenOptions: &config.TokenOptions{RefreshTokenDuration: time.Hour}},
+				loginOptions: setLoginOptions(),
+				repository:   tt.repository,
+				users:        tt.repository,
+			}
+			got, got1 := l.GetSessions(context.Background(), claims, &middleware.ContextInformation{})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loginService.GetSessions() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("loginService.GetSessions() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func Test_loginService_RevokeSession(t *testing.T) {
+	claims := &encryption.AccessTokenClaims{AuthId: 123, SessionId: "current"}
+	expiry := sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+	notFound := apierror.New(http.StatusNotFound, ErrSessionNotFound, apierror.NewErrorCause(ErrSessionNotFound, ErrSessionNotFoundCode))
+
+	tests := []struct {
+		name            string
+		repository      *MockRepository
+		want            apierror.ApiError
+		revokedSessions []string
+		revokedFamilies []string
+		revokedTokens   []string
+	}{
+		{
+			name:       "not_found",
+			repository: &MockRepository{},
+			want:       notFound,
+		},
+		{
+			name: "other_user",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetSessionMockID: &domain.Session{SessionId: "other", UserId: 456},
+			}},
+			want: notFound,
+		},
+		{
+			name: "already_revoked",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetSessionMockID: &domain.Session{SessionId: "other", UserId: 123, DateRevoked: sql.NullTime{Time: time.Now(), Valid: true}},
+			}},
+			want: notFound,
+		},
+		{
+			name: "ok",
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetSessionMockID:            &domain.Session{SessionId: "other", UserId: 123},
+				GetFamilyAccessTokensMockID: []domain.RefreshToken{{AccessTokenId: "jti", AccessTokenExpiryDate: expiry}},
+			}},
+			revokedSessions: []string{"other"},
+			revokedFamilies: []string{"other"},
+			revokedTokens:   []string{"jti"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revocations := revocation.NewMemoryStore()
+			l := &loginService{
+				cfg:          &config.EnigmaConfig{},
+				loginOptions: setLoginOptions(),
+				repository:   tt.repository,
+				users:        tt.repository,
+				revocations:  revocations,
+			}
+			got := l.RevokeSession(context.Background(), claims, "other", &middleware.ContextInformation{})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loginService.RevokeSession() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.repository.RevokedSessions, tt.revokedSessions) {
+				t.Errorf("loginService.RevokeSession() revoked sessions = %v, want %v", tt.repository.RevokedSessions, tt.revokedSessions)
+			}
+			if !reflect.DeepEqual(tt.repository.RevokedFamilies, tt.revokedFamilies) {
+				t.Errorf("loginService.RevokeSession() revoked families = %v, want %v", tt.repository.RevokedFamilies, tt.revokedFamilies)
+			}
+			for _, jti := range tt.revokedTokens {
+				if revoked, _ := revocations.IsRevoked(context.Background(), jti); !revoked {
+					t.Errorf("loginService.RevokeSession() expected %v to be revoked", jti)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package mfa
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/performance"
+	"github.com/CienciaArgentina/go-enigma/internal/auth"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type mfaController struct {
+	svc Service
+}
+
+func NewController(s Service) Controller {
+	return &mfaController{svc: s}
+}
+
+// Enroll Starts the TOTP enrollment of the user, returning the secret for their authenticator app
+func (m *mfaController) Enroll(c *gin.Context) {
+	info := middleware.GetContextInformation("EnrollMFA", c)
+
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode)))
+		return
+	}
+
+	var enrollment *domain.MFAEnrollment
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "EnrollMFA", info, func() {
+		enrollment, apierr = m.svc.Enroll(c.Request.Context(), claims, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	// The secret must not end up in any cache.
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Confirm Enables two-factor authentication with the first code generated by the authenticator app, answering with the
+// recovery codes
+func (m *mfaController) Confirm(c *gin.Context) {
+	var dto domain.MFACodeDTO
+	info := middleware.GetContextInformation("ConfirmMFA", c)
+
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode)))
+		return
+	}
+
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)))
+		return
+	}
+
+	var codes *domain.RecoveryCodes
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "ConfirmMFA", info, func() {
+		codes, apierr = m.svc.Confirm(c.Request.Context(), claims, dto.Code, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, codes)
+}
+
+// RegenerateRecoveryCodes Replaces the recovery codes of the user with a new set
+func (m *mfaController) RegenerateRecoveryCodes(c *gin.Context) {
+	info := middleware.GetContextInformation("RegenerateRecoveryCodes", c)
+
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode)))
+		return
+	}
+
+	var codes *domain.RecoveryCodes
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "RegenerateRecoveryCodes", info, func() {
+		codes, apierr = m.svc.RegenerateRecoveryCodes(c.Request.Context(), claims, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, codes)
+}
@@ -0,0 +1,212 @@
+package mfa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-enigma/internal/auth"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/gin-gonic/gin"
+)
+
+type MockService struct {
+	Enrollment    *domain.MFAEnrollment
+	RecoveryCodes *domain.RecoveryCodes
+	Error         apierror.ApiError
+
+	Code string
+}
+
+func (m *MockService) Enroll(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.MFAEnrollment, apierror.ApiError) {
+	return m.Enrollment, m.Error
+}
+
+func (m *MockService) Confirm(ctx context.Context, claims *encryption.AccessTokenClaims, code string, info *middleware.ContextInformation) (*domain.RecoveryCodes, apierror.ApiError) {
+	m.Code = code
+	return m.RecoveryCodes, m.Error
+}
+
+func (m *MockService) RegenerateRecoveryCodes(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.RecoveryCodes, apierror.ApiError) {
+	return m.RecoveryCodes, m.Error
+}
+
+func (m *MockService) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	return false, nil
+}
+
+func (m *MockService) VerifyCode(ctx context.Context, userID int64, code string) (bool, error) {
+	return false, nil
+}
+
+func marshal(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func Test_mfaController_Enroll(t *testing.T) {
+	unauthorized := apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode))
+	enabled := apierror.New(http.StatusBadRequest, ErrMFAAlreadyEnabled, apierror.NewErrorCause(ErrMFAAlreadyEnabled, ErrMFAAlreadyEnabledCode))
+	enrollment := &domain.MFAEnrollment{Secret: "SECRET", URI: "otpauth://totp/test?secret=SECRET"}
+
+	tests := []struct {
+		name           string
+		svc            *MockService
+		claims         *encryption.AccessTokenClaims
+		expectedStatus int
+		expectedBody   interface{}
+	}{
+		{
+			name:           "unauthorized",
+			svc:            &MockService{},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   unauthorized,
+		},
+		{
+			name:           "already_enabled",
+			svc:            &MockService{Error: enabled},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   enabled,
+		},
+		{
+			name:           "ok",
+			svc:            &MockService{Enrollment: enrollment},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			expectedStatus: http.StatusOK,
+			expectedBody:   enrollment,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/users/mfa/totp", nil)
+			c.Request.Header.Set("Authorization", "Bearer token")
+			if tt.claims != nil {
+				auth.SetClaims(c, tt.claims)
+			}
+
+			NewController(tt.svc).Enroll(c)
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[Enroll] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body) // nolint
+			if body := buf.String(); body != marshal(tt.expectedBody) {
+				t.Errorf("[Enroll] Expected body = %v, got %v", marshal(tt.expectedBody), body)
+			}
+		})
+	}
+}
+
+func Test_mfaController_Confirm(t *testing.T) {
+	invalidCode := apierror.New(http.StatusBadRequest, ErrInvalidMFACode, apierror.NewErrorCause(ErrInvalidMFACode, ErrInvalidMFACodeCode))
+
+	tests := []struct {
+		name           string
+		svc            *MockService
+		requestBody    string
+		expectedStatus int
+		expectedCode   string
+		expectedBody   string
+	}{
+		{
+			name:           "bad_request",
+			svc:            &MockService{},
+			requestBody:    `"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid_code",
+			svc:            &MockService{Error: invalidCode},
+			requestBody:    `{"code": "123456"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "123456",
+		},
+		{
+			name:           "ok",
+			svc:            &MockService{RecoveryCodes: &domain.RecoveryCodes{Codes: []string{"abcde-fghij"}}},
+			requestBody:    `{"code": "123456"}`,
+			expectedStatus: http.StatusOK,
+			expectedCode:   "123456",
+			expectedBody:   `{"recovery_codes":["abcde-fghij"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/users/mfa/totp/confirm", strings.NewReader(tt.requestBody))
+			c.Request.Header.Set("Authorization", "Bearer token")
+			auth.SetClaims(c, &encryption.AccessTokenClaims{AuthId: 123})
+
+			NewController(tt.svc).Confirm(c)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("[Confirm] Expected status code = %v, got %v", tt.expectedStatus, w.Code)
+			}
+			if tt.svc.Code != tt.expectedCode {
+				t.Errorf("[Confirm] Expected code = %v, got %v", tt.expectedCode, tt.svc.Code)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("[Confirm] Expected body = %v, got %v", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_mfaController_RegenerateRecoveryCodes(t *testing.T) {
+	notEnrolled := apierror.New(http.StatusBadRequest, ErrMFANotEnrolled, apierror.NewErrorCause(ErrMFANotEnrolled, ErrMFANotEnrolledCode))
+	codes := &domain.RecoveryCodes{Codes: []string{"abcde-fghij", "klmno-pqrst"}}
+
+	tests := []struct {
+		name           string
+		svc            *MockService
+		expectedStatus int
+		expectedBody   interface{}
+	}{
+		{
+			name:           "not_enrolled",
+			svc:            &MockService{Error: notEnrolled},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   notEnrolled,
+		},
+		{
+			name:           "ok",
+			svc:            &MockService{RecoveryCodes: codes},
+			expectedStatus: http.StatusOK,
+			expectedBody:   codes,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/users/mfa/recovery_codes", nil)
+			c.Request.Header.Set("Authorization", "Bearer token")
+			auth.SetClaims(c, &encryption.AccessTokenClaims{AuthId: 123})
+
+			NewController(tt.svc).RegenerateRecoveryCodes(c)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("[RegenerateRecoveryCodes] Expected status code = %v, got %v", tt.expectedStatus, w.Code)
+				return
+			}
+			if body := w.Body.String(); body != marshal(tt.expectedBody) {
+				t.Errorf("[RegenerateRecoveryCodes] Expected body = %v, got %v", marshal(tt.expectedBody), body)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package mfa
+
+import (
+	"context"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/gin-gonic/gin"
+)
+
+type Repository interface {
+	GetMFA(ctx context.Context, userID int64) (*domain.UserMFA, error)
+	SaveMFA(ctx context.Context, userID int64, encryptedSecret string) error
+	ConfirmMFA(ctx context.Context, userID int64) error
+	UpdateLastUsedStep(ctx context.Context, userID int64, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	GetRecoveryCodes(ctx context.Context, userID int64) ([]domain.RecoveryCode, error)
+	UseRecoveryCode(ctx context.Context, recoveryCodeID int64) (bool, error)
+}
+
+type Service interface {
+	Enroll(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.MFAEnrollment, apierror.ApiError)
+	Confirm(ctx context.Context, claims *encryption.AccessTokenClaims, code string, info *middleware.ContextInformation) (*domain.RecoveryCodes, apierror.ApiError)
+	RegenerateRecoveryCodes(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.RecoveryCodes, apierror.ApiError)
+	IsEnabled(ctx context.Context, userID int64) (bool, error)
+	VerifyCode(ctx context.Context, userID int64, code string) (bool, error)
+}
+
+type Controller interface {
+	Enroll(c *gin.Context)
+	Confirm(c *gin.Context)
+	RegenerateRecoveryCodes(c *gin.Context)
+}
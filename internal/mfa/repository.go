@@ -0,0 +1,150 @@
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+type mfaRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewRepository Returns new mfa repository, whose queries give up after timeout
+func NewRepository(db *sqlx.DB, timeout time.Duration) Repository {
+	return &mfaRepository{db: db, timeout: timeout}
+}
+
+// GetMFA Returns the second factor of the user, nil if they never enrolled
+func (m *mfaRepository) GetMFA(ctx context.Context, userID int64) (*domain.UserMFA, error) {
+	ctx, cancel := storage.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	var mfa domain.UserMFA
+
+	err := m.db.GetContext(ctx, &mfa, m.db.Rebind("SELECT * FROM users_mfa WHERE user_id = ?"), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// SaveMFA Stores a new, unconfirmed, secret for the user replacing the one they had
+func (m *mfaRepository) SaveMFA(ctx context.Context, userID int64, encryptedSecret string) error {
+	ctx, cancel := storage.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind("DELETE FROM users_mfa WHERE user_id = ?"), userID); err != nil {
+		tx.Rollback() // nolint
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, tx.Rebind("INSERT INTO users_mfa (user_id, totp_secret, last_used_step, date_created) VALUES (?, ?, 0, CURRENT_TIMESTAMP)"), userID, encryptedSecret)
+	if err != nil {
+		tx.Rollback() // nolint
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmMFA Enables the second factor
+func (m *mfaRepository) ConfirmMFA(ctx context.Context, userID int64) error {
+	ctx, cancel := storage.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	_, err := m.db.ExecContext(ctx, m.db.Rebind("UPDATE users_mfa SET date_confirmed = CURRENT_TIMESTAMP WHERE user_id = ?"), userID)
+	return err
+}
+
+// UpdateLastUsedStep Stores the period of the last code used, returns false if a code of that period (or a later one)
+// was already used
+func (m *mfaRepository) UpdateLastUsedStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	ctx, cancel := storage.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	res, err := m.db.ExecContext(ctx, m.db.Rebind("UPDATE users_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?"), step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// ReplaceRecoveryCodes Stores a new set of recovery codes, the previous ones stop working
+func (m *mfaRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	ctx, cancel := storage.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind("DELETE FROM users_mfa_recovery_code WHERE user_id = ?"), userID); err != nil {
+		tx.Rollback() // nolint
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx, tx.Rebind("INSERT INTO users_mfa_recovery_code (user_id, code_hash, date_created) VALUES (?, ?, CURRENT_TIMESTAMP)"), userID, hash)
+		if err != nil {
+			tx.Rollback() // nolint
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRecoveryCodes Returns the recovery codes of the user that weren't used yet
+func (m *mfaRepository) GetRecoveryCodes(ctx context.Context, userID int64) ([]domain.RecoveryCode, error) {
+	ctx, cancel := storage.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	var codes []domain.RecoveryCode
+
+	err := m.db.SelectContext(ctx, &codes, m.db.Rebind("SELECT * FROM users_mfa_recovery_code WHERE user_id = ? AND date_used IS NULL"), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode Marks the code as used, returns false if it already was
+func (m *mfaRepository) UseRecoveryCode(ctx context.Context, recoveryCodeID int64) (bool, error) {
+	ctx, cancel := storage.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	res, err := m.db.ExecContext(ctx, m.db.Rebind("UPDATE users_mfa_recovery_code SET date_used = CURRENT_TIMESTAMP WHERE recovery_code_id = ? AND date_used IS NULL"), recoveryCodeID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
@@ -0,0 +1,337 @@
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_mfaRepository_GetMFA(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "SELECT * FROM users_mfa WHERE user_id = ?"
+
+	tests := []struct {
+		name     string
+		expected *domain.UserMFA
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: &domain.UserMFA{UserId: 123, EncryptedSecret: "secret", LastUsedStep: 10},
+			mockFunc: func() {
+				rows := sqlmock.NewRows([]string{"user_id", "totp_secret", "last_used_step"}).AddRow(123, "secret", 10)
+				mock.ExpectQuery(query).WithArgs(123).WillReturnRows(rows)
+			},
+		},
+		{
+			name: "not_enrolled",
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs(123).WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs(123).WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			got, err := r.GetMFA(context.Background(), 123)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mfaRepository.GetMFA() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("mfaRepository.GetMFA() got = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_mfaRepository_SaveMFA(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	remove := "DELETE FROM users_mfa WHERE user_id = ?"
+	insert := "INSERT INTO users_mfa (user_id, totp_secret, last_used_step, date_created) VALUES (?, ?, 0, CURRENT_TIMESTAMP)"
+
+	tests := []struct {
+		name     string
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name: "ok",
+			mockFunc: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(remove).WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insert).WithArgs(123, "secret").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:    "insert_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(remove).WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(insert).WithArgs(123, "secret").WillReturnError(errors.New("internal_error"))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			err := r.SaveMFA(context.Background(), 123, "secret")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mfaRepository.SaveMFA() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("mfaRepository.SaveMFA() %v", err)
+			}
+		})
+	}
+}
+
+func Test_mfaRepository_UpdateLastUsedStep(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "UPDATE users_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?"
+
+	tests := []struct {
+		name     string
+		expected bool
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(10, 123, 10).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "already_used",
+			expected: false,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(10, 123, 10).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(10, 123, 10).WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			got, err := r.UpdateLastUsedStep(context.Background(), 123, 10)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mfaRepository.UpdateLastUsedStep() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.expected {
+				t.Errorf("mfaRepository.UpdateLastUsedStep() got = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_mfaRepository_ReplaceRecoveryCodes(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	remove := "DELETE FROM users_mfa_recovery_code WHERE user_id = ?"
+	insert := "INSERT INTO users_mfa_recovery_code (user_id, code_hash, date_created) VALUES (?, ?, CURRENT_TIMESTAMP)"
+
+	tests := []struct {
+		name     string
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name: "ok",
+			mockFunc: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(remove).WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 10))
+				mock.ExpectExec(insert).WithArgs(123, "first").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(insert).WithArgs(123, "second").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:    "insert_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(remove).WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 10))
+				mock.ExpectExec(insert).WithArgs(123, "first").WillReturnError(errors.New("internal_error"))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			err := r.ReplaceRecoveryCodes(context.Background(), 123, []string{"first", "second"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mfaRepository.ReplaceRecoveryCodes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("mfaRepository.ReplaceRecoveryCodes() %v", err)
+			}
+		})
+	}
+}
+
+func Test_mfaRepository_GetRecoveryCodes(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "SELECT * FROM users_mfa_recovery_code WHERE user_id = ? AND date_used IS NULL"
+
+	tests := []struct {
+		name     string
+		expected []domain.RecoveryCode
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: []domain.RecoveryCode{{RecoveryCodeId: 1, UserId: 123, CodeHash: "first"}, {RecoveryCodeId: 2, UserId: 123, CodeHash: "second"}},
+			mockFunc: func() {
+				rows := sqlmock.NewRows([]string{"recovery_code_id", "user_id", "code_hash"}).AddRow(1, 123, "first").AddRow(2, 123, "second")
+				mock.ExpectQuery(query).WithArgs(123).WillReturnRows(rows)
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs(123).WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			got, err := r.GetRecoveryCodes(context.Background(), 123)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mfaRepository.GetRecoveryCodes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("mfaRepository.GetRecoveryCodes() got = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_mfaRepository_UseRecoveryCode(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "UPDATE users_mfa_recovery_code SET date_used = CURRENT_TIMESTAMP WHERE recovery_code_id = ? AND date_used IS NULL"
+
+	tests := []struct {
+		name     string
+		expected bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "already_used",
+			expected: false,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			got, err := r.UseRecoveryCode(context.Background(), 1)
+			if err != nil {
+				t.Errorf("mfaRepository.UseRecoveryCode() unexpected error %v", err)
+				return
+			}
+
+			if got != tt.expected {
+				t.Errorf("mfaRepository.UseRecoveryCode() got = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
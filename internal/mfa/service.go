@@ -0,0 +1,263 @@
+package mfa
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/performance"
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+)
+
+const (
+	ErrMFAAlreadyEnabled     = "La verificación en dos pasos ya está activada"
+	ErrMFAAlreadyEnabledCode = "mfa_already_enabled"
+
+	ErrMFANotEnrolled     = "Primero tenés que activar la verificación en dos pasos"
+	ErrMFANotEnrolledCode = "mfa_not_enrolled"
+
+	ErrInvalidMFACode     = "El código de verificación no es válido"
+	ErrInvalidMFACodeCode = "invalid_mfa_code"
+
+	// Shown by authenticator apps next to the account.
+	totpIssuer = "Ciencia Argentina"
+
+	recoveryCodeCount = 10
+	totpCodeLength    = 6
+)
+
+type mfaService struct {
+	cfg        *config.EnigmaConfig
+	repository Repository
+}
+
+func NewService(cfg *config.EnigmaConfig, r Repository) Service {
+	return &mfaService{cfg: cfg, repository: r}
+}
+
+// Enroll Generates a new TOTP secret for the user. It isn't enabled until it's confirmed, enrolling again before that
+// replaces it.
+func (m *mfaService) Enroll(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.MFAEnrollment, apierror.ApiError) {
+	current, apierr := m.getMFA(ctx, claims.AuthId, info)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if current != nil && current.DateConfirmed.Valid {
+		return nil, apierror.New(http.StatusBadRequest, ErrMFAAlreadyEnabled, apierror.NewErrorCause(ErrMFAAlreadyEnabled, ErrMFAAlreadyEnabledCode))
+	}
+
+	secret, err := encryption.GenerateTOTPSecret()
+	if err != nil {
+		clog.Error("Error generating totp secret", "mfa-enroll", err, nil)
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	encrypted, err := encryption.Encrypt(secret, m.cfg.Keys.MFAEncryptionKey)
+	if err != nil {
+		clog.Error("Error encrypting totp secret", "mfa-enroll", err, nil)
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	performance.TrackTime(time.Now(), "SaveMFA", info, func() {
+		err = m.repository.SaveMFA(ctx, claims.AuthId, encrypted)
+	})
+	if err != nil {
+		clog.Error("Error saving totp secret", "mfa-enroll", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	return &domain.MFAEnrollment{
+		Secret: encryption.EncodeTOTPSecret(secret),
+		URI:    encryption.TOTPURI(totpIssuer, claims.Email, secret),
+	}, nil
+}
+
+// Confirm Enables the second factor once the user proves their authenticator app generates the right codes. Returns the
+// recovery codes to use if the authenticator is lost.
+func (m *mfaService) Confirm(ctx context.Context, claims *encryption.AccessTokenClaims, code string, info *middleware.ContextInformation) (*domain.RecoveryCodes, apierror.ApiError) {
+	if code == "" {
+		return nil, apierror.NewBadRequestApiError(domain.ErrEmptyField)
+	}
+
+	current, apierr := m.getMFA(ctx, claims.AuthId, info)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if current == nil {
+		return nil, apierror.New(http.StatusBadRequest, ErrMFANotEnrolled, apierror.NewErrorCause(ErrMFANotEnrolled, ErrMFANotEnrolledCode))
+	}
+
+	if current.DateConfirmed.Valid {
+		return nil, apierror.New(http.StatusBadRequest, ErrMFAAlreadyEnabled, apierror.NewErrorCause(ErrMFAAlreadyEnabled, ErrMFAAlreadyEnabledCode))
+	}
+
+	ok, err := m.verify(ctx, current, code)
+	if err != nil {
+		clog.Error("Error verifying totp code", "mfa-confirm", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if !ok {
+		return nil, apierror.New(http.StatusBadRequest, ErrInvalidMFACode, apierror.NewErrorCause(ErrInvalidMFACode, ErrInvalidMFACodeCode))
+	}
+
+	// The codes are stored first so the factor is never enabled without a way to recover the account.
+	codes, apierr := m.newRecoveryCodes(ctx, claims.AuthId, info)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	performance.TrackTime(time.Now(), "ConfirmMFA", info, func() {
+		err = m.repository.ConfirmMFA(ctx, claims.AuthId)
+	})
+	if err != nil {
+		clog.Error("Error confirming totp secret", "mfa-confirm", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes Returns a new set of recovery codes, the previous ones stop working
+func (m *mfaService) RegenerateRecoveryCodes(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.RecoveryCodes, apierror.ApiError) {
+	current, apierr := m.getMFA(ctx, claims.AuthId, info)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if current == nil || !current.DateConfirmed.Valid {
+		return nil, apierror.New(http.StatusBadRequest, ErrMFANotEnrolled, apierror.NewErrorCause(ErrMFANotEnrolled, ErrMFANotEnrolledCode))
+	}
+
+	return m.newRecoveryCodes(ctx, claims.AuthId, info)
+}
+
+// IsEnabled Whether the user has to enter a second factor to log in
+func (m *mfaService) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	current, err := m.repository.GetMFA(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return current != nil && current.DateConfirmed.Valid, nil
+}
+
+// VerifyCode Checks a code entered at login, either from the authenticator app or a recovery code. Each code is accepted
+// once.
+func (m *mfaService) VerifyCode(ctx context.Context, userID int64, code string) (bool, error) {
+	current, err := m.repository.GetMFA(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if current == nil || !current.DateConfirmed.Valid {
+		return false, nil
+	}
+
+	if len(code) == totpCodeLength {
+		return m.verify(ctx, current, code)
+	}
+
+	return m.verifyRecoveryCode(ctx, userID, code)
+}
+
+// verify Validates the code and marks its period as used so it can't be replayed.
+func (m *mfaService) verify(ctx context.Context, current *domain.UserMFA, code string) (bool, error) {
+	secret, err := encryption.Decrypt(current.EncryptedSecret, m.cfg.Keys.MFAEncryptionKey)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := encryption.ValidateTOTP(secret, code, time.Now(), current.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+
+	// Another request may have used the same code since we read the row.
+	return m.repository.UpdateLastUsedStep(ctx, current.UserId, step)
+}
+
+// verifyRecoveryCode Recovery codes are hashed with a random salt, so the code is checked against every unused one.
+func (m *mfaService) verifyRecoveryCode(ctx context.Context, userID int64, code string) (bool, error) {
+	code = encryption.NormalizeRecoveryCode(code)
+	if code == "" {
+		return false, nil
+	}
+
+	codes, err := m.repository.GetRecoveryCodes(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range codes {
+		ok, err := encryption.CompareEncodedHash(code, c.CodeHash, m.cfg)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+
+		// Another request may have used the same code since we read it.
+		used, err := m.repository.UseRecoveryCode(ctx, c.RecoveryCodeId)
+		if used {
+			clog.Info("Recovery code used", "mfa-verify", map[string]string{"auth_id": fmt.Sprintf("%d", userID), "remaining": fmt.Sprintf("%d", len(codes)-1)})
+		}
+		return used, err
+	}
+
+	return false, nil
+}
+
+func (m *mfaService) newRecoveryCodes(ctx context.Context, userID int64, info *middleware.ContextInformation) (*domain.RecoveryCodes, apierror.ApiError) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := encryption.GenerateRecoveryCode()
+		if err != nil {
+			return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+		}
+
+		hash, err := encryption.GenerateEncodedHash(encryption.NormalizeRecoveryCode(code), m.cfg)
+		if err != nil {
+			return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+		}
+
+		codes = append(codes, code)
+		hashes = append(hashes, hash)
+	}
+
+	var err error
+	performance.TrackTime(time.Now(), "ReplaceRecoveryCodes", info, func() {
+		err = m.repository.ReplaceRecoveryCodes(ctx, userID, hashes)
+	})
+	if err != nil {
+		clog.Error("Error saving recovery codes", "mfa-recovery-codes", err, map[string]string{"auth_id": fmt.Sprintf("%d", userID)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	return &domain.RecoveryCodes{Codes: codes}, nil
+}
+
+func (m *mfaService) getMFA(ctx context.Context, userID int64, info *middleware.ContextInformation) (*domain.UserMFA, apierror.ApiError) {
+	var current *domain.UserMFA
+	var err error
+
+	performance.TrackTime(time.Now(), "GetMFA", info, func() {
+		current, err = m.repository.GetMFA(ctx, userID)
+	})
+	if err != nil {
+		clog.Error("Error fetching mfa", "mfa", err, map[string]string{"auth_id": fmt.Sprintf("%d", userID)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	return current, nil
+}
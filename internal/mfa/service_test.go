@@ -0,0 +1,382 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"database/sql"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+)
+
+const (
+	GetMFAMockID = iota
+	SaveMFAMockID
+	ConfirmMFAMockID
+	UpdateLastUsedStepMockID
+	ReplaceRecoveryCodesMockID
+	GetRecoveryCodesMockID
+	UseRecoveryCodeMockID
+)
+
+type MockRepository struct {
+	Responses map[int]interface{}
+	Errors    map[int]error
+
+	Saved         string
+	Confirmed     bool
+	RecoveryCodes []string
+	UsedCodes     []int64
+}
+
+func (m *MockRepository) GetMFA(ctx context.Context, userID int64) (*domain.UserMFA, error) {
+	mfa, _ := m.Responses[GetMFAMockID].(*domain.UserMFA)
+	return mfa, m.Errors[GetMFAMockID]
+}
+
+func (m *MockRepository) SaveMFA(ctx context.Context, userID int64, encryptedSecret string) error {
+	m.Saved = encryptedSecret
+	return m.Errors[SaveMFAMockID]
+}
+
+func (m *MockRepository) ConfirmMFA(ctx context.Context, userID int64) error {
+	m.Confirmed = true
+	return m.Errors[ConfirmMFAMockID]
+}
+
+func (m *MockRepository) UpdateLastUsedStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	updated, ok := m.Responses[UpdateLastUsedStepMockID].(bool)
+	if !ok {
+		updated = true
+	}
+	return updated, m.Errors[UpdateLastUsedStepMockID]
+}
+
+func (m *MockRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	m.RecoveryCodes = codeHashes
+	return m.Errors[ReplaceRecoveryCodesMockID]
+}
+
+func (m *MockRepository) GetRecoveryCodes(ctx context.Context, userID int64) ([]domain.RecoveryCode, error) {
+	codes, _ := m.Responses[GetRecoveryCodesMockID].([]domain.RecoveryCode)
+	return codes, m.Errors[GetRecoveryCodesMockID]
+}
+
+func (m *MockRepository) UseRecoveryCode(ctx context.Context, recoveryCodeID int64) (bool, error) {
+	m.UsedCodes = append(m.UsedCodes, recoveryCodeID)
+	used, ok := m.Responses[UseRecoveryCodeMockID].(bool)
+	if !ok {
+		used = true
+	}
+	return used, m.Errors[UseRecoveryCodeMockID]
+}
+
+func testConfig() *config.EnigmaConfig {
+	return &config.EnigmaConfig{
+		Keys:        &config.Keys{MFAEncryptionKey: make([]byte, 32)},
+		ArgonParams: &config.ArgonParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16},
+	}
+}
+
+// recoveryCode Returns a stored recovery code and the code itself.
+func recoveryCode(t *testing.T, id int64) (domain.RecoveryCode, string) {
+	code, err := encryption.GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := encryption.GenerateEncodedHash(encryption.NormalizeRecoveryCode(code), testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return domain.RecoveryCode{RecoveryCodeId: id, UserId: 123, CodeHash: hash}, code
+}
+
+// enrolled Returns a secret of an enrolled user along with a valid code.
+func enrolled(t *testing.T, confirmed bool) (*domain.UserMFA, string) {
+	secret, err := encryption.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryption.Encrypt(secret, testConfig().Keys.MFAEncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &domain.UserMFA{UserId: 123, EncryptedSecret: encrypted, DateConfirmed: sql.NullTime{Valid: confirmed}},
+		encryption.TOTPCode(secret, time.Now())
+}
+
+func Test_mfaService_Enroll(t *testing.T) {
+	claims := &encryption.AccessTokenClaims{AuthId: 123, Email: "test@test.com"}
+	confirmed, _ := enrolled(t, true)
+	unconfirmed, _ := enrolled(t, false)
+
+	tests := []struct {
+		name       string
+		repository *MockRepository
+		want1      apierror.ApiError
+	}{
+		{
+			name:       "already_enabled",
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: confirmed}},
+			want1:      apierror.New(http.StatusBadRequest, ErrMFAAlreadyEnabled, apierror.NewErrorCause(ErrMFAAlreadyEnabled, ErrMFAAlreadyEnabledCode)),
+		},
+		{
+			name:       "save_error",
+			repository: &MockRepository{Errors: map[int]error{SaveMFAMockID: errors.New("error")}},
+			want1:      apierror.NewInternalServerApiError(domain.ErrUnexpectedError, errors.New("error"), domain.ErrInternalCode),
+		},
+		{
+			name:       "ok",
+			repository: &MockRepository{},
+		},
+		{
+			name:       "replaces_unconfirmed",
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: unconfirmed}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewService(testConfig(), tt.repository)
+			got, got1 := m.Enroll(context.Background(), claims, &middleware.ContextInformation{})
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("mfaService.Enroll() got1 = %v, want %v", got1, tt.want1)
+				return
+			}
+			if tt.want1 != nil {
+				return
+			}
+
+			// The secret in the response is the one stored, encrypted.
+			secret, err := encryption.Decrypt(tt.repository.Saved, testConfig().Keys.MFAEncryptionKey)
+			if err != nil {
+				t.Fatalf("mfaService.Enroll() stored secret can't be decrypted: %v", err)
+			}
+			if encryption.EncodeTOTPSecret(secret) != got.Secret {
+				t.Errorf("mfaService.Enroll() secret = %v, stored %v", got.Secret, encryption.EncodeTOTPSecret(secret))
+			}
+
+			uri, err := url.Parse(got.URI)
+			if err != nil || uri.Query().Get("secret") != got.Secret || uri.Path != "/"+totpIssuer+":test@test.com" {
+				t.Errorf("mfaService.Enroll() unexpected uri %v", got.URI)
+			}
+		})
+	}
+}
+
+func Test_mfaService_Confirm(t *testing.T) {
+	claims := &encryption.AccessTokenClaims{AuthId: 123}
+	confirmed, _ := enrolled(t, true)
+	unconfirmed, code := enrolled(t, false)
+	invalidCode := apierror.New(http.StatusBadRequest, ErrInvalidMFACode, apierror.NewErrorCause(ErrInvalidMFACode, ErrInvalidMFACodeCode))
+
+	tests := []struct {
+		name       string
+		code       string
+		repository *MockRepository
+		want       apierror.ApiError
+		confirmed  bool
+	}{
+		{
+			name:       "empty_code",
+			repository: &MockRepository{},
+			want:       apierror.NewBadRequestApiError(domain.ErrEmptyField),
+		},
+		{
+			name:       "not_enrolled",
+			code:       code,
+			repository: &MockRepository{},
+			want:       apierror.New(http.StatusBadRequest, ErrMFANotEnrolled, apierror.NewErrorCause(ErrMFANotEnrolled, ErrMFANotEnrolledCode)),
+		},
+		{
+			name:       "already_enabled",
+			code:       code,
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: confirmed}},
+			want:       apierror.New(http.StatusBadRequest, ErrMFAAlreadyEnabled, apierror.NewErrorCause(ErrMFAAlreadyEnabled, ErrMFAAlreadyEnabledCode)),
+		},
+		{
+			name:       "invalid_code",
+			code:       "000000x",
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: unconfirmed}},
+			want:       invalidCode,
+		},
+		{
+			name: "code_already_used",
+			code: code,
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetMFAMockID:             unconfirmed,
+				UpdateLastUsedStepMockID: false,
+			}},
+			want: invalidCode,
+		},
+		{
+			name: "recovery_codes_error",
+			code: code,
+			repository: &MockRepository{
+				Responses: map[int]interface{}{GetMFAMockID: unconfirmed},
+				Errors:    map[int]error{ReplaceRecoveryCodesMockID: errors.New("error")},
+			},
+			want: apierror.NewInternalServerApiError(domain.ErrUnexpectedError, errors.New("error"), domain.ErrInternalCode),
+		},
+		{
+			name:       "ok",
+			code:       code,
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: unconfirmed}},
+			confirmed:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewService(testConfig(), tt.repository)
+			got, got1 := m.Confirm(context.Background(), claims, tt.code, &middleware.ContextInformation{})
+			if !reflect.DeepEqual(got1, tt.want) {
+				t.Errorf("mfaService.Confirm() got1 = %v, want %v", got1, tt.want)
+			}
+			if tt.repository.Confirmed != tt.confirmed {
+				t.Errorf("mfaService.Confirm() confirmed = %v, want %v", tt.repository.Confirmed, tt.confirmed)
+			}
+			if tt.confirmed && (len(got.Codes) != recoveryCodeCount || len(tt.repository.RecoveryCodes) != recoveryCodeCount) {
+				t.Errorf("mfaService.Confirm() expected %v recovery codes, got %v", recoveryCodeCount, got)
+			}
+		})
+	}
+}
+
+func Test_mfaService_VerifyCode(t *testing.T) {
+	confirmed, code := enrolled(t, true)
+	unconfirmed, unconfirmedCode := enrolled(t, false)
+	first, firstCode := recoveryCode(t, 1)
+	second, secondCode := recoveryCode(t, 2)
+	stored := []domain.RecoveryCode{first, second}
+
+	tests := []struct {
+		name       string
+		code       string
+		repository *MockRepository
+		want       bool
+		wantErr    bool
+		usedCodes  []int64
+	}{
+		{
+			name:       "not_enrolled",
+			code:       code,
+			repository: &MockRepository{},
+		},
+		{
+			name:       "not_confirmed",
+			code:       unconfirmedCode,
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: unconfirmed}},
+		},
+		{
+			name:       "fetch_error",
+			code:       code,
+			repository: &MockRepository{Errors: map[int]error{GetMFAMockID: errors.New("error")}},
+			wantErr:    true,
+		},
+		{
+			name:       "ok",
+			code:       code,
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: confirmed}},
+			want:       true,
+		},
+		{
+			name:       "recovery_code",
+			code:       strings.ToUpper(secondCode),
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: confirmed, GetRecoveryCodesMockID: stored}},
+			want:       true,
+			usedCodes:  []int64{2},
+		},
+		{
+			name: "recovery_code_already_used",
+			code: firstCode,
+			repository: &MockRepository{Responses: map[int]interface{}{
+				GetMFAMockID:           confirmed,
+				GetRecoveryCodesMockID: stored,
+				UseRecoveryCodeMockID:  false,
+			}},
+			usedCodes: []int64{1},
+		},
+		{
+			name:       "unknown_recovery_code",
+			code:       "aaaaa-aaaaa",
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: confirmed, GetRecoveryCodesMockID: stored}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewService(testConfig(), tt.repository)
+			got, err := m.VerifyCode(context.Background(), 123, tt.code)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mfaService.VerifyCode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("mfaService.VerifyCode() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.repository.UsedCodes, tt.usedCodes) {
+				t.Errorf("mfaService.VerifyCode() used codes = %v, want %v", tt.repository.UsedCodes, tt.usedCodes)
+			}
+		})
+	}
+}
+
+func Test_mfaService_RegenerateRecoveryCodes(t *testing.T) {
+	claims := &encryption.AccessTokenClaims{AuthId: 123}
+	confirmed, _ := enrolled(t, true)
+	unconfirmed, _ := enrolled(t, false)
+	notEnrolled := apierror.New(http.StatusBadRequest, ErrMFANotEnrolled, apierror.NewErrorCause(ErrMFANotEnrolled, ErrMFANotEnrolledCode))
+
+	tests := []struct {
+		name       string
+		repository *MockRepository
+		want1      apierror.ApiError
+	}{
+		{
+			name:       "not_enrolled",
+			repository: &MockRepository{},
+			want1:      notEnrolled,
+		},
+		{
+			name:       "not_confirmed",
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: unconfirmed}},
+			want1:      notEnrolled,
+		},
+		{
+			name:       "ok",
+			repository: &MockRepository{Responses: map[int]interface{}{GetMFAMockID: confirmed}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewService(testConfig(), tt.repository)
+			got, got1 := m.RegenerateRecoveryCodes(context.Background(), claims, &middleware.ContextInformation{})
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("mfaService.RegenerateRecoveryCodes() got1 = %v, want %v", got1, tt.want1)
+				return
+			}
+			if tt.want1 != nil {
+				return
+			}
+
+			// Every code returned is the one hashed and stored in the same position.
+			if len(got.Codes) != recoveryCodeCount || len(tt.repository.RecoveryCodes) != recoveryCodeCount {
+				t.Fatalf("mfaService.RegenerateRecoveryCodes() expected %v codes, got %v", recoveryCodeCount, got.Codes)
+			}
+			for i, code := range got.Codes {
+				if ok, _ := encryption.CompareEncodedHash(encryption.NormalizeRecoveryCode(code), tt.repository.RecoveryCodes[i], testConfig()); !ok {
+					t.Errorf("mfaService.RegenerateRecoveryCodes() code %v doesn't match its hash", code)
+				}
+			}
+		})
+	}
+}
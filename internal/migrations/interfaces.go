@@ -0,0 +1,7 @@
+package migrations
+
+type Migrator interface {
+	Up() ([]Migration, error)
+	Down() (*Migration, error)
+	Status() ([]MigrationStatus, error)
+}
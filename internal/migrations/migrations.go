@@ -0,0 +1,316 @@
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed sql/*/*.sql
+var files embed.FS
+
+// migrationsTables The table applied versions are recorded in, by dialect
+var migrationsTables = map[string]string{
+	config.DatabaseDriverMySQL: `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    date_applied DATETIME NOT NULL,
+    PRIMARY KEY (version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	config.DatabaseDriverPostgres: `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    date_applied TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (version)
+)`,
+	config.DatabaseDriverSQLite: `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    date_applied DATETIME NOT NULL,
+    PRIMARY KEY (version)
+)`,
+}
+
+// fileName Migrations are named <version>_<name>.up.sql and <version>_<name>.down.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration A versioned schema change and the statements that revert it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus Whether a migration was applied to the database and when
+type MigrationStatus struct {
+	Version     int64
+	Name        string
+	Applied     bool
+	DateApplied string
+	// Unknown is set when the database has a version this binary doesn't ship, usually because it was migrated by a
+	// newer release
+	Unknown bool
+}
+
+type appliedMigration struct {
+	Version     int64  `db:"version"`
+	Name        string `db:"name"`
+	DateApplied string `db:"date_applied"`
+}
+
+type migrator struct {
+	db         *sqlx.DB
+	dialect    string
+	migrations []Migration
+}
+
+// NewMigrator Returns a migrator that applies the migrations embedded in the binary for the database db connects to
+func NewMigrator(db *sqlx.DB) (Migrator, error) {
+	dialect := storage.Dialect(db)
+	migrations, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Load Reads the embedded migrations of the dialect ordered by version. Every dialect has the same versions, written
+// in its own SQL
+func Load(dialect string) ([]Migration, error) {
+	if _, ok := migrationsTables[dialect]; !ok {
+		return nil, fmt.Errorf("there are no migrations for %s", dialect)
+	}
+
+	dir := path.Join("sql", dialect)
+	entries, err := files.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s doesn't match <version>_<name>.<up|down>.sql", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %s: %w", entry.Name(), err)
+		}
+
+		content, err := files.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up Applies every pending migration in order and returns the ones it applied. Each migration runs in a transaction
+// with the record of its version, except on MySQL where DDL is committed implicitly: there the version is recorded as
+// soon as the migration runs and if one fails the statements before it stay applied
+func (m *migrator) Up() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := m.run(migration.Up, "INSERT INTO schema_migrations (version, name, date_applied) VALUES (?, ?, CURRENT_TIMESTAMP)", migration.Version, migration.Name)
+		if err != nil {
+			return done, fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down Reverts the latest applied migration, returns nil if there was nothing to revert
+func (m *migrator) Down() (*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(applied) == 0 {
+		return nil, nil
+	}
+
+	var latest int64
+	for version := range applied {
+		if version > latest {
+			latest = version
+		}
+	}
+
+	migration := m.find(latest)
+	if migration == nil {
+		return nil, fmt.Errorf("migration %d_%s isn't known by this binary, revert it with the release that applied it", latest, applied[latest].Name)
+	}
+
+	if err := m.run(migration.Down, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+		return nil, fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return migration, nil
+}
+
+// Status Lists every known migration and whether it was applied, followed by the applied versions this binary
+// doesn't know about
+func (m *migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+	for _, migration := range m.migrations {
+		s := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if a, ok := applied[migration.Version]; ok {
+			s.Applied = true
+			s.DateApplied = a.DateApplied
+			delete(applied, migration.Version)
+		}
+		status = append(status, s)
+	}
+
+	var unknown []MigrationStatus
+	for _, a := range applied {
+		unknown = append(unknown, MigrationStatus{Version: a.Version, Name: a.Name, Applied: true, DateApplied: a.DateApplied, Unknown: true})
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+
+	return append(status, unknown...), nil
+}
+
+func (m *migrator) applied() (map[int64]appliedMigration, error) {
+	if _, err := m.db.Exec(migrationsTables[m.dialect]); err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	var rows []appliedMigration
+	err := m.db.Select(&rows, "SELECT version, name, date_applied FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("reading schema_migrations: %w", err)
+	}
+
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func (m *migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// run Runs the statements of a script one at a time, since MySQL connections aren't opened with multiStatements, and
+// then the statement that records it in schema_migrations
+func (m *migrator) run(script string, record string, args ...interface{}) error {
+	if m.dialect == config.DatabaseDriverMySQL {
+		return exec(m.db, script, record, args...)
+	}
+
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := exec(tx, script, record, args...); err != nil {
+		tx.Rollback() // nolint
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func exec(db sqlx.Ext, script string, record string, args ...interface{}) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.Exec(db.Rebind(record), args...)
+	return err
+}
+
+// splitStatements Splits a script on the semicolons that end a line, dropping -- comments. Statements can't have
+// a semicolon at the end of a line inside a string literal
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			statements = append(statements, s)
+		}
+		current.Reset()
+	}
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		if strings.HasSuffix(trimmed, ";") {
+			current.WriteString(strings.TrimSuffix(strings.TrimRight(line, " \t\r"), ";"))
+			flush()
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+	flush()
+
+	return statements
+}
@@ -0,0 +1,2 @@
+DROP TABLE users_email;
+DROP TABLE users;
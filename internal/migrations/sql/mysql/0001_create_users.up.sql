@@ -0,0 +1,31 @@
+-- IF NOT EXISTS so installs from before the migrations adopt them over the tables they already have
+CREATE TABLE IF NOT EXISTS users (
+    user_id BIGINT NOT NULL AUTO_INCREMENT,
+    username VARCHAR(255) NOT NULL,
+    normalized_username VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(512) NOT NULL,
+    lockout_enabled TINYINT(1) NOT NULL DEFAULT 0,
+    lockout_date DATETIME NULL,
+    failed_login_attempts INT NOT NULL DEFAULT 0,
+    date_created DATETIME NOT NULL,
+    security_token VARCHAR(255) NULL,
+    verification_token VARCHAR(1024) NOT NULL DEFAULT '',
+    date_deleted DATETIME NULL,
+    PRIMARY KEY (user_id),
+    UNIQUE KEY ux_users_normalized_username (normalized_username)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS users_email (
+    user_email_id BIGINT NOT NULL AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    normalized_email VARCHAR(255) NOT NULL,
+    verified_email TINYINT(1) NOT NULL DEFAULT 0,
+    verification_date DATETIME NULL,
+    date_created DATETIME NOT NULL,
+    date_deleted DATETIME NULL,
+    PRIMARY KEY (user_email_id),
+    UNIQUE KEY ux_users_email_normalized_email (normalized_email),
+    KEY ix_users_email_user_id (user_id),
+    CONSTRAINT fk_users_email_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,16 @@
+CREATE TABLE users_refresh_token (
+    refresh_token_id BIGINT NOT NULL AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    family_id VARCHAR(64) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expiry_date DATETIME NOT NULL,
+    date_created DATETIME NOT NULL,
+    date_revoked DATETIME NULL,
+    access_token_id VARCHAR(64) NOT NULL DEFAULT '',
+    access_token_expiry_date DATETIME NULL,
+    PRIMARY KEY (refresh_token_id),
+    UNIQUE KEY ux_users_refresh_token_token_hash (token_hash),
+    KEY ix_users_refresh_token_family_id (family_id),
+    KEY ix_users_refresh_token_user_id (user_id),
+    CONSTRAINT fk_users_refresh_token_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,7 @@
+CREATE TABLE revoked_token (
+    jti VARCHAR(64) NOT NULL,
+    expiry_date DATETIME NOT NULL,
+    date_created DATETIME NOT NULL,
+    PRIMARY KEY (jti),
+    KEY ix_revoked_token_expiry_date (expiry_date)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+DROP TABLE users_mfa_recovery_code;
+DROP TABLE users_mfa;
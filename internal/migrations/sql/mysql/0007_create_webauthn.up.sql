@@ -0,0 +1,25 @@
+-- Credential ids are base64url and can be up to 1023 bytes long once decoded,
+-- ascii keeps the primary key under the InnoDB index limit.
+CREATE TABLE users_webauthn_credential (
+    credential_id VARCHAR(1366) CHARACTER SET ascii COLLATE ascii_bin NOT NULL,
+    user_id BIGINT NOT NULL,
+    public_key BLOB NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    date_created DATETIME NOT NULL,
+    date_last_used DATETIME NULL,
+    PRIMARY KEY (credential_id),
+    KEY ix_users_webauthn_credential_user_id (user_id),
+    CONSTRAINT fk_users_webauthn_credential_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- user_id is 0 for passwordless login ceremonies, so it has no foreign key.
+CREATE TABLE webauthn_challenge (
+    challenge_hash CHAR(64) NOT NULL,
+    user_id BIGINT NOT NULL,
+    ceremony VARCHAR(32) NOT NULL,
+    expiry_date DATETIME NOT NULL,
+    date_created DATETIME NOT NULL,
+    PRIMARY KEY (challenge_hash),
+    KEY ix_webauthn_challenge_expiry_date (expiry_date)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
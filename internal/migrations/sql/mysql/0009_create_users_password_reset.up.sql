@@ -0,0 +1,12 @@
+CREATE TABLE users_password_reset (
+    password_reset_id BIGINT NOT NULL AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expiry_date DATETIME NOT NULL,
+    date_created DATETIME NOT NULL,
+    date_used DATETIME NULL,
+    PRIMARY KEY (password_reset_id),
+    UNIQUE KEY ux_users_password_reset_token_hash (token_hash),
+    KEY ix_users_password_reset_user_id (user_id),
+    CONSTRAINT fk_users_password_reset_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
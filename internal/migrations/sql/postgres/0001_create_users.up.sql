@@ -0,0 +1,31 @@
+-- IF NOT EXISTS so installs from before the migrations adopt them over the tables they already have
+CREATE TABLE IF NOT EXISTS users (
+    user_id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+    username VARCHAR(255) NOT NULL,
+    normalized_username VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(512) NOT NULL,
+    lockout_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    lockout_date TIMESTAMPTZ NULL,
+    failed_login_attempts INT NOT NULL DEFAULT 0,
+    date_created TIMESTAMPTZ NOT NULL,
+    security_token VARCHAR(255) NULL,
+    verification_token VARCHAR(1024) NOT NULL DEFAULT '',
+    date_deleted TIMESTAMPTZ NULL,
+    PRIMARY KEY (user_id),
+    CONSTRAINT ux_users_normalized_username UNIQUE (normalized_username)
+);
+
+CREATE TABLE IF NOT EXISTS users_email (
+    user_email_id BIGINT GENERATED BY DEFAULT AS IDENTITY,
+    user_id BIGINT NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    normalized_email VARCHAR(255) NOT NULL,
+    verified_email BOOLEAN NOT NULL DEFAULT FALSE,
+    verification_date TIMESTAMPTZ NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    date_deleted TIMESTAMPTZ NULL,
+    PRIMARY KEY (user_email_id),
+    CONSTRAINT ux_users_email_normalized_email UNIQUE (normalized_email),
+    CONSTRAINT fk_users_email_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS ix_users_email_user_id ON users_email (user_id);
@@ -0,0 +1,12 @@
+CREATE TABLE users_session (
+    session_id VARCHAR(64) NOT NULL,
+    user_id BIGINT NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    date_created TIMESTAMPTZ NOT NULL,
+    date_last_refresh TIMESTAMPTZ NOT NULL,
+    date_revoked TIMESTAMPTZ NULL,
+    PRIMARY KEY (session_id),
+    CONSTRAINT fk_users_session_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+CREATE INDEX ix_users_session_user_id ON users_session (user_id);
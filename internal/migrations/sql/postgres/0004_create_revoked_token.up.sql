@@ -0,0 +1,7 @@
+CREATE TABLE revoked_token (
+    jti VARCHAR(64) NOT NULL,
+    expiry_date TIMESTAMPTZ NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (jti)
+);
+CREATE INDEX ix_revoked_token_expiry_date ON revoked_token (expiry_date);
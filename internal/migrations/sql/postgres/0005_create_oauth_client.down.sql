@@ -0,0 +1 @@
+DROP TABLE oauth_client;
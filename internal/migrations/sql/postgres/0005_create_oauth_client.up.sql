@@ -0,0 +1,8 @@
+CREATE TABLE oauth_client (
+    client_id VARCHAR(64) NOT NULL,
+    client_secret_hash CHAR(64) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    date_deleted TIMESTAMPTZ NULL,
+    PRIMARY KEY (client_id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE webauthn_challenge;
+DROP TABLE users_webauthn_credential;
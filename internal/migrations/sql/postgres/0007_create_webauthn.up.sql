@@ -0,0 +1,23 @@
+CREATE TABLE users_webauthn_credential (
+    credential_id VARCHAR(1366) NOT NULL,
+    user_id BIGINT NOT NULL,
+    public_key BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    date_created TIMESTAMPTZ NOT NULL,
+    date_last_used TIMESTAMPTZ NULL,
+    PRIMARY KEY (credential_id),
+    CONSTRAINT fk_users_webauthn_credential_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+CREATE INDEX ix_users_webauthn_credential_user_id ON users_webauthn_credential (user_id);
+
+-- user_id is 0 for passwordless login ceremonies, so it has no foreign key.
+CREATE TABLE webauthn_challenge (
+    challenge_hash CHAR(64) NOT NULL,
+    user_id BIGINT NOT NULL,
+    ceremony VARCHAR(32) NOT NULL,
+    expiry_date TIMESTAMPTZ NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (challenge_hash)
+);
+CREATE INDEX ix_webauthn_challenge_expiry_date ON webauthn_challenge (expiry_date);
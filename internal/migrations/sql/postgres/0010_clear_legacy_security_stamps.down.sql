@@ -0,0 +1,2 @@
+-- The cleared stamps can't be restored, a new one is generated when the password changes
+SELECT 1;
@@ -0,0 +1,2 @@
+-- The old stamps were JWTs with the plaintext password in them, the random ones have no dots
+UPDATE users SET security_token = NULL WHERE security_token LIKE '%.%.%';
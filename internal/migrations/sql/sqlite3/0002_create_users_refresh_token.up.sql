@@ -0,0 +1,15 @@
+CREATE TABLE users_refresh_token (
+    refresh_token_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL,
+    family_id VARCHAR(64) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expiry_date DATETIME NOT NULL,
+    date_created DATETIME NOT NULL,
+    date_revoked DATETIME NULL,
+    access_token_id VARCHAR(64) NOT NULL DEFAULT '',
+    access_token_expiry_date DATETIME NULL,
+    CONSTRAINT ux_users_refresh_token_token_hash UNIQUE (token_hash),
+    CONSTRAINT fk_users_refresh_token_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+CREATE INDEX ix_users_refresh_token_family_id ON users_refresh_token (family_id);
+CREATE INDEX ix_users_refresh_token_user_id ON users_refresh_token (user_id);
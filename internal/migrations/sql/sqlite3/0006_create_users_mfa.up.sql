@@ -0,0 +1,19 @@
+CREATE TABLE users_mfa (
+    user_id BIGINT NOT NULL,
+    totp_secret VARCHAR(255) NOT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    date_created DATETIME NOT NULL,
+    date_confirmed DATETIME NULL,
+    PRIMARY KEY (user_id),
+    CONSTRAINT fk_users_mfa_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE users_mfa_recovery_code (
+    recovery_code_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL,
+    code_hash VARCHAR(512) NOT NULL,
+    date_created DATETIME NOT NULL,
+    date_used DATETIME NULL,
+    CONSTRAINT fk_users_mfa_recovery_code_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+CREATE INDEX ix_users_mfa_recovery_code_user_id ON users_mfa_recovery_code (user_id);
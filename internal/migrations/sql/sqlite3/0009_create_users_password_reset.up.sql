@@ -0,0 +1,11 @@
+CREATE TABLE users_password_reset (
+    password_reset_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expiry_date DATETIME NOT NULL,
+    date_created DATETIME NOT NULL,
+    date_used DATETIME NULL,
+    CONSTRAINT ux_users_password_reset_token_hash UNIQUE (token_hash),
+    CONSTRAINT fk_users_password_reset_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+CREATE INDEX ix_users_password_reset_user_id ON users_password_reset (user_id);
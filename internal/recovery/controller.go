@@ -26,7 +26,7 @@ func NewController(s RecoveryService) RecoveryController {
 }
 
 func (r *recoveryController) SendConfirmationEmail(c *gin.Context) {
-	ctx := middleware.GetContextInformation("SendConfirmationEmail", c)
+	info := middleware.GetContextInformation("SendConfirmationEmail", c)
 	userIdParam := c.Param("secondpath")
 	if userIdParam == "" {
 		c.JSON(http.StatusBadRequest, apierror.NewBadRequestApiError(ErrMissingUserId))
@@ -40,7 +40,7 @@ func (r *recoveryController) SendConfirmationEmail(c *gin.Context) {
 		return
 	}
 
-	_, e := r.svc.SendConfirmationEmail(parsedUserId, ctx)
+	_, e := r.svc.SendConfirmationEmail(c.Request.Context(), parsedUserId, info)
 	if e != nil {
 		c.JSON(e.Status(), e)
 		return
@@ -50,7 +50,7 @@ func (r *recoveryController) SendConfirmationEmail(c *gin.Context) {
 }
 
 func (r *recoveryController) ConfirmEmail(c *gin.Context) {
-	ctx := middleware.GetContextInformation("ConfirmEmail", c)
+	info := middleware.GetContextInformation("ConfirmEmail", c)
 	email := c.Query("email")
 	token := c.Query("token")
 	if email == "" || token == "" {
@@ -59,8 +59,8 @@ func (r *recoveryController) ConfirmEmail(c *gin.Context) {
 	}
 
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "ConfirmEmail", ctx, func() {
-		_, err = r.svc.ConfirmEmail(email, token, ctx)
+	performance.TrackTime(time.Now(), "ConfirmEmail", info, func() {
+		_, err = r.svc.ConfirmEmail(c.Request.Context(), email, token, info)
 	})
 	if err != nil {
 		c.JSON(err.Status(), err)
@@ -71,7 +71,7 @@ func (r *recoveryController) ConfirmEmail(c *gin.Context) {
 }
 
 func (r *recoveryController) ResendEmailConfirmation(c *gin.Context) {
-	ctx := middleware.GetContextInformation("ResendEmailConfirmation", c)
+	info := middleware.GetContextInformation("ResendEmailConfirmation", c)
 	email := c.Query("email")
 	if email == "" {
 		c.JSON(http.StatusBadRequest, apierror.NewBadRequestApiError(domain.ErrEmptyField))
@@ -79,8 +79,8 @@ func (r *recoveryController) ResendEmailConfirmation(c *gin.Context) {
 	}
 
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "ResendEmailConfirmationEmail", ctx, func() {
-		_, err = r.svc.ResendEmailConfirmationEmail(email, ctx)
+	performance.TrackTime(time.Now(), "ResendEmailConfirmationEmail", info, func() {
+		_, err = r.svc.ResendEmailConfirmationEmail(c.Request.Context(), email, info)
 	})
 
 	if err != nil {
@@ -92,7 +92,7 @@ func (r *recoveryController) ResendEmailConfirmation(c *gin.Context) {
 }
 
 func (r *recoveryController) ForgotUsername(c *gin.Context) {
-	ctx := middleware.GetContextInformation("ForgotUsername", c)
+	info := middleware.GetContextInformation("ForgotUsername", c)
 	email := c.Query("email")
 	if email == "" {
 		c.JSON(http.StatusBadRequest, apierror.NewBadRequestApiError(domain.ErrEmptyField))
@@ -100,8 +100,8 @@ func (r *recoveryController) ForgotUsername(c *gin.Context) {
 	}
 
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "SendUsername", ctx, func() {
-		_, err = r.svc.SendUsername(email, ctx)
+	performance.TrackTime(time.Now(), "SendUsername", info, func() {
+		_, err = r.svc.SendUsername(c.Request.Context(), email, info)
 	})
 	if err != nil {
 		c.JSON(err.Status(), err)
@@ -112,7 +112,7 @@ func (r *recoveryController) ForgotUsername(c *gin.Context) {
 }
 
 func (r *recoveryController) SendPasswordReset(c *gin.Context) {
-	ctx := middleware.GetContextInformation("ForgotUsername", c)
+	info := middleware.GetContextInformation("ForgotUsername", c)
 	email := c.Query("email")
 	if email == "" {
 		c.JSON(http.StatusBadRequest, apierror.NewBadRequestApiError(domain.ErrEmptyField))
@@ -120,8 +120,8 @@ func (r *recoveryController) SendPasswordReset(c *gin.Context) {
 	}
 
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "SendPasswordReset", ctx, func() {
-		_, err = r.svc.SendPasswordReset(email, ctx)
+	performance.TrackTime(time.Now(), "SendPasswordReset", info, func() {
+		_, err = r.svc.SendPasswordReset(c.Request.Context(), email, info)
 	})
 
 	if err != nil {
@@ -133,7 +133,7 @@ func (r *recoveryController) SendPasswordReset(c *gin.Context) {
 }
 
 func (r *recoveryController) ConfirmPasswordReset(c *gin.Context) {
-	ctx := middleware.GetContextInformation("ConfirmPasswordReset", c)
+	info := middleware.GetContextInformation("ConfirmPasswordReset", c)
 	var dto domain.PasswordResetDto
 
 	if err := c.ShouldBindJSON(&dto); err != nil {
@@ -146,8 +146,8 @@ func (r *recoveryController) ConfirmPasswordReset(c *gin.Context) {
 	}
 
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "ResetPassword", ctx, func() {
-		_, err = r.svc.ResetPassword(dto.Email, dto.Password, dto.ConfirmPassword, dto.Token, ctx)
+	performance.TrackTime(time.Now(), "ResetPassword", info, func() {
+		_, err = r.svc.ResetPassword(c.Request.Context(), dto.Email, dto.Password, dto.ConfirmPassword, dto.Token, info)
 	})
 	if err != nil {
 		c.JSON(err.Status(), err)
@@ -166,7 +166,7 @@ func (r *recoveryController) GetUserByUserId(c *gin.Context) {
 		return
 	}
 
-	usr, e := r.svc.GetUserByUserId(int64(userid))
+	usr, e := r.svc.GetUserByUserId(c.Request.Context(), int64(userid))
 	if e != nil {
 		c.JSON(e.Status(), e)
 		return
@@ -2,6 +2,7 @@ package recovery
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -11,7 +12,7 @@ import (
 	"testing"
 
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
-	"github.com/CienciaArgentina/go-backend-commons/pkg/rest"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
 	"github.com/gin-gonic/gin"
 )
@@ -32,31 +33,31 @@ type MockService struct {
 	Errors    map[int]apierror.ApiError
 }
 
-func (m *MockService) SendConfirmationEmail(userID int64, ctx *rest.ContextInformation) (bool, apierror.ApiError) {
+func (m *MockService) SendConfirmationEmail(ctx context.Context, userID int64, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	return m.Responses[SendConfirmationEmailMockID].(bool), m.Errors[SendConfirmationEmailMockID]
 }
 
-func (m *MockService) ConfirmEmail(email string, token string, ctx *rest.ContextInformation) (bool, apierror.ApiError) {
+func (m *MockService) ConfirmEmail(ctx context.Context, email string, token string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	return m.Responses[ConfirmEmailMockID].(bool), m.Errors[ConfirmEmailMockID]
 }
 
-func (m *MockService) ResendEmailConfirmationEmail(email string, ctx *rest.ContextInformation) (bool, apierror.ApiError) {
+func (m *MockService) ResendEmailConfirmationEmail(ctx context.Context, email string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	return m.Responses[ResendEmailConfirmationEmailMockID].(bool), m.Errors[ResendEmailConfirmationEmailMockID]
 }
 
-func (m *MockService) SendUsername(email string, ctx *rest.ContextInformation) (bool, apierror.ApiError) {
+func (m *MockService) SendUsername(ctx context.Context, email string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	return m.Responses[SendUsernameMockID].(bool), m.Errors[SendUsernameMockID]
 }
 
-func (m *MockService) SendPasswordReset(email string, ctx *rest.ContextInformation) (bool, apierror.ApiError) {
+func (m *MockService) SendPasswordReset(ctx context.Context, email string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	return m.Responses[SendPasswordResetMockID].(bool), m.Errors[SendPasswordResetMockID]
 }
 
-func (m *MockService) ResetPassword(email, password, confirmPassword, token string, ctx *rest.ContextInformation) (bool, apierror.ApiError) {
+func (m *MockService) ResetPassword(ctx context.Context, email, password, confirmPassword, token string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	return m.Responses[ResetPasswordMockID].(bool), m.Errors[ResetPasswordMockID]
 }
 
-func (m *MockService) GetUserByUserId(userID int64) (*domain.User, apierror.ApiError) {
+func (m *MockService) GetUserByUserId(ctx context.Context, userID int64) (*domain.User, apierror.ApiError) {
 	return m.Responses[GetUserByUserIdMockID].(*domain.User), m.Errors[GetUserByUserIdMockID]
 }
 
@@ -1,6 +1,8 @@
 package recovery
 
 import (
+	"context"
+
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
 	domain2 "github.com/CienciaArgentina/go-enigma/internal/domain"
@@ -8,24 +10,29 @@ import (
 )
 
 type RecoveryRepository interface {
-	GetEmailByUserId(userId int64) (string, *domain2.UserEmail, apierror.ApiError)
-	ConfirmUserEmail(email string, token string) apierror.ApiError
-	GetuserIdByEmail(email string) (int64, apierror.ApiError)
-	GetUsernameByEmail(email string) (string, apierror.ApiError)
-	GetSecurityToken(email string) (string, apierror.ApiError)
-	UpdatePasswordHash(userId int64, passwordHash string) (bool, apierror.ApiError)
-	UpdateSecurityToken(userId int64, newSecurityToken string) (bool, apierror.ApiError)
-	GetUserByUserId(userId int64) (*domain2.User, apierror.ApiError)
+	ConfirmUserEmail(ctx context.Context, email string, token string) apierror.ApiError
+	UpdateVerificationToken(ctx context.Context, userId int64, token string) apierror.ApiError
+	UpdatePasswordHash(ctx context.Context, userId int64, passwordHash string, securityToken string) (bool, apierror.ApiError)
+	AddPasswordReset(ctx context.Context, reset *domain2.PasswordReset) apierror.ApiError
+	GetPasswordReset(ctx context.Context, tokenHash string) (*domain2.PasswordReset, apierror.ApiError)
+	UsePasswordReset(ctx context.Context, reset *domain2.PasswordReset) (bool, apierror.ApiError)
+}
+
+// UserStore The lookups of users.UserStore that recovery needs
+type UserStore interface {
+	GetUser(ctx context.Context, userID int64) (*domain2.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain2.User, error)
+	GetEmail(ctx context.Context, userID int64) (*domain2.UserEmail, error)
 }
 
 type RecoveryService interface {
-	SendConfirmationEmail(userId int64, ctx *middleware.ContextInformation) (bool, apierror.ApiError)
-	ConfirmEmail(email string, token string, ctx *middleware.ContextInformation) (bool, apierror.ApiError)
-	ResendEmailConfirmationEmail(email string, ctx *middleware.ContextInformation) (bool, apierror.ApiError)
-	SendUsername(email string, ctx *middleware.ContextInformation) (bool, apierror.ApiError)
-	SendPasswordReset(email string, ctx *middleware.ContextInformation) (bool, apierror.ApiError)
-	ResetPassword(email, password, confirmPassword, token string, ctx *middleware.ContextInformation) (bool, apierror.ApiError)
-	GetUserByUserId(userId int64) (*domain2.User, apierror.ApiError)
+	SendConfirmationEmail(ctx context.Context, userId int64, info *middleware.ContextInformation) (bool, apierror.ApiError)
+	ConfirmEmail(ctx context.Context, email string, token string, info *middleware.ContextInformation) (bool, apierror.ApiError)
+	ResendEmailConfirmationEmail(ctx context.Context, email string, info *middleware.ContextInformation) (bool, apierror.ApiError)
+	SendUsername(ctx context.Context, email string, info *middleware.ContextInformation) (bool, apierror.ApiError)
+	SendPasswordReset(ctx context.Context, email string, info *middleware.ContextInformation) (bool, apierror.ApiError)
+	ResetPassword(ctx context.Context, email, password, confirmPassword, token string, info *middleware.ContextInformation) (bool, apierror.ApiError)
+	GetUserByUserId(ctx context.Context, userId int64) (*domain2.User, apierror.ApiError)
 }
 
 type RecoveryController interface {
@@ -0,0 +1,157 @@
+package recovery
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage/memory"
+)
+
+type memoryRepository struct {
+	store *memory.Store
+}
+
+// NewMemoryRepository Returns a recovery repository that keeps the users and password resets in store
+func NewMemoryRepository(store *memory.Store) RecoveryRepository {
+	return &memoryRepository{store: store}
+}
+
+func (m *memoryRepository) ConfirmUserEmail(ctx context.Context, email string, token string) apierror.ApiError {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	userEmail, ok := m.store.EmailByNormalizedEmail(email)
+	if !ok {
+		return apierror.New(http.StatusBadRequest, ErrNoUserEmail, apierror.NewErrorCause(ErrNoUserEmail, ErrNoUserEmailCode))
+	}
+
+	if userEmail.VerfiedEmail {
+		return apierror.New(http.StatusBadRequest, ErrEmailAlreadyverified, apierror.NewErrorCause(ErrEmailAlreadyVerified, ErrEmailAlreadyverifiedCode))
+	}
+
+	user, ok := m.store.Users[userEmail.UserId]
+	if !ok {
+		return apierror.New(http.StatusBadRequest, ErrNoUserId, apierror.NewErrorCause(ErrNoUserId, ErrNoUserIdCode))
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(user.VerificationToken)) != 1 {
+		return apierror.New(http.StatusBadRequest, ErrValidationTokenFailed, apierror.NewErrorCause(ErrValidationTokenFailed, ErrValidationTokenFailedCode))
+	}
+
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	for id, e := range m.store.UserEmails {
+		if e.UserId == user.AuthId {
+			e.VerfiedEmail = true
+			e.VerificationDate = now
+			m.store.UserEmails[id] = e
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryRepository) UpdateVerificationToken(ctx context.Context, userId int64, token string) apierror.ApiError {
+	if token == "" {
+		return apierror.New(http.StatusBadRequest, domain.ErrEmptyField, apierror.NewErrorCause(domain.ErrEmptyField, domain.ErrEmptyFieldCode))
+	}
+
+	if !m.updateUser(userId, func(user *domain.User) { user.VerificationToken = token }) {
+		return apierror.New(http.StatusBadRequest, ErrNoUserId, apierror.NewErrorCause(ErrNoUserId, ErrNoUserIdCode))
+	}
+
+	return nil
+}
+
+func (m *memoryRepository) UpdatePasswordHash(ctx context.Context, userId int64, passwordHash string, securityToken string) (bool, apierror.ApiError) {
+	if passwordHash == "" || securityToken == "" {
+		return false, apierror.New(http.StatusBadRequest, domain.ErrEmptyField, apierror.NewErrorCause(domain.ErrEmptyField, domain.ErrEmptyFieldCode))
+	}
+
+	update := func(user *domain.User) {
+		user.PasswordHash = passwordHash
+		user.SecurityToken = sql.NullString{String: securityToken, Valid: true}
+	}
+	if !m.updateUser(userId, update) {
+		return false, apierror.New(http.StatusInternalServerError, ErrUpdatingUser, apierror.NewErrorCause("Error updating password", ErrUpdatingUserCode))
+	}
+
+	return true, nil
+}
+
+// updateUser Changes the user, returns false if they don't exist
+func (m *memoryRepository) updateUser(userId int64, update func(user *domain.User)) bool {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	user, ok := m.store.Users[userId]
+	if !ok {
+		return false
+	}
+
+	update(&user)
+	m.store.Users[userId] = user
+	return true
+}
+
+func (m *memoryRepository) AddPasswordReset(ctx context.Context, reset *domain.PasswordReset) apierror.ApiError {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	if _, ok := m.store.Users[reset.UserId]; !ok {
+		return apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(memory.ErrForeignKeyViolation.Error(), ErrPasswordResetCode))
+	}
+	for _, r := range m.store.PasswordResets {
+		if r.TokenHash == reset.TokenHash {
+			return apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(memory.ErrUniqueViolation.Error(), ErrPasswordResetCode))
+		}
+	}
+
+	id := m.store.NextID("users_password_reset")
+	m.store.PasswordResets[id] = domain.PasswordReset{
+		PasswordResetId: id,
+		UserId:          reset.UserId,
+		TokenHash:       reset.TokenHash,
+		ExpiryDate:      reset.ExpiryDate,
+		DateCreated:     memory.Timestamp(time.Now()),
+	}
+
+	return nil
+}
+
+func (m *memoryRepository) GetPasswordReset(ctx context.Context, tokenHash string) (*domain.PasswordReset, apierror.ApiError) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	for _, reset := range m.store.PasswordResets {
+		if reset.TokenHash == tokenHash {
+			return &reset, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (m *memoryRepository) UsePasswordReset(ctx context.Context, reset *domain.PasswordReset) (bool, apierror.ApiError) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	stored, ok := m.store.PasswordResets[reset.PasswordResetId]
+	if !ok || stored.DateUsed.Valid {
+		return false, nil
+	}
+
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	for id, r := range m.store.PasswordResets {
+		if r.UserId == reset.UserId && !r.DateUsed.Valid {
+			r.DateUsed = now
+			m.store.PasswordResets[id] = r
+		}
+	}
+
+	return true, nil
+}
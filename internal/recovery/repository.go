@@ -1,11 +1,16 @@
 package recovery
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -33,48 +38,27 @@ const (
 
 	ErrUpdatingUser     = "Ocurrió un error al intentar actualizar el usuario"
 	ErrUpdatingUserCode = "user_update_failed"
+
+	ErrPasswordResetCode = "password_reset_failed"
 )
 
 type recoveryRepository struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	timeout time.Duration
 }
 
-// NewRepository Creates new repository with injected DB
-func NewRepository(db *sqlx.DB) RecoveryRepository {
-	return &recoveryRepository{db: db}
+// NewRepository Creates new repository with injected DB, its queries give up after timeout
+func NewRepository(db *sqlx.DB, timeout time.Duration) RecoveryRepository {
+	return &recoveryRepository{db: db, timeout: timeout}
 }
 
-// GetEmailByUserId Retrieves user's email based on it's ID
-func (r *recoveryRepository) GetEmailByUserId(userId int64) (string, *domain.UserEmail, apierror.ApiError) {
-	var user domain.User
-
-	err := r.db.Get(&user, "SELECT * FROM users where user_id = ?", userId)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", nil, apierror.New(http.StatusBadRequest, ErrNoUserId, apierror.NewErrorCause(ErrNoUserId, ErrNoUserIdCode))
-		}
-
-		return "", nil, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrFetchingUserCode))
-	}
+func (r *recoveryRepository) ConfirmUserEmail(ctx context.Context, email, token string) apierror.ApiError {
+	ctx, cancel := storage.WithTimeout(ctx, r.timeout)
+	defer cancel()
 
 	var userEmail domain.UserEmail
 
-	err = r.db.Get(&userEmail, "SELECT * FROM users_email where user_id = ?", userId)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", nil, apierror.New(http.StatusBadRequest, ErrNoUserEmail, apierror.NewErrorCause(ErrNoUserEmail, ErrNoUserEmailCode))
-		}
-
-		return "", nil, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrFetchingUserEmailCode))
-	}
-
-	return user.VerificationToken, &userEmail, nil
-}
-
-func (r *recoveryRepository) ConfirmUserEmail(email, token string) apierror.ApiError {
-	var userEmail domain.UserEmail
-
-	err := r.db.Get(&userEmail, "SELECT * FROM users_email where email = ?", email)
+	err := r.db.GetContext(ctx, &userEmail, r.db.Rebind("SELECT * FROM users_email where normalized_email = ?"), strings.ToUpper(email))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return apierror.New(http.StatusBadRequest, ErrNoUserEmail, apierror.NewErrorCause(ErrNoUserEmail, ErrNoUserEmailCode))
@@ -88,7 +72,7 @@ func (r *recoveryRepository) ConfirmUserEmail(email, token string) apierror.ApiE
 
 	var user domain.User
 
-	err = r.db.Get(&user, "SELECT * FROM users where user_id = ?", userEmail.UserId)
+	err = r.db.GetContext(ctx, &user, r.db.Rebind("SELECT * FROM users where user_id = ?"), userEmail.UserId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return apierror.New(http.StatusBadRequest, ErrNoUserId, apierror.NewErrorCause(ErrNoUserId, ErrNoUserIdCode))
@@ -96,11 +80,12 @@ func (r *recoveryRepository) ConfirmUserEmail(email, token string) apierror.ApiE
 		return apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrFetchingUserCode))
 	}
 
-	if token != user.VerificationToken {
+	// Only the last token sent works, the ones before it were replaced
+	if subtle.ConstantTimeCompare([]byte(token), []byte(user.VerificationToken)) != 1 {
 		return apierror.New(http.StatusBadRequest, ErrValidationTokenFailed, apierror.NewErrorCause(ErrValidationTokenFailed, ErrValidationTokenFailedCode))
 	}
 
-	result, err := r.db.Exec("UPDATE users_email SET verified_email = 1, verification_date = now() WHERE user_id = ?", user.AuthId)
+	result, err := r.db.ExecContext(ctx, r.db.Rebind("UPDATE users_email SET verified_email = TRUE, verification_date = CURRENT_TIMESTAMP WHERE user_id = ?"), user.AuthId)
 	if err != nil {
 		return apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrUpdatingUserEmailCode))
 	}
@@ -112,81 +97,41 @@ func (r *recoveryRepository) ConfirmUserEmail(email, token string) apierror.ApiE
 	return nil
 }
 
-// GetuserIdByEmail Returns user's ID from given Email
-func (r *recoveryRepository) GetuserIdByEmail(email string) (int64, apierror.ApiError) {
-	var userId int64
+// UpdateVerificationToken Replaces the email verification token of the user
+func (r *recoveryRepository) UpdateVerificationToken(ctx context.Context, userId int64, token string) apierror.ApiError {
+	ctx, cancel := storage.WithTimeout(ctx, r.timeout)
+	defer cancel()
 
-	err := r.db.Get(&userId, "SELECT user_id FROM users_email where email = ?", email)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, apierror.New(http.StatusBadRequest, ErrNoUserEmail, apierror.NewErrorCause(ErrNoUserEmail, ErrNoUserEmailCode))
-		}
-		return 0, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrFetchingUserEmailCode))
+	if token == "" {
+		return apierror.New(http.StatusBadRequest, domain.ErrEmptyField, apierror.NewErrorCause(domain.ErrEmptyField, domain.ErrEmptyFieldCode))
 	}
 
-	return userId, nil
-}
-
-func (r *recoveryRepository) GetUsernameByEmail(email string) (string, apierror.ApiError) {
-	var userId int64
-
-	err := r.db.Get(&userId, "SELECT user_id FROM users_email WHERE email = ?", email)
+	result, err := r.db.ExecContext(ctx, r.db.Rebind("UPDATE users SET verification_token = ? WHERE user_id = ?"), token, userId)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", apierror.New(http.StatusBadRequest, ErrNoUserEmail, apierror.NewErrorCause(ErrNoUserEmail, ErrNoUserEmailCode))
-		}
-		return "", apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrFetchingUserEmailCode))
+		return apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrUpdatingUserCode))
 	}
 
-	var username string
-	err = r.db.Get(&username, "SELECT username FROM users where user_id = ?", userId)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", apierror.New(http.StatusBadRequest, ErrNoUserId, apierror.NewErrorCause(ErrNoUserId, ErrNoUserIdCode))
-		}
-		return "", apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrFetchingUserCode))
+	if num, _ := result.RowsAffected(); num == 0 {
+		return apierror.New(http.StatusBadRequest, ErrNoUserId, apierror.NewErrorCause(ErrNoUserId, ErrNoUserIdCode))
 	}
 
-	return username, nil
+	return nil
 }
 
-// GetSecurityToken Returns security token for given email
-func (r *recoveryRepository) GetSecurityToken(email string) (string, apierror.ApiError) {
-	var userEmail domain.UserEmail
-
-	err := r.db.Get(&userEmail, "SELECT * FROM users_email where email = ?", email)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", apierror.New(http.StatusBadRequest, ErrNoUserEmail, apierror.NewErrorCause(ErrNoUserEmail, ErrNoUserEmailCode))
-		}
-		return "", apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrFetchingUserEmailCode))
-	}
+// UpdatePasswordHash Updates users's password and replaces the security stamp in the same statement
+func (r *recoveryRepository) UpdatePasswordHash(ctx context.Context, userId int64, passwordHash string, securityToken string) (bool, apierror.ApiError) {
+	ctx, cancel := storage.WithTimeout(ctx, r.timeout)
+	defer cancel()
 
-	if !userEmail.VerfiedEmail {
-		return "", apierror.New(http.StatusBadRequest, ErrEmailNotVerified, apierror.NewErrorCause(ErrEmailNotVerified, ErrEmailNotVerifiedCode))
+	if passwordHash == "" || securityToken == "" {
+		return false, apierror.New(http.StatusBadRequest, domain.ErrEmptyField, apierror.NewErrorCause(domain.ErrEmptyField, domain.ErrEmptyFieldCode))
 	}
 
-	var securityToken string
-
-	err = r.db.Get(&securityToken, "SELECT security_token FROM users where user_id = ?", userEmail.UserId)
+	result, err := r.db.ExecContext(ctx, r.db.Rebind("UPDATE users SET password_hash = ?, security_token = ? where user_id = ?"), passwordHash, securityToken, userId)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", apierror.New(http.StatusBadRequest, ErrNoUserId, apierror.NewErrorCause(ErrNoUserId, ErrNoUserIdCode))
-		}
-		return "", apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrFetchingUserCode))
-	}
-
-	return securityToken, nil
-}
-
-// UpdatePasswordHash Updates users's password
-func (r *recoveryRepository) UpdatePasswordHash(userId int64, passwordHash string) (bool, apierror.ApiError) {
-	if passwordHash == "" {
-		return false, apierror.New(http.StatusBadRequest, domain.ErrEmptyField, apierror.NewErrorCause(domain.ErrEmptyField, domain.ErrEmptyFieldCode))
+		return false, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrUpdatingUserCode))
 	}
 
-	result := r.db.MustExec("UPDATE users SET password_hash = ?  where user_id = ?", passwordHash, userId)
-
 	updatedRows, err := result.RowsAffected()
 	if err != nil {
 		return false, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrUpdatingUserCode))
@@ -199,39 +144,69 @@ func (r *recoveryRepository) UpdatePasswordHash(userId int64, passwordHash strin
 	return true, nil
 }
 
-func (r *recoveryRepository) UpdateSecurityToken(userId int64, newSecurityToken string) (bool, apierror.ApiError) {
-	if newSecurityToken == "" {
-		return false, apierror.New(http.StatusBadRequest, domain.ErrEmptyField, apierror.NewErrorCause(domain.ErrEmptyField, domain.ErrEmptyFieldCode))
+// AddPasswordReset Stores a new password reset link
+func (r *recoveryRepository) AddPasswordReset(ctx context.Context, reset *domain.PasswordReset) apierror.ApiError {
+	ctx, cancel := storage.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, r.db.Rebind("INSERT INTO users_password_reset (user_id, token_hash, expiry_date, date_created) VALUES (?, ?, ?, CURRENT_TIMESTAMP)"),
+		reset.UserId, reset.TokenHash, reset.ExpiryDate)
+	if err != nil {
+		return apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrPasswordResetCode))
 	}
 
-	result := r.db.MustExec("UPDATE users SET security_token = ? where user_id = ?", newSecurityToken, userId)
+	return nil
+}
 
-	updatedRows, err := result.RowsAffected()
+// GetPasswordReset Returns the password reset link with the given hash, nil if it doesn't exist
+func (r *recoveryRepository) GetPasswordReset(ctx context.Context, tokenHash string) (*domain.PasswordReset, apierror.ApiError) {
+	ctx, cancel := storage.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var reset domain.PasswordReset
+
+	err := r.db.GetContext(ctx, &reset, r.db.Rebind("SELECT * FROM users_password_reset WHERE token_hash = ?"), tokenHash)
 	if err != nil {
-		return false, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrUpdatingUserCode))
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrPasswordResetCode))
 	}
 
-	if updatedRows == 0 {
-		return false, apierror.New(http.StatusInternalServerError, ErrUpdatingUser, apierror.NewErrorCause("No rows affected", ErrUpdatingUserCode))
+	return &reset, nil
+}
+
+// UsePasswordReset Marks the link as used along with every other link of the user that wasn't. Returns false if the
+// link was already used
+func (r *recoveryRepository) UsePasswordReset(ctx context.Context, reset *domain.PasswordReset) (bool, apierror.ApiError) {
+	ctx, cancel := storage.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrPasswordResetCode))
 	}
 
-	return true, nil
-}
+	res, err := tx.ExecContext(ctx, tx.Rebind("UPDATE users_password_reset SET date_used = CURRENT_TIMESTAMP WHERE password_reset_id = ? AND date_used IS NULL"), reset.PasswordResetId)
+	if err != nil {
+		tx.Rollback() // nolint
+		return false, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrPasswordResetCode))
+	}
 
-// GetUserByUserId Retrieves user with given user ID
-func (r *recoveryRepository) GetUserByUserId(userId int64) (*domain.User, apierror.ApiError) {
-	if userId == 0 {
-		return nil, apierror.New(http.StatusBadRequest, domain.ErrEmptyField, apierror.NewErrorCause(domain.ErrEmptyField, domain.ErrEmptyFieldCode))
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		tx.Rollback() // nolint
+		return false, nil
 	}
 
-	var usr domain.User
-	err := r.db.Get(&usr, "SELECT * FROM users where user_id = ?", userId)
+	_, err = tx.ExecContext(ctx, tx.Rebind("UPDATE users_password_reset SET date_used = CURRENT_TIMESTAMP WHERE user_id = ? AND date_used IS NULL"), reset.UserId)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, apierror.New(http.StatusBadRequest, ErrNoUserId, apierror.NewErrorCause(ErrNoUserId, ErrNoUserIdCode))
-		}
-		return nil, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrFetchingUserCode))
+		tx.Rollback() // nolint
+		return false, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrPasswordResetCode))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrPasswordResetCode))
 	}
 
-	return &usr, nil
+	return true, nil
 }
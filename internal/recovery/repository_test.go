@@ -1,801 +1,27 @@
 package recovery
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
+	"database/sql"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
 )
 
-func Test_registerRepository_GetEmailByUserId(t *testing.T) {
-	type fields struct {
-		db *sqlx.DB
-	}
-
-	type args struct {
-		userId int64
-	}
-
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		expected *domain.UserEmail
-		wantErr  bool
-		mockFunc func()
-	}{
-		{
-			name: "ok",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userId: 123,
-			},
-			wantErr:  false,
-			expected: &domain.UserEmail{UserId: 123},
-			mockFunc: func() {
-				query := "SELECT * FROM users where user_id = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-
-				query = "SELECT * FROM users_email where user_id = ?"
-
-				table = sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "user_doesnt_exist",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userId: 123,
-			},
-			wantErr:  true,
-			expected: nil,
-			mockFunc: func() {
-				query := "SELECT * FROM users where user_id = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "user_internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userId: 123,
-			},
-			wantErr:  true,
-			expected: nil,
-			mockFunc: func() {
-				query := "SELECT * FROM users where user_id = ?"
-
-				mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-			},
-		},
-		{
-			name: "email_doesnt_exist",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userId: 123,
-			},
-			wantErr:  true,
-			expected: nil,
-			mockFunc: func() {
-				query := "SELECT * FROM users where user_id = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-
-				query = "SELECT * FROM users_email where user_id = ?"
-
-				table = sqlmock.NewRows([]string{"user_id"})
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "email_internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userId: 123,
-			},
-			wantErr:  true,
-			expected: nil,
-			mockFunc: func() {
-				query := "SELECT * FROM users where user_id = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-
-				query = "SELECT * FROM users_email where user_id = ?"
-				mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.mockFunc()
-
-			u := NewRepository(tt.fields.db)
-
-			_, got, err := u.GetEmailByUserId(tt.args.userId)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("registerRepository.AddUser() got = %v, expected %v", got, tt.expected)
-				return
-			}
-		})
-	}
-}
-
-func Test_registerRepository_GetuserIdByEmail(t *testing.T) {
-	type fields struct {
-		db *sqlx.DB
-	}
-
-	type args struct {
-		email string
-	}
-
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		expected int64
-		wantErr  bool
-		mockFunc func()
-	}{
-		{
-			name: "ok",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "el_pepe@gmail.com",
-			},
-			wantErr:  false,
-			expected: 123,
-			mockFunc: func() {
-				query := "SELECT user_id FROM users_email where email = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "user_doesnt_exist",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "el_pepe@gmail.com",
-			},
-			wantErr:  true,
-			expected: 0,
-			mockFunc: func() {
-				query := "SELECT user_id FROM users_email where email = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "user_internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "ete_sech@gmail.com",
-			},
-			wantErr:  true,
-			expected: 0,
-			mockFunc: func() {
-				query := "SELECT user_id FROM users_email where email = ?"
-				mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.mockFunc()
-
-			u := NewRepository(tt.fields.db)
-
-			got, err := u.GetuserIdByEmail(tt.args.email)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("registerRepository.AddUser() got = %v, expected %v", got, tt.expected)
-				return
-			}
-		})
-	}
-}
-
-func Test_registerRepository_GetUsernameByEmail(t *testing.T) {
-	type fields struct {
-		db *sqlx.DB
-	}
-
-	type args struct {
-		email string
-	}
-
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		expected string
-		wantErr  bool
-		mockFunc func()
-	}{
-		{
-			name: "ok",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "el_pepe@gmail.com",
-			},
-			wantErr:  false,
-			expected: "el_pepe_😎👊",
-			mockFunc: func() {
-				query := "SELECT user_id FROM users_email WHERE email = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-
-				query = "SELECT username FROM users where user_id = ?"
-
-				table = sqlmock.NewRows([]string{"username"})
-				table.AddRow("el_pepe_😎👊")
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "email_doesnt_exist",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "el_pepe@gmail.com",
-			},
-			wantErr:  true,
-			expected: "",
-			mockFunc: func() {
-				query := "SELECT user_id FROM users_email WHERE email = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "email_internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "el_pepe@gmail.com",
-			},
-			wantErr:  true,
-			expected: "",
-			mockFunc: func() {
-				query := "SELECT user_id FROM users_email WHERE email = ?"
-
-				mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-			},
-		},
-		{
-			name: "username_doesnt_exist",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "el_pepe@gmail.com",
-			},
-			wantErr:  true,
-			expected: "",
-			mockFunc: func() {
-				query := "SELECT user_id FROM users_email WHERE email = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-
-				query = "SELECT username FROM users where user_id = ?"
-
-				table = sqlmock.NewRows([]string{"username"})
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "username_internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "el_pepe@gmail.com",
-			},
-			wantErr:  true,
-			expected: "",
-			mockFunc: func() {
-				query := "SELECT user_id FROM users_email WHERE email = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-
-				query = "SELECT username FROM users where user_id = ?"
-				mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.mockFunc()
-
-			u := NewRepository(tt.fields.db)
-
-			got, err := u.GetUsernameByEmail(tt.args.email)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("registerRepository.AddUser() got = %v, expected %v", got, tt.expected)
-				return
-			}
-		})
-	}
-}
-
-func Test_registerRepository_GetSecurityToken(t *testing.T) {
-	type fields struct {
-		db *sqlx.DB
-	}
-
-	type args struct {
-		email string
-	}
-
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		expected string
-		wantErr  bool
-		mockFunc func()
-	}{
-		{
-			name: "ok",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "ete_sech@gmail.com",
-			},
-			wantErr:  false,
-			expected: "token",
-			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
-
-				table := sqlmock.NewRows([]string{"email", "verified_email"})
-				table.AddRow("ete_sech@gmail.com", true)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-
-				query = "SELECT security_token FROM users where user_id = ?"
-
-				table = sqlmock.NewRows([]string{"security_token"})
-				table.AddRow("token")
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "email_not_verified",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "ete_sech@gmail.com",
-			},
-			wantErr:  true,
-			expected: "",
-			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
-
-				table := sqlmock.NewRows([]string{"email", "verified_email"})
-				table.AddRow("ete_sech@gmail.com", false)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "email_doesnt_exist",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "ete_sech@gmail.com",
-			},
-			wantErr:  true,
-			expected: "",
-			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
-
-				table := sqlmock.NewRows([]string{"email", "verified_email"})
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "email_internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "ete_sech@gmail.com",
-			},
-			wantErr:  true,
-			expected: "",
-			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
-
-				mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-			},
-		},
-		{
-			name: "token_doesnt_exist",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "ete_sech@gmail.com",
-			},
-			wantErr:  true,
-			expected: "",
-			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
-
-				table := sqlmock.NewRows([]string{"email", "verified_email"})
-				table.AddRow("ete_sech@gmail.com", true)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-
-				query = "SELECT security_token FROM users where user_id = ?"
-
-				table = sqlmock.NewRows([]string{"security_token"})
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "token_internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "ete_sech@gmail.com",
-			},
-			wantErr:  true,
-			expected: "",
-			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
-
-				table := sqlmock.NewRows([]string{"email", "verified_email"})
-				table.AddRow("ete_sech@gmail.com", true)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-
-				query = "SELECT security_token FROM users where user_id = ?"
-
-				mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.mockFunc()
-
-			u := NewRepository(tt.fields.db)
-
-			got, err := u.GetSecurityToken(tt.args.email)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("registerRepository.AddUser() got = %v, expected %v", got, tt.expected)
-				return
-			}
-		})
-	}
-}
-
-func Test_registerRepository_GetUserByUserId(t *testing.T) {
-	type fields struct {
-		db *sqlx.DB
-	}
-
-	type args struct {
-		userID int64
-	}
-
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		expected *domain.User
-		wantErr  bool
-		mockFunc func()
-	}{
-		{
-			name: "ok",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userID: 123,
-			},
-			wantErr: false,
-			expected: &domain.User{
-				Username: "test",
-			},
-			mockFunc: func() {
-				query := "SELECT * FROM users where user_id = ?"
-
-				table := sqlmock.NewRows([]string{"username"})
-				table.AddRow("test")
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "user_doesnt_exist",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userID: 123,
-			},
-			wantErr:  true,
-			expected: nil,
-			mockFunc: func() {
-				query := "SELECT * FROM users where user_id = ?"
-
-				table := sqlmock.NewRows([]string{"username"})
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "bad_request",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userID: 0,
-			},
-			wantErr:  true,
-			expected: nil,
-			mockFunc: func() {
-			},
-		},
-		{
-			name: "user_internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userID: 123,
-			},
-			wantErr:  true,
-			expected: nil,
-			mockFunc: func() {
-				query := "SELECT * FROM users where user_id = ?"
-
-				mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.mockFunc()
-
-			u := NewRepository(tt.fields.db)
-
-			got, err := u.GetUserByUserId(tt.args.userID)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("registerRepository.AddUser() got = %v, expected %v", got, tt.expected)
-				return
-			}
-		})
-	}
-}
-
-func Test_registerRepository_UpdateSecurityToken(t *testing.T) {
-	type fields struct {
-		db *sqlx.DB
-	}
-
-	type args struct {
-		userID           int64
-		newSecurityToken string
-	}
-
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		expected bool
-		wantErr  bool
-		mockFunc func()
-	}{
-		{
-			name: "bad_request",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userID:           0,
-				newSecurityToken: "",
-			},
-			wantErr:  true,
-			expected: false,
-			mockFunc: func() {
-			},
-		},
-		{
-			name: "ok",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userID:           123,
-				newSecurityToken: "123",
-			},
-			wantErr:  false,
-			expected: true,
-			mockFunc: func() {
-				query := "UPDATE users SET security_token = ? where user_id = ?"
-				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(1, 1))
-			},
-		},
-		{
-			name: "no_affected_rows",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				userID:           123,
-				newSecurityToken: "123",
-			},
-			wantErr:  true,
-			expected: false,
-			mockFunc: func() {
-				query := "UPDATE users SET security_token = ? where user_id = ?"
-				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.mockFunc()
-
-			u := NewRepository(tt.fields.db)
-
-			got, err := u.UpdateSecurityToken(tt.args.userID, tt.args.newSecurityToken)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("registerRepository.AddUser() got = %v, expected %v", got, tt.expected)
-				return
-			}
-		})
-	}
-}
-
 func Test_registerRepository_UpdatePasswordHash(t *testing.T) {
 	type fields struct {
 		db *sqlx.DB
 	}
 
 	type args struct {
-		userID   int64
-		passHash string
+		userID        int64
+		passHash      string
+		securityToken string
 	}
 
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -832,13 +58,14 @@ func Test_registerRepository_UpdatePasswordHash(t *testing.T) {
 				db: sqlx.NewDb(db, "sqlmock"),
 			},
 			args: args{
-				userID:   123,
-				passHash: "123",
+				userID:        123,
+				passHash:      "123",
+				securityToken: "stamp",
 			},
 			wantErr:  false,
 			expected: true,
 			mockFunc: func() {
-				query := "UPDATE users SET password_hash = ?  where user_id = ?"
+				query := "UPDATE users SET password_hash = ?, security_token = ? where user_id = ?"
 				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 		},
@@ -848,13 +75,14 @@ func Test_registerRepository_UpdatePasswordHash(t *testing.T) {
 				db: sqlx.NewDb(db, "sqlmock"),
 			},
 			args: args{
-				userID:   123,
-				passHash: "123",
+				userID:        123,
+				passHash:      "123",
+				securityToken: "stamp",
 			},
 			wantErr:  true,
 			expected: false,
 			mockFunc: func() {
-				query := "UPDATE users SET password_hash = ?  where user_id = ?"
+				query := "UPDATE users SET password_hash = ?, security_token = ? where user_id = ?"
 				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
 			},
 		},
@@ -864,9 +92,9 @@ func Test_registerRepository_UpdatePasswordHash(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockFunc()
 
-			u := NewRepository(tt.fields.db)
+			u := NewRepository(tt.fields.db, time.Second)
 
-			got, err := u.UpdatePasswordHash(tt.args.userID, tt.args.passHash)
+			got, err := u.UpdatePasswordHash(context.Background(), tt.args.userID, tt.args.passHash, tt.args.securityToken)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -914,7 +142,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 			},
 			wantErr: false,
 			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
+				query := "SELECT * FROM users_email where normalized_email = ?"
 
 				table := sqlmock.NewRows([]string{"verified_email", "user_id"})
 				table.AddRow(false, 123)
@@ -928,7 +156,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 
 				mock.ExpectQuery(query).WillReturnRows(table)
 
-				query = "UPDATE users_email SET verified_email = 1, verification_date = now() WHERE user_id = ?"
+				query = "UPDATE users_email SET verified_email = TRUE, verification_date = CURRENT_TIMESTAMP WHERE user_id = ?"
 
 				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(1, 1))
 			},
@@ -944,7 +172,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 			},
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
+				query := "SELECT * FROM users_email where normalized_email = ?"
 
 				table := sqlmock.NewRows([]string{"verified_email", "user_id"})
 
@@ -962,7 +190,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 			},
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
+				query := "SELECT * FROM users_email where normalized_email = ?"
 				mock.ExpectQuery(query).WillReturnError(errors.New("internal_error"))
 			},
 		},
@@ -977,7 +205,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 			},
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
+				query := "SELECT * FROM users_email where normalized_email = ?"
 
 				table := sqlmock.NewRows([]string{"verified_email", "user_id"})
 				table.AddRow(true, 123)
@@ -996,7 +224,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 			},
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
+				query := "SELECT * FROM users_email where normalized_email = ?"
 
 				table := sqlmock.NewRows([]string{"verified_email", "user_id"})
 				table.AddRow(false, 123)
@@ -1021,7 +249,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 			},
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
+				query := "SELECT * FROM users_email where normalized_email = ?"
 
 				table := sqlmock.NewRows([]string{"verified_email", "user_id"})
 				table.AddRow(false, 123)
@@ -1047,7 +275,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 			},
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
+				query := "SELECT * FROM users_email where normalized_email = ?"
 
 				table := sqlmock.NewRows([]string{"verified_email", "user_id"})
 				table.AddRow(false, 123)
@@ -1069,7 +297,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 			},
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
+				query := "SELECT * FROM users_email where normalized_email = ?"
 
 				table := sqlmock.NewRows([]string{"verified_email", "user_id"})
 				table.AddRow(false, 123)
@@ -1083,7 +311,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 
 				mock.ExpectQuery(query).WillReturnRows(table)
 
-				query = "UPDATE users_email SET verified_email = 1, verification_date = now() WHERE user_id = ?"
+				query = "UPDATE users_email SET verified_email = TRUE, verification_date = CURRENT_TIMESTAMP WHERE user_id = ?"
 
 				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
 			},
@@ -1099,7 +327,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 			},
 			wantErr: true,
 			mockFunc: func() {
-				query := "SELECT * FROM users_email where email = ?"
+				query := "SELECT * FROM users_email where normalized_email = ?"
 
 				table := sqlmock.NewRows([]string{"verified_email", "user_id"})
 				table.AddRow(false, 123)
@@ -1113,7 +341,7 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 
 				mock.ExpectQuery(query).WillReturnRows(table)
 
-				query = "UPDATE users_email SET verified_email = 1, verification_date = now() WHERE user_id = ?"
+				query = "UPDATE users_email SET verified_email = TRUE, verification_date = CURRENT_TIMESTAMP WHERE user_id = ?"
 
 				mock.ExpectExec(query).WillReturnError(errors.New("internal_error"))
 			},
@@ -1124,9 +352,9 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockFunc()
 
-			u := NewRepository(tt.fields.db)
+			u := NewRepository(tt.fields.db, time.Second)
 
-			err := u.ConfirmUserEmail(tt.args.email, tt.args.token)
+			err := u.ConfirmUserEmail(context.Background(), tt.args.email, tt.args.token)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -1134,3 +362,221 @@ func Test_registerRepository_ConfirmUserEmail(t *testing.T) {
 		})
 	}
 }
+
+func Test_registerRepository_AddPasswordReset(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	reset := &domain.PasswordReset{UserId: 1, TokenHash: "hash", ExpiryDate: sql.NullTime{Time: time.Now(), Valid: true}}
+	query := "INSERT INTO users_password_reset (user_id, token_hash, expiry_date, date_created) VALUES (?, ?, ?, CURRENT_TIMESTAMP)"
+
+	r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+	mock.ExpectExec(query).WithArgs(reset.UserId, reset.TokenHash, reset.ExpiryDate).WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := r.AddPasswordReset(context.Background(), reset); err != nil {
+		t.Errorf("recoveryRepository.AddPasswordReset() error = %v", err)
+	}
+
+	mock.ExpectExec(query).WillReturnError(errors.New("Internal error"))
+	if err := r.AddPasswordReset(context.Background(), reset); err == nil {
+		t.Errorf("recoveryRepository.AddPasswordReset() expected error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_registerRepository_GetPasswordReset(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "SELECT * FROM users_password_reset WHERE token_hash = ?"
+
+	tests := []struct {
+		name     string
+		mockFunc func()
+		expected *domain.PasswordReset
+		wantErr  bool
+	}{
+		{
+			name: "ok",
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("hash").WillReturnRows(sqlmock.NewRows([]string{"password_reset_id", "user_id", "token_hash"}).AddRow(1, 2, "hash"))
+			},
+			expected: &domain.PasswordReset{PasswordResetId: 1, UserId: 2, TokenHash: "hash"},
+		},
+		{
+			name: "not_found",
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("hash").WillReturnRows(sqlmock.NewRows([]string{"password_reset_id"}))
+			},
+			expected: nil,
+		},
+		{
+			name: "internal_error",
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("hash").WillReturnError(errors.New("Internal error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			got, err := r.GetPasswordReset(context.Background(), "hash")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("recoveryRepository.GetPasswordReset() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("recoveryRepository.GetPasswordReset() got = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_registerRepository_UsePasswordReset(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	useQuery := "UPDATE users_password_reset SET date_used = CURRENT_TIMESTAMP WHERE password_reset_id = ? AND date_used IS NULL"
+	invalidateQuery := "UPDATE users_password_reset SET date_used = CURRENT_TIMESTAMP WHERE user_id = ? AND date_used IS NULL"
+	reset := &domain.PasswordReset{PasswordResetId: 1, UserId: 2}
+
+	tests := []struct {
+		name     string
+		mockFunc func()
+		expected bool
+		wantErr  bool
+	}{
+		{
+			name: "ok",
+			mockFunc: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(useQuery).WithArgs(reset.PasswordResetId).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(invalidateQuery).WithArgs(reset.UserId).WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectCommit()
+			},
+			expected: true,
+		},
+		{
+			name: "already_used",
+			mockFunc: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(useQuery).WithArgs(reset.PasswordResetId).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			expected: false,
+		},
+		{
+			name: "invalidate_error",
+			mockFunc: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(useQuery).WithArgs(reset.PasswordResetId).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(invalidateQuery).WithArgs(reset.UserId).WillReturnError(errors.New("Internal error"))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			got, err := r.UsePasswordReset(context.Background(), reset)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("recoveryRepository.UsePasswordReset() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.expected {
+				t.Errorf("recoveryRepository.UsePasswordReset() got = %v, expected %v", got, tt.expected)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_registerRepository_UpdateVerificationToken(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "UPDATE users SET verification_token = ? WHERE user_id = ?"
+
+	tests := []struct {
+		name     string
+		token    string
+		mockFunc func()
+		wantErr  bool
+	}{
+		{
+			name:     "empty_token",
+			token:    "",
+			mockFunc: func() {},
+			wantErr:  true,
+		},
+		{
+			name:  "ok",
+			token: "token",
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs("token", 123).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:  "user_doesnt_exist",
+			token: "token",
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs("token", 123).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name:  "internal_error",
+			token: "token",
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs("token", 123).WillReturnError(errors.New("Internal error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			if err := r.UpdateVerificationToken(context.Background(), 123, tt.token); (err != nil) != tt.wantErr {
+				t.Errorf("recoveryRepository.UpdateVerificationToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package recovery
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
 	"net/http"
 	"reflect"
+	"strings"
 	"time"
 
+	"database/sql"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/performance"
 	"github.com/go-resty/resty/v2"
@@ -18,6 +22,7 @@ import (
 	"github.com/CienciaArgentina/go-enigma/config"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
 	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/internal/users"
 )
 
 const (
@@ -34,27 +39,36 @@ const (
 
 	ErrPasswordTokenIsNotValid     = "El token para resetear la contraseña no es válido"
 
-	errFailedDecryptionCode = "failed_decryption"
+	ErrVerificationTokenExpired     = "El link para confirmar el email expiró, pedí que te lo enviemos de nuevo"
+	ErrVerificationTokenExpiredCode = "verification_token_expired"
+
+	errFailedDecryptionCode   = "failed_decryption"
+	errPasswordResetTokenCode = "password_reset_token_err"
+	errVerificationTokenCode  = "verification_token_err"
+
+	passwordResetTokenLength = 32
 )
 
 type recoveryService struct {
 	repository RecoveryRepository
+	users      UserStore
 	cfg        *config.EnigmaConfig
 }
 
-func NewService(cfg *config.EnigmaConfig, r RecoveryRepository) RecoveryService {
+func NewService(cfg *config.EnigmaConfig, r RecoveryRepository, u UserStore) RecoveryService {
 	return &recoveryService{
 		repository: r,
+		users:      u,
 		cfg:        cfg,
 	}
 }
 
-func (r *recoveryService) SendConfirmationEmail(userId int64, ctx *middleware.ContextInformation) (bool, apierror.ApiError) {
+func (r *recoveryService) SendConfirmationEmail(ctx context.Context, userId int64, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	var verificationToken string
 	var userEmail *domain.UserEmail
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "GetEmailByUserId", ctx, func() {
-		verificationToken, userEmail, err = r.repository.GetEmailByUserId(userId)
+	performance.TrackTime(time.Now(), "GetEmailByUserId", info, func() {
+		verificationToken, userEmail, err = r.getEmailByUserId(ctx, userId)
 	})
 	if err != nil {
 		clog.Error("Can't send confirmation email", "send-confirmation-email", err, map[string]string{"auth_id": fmt.Sprintf("%d", userId), clog.Subtype: "get-email-by-user-id"})
@@ -70,6 +84,10 @@ func (r *recoveryService) SendConfirmationEmail(userId int64, ctx *middleware.Co
 		return false, apierror.NewBadRequestApiError(ErrEmailAlreadyVerified)
 	}
 
+	return r.sendConfirmationEmail(ctx, userId, userEmail, verificationToken, info)
+}
+
+func (r *recoveryService) sendConfirmationEmail(ctx context.Context, userId int64, userEmail *domain.UserEmail, verificationToken string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	url := fmt.Sprintf("/confirm_email?email=%s&token=%s", userEmail.Email, verificationToken)
 
 	emailDto := commons.NewDTO([]string{userEmail.Email}, url, defines.ConfirmEmail)
@@ -77,8 +95,8 @@ func (r *recoveryService) SendConfirmationEmail(userId int64, ctx *middleware.Co
 	var response *resty.Response
 	var apierr error
 	// TODO: Move this to a client
-	performance.TrackTime(time.Now(), "EmailSendAPICall", ctx, func() {
-		response, apierr = resty.New().SetHostURL(domain.GetEmailSenderBaseURL()).R().SetBody(emailDto).Post("/email")
+	performance.TrackTime(time.Now(), "EmailSendAPICall", info, func() {
+		response, apierr = resty.New().SetHostURL(domain.GetEmailSenderBaseURL()).SetTimeout(r.cfg.TimeoutOptions.EmailSender).R().SetContext(ctx).SetBody(emailDto).Post("/email")
 	})
 
 	if apierr != nil {
@@ -94,14 +112,23 @@ func (r *recoveryService) SendConfirmationEmail(userId int64, ctx *middleware.Co
 	return true, nil
 }
 
-func (r *recoveryService) ConfirmEmail(email string, token string, ctx *middleware.ContextInformation) (bool, apierror.ApiError) {
+func (r *recoveryService) ConfirmEmail(ctx context.Context, email string, token string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	if email == "" || token == "" {
 		return false, apierror.NewBadRequestApiError(ErrEmailValidationFailed)
 	}
 
+	tokenEmail, e := encryption.ParseVerificationToken(token, r.cfg)
+	if e == encryption.ErrVerificationTokenExpired {
+		return false, apierror.New(http.StatusBadRequest, ErrVerificationTokenExpired, apierror.NewErrorCause(ErrVerificationTokenExpired, ErrVerificationTokenExpiredCode))
+	}
+
+	if e != nil || !strings.EqualFold(tokenEmail, email) {
+		return false, apierror.New(http.StatusBadRequest, ErrValidationTokenFailed, apierror.NewErrorCause(ErrValidationTokenFailed, ErrValidationTokenFailedCode))
+	}
+
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "ConfirmUserEmail", ctx, func() {
-		err = r.repository.ConfirmUserEmail(email, token)
+	performance.TrackTime(time.Now(), "ConfirmUserEmail", info, func() {
+		err = r.repository.ConfirmUserEmail(ctx, email, token)
 	})
 
 	if err != nil {
@@ -112,15 +139,47 @@ func (r *recoveryService) ConfirmEmail(email string, token string, ctx *middlewa
 	return true, nil
 }
 
-func (r *recoveryService) ResendEmailConfirmationEmail(email string, ctx *middleware.ContextInformation) (bool, apierror.ApiError) {
+// ResendEmailConfirmationEmail Emails a new verification token, the ones sent before stop working.
+func (r *recoveryService) ResendEmailConfirmationEmail(ctx context.Context, email string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	if email == "" {
 		return false, apierror.NewBadRequestApiError(domain.ErrEmptyEmail)
 	}
 
 	var userId int64
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "GetuserIdByEmail", ctx, func() {
-		userId, err = r.repository.GetuserIdByEmail(email)
+	performance.TrackTime(time.Now(), "GetuserIdByEmail", info, func() {
+		userId, err = r.getUserIdByEmail(ctx, email)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	var userEmail *domain.UserEmail
+	performance.TrackTime(time.Now(), "GetEmailByUserId", info, func() {
+		_, userEmail, err = r.getEmailByUserId(ctx, userId)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	// Same as SendConfirmationEmail, it doesn't tell whether the user exists
+	if userEmail == nil || reflect.DeepEqual(userEmail, &domain.UserEmail{}) {
+		return true, nil
+	}
+
+	if userEmail.VerfiedEmail {
+		return false, apierror.NewBadRequestApiError(ErrEmailAlreadyVerified)
+	}
+
+	verificationToken, e := encryption.GenerateVerificationToken(userEmail.Email, r.cfg.EmailVerificationDuration(), r.cfg)
+	if e != nil {
+		return false, apierror.NewInternalServerApiError(e.Error(), e, errVerificationTokenCode)
+	}
+
+	performance.TrackTime(time.Now(), "UpdateVerificationToken", info, func() {
+		err = r.repository.UpdateVerificationToken(ctx, userId, verificationToken)
 	})
 
 	if err != nil {
@@ -128,8 +187,8 @@ func (r *recoveryService) ResendEmailConfirmationEmail(email string, ctx *middle
 	}
 
 	var sent bool
-	performance.TrackTime(time.Now(), "SendConfirmationEmail", ctx, func() {
-		sent, err = r.SendConfirmationEmail(userId, ctx)
+	performance.TrackTime(time.Now(), "SendConfirmationEmail", info, func() {
+		sent, err = r.sendConfirmationEmail(ctx, userId, userEmail, verificationToken, info)
 	})
 
 	if err != nil || !sent {
@@ -139,15 +198,15 @@ func (r *recoveryService) ResendEmailConfirmationEmail(email string, ctx *middle
 	return sent, nil
 }
 
-func (r *recoveryService) SendUsername(email string, ctx *middleware.ContextInformation) (bool, apierror.ApiError) {
+func (r *recoveryService) SendUsername(ctx context.Context, email string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	if email == "" {
 		return false, apierror.NewBadRequestApiError(domain.ErrEmptyEmail)
 	}
 
 	var username string
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "GetUsernameByEmail", ctx, func() {
-		username, err = r.repository.GetUsernameByEmail(email)
+	performance.TrackTime(time.Now(), "GetUsernameByEmail", info, func() {
+		username, err = r.getUsernameByEmail(ctx, email)
 	})
 
 	if err != nil {
@@ -158,8 +217,8 @@ func (r *recoveryService) SendUsername(email string, ctx *middleware.ContextInfo
 
 	var response *resty.Response
 	var apierr error
-	performance.TrackTime(time.Now(), "SendEmailAPICall", ctx, func() {
-		response, apierr = resty.New().SetHostURL(domain.GetEmailSenderBaseURL()).R().SetBody(emailDto).Post("/email")
+	performance.TrackTime(time.Now(), "SendEmailAPICall", info, func() {
+		response, apierr = resty.New().SetHostURL(domain.GetEmailSenderBaseURL()).SetTimeout(r.cfg.TimeoutOptions.EmailSender).R().SetContext(ctx).SetBody(emailDto).Post("/email")
 	})
 
 	if apierr != nil {
@@ -173,30 +232,63 @@ func (r *recoveryService) SendUsername(email string, ctx *middleware.ContextInfo
 	return true, nil
 }
 
-func (r *recoveryService) SendPasswordReset(email string, ctx *middleware.ContextInformation) (bool, apierror.ApiError) {
+// SendPasswordReset Emails the user a single use link to set a new password. Only the hash of its token is stored and
+// it expires after PasswordResetDuration.
+func (r *recoveryService) SendPasswordReset(ctx context.Context, email string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	if email == "" {
 		return false, apierror.NewBadRequestApiError(domain.ErrEmptyEmail)
 	}
 
-	var securityToken string
+	var userId int64
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "GetSecurityToken", ctx, func() {
-		securityToken, err = r.repository.GetSecurityToken(email)
+	performance.TrackTime(time.Now(), "GetuserIdByEmail", info, func() {
+		userId, err = r.getUserIdByEmail(ctx, email)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	var userEmail *domain.UserEmail
+	performance.TrackTime(time.Now(), "GetEmailByUserId", info, func() {
+		_, userEmail, err = r.getEmailByUserId(ctx, userId)
 	})
 
 	if err != nil {
 		return false, err
 	}
 
-	url := fmt.Sprintf("/sendpasswordreset?email=%s&token=%s", email, securityToken)
+	if !userEmail.VerfiedEmail {
+		return false, apierror.New(http.StatusBadRequest, ErrEmailNotVerified, apierror.NewErrorCause(ErrEmailNotVerified, ErrEmailNotVerifiedCode))
+	}
+
+	token, e := encryption.GenerateOpaqueToken(passwordResetTokenLength)
+	if e != nil {
+		return false, apierror.NewInternalServerApiError(e.Error(), e, errPasswordResetTokenCode)
+	}
+
+	reset := &domain.PasswordReset{
+		UserId:     userId,
+		TokenHash:  encryption.HashOpaqueToken(token),
+		ExpiryDate: sql.NullTime{Time: time.Now().Add(r.cfg.TokenOptions.PasswordResetDuration), Valid: true},
+	}
+	performance.TrackTime(time.Now(), "AddPasswordReset", info, func() {
+		err = r.repository.AddPasswordReset(ctx, reset)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	url := fmt.Sprintf("/sendpasswordreset?email=%s&token=%s", email, token)
 
 	emailDto := commons.NewDTO([]string{email}, url, defines.SendPasswordReset)
 
 	var response *resty.Response
 	var apierr error
 	// TODO: Move this to a client
-	performance.TrackTime(time.Now(), "SendEmailAPICall", ctx, func() {
-		response, apierr = resty.New().SetHostURL(domain.GetEmailSenderBaseURL()).R().SetBody(emailDto).Post("/email")
+	performance.TrackTime(time.Now(), "SendEmailAPICall", info, func() {
+		response, apierr = resty.New().SetHostURL(domain.GetEmailSenderBaseURL()).SetTimeout(r.cfg.TimeoutOptions.EmailSender).R().SetContext(ctx).SetBody(emailDto).Post("/email")
 	})
 
 	if apierr != nil {
@@ -210,7 +302,9 @@ func (r *recoveryService) SendPasswordReset(email string, ctx *middleware.Contex
 	return true, nil
 }
 
-func (r *recoveryService) ResetPassword(email, password, confirmPassword, token string, ctx *middleware.ContextInformation) (bool, apierror.ApiError) {
+// ResetPassword Sets the new password if the token is one of the user's links that wasn't used and didn't expire. Using
+// it invalidates the other links of the user too.
+func (r *recoveryService) ResetPassword(ctx context.Context, email, password, confirmPassword, token string, info *middleware.ContextInformation) (bool, apierror.ApiError) {
 	if email == "" || password == "" || confirmPassword == "" || token == "" {
 		return false, apierror.NewBadRequestApiError(domain.ErrEmptyField)
 	}
@@ -219,23 +313,58 @@ func (r *recoveryService) ResetPassword(email, password, confirmPassword, token
 		return false, apierror.NewBadRequestApiError(ErrPasswordConfirmationDoesntMatch)
 	}
 
-	var securityToken string
+	invalid := apierror.NewBadRequestApiError(ErrPasswordTokenIsNotValid)
+	tokenHash := encryption.HashOpaqueToken(token)
+
+	var reset *domain.PasswordReset
 	var err apierror.ApiError
-	performance.TrackTime(time.Now(), "GetSecurityToken", ctx, func() {
-		securityToken, err = r.repository.GetSecurityToken(email)
+	performance.TrackTime(time.Now(), "GetPasswordReset", info, func() {
+		reset, err = r.repository.GetPasswordReset(ctx, tokenHash)
 	})
 
 	if err != nil {
 		return false, err
 	}
 
-	if token != securityToken {
-		return false, apierror.NewBadRequestApiError(ErrPasswordTokenIsNotValid)
+	// The hash was looked up in the database already, comparing it again doesn't depend on how the database does it
+	if reset == nil || subtle.ConstantTimeCompare([]byte(reset.TokenHash), []byte(tokenHash)) != 1 {
+		return false, invalid
+	}
+
+	if reset.DateUsed.Valid || !reset.ExpiryDate.Time.After(time.Now()) {
+		return false, invalid
+	}
+
+	var userId int64
+	performance.TrackTime(time.Now(), "GetuserIdByEmail", info, func() {
+		userId, err = r.getUserIdByEmail(ctx, email)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	if reset.UserId != userId {
+		return false, invalid
+	}
+
+	var used bool
+	performance.TrackTime(time.Now(), "UsePasswordReset", info, func() {
+		used, err = r.repository.UsePasswordReset(ctx, reset)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	// Someone else used it between the fetch and now
+	if !used {
+		return false, invalid
 	}
 
 	var newHashedPassword string
 	var e error
-	performance.TrackTime(time.Now(), "GenerateEncodedHash", ctx, func() {
+	performance.TrackTime(time.Now(), "GenerateEncodedHash", info, func() {
 		newHashedPassword, e = encryption.GenerateEncodedHash(password, r.cfg)
 	})
 
@@ -244,26 +373,17 @@ func (r *recoveryService) ResetPassword(email, password, confirmPassword, token
 	}
 
 	var newSecurityToken string
-	performance.TrackTime(time.Now(), "GenerateSecurityToken", ctx, func() {
-		newSecurityToken, e = encryption.GenerateSecurityToken(password, r.cfg)
+	performance.TrackTime(time.Now(), "GenerateSecurityStamp", info, func() {
+		newSecurityToken, e = encryption.GenerateSecurityStamp()
 	})
 
 	if e != nil {
 		return false, apierror.NewInternalServerApiError(e.Error(), e, "security_token_err")
 	}
 
-	var userId int64
-	performance.TrackTime(time.Now(), "GetuserIdByEmail", ctx, func() {
-		userId, err = r.repository.GetuserIdByEmail(email)
-	})
-
-	if err != nil {
-		return false, err
-	}
-
 	var updated bool
-	performance.TrackTime(time.Now(), "UpdatePasswordHash", ctx, func() {
-		updated, err = r.repository.UpdatePasswordHash(userId, newHashedPassword)
+	performance.TrackTime(time.Now(), "UpdatePasswordHash", info, func() {
+		updated, err = r.repository.UpdatePasswordHash(ctx, userId, newHashedPassword, newSecurityToken)
 	})
 
 	if err != nil {
@@ -279,8 +399,8 @@ func (r *recoveryService) ResetPassword(email, password, confirmPassword, token
 
 		var response *resty.Response
 		// TODO: Move this to a client
-		performance.TrackTime(time.Now(), "SendEmailAPICall", ctx, func() {
-			response, e = resty.New().SetHostURL(domain.GetEmailSenderBaseURL()).R().SetBody(emailDto).Post("/email")
+		performance.TrackTime(time.Now(), "SendEmailAPICall", info, func() {
+			response, e = resty.New().SetHostURL(domain.GetEmailSenderBaseURL()).SetTimeout(r.cfg.TimeoutOptions.EmailSender).R().SetContext(ctx).SetBody(emailDto).Post("/email")
 		})
 
 		if e != nil {
@@ -292,22 +412,75 @@ func (r *recoveryService) ResetPassword(email, password, confirmPassword, token
 		}
 	}
 
-	performance.TrackTime(time.Now(), "UpdateSecurityToken", ctx, func() {
-		_, err = r.repository.UpdateSecurityToken(userId, newSecurityToken)
-	})
+	return updated, nil
+}
 
+func (r *recoveryService) GetUserByUserId(ctx context.Context, userId int64) (*domain.User, apierror.ApiError) {
+	if userId == 0 {
+		return nil, apierror.New(http.StatusBadRequest, domain.ErrEmptyField, apierror.NewErrorCause(domain.ErrEmptyField, domain.ErrEmptyFieldCode))
+	}
+
+	usr, err := r.users.GetUser(ctx, userId)
 	if err != nil {
-		// TODO: LOG THIS
+		return nil, userError(err)
 	}
 
-	return updated, nil
+	return usr, nil
+}
+
+// getEmailByUserId Returns the verification token of the user along with their email
+func (r *recoveryService) getEmailByUserId(ctx context.Context, userId int64) (string, *domain.UserEmail, apierror.ApiError) {
+	usr, err := r.users.GetUser(ctx, userId)
+	if err != nil {
+		return "", nil, userError(err)
+	}
+
+	userEmail, err := r.users.GetEmail(ctx, userId)
+	if err != nil {
+		return "", nil, userError(err)
+	}
+
+	return usr.VerificationToken, userEmail, nil
+}
+
+func (r *recoveryService) getUserIdByEmail(ctx context.Context, email string) (int64, apierror.ApiError) {
+	usr, apierr := r.getUserByEmail(ctx, email)
+	if apierr != nil {
+		return 0, apierr
+	}
+
+	return usr.AuthId, nil
 }
 
-func (r *recoveryService) GetUserByUserId(userId int64) (*domain.User, apierror.ApiError) {
-	usr, err := r.repository.GetUserByUserId(userId)
+func (r *recoveryService) getUsernameByEmail(ctx context.Context, email string) (string, apierror.ApiError) {
+	usr, apierr := r.getUserByEmail(ctx, email)
+	if apierr != nil {
+		return "", apierr
+	}
+
+	return usr.Username, nil
+}
+
+func (r *recoveryService) getUserByEmail(ctx context.Context, email string) (*domain.User, apierror.ApiError) {
+	usr, err := r.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, users.ErrUserNotFound) {
+		return nil, apierror.New(http.StatusBadRequest, ErrNoUserEmail, apierror.NewErrorCause(ErrNoUserEmail, ErrNoUserEmailCode))
+	}
 	if err != nil {
-		return nil, err
+		return nil, userError(err)
 	}
 
 	return usr, nil
 }
+
+// userError Converts the error of the user store into the response
+func userError(err error) apierror.ApiError {
+	switch {
+	case errors.Is(err, users.ErrUserNotFound):
+		return apierror.New(http.StatusBadRequest, ErrNoUserId, apierror.NewErrorCause(ErrNoUserId, ErrNoUserIdCode))
+	case errors.Is(err, users.ErrEmailNotFound):
+		return apierror.New(http.StatusBadRequest, ErrNoUserEmail, apierror.NewErrorCause(ErrNoUserEmail, ErrNoUserEmailCode))
+	default:
+		return apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause(err.Error(), ErrFetchingUserCode))
+	}
+}
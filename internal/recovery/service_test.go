@@ -1,67 +1,102 @@
 package recovery
 
 import (
+	"context"
 	"errors"
+	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
+	"database/sql"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
-	"github.com/CienciaArgentina/go-backend-commons/pkg/rest"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
 	"github.com/CienciaArgentina/go-enigma/config"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
 	domain2 "github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/internal/users"
 )
 
 const (
-	GetEmailByUserIdMockID = iota
+	GetEmailMockID = iota
 	ConfirmUserEmailMockID
-	GetuserIdByEmailMockID
-	GetUsernameByEmailMockID
-	GetSecurityTokenMockID
+	GetUserByEmailMockID
 	UpdatePasswordHashMockID
-	UpdateSecurityTokenMockID
+	AddPasswordResetMockID
+	GetPasswordResetMockID
+	UsePasswordResetMockID
+	UpdateVerificationTokenMockID
 )
 
 type MockRepository struct {
 	Responses map[int]interface{}
-	Errors    map[int]apierror.ApiError
+	Errors    map[int]error
+	// Last password reset added
+	PasswordReset *domain2.PasswordReset
+	// Last verification token set
+	VerificationToken string
+	// Last security stamp set along with a password
+	SecurityToken string
 }
 
-func (m *MockRepository) GetEmailByUserId(userId int64) (string, *domain2.UserEmail, apierror.ApiError) {
-	return "token", m.Responses[GetEmailByUserIdMockID].(*domain2.UserEmail), m.Errors[GetEmailByUserIdMockID]
+func (m *MockRepository) ConfirmUserEmail(ctx context.Context, email string, token string) apierror.ApiError {
+	return m.apierror(ConfirmUserEmailMockID)
 }
 
-func (m *MockRepository) ConfirmUserEmail(email string, token string) apierror.ApiError {
-	return m.Errors[ConfirmUserEmailMockID]
+func (m *MockRepository) UpdateVerificationToken(ctx context.Context, userId int64, token string) apierror.ApiError {
+	m.VerificationToken = token
+	return m.apierror(UpdateVerificationTokenMockID)
 }
 
-func (m *MockRepository) GetuserIdByEmail(email string) (int64, apierror.ApiError) {
-	return m.Responses[GetuserIdByEmailMockID].(int64), m.Errors[GetuserIdByEmailMockID]
+func (m *MockRepository) UpdatePasswordHash(ctx context.Context, userId int64, passwordHash string, securityToken string) (bool, apierror.ApiError) {
+	m.SecurityToken = securityToken
+	updated, _ := m.Responses[UpdatePasswordHashMockID].(bool)
+	return updated, m.apierror(UpdatePasswordHashMockID)
 }
 
-func (m *MockRepository) GetUsernameByEmail(email string) (string, apierror.ApiError) {
-	return m.Responses[GetUsernameByEmailMockID].(string), m.Errors[GetUsernameByEmailMockID]
+func (m *MockRepository) AddPasswordReset(ctx context.Context, reset *domain2.PasswordReset) apierror.ApiError {
+	m.PasswordReset = reset
+	return m.apierror(AddPasswordResetMockID)
 }
 
-func (m *MockRepository) GetSecurityToken(email string) (string, apierror.ApiError) {
-	return m.Responses[GetSecurityTokenMockID].(string), m.Errors[GetSecurityTokenMockID]
+func (m *MockRepository) GetPasswordReset(ctx context.Context, tokenHash string) (*domain2.PasswordReset, apierror.ApiError) {
+	reset, _ := m.Responses[GetPasswordResetMockID].(*domain2.PasswordReset)
+	return reset, m.apierror(GetPasswordResetMockID)
 }
 
-func (m *MockRepository) UpdatePasswordHash(userId int64, passwordHash string) (bool, apierror.ApiError) {
-	return m.Responses[UpdatePasswordHashMockID].(bool), m.Errors[UpdatePasswordHashMockID]
+func (m *MockRepository) UsePasswordReset(ctx context.Context, reset *domain2.PasswordReset) (bool, apierror.ApiError) {
+	used, _ := m.Responses[UsePasswordResetMockID].(bool)
+	return used, m.apierror(UsePasswordResetMockID)
 }
 
-func (m *MockRepository) UpdateSecurityToken(userId int64, newSecurityToken string) (bool, apierror.ApiError) {
-	return m.Responses[UpdateSecurityTokenMockID].(bool), m.Errors[UpdateSecurityTokenMockID]
+func (m *MockRepository) GetUser(ctx context.Context, userID int64) (*domain2.User, error) {
+	usr, ok := m.Responses[GetUserByUserIdMockID].(*domain2.User)
+	if !ok {
+		usr = &domain2.User{AuthId: userID, VerificationToken: "token"}
+	}
+	return usr, m.Errors[GetUserByUserIdMockID]
+}
+
+func (m *MockRepository) GetUserByEmail(ctx context.Context, email string) (*domain2.User, error) {
+	usr, _ := m.Responses[GetUserByEmailMockID].(*domain2.User)
+	return usr, m.Errors[GetUserByEmailMockID]
+}
+
+func (m *MockRepository) GetEmail(ctx context.Context, userID int64) (*domain2.UserEmail, error) {
+	userEmail, _ := m.Responses[GetEmailMockID].(*domain2.UserEmail)
+	return userEmail, m.Errors[GetEmailMockID]
 }
 
-func (m *MockRepository) GetUserByUserId(userId int64) (*domain2.User, apierror.ApiError) {
-	return m.Responses[GetUserByUserIdMockID].(*domain2.User), m.Errors[GetUserByUserIdMockID]
+// apierror Returns the error set for the mock as the apierror.ApiError the repository answers
+func (m *MockRepository) apierror(id int) apierror.ApiError {
+	err, _ := m.Errors[id].(apierror.ApiError)
+	return err
 }
 
 func Test_recoveryService_GetUserByUserId(t *testing.T) {
 	type fields struct {
-		repository RecoveryRepository
+		repository *MockRepository
 		cfg        *config.EnigmaConfig
 	}
 
@@ -83,12 +118,12 @@ func Test_recoveryService_GetUserByUserId(t *testing.T) {
 					Responses: map[int]interface{}{
 						GetUserByUserIdMockID: &domain2.User{Username: "koppin"},
 					},
-					Errors: map[int]apierror.ApiError{
+					Errors: map[int]error{
 						GetUserByUserIdMockID: nil,
 					},
 				},
 			},
-			args:  args{},
+			args:  args{userId: 1},
 			want:  &domain2.User{Username: "koppin"},
 			want1: nil,
 		},
@@ -99,14 +134,33 @@ func Test_recoveryService_GetUserByUserId(t *testing.T) {
 					Responses: map[int]interface{}{
 						GetUserByUserIdMockID: &domain2.User{Username: "koppin"},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetUserByUserIdMockID: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+					Errors: map[int]error{
+						GetUserByUserIdMockID: errors.New("error"),
 					},
 				},
 			},
+			args:  args{userId: 1},
+			want:  nil,
+			want1: apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause("error", ErrFetchingUserCode)),
+		},
+		{
+			name: "not_found",
+			fields: fields{
+				repository: &MockRepository{
+					Errors: map[int]error{
+						GetUserByUserIdMockID: users.ErrUserNotFound,
+					},
+				},
+			},
+			args:  args{userId: 1},
+			want:  nil,
+			want1: apierror.New(http.StatusBadRequest, ErrNoUserId, apierror.NewErrorCause(ErrNoUserId, ErrNoUserIdCode)),
+		},
+		{
+			name:  "empty_user_id",
 			args:  args{},
 			want:  nil,
-			want1: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+			want1: apierror.New(http.StatusBadRequest, domain.ErrEmptyField, apierror.NewErrorCause(domain.ErrEmptyField, domain.ErrEmptyFieldCode)),
 		},
 	}
 
@@ -114,9 +168,10 @@ func Test_recoveryService_GetUserByUserId(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &recoveryService{
 				repository: tt.fields.repository,
+				users:      tt.fields.repository,
 				cfg:        tt.fields.cfg,
 			}
-			got, got1 := r.GetUserByUserId(tt.args.userId)
+			got, got1 := r.GetUserByUserId(context.Background(), tt.args.userId)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("recoveryService.GetUserByUserId() got = %v, want %v", got, tt.want)
 			}
@@ -127,16 +182,29 @@ func Test_recoveryService_GetUserByUserId(t *testing.T) {
 	}
 }
 
+func testVerificationConfig() *config.EnigmaConfig {
+	return &config.EnigmaConfig{
+		Keys:         &config.Keys{PasswordHashingKey: "key"},
+		TokenOptions: &config.TokenOptions{EmailVerificationDuration: time.Hour},
+	}
+}
+
 func Test_recoveryService_ConfirmEmail(t *testing.T) {
+	cfg := testVerificationConfig()
+	token, _ := encryption.GenerateVerificationToken("test@test.com", time.Hour, cfg)
+	expiredToken, _ := encryption.GenerateVerificationToken("test@test.com", -time.Minute, cfg)
+	otherKeyToken, _ := encryption.GenerateVerificationToken("test@test.com", time.Hour, &config.EnigmaConfig{Keys: &config.Keys{PasswordHashingKey: "other"}})
+	tokenFailed := apierror.New(http.StatusBadRequest, ErrValidationTokenFailed, apierror.NewErrorCause(ErrValidationTokenFailed, ErrValidationTokenFailedCode))
+
 	type fields struct {
-		repository RecoveryRepository
+		repository *MockRepository
 		cfg        *config.EnigmaConfig
 	}
 
 	type args struct {
 		email string
 		token string
-		ctx   *rest.ContextInformation
+		info  *middleware.ContextInformation
 	}
 
 	tests := []struct {
@@ -153,7 +221,7 @@ func Test_recoveryService_ConfirmEmail(t *testing.T) {
 					Responses: map[int]interface{}{
 						ConfirmUserEmailMockID: true,
 					},
-					Errors: map[int]apierror.ApiError{
+					Errors: map[int]error{
 						ConfirmUserEmailMockID: nil,
 					},
 				},
@@ -171,7 +239,7 @@ func Test_recoveryService_ConfirmEmail(t *testing.T) {
 					Responses: map[int]interface{}{
 						ConfirmUserEmailMockID: true,
 					},
-					Errors: map[int]apierror.ApiError{
+					Errors: map[int]error{
 						ConfirmUserEmailMockID: nil,
 					},
 				},
@@ -189,7 +257,7 @@ func Test_recoveryService_ConfirmEmail(t *testing.T) {
 					Responses: map[int]interface{}{
 						ConfirmUserEmailMockID: true,
 					},
-					Errors: map[int]apierror.ApiError{
+					Errors: map[int]error{
 						ConfirmUserEmailMockID: nil,
 					},
 				},
@@ -205,15 +273,15 @@ func Test_recoveryService_ConfirmEmail(t *testing.T) {
 					Responses: map[int]interface{}{
 						ConfirmUserEmailMockID: false,
 					},
-					Errors: map[int]apierror.ApiError{
+					Errors: map[int]error{
 						ConfirmUserEmailMockID: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
 					},
 				},
 			},
 			args: args{
-				email: "test",
-				token: "test",
-				ctx:   &rest.ContextInformation{},
+				email: "test@test.com",
+				token: token,
+				info:  &middleware.ContextInformation{},
 			},
 			want:  false,
 			want1: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
@@ -225,28 +293,81 @@ func Test_recoveryService_ConfirmEmail(t *testing.T) {
 					Responses: map[int]interface{}{
 						ConfirmUserEmailMockID: true,
 					},
-					Errors: map[int]apierror.ApiError{
+					Errors: map[int]error{
 						ConfirmUserEmailMockID: nil,
 					},
 				},
 			},
 			args: args{
-				email: "test",
-				token: "test",
-				ctx:   &rest.ContextInformation{},
+				email: "test@test.com",
+				token: token,
+				info:  &middleware.ContextInformation{},
 			},
 			want:  true,
 			want1: nil,
 		},
+		{
+			name: "expired",
+			fields: fields{
+				repository: &MockRepository{Errors: map[int]error{}},
+			},
+			args: args{
+				email: "test@test.com",
+				token: expiredToken,
+				info:  &middleware.ContextInformation{},
+			},
+			want:  false,
+			want1: apierror.New(http.StatusBadRequest, ErrVerificationTokenExpired, apierror.NewErrorCause(ErrVerificationTokenExpired, ErrVerificationTokenExpiredCode)),
+		},
+		{
+			name: "other_signature",
+			fields: fields{
+				repository: &MockRepository{Errors: map[int]error{}},
+			},
+			args: args{
+				email: "test@test.com",
+				token: otherKeyToken,
+				info:  &middleware.ContextInformation{},
+			},
+			want:  false,
+			want1: tokenFailed,
+		},
+		{
+			name: "other_email",
+			fields: fields{
+				repository: &MockRepository{Errors: map[int]error{}},
+			},
+			args: args{
+				email: "other@test.com",
+				token: token,
+				info:  &middleware.ContextInformation{},
+			},
+			want:  false,
+			want1: tokenFailed,
+		},
+		{
+			name: "not_a_token",
+			fields: fields{
+				repository: &MockRepository{Errors: map[int]error{}},
+			},
+			args: args{
+				email: "test@test.com",
+				token: "test",
+				info:  &middleware.ContextInformation{},
+			},
+			want:  false,
+			want1: tokenFailed,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &recoveryService{
 				repository: tt.fields.repository,
-				cfg:        tt.fields.cfg,
+				users:      tt.fields.repository,
+				cfg:        cfg,
 			}
-			got, got1 := r.ConfirmEmail(tt.args.email, tt.args.token, tt.args.ctx)
+			got, got1 := r.ConfirmEmail(context.Background(), tt.args.email, tt.args.token, tt.args.info)
 			if got != tt.want {
 				t.Errorf("recoveryService.ConfirmEmail() got = %v, want %v", got, tt.want)
 			}
@@ -259,12 +380,12 @@ func Test_recoveryService_ConfirmEmail(t *testing.T) {
 
 func Test_recoveryService_ResendEmailConfirmationEmail(t *testing.T) {
 	type fields struct {
-		repository RecoveryRepository
+		repository *MockRepository
 		cfg        *config.EnigmaConfig
 	}
 	type args struct {
 		email string
-		ctx   *rest.ContextInformation
+		info  *middleware.ContextInformation
 	}
 	tests := []struct {
 		name   string
@@ -278,19 +399,19 @@ func Test_recoveryService_ResendEmailConfirmationEmail(t *testing.T) {
 			fields: fields{
 				repository: &MockRepository{
 					Responses: map[int]interface{}{
-						GetEmailByUserIdMockID: &domain.UserEmail{
+						GetEmailMockID: &domain.UserEmail{
 							UserId: 123,
 						},
-						GetuserIdByEmailMockID: int64(123),
+						GetUserByEmailMockID: &domain2.User{AuthId: 123},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetEmailByUserIdMockID: nil,
+					Errors: map[int]error{
+						GetEmailMockID: nil,
 					},
 				},
 			},
 			args: args{
 				email: "",
-				ctx:   &rest.ContextInformation{},
+				info:  &middleware.ContextInformation{},
 			},
 			want:  false,
 			want1: apierror.NewBadRequestApiError(domain.ErrEmptyEmail),
@@ -300,20 +421,67 @@ func Test_recoveryService_ResendEmailConfirmationEmail(t *testing.T) {
 			fields: fields{
 				repository: &MockRepository{
 					Responses: map[int]interface{}{
-						GetEmailByUserIdMockID: &domain.UserEmail{
+						GetEmailMockID: &domain.UserEmail{
 							UserId: 123,
 						},
-						GetuserIdByEmailMockID: int64(123),
+						GetUserByEmailMockID: &domain2.User{AuthId: 123},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetEmailByUserIdMockID: nil,
-						GetuserIdByEmailMockID: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+					Errors: map[int]error{
+						GetEmailMockID:       nil,
+						GetUserByEmailMockID: errors.New("error"),
 					},
 				},
 			},
 			args: args{
 				email: "test",
-				ctx:   &rest.ContextInformation{},
+				info:  &middleware.ContextInformation{},
+			},
+			want:  false,
+			want1: apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause("error", ErrFetchingUserCode)),
+		},
+		{
+			name: "already_verified",
+			fields: fields{
+				repository: &MockRepository{
+					Responses: map[int]interface{}{
+						GetEmailMockID: &domain.UserEmail{
+							UserId:       123,
+							Email:        "test@test.com",
+							VerfiedEmail: true,
+						},
+						GetUserByEmailMockID: &domain2.User{AuthId: 123},
+					},
+					Errors: map[int]error{},
+				},
+				cfg: testVerificationConfig(),
+			},
+			args: args{
+				email: "test@test.com",
+				info:  &middleware.ContextInformation{},
+			},
+			want:  false,
+			want1: apierror.NewBadRequestApiError(ErrEmailAlreadyVerified),
+		},
+		{
+			name: "update_token_error",
+			fields: fields{
+				repository: &MockRepository{
+					Responses: map[int]interface{}{
+						GetEmailMockID: &domain.UserEmail{
+							UserId: 123,
+							Email:  "test@test.com",
+						},
+						GetUserByEmailMockID: &domain2.User{AuthId: 123},
+					},
+					Errors: map[int]error{
+						UpdateVerificationTokenMockID: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+					},
+				},
+				cfg: testVerificationConfig(),
+			},
+			args: args{
+				email: "test@test.com",
+				info:  &middleware.ContextInformation{},
 			},
 			want:  false,
 			want1: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
@@ -323,19 +491,21 @@ func Test_recoveryService_ResendEmailConfirmationEmail(t *testing.T) {
 			fields: fields{
 				repository: &MockRepository{
 					Responses: map[int]interface{}{
-						GetEmailByUserIdMockID: &domain.UserEmail{
+						GetEmailMockID: &domain.UserEmail{
 							UserId: 123,
+							Email:  "test@test.com",
 						},
-						GetuserIdByEmailMockID: int64(123),
+						GetUserByEmailMockID: &domain2.User{AuthId: 123},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetEmailByUserIdMockID: nil,
+					Errors: map[int]error{
+						GetEmailMockID: nil,
 					},
 				},
+				cfg: testVerificationConfig(),
 			},
 			args: args{
 				email: "test",
-				ctx:   &rest.ContextInformation{},
+				info:  &middleware.ContextInformation{},
 			},
 			want:  false,
 			want1: apierror.NewInternalServerApiError("cant send email", errors.New("cant send email"), "cannot_email"),
@@ -345,12 +515,19 @@ func Test_recoveryService_ResendEmailConfirmationEmail(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &recoveryService{
 				repository: tt.fields.repository,
+				users:      tt.fields.repository,
 				cfg:        tt.fields.cfg,
 			}
-			got, got1 := r.ResendEmailConfirmationEmail(tt.args.email, tt.args.ctx)
+			got, got1 := r.ResendEmailConfirmationEmail(context.Background(), tt.args.email, tt.args.info)
 			if got != tt.want {
 				t.Errorf("recoveryService.ResendEmailConfirmationEmail() got = %v, want %v", got, tt.want)
 			}
+			// A fresh token is stored before the email is sent
+			if token := tt.fields.repository.VerificationToken; token != "" {
+				if email, err := encryption.ParseVerificationToken(token, tt.fields.cfg); err != nil || email != "test@test.com" {
+					t.Errorf("recoveryService.ResendEmailConfirmationEmail() stored token for %v, err %v", email, err)
+				}
+			}
 			if !reflect.DeepEqual(got1, tt.want1) {
 				t.Errorf("recoveryService.ResendEmailConfirmationEmail() got1 = %v, want %v", got1, tt.want1)
 			}
@@ -360,12 +537,12 @@ func Test_recoveryService_ResendEmailConfirmationEmail(t *testing.T) {
 
 func Test_recoveryService_SendConfirmationEmail(t *testing.T) {
 	type fields struct {
-		repository RecoveryRepository
+		repository *MockRepository
 		cfg        *config.EnigmaConfig
 	}
 	type args struct {
 		userId int64
-		ctx    *rest.ContextInformation
+		info   *middleware.ContextInformation
 	}
 	tests := []struct {
 		name   string
@@ -379,37 +556,37 @@ func Test_recoveryService_SendConfirmationEmail(t *testing.T) {
 			fields: fields{
 				repository: &MockRepository{
 					Responses: map[int]interface{}{
-						GetEmailByUserIdMockID: &domain2.UserEmail{
+						GetEmailMockID: &domain2.UserEmail{
 							UserId: 123,
 						},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetEmailByUserIdMockID: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+					Errors: map[int]error{
+						GetEmailMockID: errors.New("error"),
 					},
 				},
 			},
 			args: args{
 				userId: 123,
-				ctx:    &rest.ContextInformation{},
+				info:   &middleware.ContextInformation{},
 			},
 			want:  false,
-			want1: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+			want1: apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause("error", ErrFetchingUserCode)),
 		},
 		{
 			name: "empty_user_email",
 			fields: fields{
 				repository: &MockRepository{
 					Responses: map[int]interface{}{
-						GetEmailByUserIdMockID: &domain.UserEmail{},
+						GetEmailMockID: &domain.UserEmail{},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetEmailByUserIdMockID: nil,
+					Errors: map[int]error{
+						GetEmailMockID: nil,
 					},
 				},
 			},
 			args: args{
 				userId: 123,
-				ctx:    &rest.ContextInformation{},
+				info:   &middleware.ContextInformation{},
 			},
 			want:  true,
 			want1: nil,
@@ -419,18 +596,18 @@ func Test_recoveryService_SendConfirmationEmail(t *testing.T) {
 			fields: fields{
 				repository: &MockRepository{
 					Responses: map[int]interface{}{
-						GetEmailByUserIdMockID: &domain.UserEmail{
+						GetEmailMockID: &domain.UserEmail{
 							VerfiedEmail: true,
 						},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetEmailByUserIdMockID: nil,
+					Errors: map[int]error{
+						GetEmailMockID: nil,
 					},
 				},
 			},
 			args: args{
 				userId: 123,
-				ctx:    &rest.ContextInformation{},
+				info:   &middleware.ContextInformation{},
 			},
 			want:  false,
 			want1: apierror.NewBadRequestApiError(ErrEmailAlreadyVerified),
@@ -440,18 +617,19 @@ func Test_recoveryService_SendConfirmationEmail(t *testing.T) {
 			fields: fields{
 				repository: &MockRepository{
 					Responses: map[int]interface{}{
-						GetEmailByUserIdMockID: &domain.UserEmail{
+						GetEmailMockID: &domain.UserEmail{
 							UserId: 123,
 						},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetEmailByUserIdMockID: nil,
+					Errors: map[int]error{
+						GetEmailMockID: nil,
 					},
 				},
+				cfg: &config.EnigmaConfig{},
 			},
 			args: args{
 				userId: 123,
-				ctx:    &rest.ContextInformation{},
+				info:   &middleware.ContextInformation{},
 			},
 			want:  false,
 			want1: apierror.NewInternalServerApiError("cant send email", errors.New("cant send email"), "cannot_email"),
@@ -461,9 +639,10 @@ func Test_recoveryService_SendConfirmationEmail(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &recoveryService{
 				repository: tt.fields.repository,
+				users:      tt.fields.repository,
 				cfg:        tt.fields.cfg,
 			}
-			got, got1 := r.SendConfirmationEmail(tt.args.userId, tt.args.ctx)
+			got, got1 := r.SendConfirmationEmail(context.Background(), tt.args.userId, tt.args.info)
 			if got != tt.want {
 				t.Errorf("recoveryService.SendConfirmationEmail() got = %v, want %v", got, tt.want)
 			}
@@ -476,12 +655,12 @@ func Test_recoveryService_SendConfirmationEmail(t *testing.T) {
 
 func Test_recoveryService_SendUsername(t *testing.T) {
 	type fields struct {
-		repository RecoveryRepository
+		repository *MockRepository
 		cfg        *config.EnigmaConfig
 	}
 	type args struct {
 		email string
-		ctx   *rest.ContextInformation
+		info  *middleware.ContextInformation
 	}
 	tests := []struct {
 		name   string
@@ -495,16 +674,14 @@ func Test_recoveryService_SendUsername(t *testing.T) {
 			fields: fields{
 				repository: &MockRepository{
 					Responses: map[int]interface{}{
-						GetUsernameByEmailMockID: &domain.UserEmail{
-							UserId: 123,
-						},
+						GetUserByEmailMockID: &domain2.User{Username: "test"},
 					},
-					Errors: map[int]apierror.ApiError{},
+					Errors: map[int]error{},
 				},
 			},
 			args: args{
 				email: "",
-				ctx:   &rest.ContextInformation{},
+				info:  &middleware.ContextInformation{},
 			},
 			want:  false,
 			want1: apierror.NewBadRequestApiError(domain.ErrEmptyEmail),
@@ -514,35 +691,36 @@ func Test_recoveryService_SendUsername(t *testing.T) {
 			fields: fields{
 				repository: &MockRepository{
 					Responses: map[int]interface{}{
-						GetUsernameByEmailMockID: "test",
+						GetUserByEmailMockID: &domain2.User{Username: "test"},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetUsernameByEmailMockID: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+					Errors: map[int]error{
+						GetUserByEmailMockID: errors.New("error"),
 					},
 				},
 			},
 			args: args{
 				email: "test",
-				ctx:   &rest.ContextInformation{},
+				info:  &middleware.ContextInformation{},
 			},
 			want:  false,
-			want1: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+			want1: apierror.New(http.StatusInternalServerError, domain.ErrUnexpectedError, apierror.NewErrorCause("error", ErrFetchingUserCode)),
 		},
 		{
 			name: "ok",
 			fields: fields{
 				repository: &MockRepository{
 					Responses: map[int]interface{}{
-						GetUsernameByEmailMockID: "test",
+						GetUserByEmailMockID: &domain2.User{Username: "test"},
 					},
-					Errors: map[int]apierror.ApiError{
-						GetUsernameByEmailMockID: nil,
+					Errors: map[int]error{
+						GetUserByEmailMockID: nil,
 					},
 				},
+				cfg: &config.EnigmaConfig{},
 			},
 			args: args{
 				email: "test",
-				ctx:   &rest.ContextInformation{},
+				info:  &middleware.ContextInformation{},
 			},
 			want:  false,
 			want1: apierror.NewInternalServerApiError("cant send email", errors.New("cant send email"), "cannot_email"),
@@ -552,9 +730,10 @@ func Test_recoveryService_SendUsername(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &recoveryService{
 				repository: tt.fields.repository,
+				users:      tt.fields.repository,
 				cfg:        tt.fields.cfg,
 			}
-			got, got1 := r.SendUsername(tt.args.email, tt.args.ctx)
+			got, got1 := r.SendUsername(context.Background(), tt.args.email, tt.args.info)
 			if got != tt.want {
 				t.Errorf("recoveryService.SendUsername() got = %v, want %v", got, tt.want)
 			}
@@ -564,3 +743,181 @@ func Test_recoveryService_SendUsername(t *testing.T) {
 		})
 	}
 }
+
+func Test_recoveryService_SendPasswordReset(t *testing.T) {
+	cfg := &config.EnigmaConfig{TokenOptions: &config.TokenOptions{PasswordResetDuration: time.Hour}}
+
+	tests := []struct {
+		name       string
+		email      string
+		repository *MockRepository
+		want1      apierror.ApiError
+		stored     bool
+	}{
+		{
+			name:       "empty_email",
+			email:      "",
+			repository: &MockRepository{},
+			want1:      apierror.NewBadRequestApiError(domain.ErrEmptyEmail),
+		},
+		{
+			name:  "email_doesnt_exist",
+			email: "test@test.com",
+			repository: &MockRepository{
+				Errors: map[int]error{GetUserByEmailMockID: users.ErrUserNotFound},
+			},
+			want1: apierror.New(http.StatusBadRequest, ErrNoUserEmail, apierror.NewErrorCause(ErrNoUserEmail, ErrNoUserEmailCode)),
+		},
+		{
+			name:  "email_not_verified",
+			email: "test@test.com",
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetUserByEmailMockID: &domain2.User{AuthId: 1},
+					GetEmailMockID:       &domain.UserEmail{VerfiedEmail: false},
+				},
+				Errors: map[int]error{},
+			},
+			want1: apierror.New(http.StatusBadRequest, ErrEmailNotVerified, apierror.NewErrorCause(ErrEmailNotVerified, ErrEmailNotVerifiedCode)),
+		},
+		{
+			name:  "stored",
+			email: "test@test.com",
+			repository: &MockRepository{
+				Responses: map[int]interface{}{
+					GetUserByEmailMockID: &domain2.User{AuthId: 1},
+					GetEmailMockID:       &domain.UserEmail{VerfiedEmail: true},
+				},
+				Errors: map[int]error{},
+			},
+			want1:  apierror.NewInternalServerApiError("cant send email", errors.New("cant send email"), "cannot_email"),
+			stored: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewService(cfg, tt.repository, tt.repository)
+			_, got1 := r.SendPasswordReset(context.Background(), tt.email, &middleware.ContextInformation{})
+			// The email sender isn't running in the tests so the ones that get to it fail there
+			if !tt.stored && !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("recoveryService.SendPasswordReset() got1 = %v, want %v", got1, tt.want1)
+			}
+
+			reset := tt.repository.PasswordReset
+			if (reset != nil) != tt.stored {
+				t.Fatalf("recoveryService.SendPasswordReset() stored = %v, want %v", reset != nil, tt.stored)
+			}
+			if !tt.stored {
+				return
+			}
+
+			if reset.UserId != 1 || len(reset.TokenHash) != 64 || reset.DateUsed.Valid {
+				t.Errorf("recoveryService.SendPasswordReset() stored %+v", reset)
+			}
+			if until := time.Until(reset.ExpiryDate.Time); until <= 59*time.Minute || until > time.Hour {
+				t.Errorf("recoveryService.SendPasswordReset() expires in %v, want 1h", until)
+			}
+		})
+	}
+}
+
+func Test_recoveryService_ResetPassword(t *testing.T) {
+	token := "token"
+	valid := func() *domain.PasswordReset {
+		return &domain.PasswordReset{
+			PasswordResetId: 1,
+			UserId:          1,
+			TokenHash:       encryption.HashOpaqueToken(token),
+			ExpiryDate:      sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+		}
+	}
+	expired := valid()
+	expired.ExpiryDate.Time = time.Now().Add(-time.Minute)
+	used := valid()
+	used.DateUsed = sql.NullTime{Time: time.Now(), Valid: true}
+	otherUser := valid()
+	otherUser.UserId = 2
+
+	invalid := apierror.NewBadRequestApiError(ErrPasswordTokenIsNotValid)
+	repository := func(reset *domain.PasswordReset, consumed bool) *MockRepository {
+		return &MockRepository{
+			Responses: map[int]interface{}{
+				GetPasswordResetMockID: reset,
+				GetUserByEmailMockID:   &domain2.User{AuthId: 1},
+				UsePasswordResetMockID: consumed,
+			},
+			Errors: map[int]error{},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		password   string
+		confirm    string
+		token      string
+		repository *MockRepository
+		want1      apierror.ApiError
+	}{
+		{name: "empty_token", password: "password", confirm: "password", token: "", repository: repository(valid(), true), want1: apierror.NewBadRequestApiError(domain.ErrEmptyField)},
+		{name: "passwords_dont_match", password: "password", confirm: "other", token: token, repository: repository(valid(), true), want1: apierror.NewBadRequestApiError(ErrPasswordConfirmationDoesntMatch)},
+		{name: "unknown_token", password: "password", confirm: "password", token: token, repository: repository(nil, true), want1: invalid},
+		{name: "expired", password: "password", confirm: "password", token: token, repository: repository(expired, true), want1: invalid},
+		{name: "used", password: "password", confirm: "password", token: token, repository: repository(used, true), want1: invalid},
+		{name: "other_user", password: "password", confirm: "password", token: token, repository: repository(otherUser, true), want1: invalid},
+		{name: "used_concurrently", password: "password", confirm: "password", token: token, repository: repository(valid(), false), want1: invalid},
+		{
+			name: "repository_error", password: "password", confirm: "password", token: token,
+			repository: &MockRepository{
+				Responses: map[int]interface{}{},
+				Errors:    map[int]error{GetPasswordResetMockID: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test")},
+			},
+			want1: apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewService(&config.EnigmaConfig{}, tt.repository, tt.repository)
+			got, got1 := r.ResetPassword(context.Background(), "test@test.com", tt.password, tt.confirm, tt.token, &middleware.ContextInformation{})
+			if got {
+				t.Errorf("recoveryService.ResetPassword() got = %v, want false", got)
+			}
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("recoveryService.ResetPassword() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func Test_recoveryService_ResetPassword_replacesStamp(t *testing.T) {
+	token := "token"
+	cfg := &config.EnigmaConfig{
+		Keys:        &config.Keys{},
+		ArgonParams: &config.ArgonParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16},
+	}
+	updateErr := apierror.NewInternalServerApiError("Internal error", errors.New("error"), "test")
+	repository := &MockRepository{
+		Responses: map[int]interface{}{
+			GetPasswordResetMockID: &domain.PasswordReset{
+				PasswordResetId: 1,
+				UserId:          1,
+				TokenHash:       encryption.HashOpaqueToken(token),
+				ExpiryDate:      sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+			},
+			GetUserByEmailMockID:   &domain2.User{AuthId: 1},
+			UsePasswordResetMockID: true,
+		},
+		Errors: map[int]error{UpdatePasswordHashMockID: updateErr},
+	}
+
+	r := NewService(cfg, repository, repository)
+	got, got1 := r.ResetPassword(context.Background(), "test@test.com", "password", "password", token, &middleware.ContextInformation{})
+	if got {
+		t.Errorf("recoveryService.ResetPassword() got = %v, want false", got)
+	}
+	if !reflect.DeepEqual(got1, updateErr) {
+		t.Errorf("recoveryService.ResetPassword() got1 = %v, want %v", got1, updateErr)
+	}
+	if repository.SecurityToken == "" {
+		t.Errorf("recoveryService.ResetPassword() didn't save a new stamp with the password")
+	}
+}
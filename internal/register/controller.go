@@ -23,7 +23,7 @@ func NewController(s RegisterService) RegisterController {
 func (u *registerController) SignUp(c *gin.Context) {
 	var usr domain.UserSignupDTO
 	var errs apierror.ApiError
-	ctx := middleware.GetContextInformation("SignUp", c)
+	info := middleware.GetContextInformation("SignUp", c)
 
 	if err := c.ShouldBindJSON(&usr); err != nil {
 		c.JSON(http.StatusBadRequest, apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)))
@@ -31,8 +31,8 @@ func (u *registerController) SignUp(c *gin.Context) {
 	}
 
 	var userId int64
-	performance.TrackTime(time.Now(), "CreateUser", ctx, func() {
-		userId, errs = u.svc.CreateUser(&usr, ctx)
+	performance.TrackTime(time.Now(), "CreateUser", info, func() {
+		userId, errs = u.svc.CreateUser(c.Request.Context(), &usr, info)
 	})
 
 	if errs != nil {
@@ -2,6 +2,7 @@ package register
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -11,7 +12,7 @@ import (
 	"testing"
 
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
-	"github.com/CienciaArgentina/go-backend-commons/pkg/rest"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
 	"github.com/gin-gonic/gin"
 )
@@ -26,11 +27,11 @@ type MockService struct {
 	Errors    map[string]apierror.ApiError
 }
 
-func (m *MockService) UserCanSignUp(u *domain.UserSignupDTO) (bool, apierror.ApiError) {
+func (m *MockService) UserCanSignUp(ctx context.Context, u *domain.UserSignupDTO) (bool, apierror.ApiError) {
 	return m.Responses[UserCanSignUpMockName].(bool), m.Errors[UserCanSignUpMockName]
 }
 
-func (m *MockService) CreateUser(u *domain.UserSignupDTO, ctx *rest.ContextInformation) (int64, apierror.ApiError) {
+func (m *MockService) CreateUser(ctx context.Context, u *domain.UserSignupDTO, info *middleware.ContextInformation) (int64, apierror.ApiError) {
 	return m.Responses[CreateUserMockName].(int64), m.Errors[CreateUserMockName]
 }
 
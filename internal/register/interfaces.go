@@ -1,6 +1,8 @@
 package register
 
 import (
+	"context"
+
 	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
 	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
@@ -9,17 +11,20 @@ import (
 )
 
 type RegisterRepository interface {
-	GetUserById(userId int64) (*domain.User, error)
-	AddUser(tx *sqlx.Tx, u *domain.User) (int64, error)
-	AddUserEmail(tx *sqlx.Tx, e *domain.UserEmail) (int64, error)
-	DeleteUser(userId int64) error
-	CheckUsernameExists(username string) (bool, error)
-	CheckEmailExists(email string) (bool, error)
+	AddUser(ctx context.Context, tx *sqlx.Tx, u *domain.User) (int64, error)
+	AddUserEmail(ctx context.Context, tx *sqlx.Tx, e *domain.UserEmail) (int64, error)
+	DeleteUser(ctx context.Context, userId int64) error
+}
+
+// UserStore The lookups of users.UserStore that register needs
+type UserStore interface {
+	UsernameExists(ctx context.Context, username string) (bool, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
 }
 
 type RegisterService interface {
-	UserCanSignUp(u *domain.UserSignupDTO) (bool, apierror.ApiError)
-	CreateUser(u *domain.UserSignupDTO, ctx *middleware.ContextInformation) (int64, apierror.ApiError)
+	UserCanSignUp(ctx context.Context, u *domain.UserSignupDTO) (bool, apierror.ApiError)
+	CreateUser(ctx context.Context, u *domain.UserSignupDTO, info *middleware.ContextInformation) (int64, apierror.ApiError)
 }
 
 type RegisterController interface {
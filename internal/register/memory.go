@@ -0,0 +1,76 @@
+package register
+
+import (
+	"context"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage/memory"
+	"github.com/jmoiron/sqlx"
+)
+
+type memoryRepository struct {
+	store *memory.Store
+}
+
+// NewMemoryRepository Returns a register repository that keeps the users in store. The transactions it's given are
+// ignored: every write is applied right away and isn't undone if the caller rolls back.
+func NewMemoryRepository(store *memory.Store) RegisterRepository {
+	return &memoryRepository{store: store}
+}
+
+func (m *memoryRepository) AddUser(ctx context.Context, _ *sqlx.Tx, usr *domain.User) (int64, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	if _, ok := m.store.UserByNormalizedUsername(usr.NormalizedUsername); ok {
+		return 0, memory.ErrUniqueViolation
+	}
+
+	id := m.store.NextID("users")
+	m.store.Users[id] = domain.User{
+		AuthId:             id,
+		Username:           usr.Username,
+		NormalizedUsername: usr.NormalizedUsername,
+		PasswordHash:       usr.PasswordHash,
+		DateCreated:        memory.Timestamp(time.Now()),
+		SecurityToken:      usr.SecurityToken,
+		VerificationToken:  usr.VerificationToken,
+	}
+
+	return id, nil
+}
+
+func (m *memoryRepository) AddUserEmail(ctx context.Context, _ *sqlx.Tx, e *domain.UserEmail) (int64, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	if _, ok := m.store.Users[e.UserId]; !ok {
+		return 0, memory.ErrForeignKeyViolation
+	}
+	if _, ok := m.store.EmailByNormalizedEmail(e.NormalizedEmail); ok {
+		return 0, memory.ErrUniqueViolation
+	}
+
+	id := m.store.NextID("users_email")
+	m.store.UserEmails[id] = domain.UserEmail{
+		UserEmailId:     id,
+		UserId:          e.UserId,
+		Email:           e.Email,
+		NormalizedEmail: e.NormalizedEmail,
+		DateCreated:     memory.Timestamp(time.Now()),
+	}
+
+	return id, nil
+}
+
+func (m *memoryRepository) DeleteUser(ctx context.Context, userId int64) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	if !m.store.DeleteUser(userId) {
+		return errCannotDelete
+	}
+
+	return nil
+}
@@ -1,48 +1,32 @@
 package register
 
 import (
-	"database/sql"
-	"strings"
+	"context"
+	"time"
 
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
 
 	"github.com/jmoiron/sqlx"
 )
 
 type registerRepository struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	timeout time.Duration
 }
 
-// NewRepository Returns new productive register repository implementation
-func NewRepository(db *sqlx.DB) RegisterRepository {
-	return &registerRepository{db: db}
-}
-
-// GetUserById Returns user with given ID from repository
-func (u *registerRepository) GetUserById(userId int64) (*domain.User, error) {
-	var usr domain.User
-
-	err := u.db.Get(&usr, "SELECT username FROM users WHERE user_id = ?", userId)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-
-		return nil, err
-	}
-
-	return &usr, nil
+// NewRepository Returns new productive register repository implementation, whose queries give up after timeout
+func NewRepository(db *sqlx.DB, timeout time.Duration) RegisterRepository {
+	return &registerRepository{db: db, timeout: timeout}
 }
 
 // AddUser Creates a new user in repository
-func (u *registerRepository) AddUser(tx *sqlx.Tx, usr *domain.User) (int64, error) {
-	res, err := tx.Exec("INSERT INTO users (username, normalized_username, password_hash,  date_created, verification_token, security_token) VALUES (?, ?, ?, now(), ?, ?)",
-		usr.Username, usr.NormalizedUsername, usr.PasswordHash, usr.VerificationToken, usr.SecurityToken)
-	if err != nil {
-		return 0, err
-	}
+func (u *registerRepository) AddUser(ctx context.Context, tx *sqlx.Tx, usr *domain.User) (int64, error) {
+	ctx, cancel := storage.WithTimeout(ctx, u.timeout)
+	defer cancel()
 
-	lastID, err := res.LastInsertId()
+	lastID, err := storage.InsertID(ctx, tx, "user_id", "INSERT INTO users (username, normalized_username, password_hash,  date_created, verification_token, security_token) VALUES (?, ?, ?, CURRENT_TIMESTAMP, ?, ?)",
+		usr.Username, usr.NormalizedUsername, usr.PasswordHash, usr.VerificationToken, usr.SecurityToken)
 	if err != nil {
 		return 0, err
 	}
@@ -51,13 +35,11 @@ func (u *registerRepository) AddUser(tx *sqlx.Tx, usr *domain.User) (int64, erro
 }
 
 // AddUserEmail Updates user's email
-func (u *registerRepository) AddUserEmail(tx *sqlx.Tx, e *domain.UserEmail) (int64, error) {
-	res, err := tx.Exec("INSERT INTO users_email (user_id, email, normalized_email, date_created) VALUES (?, ?, ?, now())", e.UserId, e.Email, e.NormalizedEmail)
-	if err != nil {
-		return 0, err
-	}
+func (u *registerRepository) AddUserEmail(ctx context.Context, tx *sqlx.Tx, e *domain.UserEmail) (int64, error) {
+	ctx, cancel := storage.WithTimeout(ctx, u.timeout)
+	defer cancel()
 
-	lastID, err := res.LastInsertId()
+	lastID, err := storage.InsertID(ctx, tx, "user_email_id", "INSERT INTO users_email (user_id, email, normalized_email, date_created) VALUES (?, ?, ?, CURRENT_TIMESTAMP)", e.UserId, e.Email, e.NormalizedEmail)
 	if err != nil {
 		return 0, err
 	}
@@ -66,8 +48,11 @@ func (u *registerRepository) AddUserEmail(tx *sqlx.Tx, e *domain.UserEmail) (int
 }
 
 // DeleteUser Deletes user's email
-func (u *registerRepository) DeleteUser(userId int64) error {
-	res, err := u.db.Exec("DELETE FROM users WHERE user_id = ?", userId)
+func (u *registerRepository) DeleteUser(ctx context.Context, userId int64) error {
+	ctx, cancel := storage.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	res, err := u.db.ExecContext(ctx, u.db.Rebind("DELETE FROM users WHERE user_id = ?"), userId)
 	if err != nil {
 		return err
 	}
@@ -80,31 +65,3 @@ func (u *registerRepository) DeleteUser(userId int64) error {
 
 	return nil
 }
-
-// CheckUsernameExists Check's for username existence
-func (u *registerRepository) CheckUsernameExists(username string) (bool, error) {
-	var exists int
-	err := u.db.Get(&exists, "SELECT count(*) FROM users where username = ?", username)
-	if err != nil && err != sql.ErrNoRows {
-		return false, err
-	}
-
-	if exists > 0 {
-		return true, nil
-	}
-
-	return false, nil
-}
-
-// CheckEmailExists Check's user's email existence
-func (u *registerRepository) CheckEmailExists(email string) (bool, error) {
-	var exists int
-	err := u.db.Get(&exists, "SELECT count(*) FROM users_email WHERE normalized_email = ?", strings.ToUpper(email))
-	if err != nil && err != sql.ErrNoRows {
-		return false, err
-	} else if exists > 0 {
-		return true, nil
-	}
-
-	return false, nil
-}
@@ -1,8 +1,8 @@
 package register
 
 import (
+	"context"
 	"errors"
-	"reflect"
 	"testing"
 
 	"github.com/CienciaArgentina/go-enigma/internal/domain"
@@ -11,76 +11,6 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-func TestGetUserByIdOk(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	query := "SELECT username FROM users WHERE user_id = ?"
-	table := sqlmock.NewRows([]string{"user_id"})
-	table.AddRow(123)
-
-	mock.ExpectQuery(query).WillReturnRows(table)
-
-	repo := NewRepository(sqlx.NewDb(db, "sqlmock"))
-	got, err := repo.GetUserById(123)
-	if err != nil {
-		t.Errorf("Unexpected error %+v", err)
-		return
-	}
-
-	expected := domain.User{
-		AuthId: 123,
-	}
-
-	if !reflect.DeepEqual(*got, expected) {
-		t.Errorf("Expected %+v got %+v", expected, got)
-		return
-	}
-}
-
-func TestGetUserByIdInternalError(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	query := "SELECT username FROM users WHERE user_id = ?"
-	mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-
-	repo := NewRepository(sqlx.NewDb(db, "sqlmock"))
-	_, err = repo.GetUserById(123)
-	if err == nil {
-		t.Error("Expected error")
-		return
-	}
-}
-
-func TestGetUserByIdErrorNotFound(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	query := "SELECT username FROM users WHERE user_id = ?"
-	table := sqlmock.NewRows([]string{"user_id"})
-	mock.ExpectQuery(query).WillReturnRows(table)
-
-	repo := NewRepository(sqlx.NewDb(db, "sqlmock"))
-	got, err := repo.GetUserById(123)
-	if err != nil {
-		t.Errorf("Unexpected error %+v", err)
-		return
-	}
-	if got != nil {
-		t.Errorf("Expected nil got %+v", got)
-	}
-}
-
 func Test_registerRepository_AddUser(t *testing.T) {
 	type fields struct {
 		db *sqlx.DB
@@ -122,7 +52,7 @@ func Test_registerRepository_AddUser(t *testing.T) {
 			want:    123,
 			wantErr: false,
 			mockFunc: func() {
-				query := "INSERT INTO users (username, normalized_username, password_hash,  date_created, verification_token, security_token) VALUES (?, ?, ?, now(), ?, ?)"
+				query := "INSERT INTO users (username, normalized_username, password_hash,  date_created, verification_token, security_token) VALUES (?, ?, ?, CURRENT_TIMESTAMP, ?, ?)"
 
 				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(123, 1))
 			},
@@ -138,7 +68,7 @@ func Test_registerRepository_AddUser(t *testing.T) {
 			want:    0,
 			wantErr: true,
 			mockFunc: func() {
-				query := "INSERT INTO users (username, normalized_username, password_hash,  date_created, verification_token, security_token) VALUES (?, ?, ?, now(), ?, ?)"
+				query := "INSERT INTO users (username, normalized_username, password_hash,  date_created, verification_token, security_token) VALUES (?, ?, ?, CURRENT_TIMESTAMP, ?, ?)"
 
 				mock.ExpectExec(query).WillReturnError(errors.New("Internal error"))
 			},
@@ -153,7 +83,7 @@ func Test_registerRepository_AddUser(t *testing.T) {
 				db: tt.fields.db,
 			}
 
-			got, err := u.AddUser(&sqlx.Tx{Tx: tx}, tt.args.usr)
+			got, err := u.AddUser(context.Background(), &sqlx.Tx{Tx: tx}, tt.args.usr)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -206,7 +136,7 @@ func Test_registerRepository_AddUserEmail(t *testing.T) {
 			want:    123,
 			wantErr: false,
 			mockFunc: func() {
-				query := "INSERT INTO users_email (user_id, email, normalized_email, date_created) VALUES (?, ?, ?, now())"
+				query := "INSERT INTO users_email (user_id, email, normalized_email, date_created) VALUES (?, ?, ?, CURRENT_TIMESTAMP)"
 
 				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(123, 1))
 			},
@@ -222,7 +152,7 @@ func Test_registerRepository_AddUserEmail(t *testing.T) {
 			want:    0,
 			wantErr: true,
 			mockFunc: func() {
-				query := "INSERT INTO users_email (user_id, email, normalized_email, date_created) VALUES (?, ?, ?, now())"
+				query := "INSERT INTO users_email (user_id, email, normalized_email, date_created) VALUES (?, ?, ?, CURRENT_TIMESTAMP)"
 
 				mock.ExpectExec(query).WillReturnError(errors.New("Internal error"))
 			},
@@ -237,7 +167,7 @@ func Test_registerRepository_AddUserEmail(t *testing.T) {
 				db: tt.fields.db,
 			}
 
-			got, err := u.AddUserEmail(&sqlx.Tx{Tx: tx}, tt.args.usrEmail)
+			got, err := u.AddUserEmail(context.Background(), &sqlx.Tx{Tx: tx}, tt.args.usrEmail)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -326,7 +256,7 @@ func Test_registerRepository_DeleteUser(t *testing.T) {
 				db: tt.fields.db,
 			}
 
-			err := u.DeleteUser(tt.args.userID)
+			err := u.DeleteUser(context.Background(), tt.args.userID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -334,203 +264,3 @@ func Test_registerRepository_DeleteUser(t *testing.T) {
 		})
 	}
 }
-
-func Test_registerRepository_CheckUsernameExists(t *testing.T) {
-	type fields struct {
-		db *sqlx.DB
-	}
-
-	type args struct {
-		username string
-	}
-
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		expected bool
-		wantErr  bool
-		mockFunc func()
-	}{
-		{
-			name: "ok",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				username: "el_pepe",
-			},
-			wantErr:  false,
-			expected: true,
-			mockFunc: func() {
-				query := "SELECT count(*) FROM users where username = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "doesnt_exist",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				username: "el_pepe",
-			},
-			wantErr:  false,
-			expected: false,
-			mockFunc: func() {
-				query := "SELECT count(*) FROM users where username = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				username: "el_pepe",
-			},
-			wantErr:  true,
-			expected: false,
-			mockFunc: func() {
-				query := "SELECT count(*) FROM users where username = ?"
-
-				mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.mockFunc()
-
-			u := &registerRepository{
-				db: tt.fields.db,
-			}
-
-			got, err := u.CheckUsernameExists(tt.args.username)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if got != tt.expected {
-				t.Errorf("registerRepository.AddUser() got = %v, expected %v", got, tt.expected)
-				return
-			}
-		})
-	}
-}
-
-func Test_registerRepository_CheckEmailExists(t *testing.T) {
-	type fields struct {
-		db *sqlx.DB
-	}
-
-	type args struct {
-		email string
-	}
-
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-	if err != nil {
-		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		expected bool
-		wantErr  bool
-		mockFunc func()
-	}{
-		{
-			name: "ok",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "el_pepe",
-			},
-			wantErr:  false,
-			expected: true,
-			mockFunc: func() {
-				query := "SELECT count(*) FROM users_email WHERE normalized_email = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-				table.AddRow(123)
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "doesnt_exist",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "el_pepe",
-			},
-			wantErr:  false,
-			expected: false,
-			mockFunc: func() {
-				query := "SELECT count(*) FROM users_email WHERE normalized_email = ?"
-
-				table := sqlmock.NewRows([]string{"user_id"})
-
-				mock.ExpectQuery(query).WillReturnRows(table)
-			},
-		},
-		{
-			name: "internal_error",
-			fields: fields{
-				db: sqlx.NewDb(db, "sqlmock"),
-			},
-			args: args{
-				email: "el_pepe",
-			},
-			wantErr:  true,
-			expected: false,
-			mockFunc: func() {
-				query := "SELECT count(*) FROM users_email WHERE normalized_email = ?"
-
-				mock.ExpectQuery(query).WillReturnError(errors.New("Internal error"))
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.mockFunc()
-
-			u := &registerRepository{
-				db: tt.fields.db,
-			}
-
-			got, err := u.CheckEmailExists(tt.args.email)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("registerRepository.AddUser() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if got != tt.expected {
-				t.Errorf("registerRepository.AddUser() got = %v, expected %v", got, tt.expected)
-				return
-			}
-		})
-	}
-}
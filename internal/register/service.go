@@ -1,6 +1,7 @@
 package register
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -81,15 +82,17 @@ type registerService struct {
 	db              *sqlx.DB
 	registerOptions *config.RegisterOptions
 	repository      RegisterRepository
+	users           UserStore
 	recoverySvc     recovery.RecoveryService
 }
 
-func NewService(c *config.EnigmaConfig, db *sqlx.DB, r RegisterRepository, recoverySvc recovery.RecoveryService) RegisterService {
+func NewService(c *config.EnigmaConfig, db *sqlx.DB, r RegisterRepository, users UserStore, recoverySvc recovery.RecoveryService) RegisterService {
 	return &registerService{
 		cfg:             c,
 		db:              db,
 		registerOptions: initRegisterOptions(),
 		repository:      r,
+		users:           users,
 		recoverySvc:     recoverySvc,
 	}
 }
@@ -99,7 +102,6 @@ func initRegisterOptions() *config.RegisterOptions {
 
 	o.UserOptions.RequireUniqueEmail = true
 	o.UserOptions.AllowedCharacters = "[^a-zA-Z0-9\\s._\\-/]"
-	o.UserOptions.EmailVerificationExpiryDuration, _ = time.ParseDuration("1d")
 
 	o.PasswordOptions.RequiredLength = 8
 	o.PasswordOptions.RequireLowercase = true
@@ -111,24 +113,28 @@ func initRegisterOptions() *config.RegisterOptions {
 	return o
 }
 
-func (u *registerService) CreateUser(usr *domain.UserSignupDTO, ctx *middleware.ContextInformation) (int64, apierror.ApiError) {
+func (u *registerService) CreateUser(ctx context.Context, usr *domain.UserSignupDTO, info *middleware.ContextInformation) (int64, apierror.ApiError) {
 	var err error
 	var apierr apierror.ApiError
 	var cansignup bool
 
-	performance.TrackTime(time.Now(), "UserCanSignUp", ctx, func() {
-		cansignup, apierr = u.UserCanSignUp(usr)
+	performance.TrackTime(time.Now(), "UserCanSignUp", info, func() {
+		cansignup, apierr = u.UserCanSignUp(ctx, usr)
 	})
 
 	if !cansignup {
 		return 0, apierr
 	}
 
-	tx := u.db.MustBegin()
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		clog.Error("Error starting transaction", "create-user", err, map[string]string{"email": usr.Email, clog.Subtype: "begin-tx"})
+		return 0, apierror.NewInternalServerApiError(errAddingUser, err, errInvalidRegisterCode)
+	}
 
 	var verificationToken string
-	performance.TrackTime(time.Now(), "GenerateVerificationToken", ctx, func() {
-		verificationToken, err = encryption.GenerateVerificationToken(usr.Email, u.registerOptions.UserOptions.EmailVerificationExpiryDuration, u.cfg)
+	performance.TrackTime(time.Now(), "GenerateVerificationToken", info, func() {
+		verificationToken, err = encryption.GenerateVerificationToken(usr.Email, u.cfg.EmailVerificationDuration(), u.cfg)
 	})
 	if err != nil {
 		clog.Error("Error generating verification token for user", "create-user", err, map[string]string{"email": usr.Email, clog.Subtype: "generate-verification-token"})
@@ -141,15 +147,16 @@ func (u *registerService) CreateUser(usr *domain.UserSignupDTO, ctx *middleware.
 		VerificationToken:  verificationToken,
 	}
 
-	performance.TrackTime(time.Now(), "GenerateSecurityToken", ctx, func() {
-		user.SecurityToken.String, err = encryption.GenerateSecurityToken(usr.Password, u.cfg)
+	performance.TrackTime(time.Now(), "GenerateSecurityStamp", info, func() {
+		user.SecurityToken.String, err = encryption.GenerateSecurityStamp()
 	})
 	if err != nil {
 		clog.Error("Error generating security token for user", "create-user", err, map[string]string{"email": usr.Email, clog.Subtype: "generate-security-token"})
 		return 0, apierror.NewInternalServerApiError(errGenerateSecurityToken, err, errTokenGeneration)
 	}
+	user.SecurityToken.Valid = true
 
-	performance.TrackTime(time.Now(), "GenerateEncodedHash", ctx, func() {
+	performance.TrackTime(time.Now(), "GenerateEncodedHash", info, func() {
 		user.PasswordHash, err = encryption.GenerateEncodedHash(usr.Password, u.cfg)
 	})
 	if err != nil {
@@ -158,8 +165,8 @@ func (u *registerService) CreateUser(usr *domain.UserSignupDTO, ctx *middleware.
 	}
 
 	var userID int64
-	performance.TrackTime(time.Now(), "AddUser", ctx, func() {
-		userID, err = u.repository.AddUser(tx, user)
+	performance.TrackTime(time.Now(), "AddUser", info, func() {
+		userID, err = u.repository.AddUser(ctx, tx, user)
 	})
 	if err != nil {
 		clog.Error("Error saving user", "create-user", err, map[string]string{"email": usr.Email, clog.Subtype: "add-user"})
@@ -173,8 +180,8 @@ func (u *registerService) CreateUser(usr *domain.UserSignupDTO, ctx *middleware.
 		VerfiedEmail:    false,
 	}
 
-	performance.TrackTime(time.Now(), "AddUserEmail", ctx, func() {
-		_, err = u.repository.AddUserEmail(tx, email)
+	performance.TrackTime(time.Now(), "AddUserEmail", info, func() {
+		_, err = u.repository.AddUserEmail(ctx, tx, email)
 	})
 	if err != nil {
 		tx.Rollback()
@@ -182,13 +189,13 @@ func (u *registerService) CreateUser(usr *domain.UserSignupDTO, ctx *middleware.
 		return 0, apierror.NewInternalServerApiError(errAddingUserEmail, err, errInvalidRegisterCode)
 	}
 
-	apierr = setInitialRole(userID, ctx)
+	apierr = u.setInitialRole(ctx, userID, info)
 	if apierr != nil {
 		tx.Rollback()
 		return 0, apierr
 	}
 
-	apierr = createProfile(userID, usr.Email, usr.Username, ctx)
+	apierr = u.createProfile(ctx, userID, usr.Email, usr.Username, info)
 	if apierr != nil {
 		tx.Rollback()
 		return 0, apierr
@@ -196,11 +203,11 @@ func (u *registerService) CreateUser(usr *domain.UserSignupDTO, ctx *middleware.
 
 	tx.Commit()
 
-	u.recoverySvc.SendConfirmationEmail(userID, ctx)
+	u.recoverySvc.SendConfirmationEmail(ctx, userID, info)
 	return userID, nil
 }
 
-func (u *registerService) UserCanSignUp(usr *domain.UserSignupDTO) (bool, apierror.ApiError) {
+func (u *registerService) UserCanSignUp(ctx context.Context, usr *domain.UserSignupDTO) (bool, apierror.ApiError) {
 	errs := apierror.NewWithStatus(http.StatusBadRequest).WithMessage(errCantCreateUser)
 
 	// Check that every field is correct
@@ -223,7 +230,7 @@ func (u *registerService) UserCanSignUp(usr *domain.UserSignupDTO) (bool, apierr
 	}
 
 	if u.registerOptions.UserOptions.RequireUniqueEmail {
-		exists, err := u.repository.CheckEmailExists(usr.Email)
+		exists, err := u.users.EmailExists(ctx, usr.Email)
 		if exists {
 			return false, apierror.NewBadRequestApiError(errEmailAlreadyExists)
 		} else if err != nil && err != sql.ErrNoRows {
@@ -231,7 +238,7 @@ func (u *registerService) UserCanSignUp(usr *domain.UserSignupDTO) (bool, apierr
 		}
 	}
 
-	usrexists, err := u.repository.CheckUsernameExists(usr.Username)
+	usrexists, err := u.users.UsernameExists(ctx, usr.Username)
 	if usrexists {
 		return false, apierror.NewBadRequestApiError(errUserAlreadyExists)
 	} else if err != nil && err != sql.ErrNoRows {
@@ -287,14 +294,14 @@ func (u *registerService) UserCanSignUp(usr *domain.UserSignupDTO) (bool, apierr
 	return true, nil
 }
 
-func setInitialRole(authid int64, ctx *middleware.ContextInformation) apierror.ApiError {
+func (u *registerService) setInitialRole(ctx context.Context, authid int64, info *middleware.ContextInformation) apierror.ApiError {
 	var err error
 	var res *resty.Response
 	baseURL := domain.GetRolesBaseURL()
 	assign := domain.AssignRoleRequest{AuthID: authid, RoleID: 1}
 	// TODO: Move this to a client
-	performance.TrackTime(time.Now(), "SetInitialRoleAPICall", ctx, func() {
-		res, err = resty.New().SetHostURL(baseURL).R().SetBody(assign).Post("/assign")
+	performance.TrackTime(time.Now(), "SetInitialRoleAPICall", info, func() {
+		res, err = resty.New().SetHostURL(baseURL).SetTimeout(u.cfg.TimeoutOptions.Roles).R().SetContext(ctx).SetBody(assign).Post("/assign")
 	})
 	if err != nil {
 		clog.Error("Rest client error", "set-initial-role", err, nil)
@@ -307,7 +314,7 @@ func setInitialRole(authid int64, ctx *middleware.ContextInformation) apierror.A
 	return nil
 }
 
-func createProfile(authid int64, email, username string, ctx *middleware.ContextInformation) apierror.ApiError {
+func (u *registerService) createProfile(ctx context.Context, authid int64, email, username string, info *middleware.ContextInformation) apierror.ApiError {
 	var err error
 	var res *resty.Response
 	baseURL := domain.GetProfileBaseURL()
@@ -317,8 +324,8 @@ func createProfile(authid int64, email, username string, ctx *middleware.Context
 		Email:                  email,
 	}
 	// TODO: Move this to a client
-	performance.TrackTime(time.Now(), "CreateUserProfile", ctx, func() {
-		res, err = resty.New().SetHostURL(baseURL).R().SetBody(profile).Post("/user_profiles")
+	performance.TrackTime(time.Now(), "CreateUserProfile", info, func() {
+		res, err = resty.New().SetHostURL(baseURL).SetTimeout(u.cfg.TimeoutOptions.Profile).R().SetContext(ctx).SetBody(profile).Post("/user_profiles")
 	})
 	if err != nil {
 		clog.Error("Rest client error", "create-profile", err, nil)
@@ -1,6 +1,7 @@
 package register
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
@@ -13,12 +14,11 @@ import (
 )
 
 const (
-	GetUserByIDMockName         = "GetUserById"
-	AddUserMockName             = "AddUser"
-	AddUserEmailMockName        = "AddUserEmail"
-	DeleteUserMockName          = "DeleteUser"
-	CheckUsernameExistsMockName = "CheckUsernameExists"
-	CheckEmailExistsMockName    = "CheckEmailExists"
+	AddUserMockName        = "AddUser"
+	AddUserEmailMockName   = "AddUserEmail"
+	DeleteUserMockName     = "DeleteUser"
+	UsernameExistsMockName = "UsernameExists"
+	EmailExistsMockName    = "EmailExists"
 )
 
 type MockRepository struct {
@@ -26,33 +26,29 @@ type MockRepository struct {
 	Errors    map[string]error
 }
 
-func (m *MockRepository) GetUserById(userId int64) (*domain.User, error) {
-	return m.Responses[GetUserByIDMockName].(*domain.User), m.Errors[GetUserByIDMockName]
-}
-
-func (m *MockRepository) AddUser(tx *sqlx.Tx, u *domain.User) (int64, error) {
+func (m *MockRepository) AddUser(ctx context.Context, tx *sqlx.Tx, u *domain.User) (int64, error) {
 	return m.Responses[AddUserMockName].(int64), m.Errors[AddUserMockName]
 }
 
-func (m *MockRepository) AddUserEmail(tx *sqlx.Tx, e *domain.UserEmail) (int64, error) {
+func (m *MockRepository) AddUserEmail(ctx context.Context, tx *sqlx.Tx, e *domain.UserEmail) (int64, error) {
 	return m.Responses[AddUserEmailMockName].(int64), m.Errors[AddUserEmailMockName]
 }
 
-func (m *MockRepository) DeleteUser(userId int64) error {
+func (m *MockRepository) DeleteUser(ctx context.Context, userId int64) error {
 	return m.Errors[DeleteUserMockName]
 }
 
-func (m *MockRepository) CheckUsernameExists(username string) (bool, error) {
-	return m.Responses[CheckUsernameExistsMockName].(bool), m.Errors[CheckUsernameExistsMockName]
+func (m *MockRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+	return m.Responses[UsernameExistsMockName].(bool), m.Errors[UsernameExistsMockName]
 }
 
-func (m *MockRepository) CheckEmailExists(email string) (bool, error) {
-	return m.Responses[CheckEmailExistsMockName].(bool), m.Errors[CheckEmailExistsMockName]
+func (m *MockRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	return m.Responses[EmailExistsMockName].(bool), m.Errors[EmailExistsMockName]
 }
 
 func Test_registerService_UserCanSignUp(t *testing.T) {
 	type fields struct {
-		repository RegisterRepository
+		users UserStore
 	}
 
 	type args struct {
@@ -114,9 +110,9 @@ func Test_registerService_UserCanSignUp(t *testing.T) {
 		{
 			name: "non_unique_email",
 			fields: fields{
-				repository: &MockRepository{
+				users: &MockRepository{
 					Responses: map[string]interface{}{
-						CheckEmailExistsMockName: true,
+						EmailExistsMockName: true,
 					},
 				},
 			},
@@ -133,12 +129,12 @@ func Test_registerService_UserCanSignUp(t *testing.T) {
 		{
 			name: "check_email_exists_error",
 			fields: fields{
-				repository: &MockRepository{
+				users: &MockRepository{
 					Responses: map[string]interface{}{
-						CheckEmailExistsMockName: false,
+						EmailExistsMockName: false,
 					},
 					Errors: map[string]error{
-						CheckEmailExistsMockName: errCannotDelete,
+						EmailExistsMockName: errCannotDelete,
 					},
 				},
 			},
@@ -155,13 +151,13 @@ func Test_registerService_UserCanSignUp(t *testing.T) {
 		{
 			name: "check_user_exists",
 			fields: fields{
-				repository: &MockRepository{
+				users: &MockRepository{
 					Responses: map[string]interface{}{
-						CheckEmailExistsMockName:    false,
-						CheckUsernameExistsMockName: true,
+						EmailExistsMockName:    false,
+						UsernameExistsMockName: true,
 					},
 					Errors: map[string]error{
-						CheckEmailExistsMockName: sql.ErrNoRows,
+						EmailExistsMockName: sql.ErrNoRows,
 					},
 				},
 			},
@@ -178,14 +174,14 @@ func Test_registerService_UserCanSignUp(t *testing.T) {
 		{
 			name: "check_user_exists_error",
 			fields: fields{
-				repository: &MockRepository{
+				users: &MockRepository{
 					Responses: map[string]interface{}{
-						CheckEmailExistsMockName:    false,
-						CheckUsernameExistsMockName: false,
+						EmailExistsMockName:    false,
+						UsernameExistsMockName: false,
 					},
 					Errors: map[string]error{
-						CheckEmailExistsMockName:    sql.ErrNoRows,
-						CheckUsernameExistsMockName: errCannotDelete,
+						EmailExistsMockName:    sql.ErrNoRows,
+						UsernameExistsMockName: errCannotDelete,
 					},
 				},
 			},
@@ -202,14 +198,14 @@ func Test_registerService_UserCanSignUp(t *testing.T) {
 		{
 			name: "invalid_user_request_lower",
 			fields: fields{
-				repository: &MockRepository{
+				users: &MockRepository{
 					Responses: map[string]interface{}{
-						CheckEmailExistsMockName:    false,
-						CheckUsernameExistsMockName: false,
+						EmailExistsMockName:    false,
+						UsernameExistsMockName: false,
 					},
 					Errors: map[string]error{
-						CheckEmailExistsMockName:    sql.ErrNoRows,
-						CheckUsernameExistsMockName: sql.ErrNoRows,
+						EmailExistsMockName:    sql.ErrNoRows,
+						UsernameExistsMockName: sql.ErrNoRows,
 					},
 				},
 			},
@@ -234,14 +230,14 @@ func Test_registerService_UserCanSignUp(t *testing.T) {
 		{
 			name: "invalid_user_request_lower",
 			fields: fields{
-				repository: &MockRepository{
+				users: &MockRepository{
 					Responses: map[string]interface{}{
-						CheckEmailExistsMockName:    false,
-						CheckUsernameExistsMockName: false,
+						EmailExistsMockName:    false,
+						UsernameExistsMockName: false,
 					},
 					Errors: map[string]error{
-						CheckEmailExistsMockName:    sql.ErrNoRows,
-						CheckUsernameExistsMockName: sql.ErrNoRows,
+						EmailExistsMockName:    sql.ErrNoRows,
+						UsernameExistsMockName: sql.ErrNoRows,
 					},
 				},
 			},
@@ -266,14 +262,14 @@ func Test_registerService_UserCanSignUp(t *testing.T) {
 		{
 			name: "invalid_user_request_lower",
 			fields: fields{
-				repository: &MockRepository{
+				users: &MockRepository{
 					Responses: map[string]interface{}{
-						CheckEmailExistsMockName:    false,
-						CheckUsernameExistsMockName: false,
+						EmailExistsMockName:    false,
+						UsernameExistsMockName: false,
 					},
 					Errors: map[string]error{
-						CheckEmailExistsMockName:    sql.ErrNoRows,
-						CheckUsernameExistsMockName: sql.ErrNoRows,
+						EmailExistsMockName:    sql.ErrNoRows,
+						UsernameExistsMockName: sql.ErrNoRows,
 					},
 				},
 			},
@@ -293,9 +289,9 @@ func Test_registerService_UserCanSignUp(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			u := &registerService{
 				registerOptions: initRegisterOptions(),
-				repository:      tt.fields.repository,
+				users:           tt.fields.users,
 			}
-			got, got1 := u.UserCanSignUp(tt.args.usr)
+			got, got1 := u.UserCanSignUp(context.Background(), tt.args.usr)
 			if got != tt.want {
 				t.Errorf("registerService.UserCanSignUp() got = %v, want %v", got, tt.want)
 			}
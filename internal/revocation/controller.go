@@ -0,0 +1,36 @@
+package revocation
+
+import (
+	"net/http"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type revocationController struct {
+	store Store
+}
+
+func NewController(s Store) Controller {
+	return &revocationController{store: s}
+}
+
+// IsRevoked Lets services that verify our tokens on their own check whether a jti was revoked
+func (r *revocationController) IsRevoked(c *gin.Context) {
+	jti := c.Param("jti")
+	if jti == "" {
+		c.JSON(http.StatusBadRequest, apierror.NewBadRequestApiError(domain.ErrEmptyField))
+		return
+	}
+
+	revoked, err := r.store.IsRevoked(c.Request.Context(), jti)
+	if err != nil {
+		clog.Error("Error checking token revocation", "is-revoked", err, map[string]string{"jti": jti})
+		c.JSON(http.StatusInternalServerError, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jti": jti, "revoked": revoked})
+}
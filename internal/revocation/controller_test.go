@@ -0,0 +1,59 @@
+package revocation
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Test_revocationController_IsRevoked(t *testing.T) {
+	store := NewMemoryStore()
+	_ = store.Revoke(context.Background(), "revoked", time.Now().Add(time.Minute))
+
+	tests := []struct {
+		name           string
+		jti            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "revoked",
+			jti:            "revoked",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jti":"revoked","revoked":true}`,
+		},
+		{
+			name:           "not_revoked",
+			jti:            "valid",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jti":"valid","revoked":false}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/tokens/revoked/"+tt.jti, nil)
+			c.Params = gin.Params{{Key: "jti", Value: tt.jti}}
+
+			NewController(store).IsRevoked(c)
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[IsRevoked] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body)
+			if buf.String() != tt.expectedBody {
+				t.Errorf("[IsRevoked] Expected body = %v, got %v", tt.expectedBody, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Store Keeps the jti of access tokens that were revoked before expiring. Entries are only needed until the token
+// expires, after that the token is rejected anyway.
+type Store interface {
+	// Revoke Adds the jti to the list, revoking one that already is isn't an error
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+type Controller interface {
+	IsRevoked(c *gin.Context)
+}
@@ -0,0 +1,43 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryStore struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+	now     func() time.Time
+}
+
+// NewMemoryStore Returns a store that lives in the process memory. It's only suitable when a single instance of Enigma
+// is running, revocations are lost on restart.
+func NewMemoryStore() Store {
+	return &memoryStore{revoked: map[string]time.Time{}, now: time.Now}
+}
+
+func (m *memoryStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Drop the tokens that already expired so the map doesn't grow forever.
+	now := m.now()
+	for id, exp := range m.revoked {
+		if exp.Before(now) {
+			delete(m.revoked, id)
+		}
+	}
+
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+func (m *memoryStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
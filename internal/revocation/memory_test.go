@@ -0,0 +1,39 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	revoked, err := store.IsRevoked(context.Background(), "jti")
+	if err != nil || revoked {
+		t.Fatalf("memoryStore.IsRevoked() = %v, %v, want false", revoked, err)
+	}
+
+	if err := store.Revoke(context.Background(), "jti", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("memoryStore.Revoke() error = %v", err)
+	}
+
+	revoked, err = store.IsRevoked(context.Background(), "jti")
+	if err != nil || !revoked {
+		t.Fatalf("memoryStore.IsRevoked() = %v, %v, want true", revoked, err)
+	}
+}
+
+func TestMemoryStorePurgesExpired(t *testing.T) {
+	store := NewMemoryStore().(*memoryStore)
+
+	_ = store.Revoke(context.Background(), "expired", time.Now().Add(-time.Minute))
+	_ = store.Revoke(context.Background(), "valid", time.Now().Add(time.Minute))
+
+	if _, ok := store.revoked["expired"]; ok {
+		t.Errorf("memoryStore.Revoke() expected expired entries to be purged")
+	}
+	if _, ok := store.revoked["valid"]; !ok {
+		t.Errorf("memoryStore.Revoke() expected valid entries to be kept")
+	}
+}
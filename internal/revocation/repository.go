@@ -0,0 +1,64 @@
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+type revocationRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewRepository Returns a store backed by the revoked_token table, shared by every instance of Enigma. Its queries give up after timeout
+func NewRepository(db *sqlx.DB, timeout time.Duration) Store {
+	return &revocationRepository{db: db, timeout: timeout}
+}
+
+// Revoke Adds the jti to the revocation list, doing nothing if it was already there, and purges the entries of tokens
+// that already expired. The jti is revoked even if the purge fails, that's only logged and retried on the next one
+func (r *revocationRepository) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ctx, cancel := storage.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(revokeQuery(r.db)), jti, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, r.db.Rebind("DELETE FROM revoked_token WHERE expiry_date < CURRENT_TIMESTAMP"))
+	if err != nil {
+		clog.Error("Error purging the expired revoked tokens", "revoke", err, nil)
+	}
+
+	return nil
+}
+
+// IsRevoked Returns true if the jti is in the revocation list
+func (r *revocationRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	ctx, cancel := storage.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var count int
+
+	err := r.db.GetContext(ctx, &count, r.db.Rebind("SELECT count(*) FROM revoked_token WHERE jti = ?"), jti)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// revokeQuery Returns the INSERT of a jti that ignores the ones already revoked, in the form of the dialect
+func revokeQuery(db *sqlx.DB) string {
+	query := "INSERT INTO revoked_token (jti, expiry_date, date_created) VALUES (?, ?, CURRENT_TIMESTAMP)"
+	if storage.Dialect(db) == config.DatabaseDriverMySQL {
+		return query + " ON DUPLICATE KEY UPDATE jti = jti"
+	}
+	return query + " ON CONFLICT (jti) DO NOTHING"
+}
@@ -0,0 +1,142 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_revocationRepository_Revoke(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	insert := "INSERT INTO revoked_token (jti, expiry_date, date_created) VALUES (?, ?, CURRENT_TIMESTAMP) ON CONFLICT (jti) DO NOTHING"
+	purge := "DELETE FROM revoked_token WHERE expiry_date < CURRENT_TIMESTAMP"
+	expiry := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name     string
+		driver   string
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name: "ok",
+			mockFunc: func() {
+				mock.ExpectExec(insert).WithArgs("jti", expiry).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(purge).WillReturnResult(sqlmock.NewResult(0, 2))
+			},
+		},
+		{
+			name: "already_revoked",
+			mockFunc: func() {
+				mock.ExpectExec(insert).WithArgs("jti", expiry).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(purge).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+		{
+			name:   "mysql",
+			driver: "mysql",
+			mockFunc: func() {
+				mock.ExpectExec("INSERT INTO revoked_token (jti, expiry_date, date_created) VALUES (?, ?, CURRENT_TIMESTAMP) ON DUPLICATE KEY UPDATE jti = jti").
+					WithArgs("jti", expiry).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(purge).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+		{
+			name: "purge_error",
+			mockFunc: func() {
+				mock.ExpectExec(insert).WithArgs("jti", expiry).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(purge).WillReturnError(errors.New("internal_error"))
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectExec(insert).WithArgs("jti", expiry).WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			driver := tt.driver
+			if driver == "" {
+				driver = "sqlmock"
+			}
+			r := NewRepository(sqlx.NewDb(db, driver), time.Second)
+
+			err := r.Revoke(context.Background(), "jti", expiry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("revocationRepository.Revoke() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_revocationRepository_IsRevoked(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "SELECT count(*) FROM revoked_token WHERE jti = ?"
+
+	tests := []struct {
+		name     string
+		expected bool
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name:     "revoked",
+			expected: true,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("jti").WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(1))
+			},
+		},
+		{
+			name:     "not_revoked",
+			expected: false,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("jti").WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(0))
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("jti").WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			revoked, err := r.IsRevoked(context.Background(), "jti")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("revocationRepository.IsRevoked() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if revoked != tt.expected {
+				t.Errorf("revocationRepository.IsRevoked() got = %v, expected %v", revoked, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,4 @@
+package storage
+
+// Registers the "postgres" driver
+import _ "github.com/lib/pq"
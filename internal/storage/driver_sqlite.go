@@ -0,0 +1,14 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"modernc.org/sqlite"
+)
+
+// The SQLite driver is a pure Go port, so the binary is still built without cgo. It registers itself as "sqlite" and is
+// registered again with the name sqlx rebinds the queries for
+func init() {
+	sql.Register(config.DatabaseDriverSQLite, &sqlite.Driver{})
+}
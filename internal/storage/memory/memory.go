@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+)
+
+// ErrUniqueViolation Returned when a row would repeat the value of a unique column, like the SQL constraints do
+var ErrUniqueViolation = errors.New("duplicate value for a unique column")
+
+// ErrForeignKeyViolation Returned when a row references a user that doesn't exist
+var ErrForeignKeyViolation = errors.New("the referenced user doesn't exist")
+
+// Store Tables of an in-memory database, shared by the memory user store and the memory repositories of login, register
+// and recovery so a user registered through one is found by the others. They hold the lock for the whole operation,
+// like a transaction, and store and return copies so callers can't change the rows behind its back
+type Store struct {
+	sync.Mutex
+	Users          map[int64]domain.User
+	UserEmails     map[int64]domain.UserEmail
+	RefreshTokens  map[int64]domain.RefreshToken
+	Sessions       map[string]domain.Session
+	MagicLinks     map[int64]domain.MagicLink
+	PasswordResets map[int64]domain.PasswordReset
+
+	sequences map[string]int64
+}
+
+// NewStore Returns an empty store
+func NewStore() *Store {
+	return &Store{
+		Users:          map[int64]domain.User{},
+		UserEmails:     map[int64]domain.UserEmail{},
+		RefreshTokens:  map[int64]domain.RefreshToken{},
+		Sessions:       map[string]domain.Session{},
+		MagicLinks:     map[int64]domain.MagicLink{},
+		PasswordResets: map[int64]domain.PasswordReset{},
+		sequences:      map[string]int64{},
+	}
+}
+
+// NextID Returns the next id of the table, like an auto increment column
+func (s *Store) NextID(table string) int64 {
+	s.sequences[table]++
+	return s.sequences[table]
+}
+
+// Timestamp Formats a date like the SQL repositories return the date columns scanned into strings
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// UserByUsername Returns the user whose username is exactly the given one
+func (s *Store) UserByUsername(username string) (domain.User, bool) {
+	for _, user := range s.Users {
+		if user.Username == username {
+			return user, true
+		}
+	}
+	return domain.User{}, false
+}
+
+// UserByNormalizedUsername Returns the user whose normalized username is the given one upper cased
+func (s *Store) UserByNormalizedUsername(username string) (domain.User, bool) {
+	normalized := strings.ToUpper(username)
+	for _, user := range s.Users {
+		if user.NormalizedUsername == normalized {
+			return user, true
+		}
+	}
+	return domain.User{}, false
+}
+
+// EmailByNormalizedEmail Returns the email whose normalized address is the given one upper cased
+func (s *Store) EmailByNormalizedEmail(email string) (domain.UserEmail, bool) {
+	normalized := strings.ToUpper(email)
+	for _, userEmail := range s.UserEmails {
+		if userEmail.NormalizedEmail == normalized {
+			return userEmail, true
+		}
+	}
+	return domain.UserEmail{}, false
+}
+
+// EmailByUserID Returns the first email the user added that wasn't deleted
+func (s *Store) EmailByUserID(userID int64) (domain.UserEmail, bool) {
+	var found domain.UserEmail
+	for _, userEmail := range s.UserEmails {
+		if userEmail.UserId == userID && !userEmail.DateDeleted.Valid && (found.UserEmailId == 0 || userEmail.UserEmailId < found.UserEmailId) {
+			found = userEmail
+		}
+	}
+	return found, found.UserEmailId != 0
+}
+
+// DeleteUser Removes the user and, like the foreign keys cascade, every row that belongs to them. Returns false if
+// the user doesn't exist
+func (s *Store) DeleteUser(userID int64) bool {
+	if _, ok := s.Users[userID]; !ok {
+		return false
+	}
+
+	delete(s.Users, userID)
+	for id, userEmail := range s.UserEmails {
+		if userEmail.UserId == userID {
+			delete(s.UserEmails, id)
+		}
+	}
+	for id, token := range s.RefreshTokens {
+		if token.UserId == userID {
+			delete(s.RefreshTokens, id)
+		}
+	}
+	for id, session := range s.Sessions {
+		if session.UserId == userID {
+			delete(s.Sessions, id)
+		}
+	}
+	for id, link := range s.MagicLinks {
+		if link.UserId == userID {
+			delete(s.MagicLinks, id)
+		}
+	}
+	for id, reset := range s.PasswordResets {
+		if reset.UserId == userID {
+			delete(s.PasswordResets, id)
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// Open Connects to the database configured in opts. The queries of the repositories are written with ? placeholders
+// and standard SQL, and are adapted to the dialect with Rebind
+func Open(opts *config.DatabaseOptions) (*sqlx.DB, error) {
+	if opts == nil {
+		return nil, errors.New("database options can't be nil")
+	}
+
+	dsn, err := dataSourceName(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sqlx.Open(opts.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Driver == config.DatabaseDriverSQLite {
+		// SQLite has a single writer, sharing one connection avoids "database is locked" errors
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close() // nolint
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// dataSourceName Returns the DSN for the driver. The dates are scanned into sql.NullTime so MySQL always needs
+// parseTime, even in a DSN given as is
+func dataSourceName(opts *config.DatabaseOptions) (string, error) {
+	switch opts.Driver {
+	case config.DatabaseDriverMySQL:
+		cfg := mysql.NewConfig()
+		if opts.DSN != "" {
+			var err error
+			cfg, err = mysql.ParseDSN(opts.DSN)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			cfg.User = opts.Username
+			cfg.Passwd = opts.Password
+			cfg.Net = "tcp"
+			cfg.Addr = net.JoinHostPort(opts.Hostname, opts.Port)
+			cfg.DBName = opts.Name
+		}
+		cfg.ParseTime = true
+		return cfg.FormatDSN(), nil
+	case config.DatabaseDriverPostgres:
+		if opts.DSN != "" {
+			return opts.DSN, nil
+		}
+		u := url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(opts.Username, opts.Password),
+			Host:   net.JoinHostPort(opts.Hostname, opts.Port),
+			Path:   "/" + opts.Name,
+		}
+		return u.String(), nil
+	case config.DatabaseDriverSQLite:
+		if opts.DSN != "" {
+			return opts.DSN, nil
+		}
+		if opts.Name == "" {
+			return "", errors.New("the sqlite database needs a file name")
+		}
+		return "file:" + opts.Name + "?_pragma=foreign_keys(1)", nil
+	default:
+		return "", fmt.Errorf("unknown database driver %s", opts.Driver)
+	}
+}
+
+// Dialect Returns which of the supported databases db is connected to, or its driver name if it's none of them
+func Dialect(db sqlx.ExtContext) string {
+	switch db.DriverName() {
+	case "postgres", "pgx":
+		return config.DatabaseDriverPostgres
+	case "sqlite3":
+		return config.DatabaseDriverSQLite
+	default:
+		return db.DriverName()
+	}
+}
+
+// InsertID Runs an INSERT and returns the id the database generated in idColumn. PostgreSQL doesn't support
+// LastInsertId so the id is read with RETURNING instead
+func InsertID(ctx context.Context, db sqlx.ExtContext, idColumn string, query string, args ...interface{}) (int64, error) {
+	if Dialect(db) == config.DatabaseDriverPostgres {
+		var id int64
+		err := sqlx.GetContext(ctx, db, &id, db.Rebind(query+" RETURNING "+idColumn), args...)
+		return id, err
+	}
+
+	res, err := db.ExecContext(ctx, db.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+// WithTimeout Returns ctx bounded by timeout, each query of a repository gets its own so a slow database doesn't hold
+// the request forever. A zero timeout leaves only the deadline ctx already had
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
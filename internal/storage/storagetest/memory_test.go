@@ -0,0 +1,25 @@
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/CienciaArgentina/go-enigma/internal/login"
+	"github.com/CienciaArgentina/go-enigma/internal/recovery"
+	"github.com/CienciaArgentina/go-enigma/internal/register"
+	"github.com/CienciaArgentina/go-enigma/internal/revocation"
+	"github.com/CienciaArgentina/go-enigma/internal/storage/memory"
+	"github.com/CienciaArgentina/go-enigma/internal/users"
+)
+
+func TestMemory(t *testing.T) {
+	Run(t, func(t *testing.T) *Backend {
+		store := memory.NewStore()
+		return &Backend{
+			Users:       users.NewMemoryStore(store),
+			Login:       login.NewMemoryRepository(store),
+			Register:    register.NewMemoryRepository(store),
+			Recovery:    recovery.NewMemoryRepository(store),
+			Revocations: revocation.NewMemoryStore(),
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package storagetest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/login"
+	"github.com/CienciaArgentina/go-enigma/internal/mfa"
+	"github.com/CienciaArgentina/go-enigma/internal/migrations"
+	"github.com/CienciaArgentina/go-enigma/internal/recovery"
+	"github.com/CienciaArgentina/go-enigma/internal/register"
+	"github.com/CienciaArgentina/go-enigma/internal/revocation"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
+	"github.com/CienciaArgentina/go-enigma/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSQLite Runs the suite against a SQLite database in a temporary file, migrated like any other. SQLite compares
+// dates as text so, like Enigma, the suite runs in UTC
+func TestSQLite(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	runSQL(t, &config.DatabaseOptions{Driver: config.DatabaseDriverSQLite, Name: filepath.Join(t.TempDir(), "enigma.db")})
+}
+
+// TestSQL Runs the suite against the database of ENIGMA_TEST_DB_DRIVER and ENIGMA_TEST_DB_DSN, migrating it first.
+// Use a database just for the tests, the rows they add aren't deleted.
+func TestSQL(t *testing.T) {
+	driver, dsn := os.Getenv("ENIGMA_TEST_DB_DRIVER"), os.Getenv("ENIGMA_TEST_DB_DSN")
+	if driver == "" || dsn == "" {
+		t.Skip("ENIGMA_TEST_DB_DRIVER and ENIGMA_TEST_DB_DSN aren't set")
+	}
+
+	runSQL(t, &config.DatabaseOptions{Driver: driver, DSN: dsn})
+}
+
+func runSQL(t *testing.T, opts *config.DatabaseOptions) {
+	db, err := storage.Open(opts)
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	Run(t, func(t *testing.T) *Backend {
+		return &Backend{
+			Users:       users.NewRepository(db, time.Minute),
+			Login:       login.NewRepository(db, time.Minute),
+			Register:    register.NewRepository(db, time.Minute),
+			Recovery:    recovery.NewRepository(db, time.Minute),
+			Revocations: revocation.NewRepository(db, time.Minute),
+			MFA:         mfa.NewRepository(db, time.Minute),
+			DB:          db,
+		}
+	})
+}
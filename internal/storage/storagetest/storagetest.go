@@ -0,0 +1,560 @@
+// Package storagetest Conformance suite every implementation of the user store, the login, register and recovery
+// repositories and the revocation store has to pass, so the in-memory store and the SQL databases can be swapped
+// without the services noticing.
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/internal/login"
+	"github.com/CienciaArgentina/go-enigma/internal/mfa"
+	"github.com/CienciaArgentina/go-enigma/internal/recovery"
+	"github.com/CienciaArgentina/go-enigma/internal/register"
+	"github.com/CienciaArgentina/go-enigma/internal/revocation"
+	"github.com/CienciaArgentina/go-enigma/internal/users"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// Backend Repositories under test. DB is the database behind them, nil for the ones that don't need a transaction
+// to register users.
+type Backend struct {
+	Users       users.UserStore
+	Login       login.Repository
+	Register    register.RegisterRepository
+	Recovery    recovery.RecoveryRepository
+	Revocations revocation.Store
+	// MFA is nil for the backends that don't implement it
+	MFA mfa.Repository
+	DB  *sqlx.DB
+}
+
+var sequence int64
+
+// unique Returns a name no other test used, the SQL databases keep the rows of previous runs
+func unique(prefix string) string {
+	return fmt.Sprintf("%s%d_%d", prefix, time.Now().UnixNano()%1e9, atomic.AddInt64(&sequence, 1))
+}
+
+// Run Runs the suite against the repositories newBackend returns
+func Run(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, b *Backend)
+	}{
+		{name: "register_unique_username", test: testRegisterUniqueUsername},
+		{name: "register_unique_email", test: testRegisterUniqueEmail},
+		{name: "register_delete_user", test: testRegisterDeleteUser},
+		{name: "users_lookups", test: testUsersLookups},
+		{name: "users_exists_ignores_case", test: testUsersExistsIgnoresCase},
+		{name: "login_lockout", test: testLoginLockout},
+		{name: "login_refresh_tokens", test: testLoginRefreshTokens},
+		{name: "login_sessions", test: testLoginSessions},
+		{name: "login_magic_links", test: testLoginMagicLinks},
+		{name: "recovery_confirm_email", test: testRecoveryConfirmEmail},
+		{name: "recovery_tokens", test: testRecoveryTokens},
+		{name: "recovery_password_resets", test: testRecoveryPasswordResets},
+		{name: "revocations_revoke_twice", test: testRevocationsRevokeTwice},
+		{name: "mfa_recovery_codes", test: testMFARecoveryCodes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newBackend(t))
+		})
+	}
+}
+
+// addUser Registers a user with an email, the way the register service does, and returns them
+func addUser(t *testing.T, b *Backend) (*domain.User, *domain.UserEmail) {
+	username := unique("User")
+	user := &domain.User{
+		Username:           username,
+		NormalizedUsername: strings.ToUpper(username),
+		PasswordHash:       "hash",
+		SecurityToken:      sql.NullString{String: unique("stamp"), Valid: true},
+		VerificationToken:  unique("verification"),
+	}
+	email := &domain.UserEmail{Email: username + "@Example.com", NormalizedEmail: strings.ToUpper(username + "@Example.com")}
+
+	var tx *sqlx.Tx
+	if b.DB != nil {
+		tx = b.DB.MustBegin()
+	}
+
+	var err error
+	user.AuthId, err = b.Register.AddUser(context.Background(), tx, user)
+	require.NoError(t, err)
+
+	email.UserId = user.AuthId
+	email.UserEmailId, err = b.Register.AddUserEmail(context.Background(), tx, email)
+	require.NoError(t, err)
+
+	if tx != nil {
+		require.NoError(t, tx.Commit())
+	}
+
+	return user, email
+}
+
+// commit Runs fn in a transaction of the database, if there is one, committing it when fn doesn't fail
+func commit(t *testing.T, b *Backend, fn func(tx *sqlx.Tx) error) error {
+	var tx *sqlx.Tx
+	if b.DB != nil {
+		tx = b.DB.MustBegin()
+	}
+
+	err := fn(tx)
+	if tx != nil {
+		if err != nil {
+			tx.Rollback() // nolint
+		} else {
+			require.NoError(t, tx.Commit())
+		}
+	}
+
+	return err
+}
+
+func testRegisterUniqueUsername(t *testing.T, b *Backend) {
+	user, _ := addUser(t, b)
+
+	err := commit(t, b, func(tx *sqlx.Tx) error {
+		_, err := b.Register.AddUser(context.Background(), tx, &domain.User{
+			Username:           strings.ToLower(user.Username),
+			NormalizedUsername: user.NormalizedUsername,
+			PasswordHash:       "hash",
+			VerificationToken:  unique("verification"),
+		})
+		return err
+	})
+	require.Error(t, err)
+}
+
+func testRegisterUniqueEmail(t *testing.T, b *Backend) {
+	_, email := addUser(t, b)
+	other, _ := addUser(t, b)
+
+	err := commit(t, b, func(tx *sqlx.Tx) error {
+		_, err := b.Register.AddUserEmail(context.Background(), tx, &domain.UserEmail{UserId: other.AuthId, Email: email.Email, NormalizedEmail: email.NormalizedEmail})
+		return err
+	})
+	require.Error(t, err)
+
+	err = commit(t, b, func(tx *sqlx.Tx) error {
+		_, err := b.Register.AddUserEmail(context.Background(), tx, &domain.UserEmail{UserId: -1, Email: unique("nobody"), NormalizedEmail: unique("NOBODY")})
+		return err
+	})
+	require.Error(t, err, "emails of users that don't exist are rejected")
+}
+
+func testRegisterDeleteUser(t *testing.T, b *Backend) {
+	user, email := addUser(t, b)
+	require.NoError(t, b.Login.AddSession(context.Background(), &domain.Session{SessionId: unique("session"), UserId: user.AuthId}))
+
+	require.NoError(t, b.Register.DeleteUser(context.Background(), user.AuthId))
+	require.Error(t, b.Register.DeleteUser(context.Background(), user.AuthId), "the user was already deleted")
+
+	exists, err := b.Users.EmailExists(context.Background(), email.Email)
+	require.NoError(t, err)
+	require.False(t, exists, "the emails are deleted along with the user")
+
+	_, err = b.Users.GetUser(context.Background(), user.AuthId)
+	require.True(t, errors.Is(err, users.ErrUserNotFound))
+}
+
+func testUsersLookups(t *testing.T, b *Backend) {
+	user, email := addUser(t, b)
+	ctx := context.Background()
+
+	for name, lookup := range map[string]func() (*domain.User, error){
+		"user_id":  func() (*domain.User, error) { return b.Users.GetUser(ctx, user.AuthId) },
+		"username": func() (*domain.User, error) { return b.Users.GetUserByUsername(ctx, user.Username) },
+		"email":    func() (*domain.User, error) { return b.Users.GetUserByEmail(ctx, strings.ToLower(email.Email)) },
+	} {
+		got, err := lookup()
+		require.NoError(t, err, name)
+		require.Equal(t, user.AuthId, got.AuthId, name)
+		require.Equal(t, user.Username, got.Username, name)
+		require.Equal(t, user.PasswordHash, got.PasswordHash, name)
+		require.Equal(t, user.SecurityToken, got.SecurityToken, name)
+		require.Equal(t, user.VerificationToken, got.VerificationToken, name)
+	}
+
+	got, err := b.Users.GetEmail(ctx, user.AuthId)
+	require.NoError(t, err)
+	require.Equal(t, email.UserEmailId, got.UserEmailId)
+	require.Equal(t, email.Email, got.Email)
+	require.False(t, got.VerfiedEmail)
+
+	_, err = b.Users.GetUser(ctx, -1)
+	require.True(t, errors.Is(err, users.ErrUserNotFound))
+	_, err = b.Users.GetUserByUsername(ctx, unique("missing"))
+	require.True(t, errors.Is(err, users.ErrUserNotFound))
+	_, err = b.Users.GetUserByEmail(ctx, unique("missing")+"@example.com")
+	require.True(t, errors.Is(err, users.ErrUserNotFound))
+	_, err = b.Users.GetEmail(ctx, -1)
+	require.True(t, errors.Is(err, users.ErrEmailNotFound))
+}
+
+func testUsersExistsIgnoresCase(t *testing.T, b *Backend) {
+	user, email := addUser(t, b)
+
+	exists, err := b.Users.UsernameExists(context.Background(), strings.ToLower(user.Username))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = b.Users.EmailExists(context.Background(), strings.ToLower(email.Email))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = b.Users.UsernameExists(context.Background(), unique("missing"))
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	exists, err = b.Users.EmailExists(context.Background(), unique("missing")+"@example.com")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+// getUser Returns the user as stored
+func getUser(t *testing.T, b *Backend, userID int64) *domain.User {
+	user, err := b.Users.GetUser(context.Background(), userID)
+	require.NoError(t, err)
+	return user
+}
+
+func testLoginLockout(t *testing.T, b *Backend) {
+	user, _ := addUser(t, b)
+
+	require.NoError(t, b.Login.IncrementLoginFailAttempt(context.Background(), user.AuthId))
+	require.NoError(t, b.Login.IncrementLoginFailAttempt(context.Background(), user.AuthId))
+	got := getUser(t, b, user.AuthId)
+	require.Equal(t, 2, got.FailedLoginAttempts)
+	require.False(t, got.LockoutEnabled)
+	require.False(t, got.LockoutDate.Valid)
+
+	require.NoError(t, b.Login.ResetLoginFails(context.Background(), user.AuthId))
+	got = getUser(t, b, user.AuthId)
+	require.Equal(t, 0, got.FailedLoginAttempts)
+
+	require.NoError(t, b.Login.IncrementLoginFailAttempt(context.Background(), user.AuthId))
+	require.NoError(t, b.Login.LockAccount(context.Background(), user.AuthId, time.Hour))
+	got = getUser(t, b, user.AuthId)
+	require.True(t, got.LockoutEnabled)
+	require.True(t, got.LockoutDate.Valid)
+	require.WithinDuration(t, time.Now().Add(time.Hour), got.LockoutDate.Time, time.Minute)
+
+	require.NoError(t, b.Login.UnlockAccount(context.Background(), user.AuthId))
+	got = getUser(t, b, user.AuthId)
+	require.False(t, got.LockoutEnabled)
+	require.False(t, got.LockoutDate.Valid)
+	require.Equal(t, 0, got.FailedLoginAttempts)
+
+	require.NoError(t, b.Login.UpdatePasswordHash(context.Background(), user.AuthId, "new_hash"))
+	got = getUser(t, b, user.AuthId)
+	require.Equal(t, "new_hash", got.PasswordHash)
+
+	require.NoError(t, b.Login.IncrementLoginFailAttempt(context.Background(), -1), "updating a user that doesn't exist isn't an error")
+}
+
+func testLoginRefreshTokens(t *testing.T, b *Backend) {
+	user, _ := addUser(t, b)
+	family := unique("family")
+	now := time.Now()
+
+	active := &domain.RefreshToken{
+		UserId:                user.AuthId,
+		FamilyId:              family,
+		TokenHash:             unique("hash"),
+		ExpiryDate:            sql.NullTime{Time: now.Add(time.Hour), Valid: true},
+		AccessTokenId:         unique("jti"),
+		AccessTokenExpiryDate: sql.NullTime{Time: now.Add(time.Hour), Valid: true},
+	}
+	require.NoError(t, b.Login.AddRefreshToken(context.Background(), active))
+	require.NotZero(t, active.RefreshTokenId)
+
+	expired := &domain.RefreshToken{
+		UserId:                user.AuthId,
+		FamilyId:              family,
+		TokenHash:             unique("hash"),
+		ExpiryDate:            sql.NullTime{Time: now.Add(time.Hour), Valid: true},
+		AccessTokenId:         unique("jti"),
+		AccessTokenExpiryDate: sql.NullTime{Time: now.Add(-time.Hour), Valid: true},
+	}
+	require.NoError(t, b.Login.AddRefreshToken(context.Background(), expired))
+
+	require.Error(t, b.Login.AddRefreshToken(context.Background(), &domain.RefreshToken{UserId: user.AuthId, FamilyId: family, TokenHash: active.TokenHash}),
+		"token hashes are unique")
+
+	got, err := b.Login.GetRefreshToken(context.Background(), active.TokenHash)
+	require.NoError(t, err)
+	require.Equal(t, active.RefreshTokenId, got.RefreshTokenId)
+	require.Equal(t, family, got.FamilyId)
+	require.Equal(t, active.AccessTokenId, got.AccessTokenId)
+	require.False(t, got.DateRevoked.Valid)
+
+	got, err = b.Login.GetRefreshToken(context.Background(), unique("missing"))
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	tokens, err := b.Login.GetFamilyAccessTokens(context.Background(), family)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1, "only the tokens whose access token didn't expire")
+	require.Equal(t, active.AccessTokenId, tokens[0].AccessTokenId)
+
+	tokens, err = b.Login.GetUserAccessTokens(context.Background(), user.AuthId)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+
+	revoked, err := b.Login.RevokeRefreshToken(context.Background(), active.RefreshTokenId)
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	revoked, err = b.Login.RevokeRefreshToken(context.Background(), active.RefreshTokenId)
+	require.NoError(t, err)
+	require.False(t, revoked, "a token is revoked only once")
+
+	require.NoError(t, b.Login.RevokeRefreshTokenFamily(context.Background(), family))
+	got, _ = b.Login.GetRefreshToken(context.Background(), expired.TokenHash)
+	require.True(t, got.DateRevoked.Valid)
+
+	other := &domain.RefreshToken{UserId: user.AuthId, FamilyId: unique("family"), TokenHash: unique("hash"), ExpiryDate: sql.NullTime{Time: now.Add(time.Hour), Valid: true}}
+	require.NoError(t, b.Login.AddRefreshToken(context.Background(), other))
+	require.NoError(t, b.Login.RevokeUserRefreshTokens(context.Background(), user.AuthId))
+	got, _ = b.Login.GetRefreshToken(context.Background(), other.TokenHash)
+	require.True(t, got.DateRevoked.Valid)
+}
+
+func testLoginSessions(t *testing.T, b *Backend) {
+	user, _ := addUser(t, b)
+	since := time.Now().Add(-time.Hour)
+
+	first := &domain.Session{SessionId: unique("session"), UserId: user.AuthId, UserAgent: "Firefox", IPAddress: "127.0.0.1"}
+	second := &domain.Session{SessionId: unique("session"), UserId: user.AuthId, UserAgent: "curl", IPAddress: "::1"}
+	require.NoError(t, b.Login.AddSession(context.Background(), first))
+	require.NoError(t, b.Login.AddSession(context.Background(), second))
+	require.Error(t, b.Login.AddSession(context.Background(), first), "session ids are unique")
+
+	got, err := b.Login.GetSession(context.Background(), first.SessionId)
+	require.NoError(t, err)
+	require.Equal(t, user.AuthId, got.UserId)
+	require.Equal(t, "Firefox", got.UserAgent)
+	require.Equal(t, "127.0.0.1", got.IPAddress)
+	require.NotEmpty(t, got.DateCreated)
+	require.NotEmpty(t, got.DateLastRefresh)
+
+	got, err = b.Login.GetSession(context.Background(), unique("missing"))
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	require.NoError(t, b.Login.UpdateSessionLastRefresh(context.Background(), first.SessionId))
+
+	sessions, err := b.Login.GetUserSessions(context.Background(), user.AuthId, since)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{first.SessionId, second.SessionId}, sessionIDs(sessions))
+
+	sessions, err = b.Login.GetUserSessions(context.Background(), user.AuthId, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, sessions, "sessions not refreshed since then are left out")
+
+	require.NoError(t, b.Login.RevokeSession(context.Background(), second.SessionId))
+	sessions, err = b.Login.GetUserSessions(context.Background(), user.AuthId, since)
+	require.NoError(t, err)
+	require.Equal(t, []string{first.SessionId}, sessionIDs(sessions))
+
+	require.NoError(t, b.Login.RevokeUserSessions(context.Background(), user.AuthId))
+	sessions, err = b.Login.GetUserSessions(context.Background(), user.AuthId, since)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+
+	got, _ = b.Login.GetSession(context.Background(), first.SessionId)
+	require.True(t, got.DateRevoked.Valid)
+}
+
+func sessionIDs(sessions []domain.Session) []string {
+	var ids []string
+	for _, session := range sessions {
+		ids = append(ids, session.SessionId)
+	}
+	return ids
+}
+
+func testLoginMagicLinks(t *testing.T, b *Backend) {
+	user, _ := addUser(t, b)
+
+	link := &domain.MagicLink{UserId: user.AuthId, TokenHash: unique("hash"), ExpiryDate: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}}
+	require.NoError(t, b.Login.AddMagicLink(context.Background(), link))
+	require.Error(t, b.Login.AddMagicLink(context.Background(), link), "token hashes are unique")
+
+	got, err := b.Login.GetMagicLink(context.Background(), link.TokenHash)
+	require.NoError(t, err)
+	require.Equal(t, user.AuthId, got.UserId)
+	require.True(t, got.ExpiryDate.Valid)
+	require.False(t, got.DateUsed.Valid)
+
+	used, err := b.Login.UseMagicLink(context.Background(), got.MagicLinkId)
+	require.NoError(t, err)
+	require.True(t, used)
+
+	used, err = b.Login.UseMagicLink(context.Background(), got.MagicLinkId)
+	require.NoError(t, err)
+	require.False(t, used, "a link is used only once")
+
+	got, err = b.Login.GetMagicLink(context.Background(), unique("missing"))
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
+
+func testRecoveryConfirmEmail(t *testing.T, b *Backend) {
+	user, email := addUser(t, b)
+
+	apiErr := b.Recovery.ConfirmUserEmail(context.Background(), email.Email, "wrong")
+	require.NotNil(t, apiErr)
+	require.Equal(t, recovery.ErrValidationTokenFailed, apiErr.Message())
+
+	require.Nil(t, b.Recovery.ConfirmUserEmail(context.Background(), strings.ToLower(email.Email), user.VerificationToken))
+
+	apiErr = b.Recovery.ConfirmUserEmail(context.Background(), email.Email, user.VerificationToken)
+	require.NotNil(t, apiErr)
+	require.Equal(t, recovery.ErrEmailAlreadyverified, apiErr.Message())
+
+	got, err := b.Users.GetEmail(context.Background(), user.AuthId)
+	require.NoError(t, err)
+	require.True(t, got.VerfiedEmail)
+	require.True(t, got.VerificationDate.Valid)
+
+	require.Equal(t, user.SecurityToken.String, getUser(t, b, user.AuthId).SecurityToken.String)
+
+	apiErr = b.Recovery.ConfirmUserEmail(context.Background(), unique("missing")+"@example.com", "token")
+	require.NotNil(t, apiErr)
+	require.Equal(t, recovery.ErrNoUserEmail, apiErr.Message())
+}
+
+func testRecoveryTokens(t *testing.T, b *Backend) {
+	user, _ := addUser(t, b)
+
+	token := unique("verification")
+	require.Nil(t, b.Recovery.UpdateVerificationToken(context.Background(), user.AuthId, token))
+	require.Equal(t, token, getUser(t, b, user.AuthId).VerificationToken)
+	require.NotNil(t, b.Recovery.UpdateVerificationToken(context.Background(), user.AuthId, ""))
+	require.NotNil(t, b.Recovery.UpdateVerificationToken(context.Background(), -1, unique("verification")))
+
+	stamp := unique("stamp")
+	updated, apiErr := b.Recovery.UpdatePasswordHash(context.Background(), user.AuthId, "new_hash", stamp)
+	require.Nil(t, apiErr)
+	require.True(t, updated)
+
+	usr := getUser(t, b, user.AuthId)
+	require.Equal(t, "new_hash", usr.PasswordHash)
+	require.Equal(t, stamp, usr.SecurityToken.String)
+
+	_, apiErr = b.Recovery.UpdatePasswordHash(context.Background(), -1, "new_hash", unique("stamp"))
+	require.NotNil(t, apiErr)
+	_, apiErr = b.Recovery.UpdatePasswordHash(context.Background(), user.AuthId, "new_hash", "")
+	require.NotNil(t, apiErr)
+}
+
+func testRecoveryPasswordResets(t *testing.T, b *Backend) {
+	user, _ := addUser(t, b)
+	expiry := sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+
+	first := &domain.PasswordReset{UserId: user.AuthId, TokenHash: unique("hash"), ExpiryDate: expiry}
+	second := &domain.PasswordReset{UserId: user.AuthId, TokenHash: unique("hash"), ExpiryDate: expiry}
+	require.Nil(t, b.Recovery.AddPasswordReset(context.Background(), first))
+	require.Nil(t, b.Recovery.AddPasswordReset(context.Background(), second))
+	require.NotNil(t, b.Recovery.AddPasswordReset(context.Background(), &domain.PasswordReset{UserId: -1, TokenHash: unique("hash"), ExpiryDate: expiry}),
+		"resets of users that don't exist are rejected")
+
+	got, apiErr := b.Recovery.GetPasswordReset(context.Background(), first.TokenHash)
+	require.Nil(t, apiErr)
+	require.Equal(t, user.AuthId, got.UserId)
+	require.False(t, got.DateUsed.Valid)
+
+	used, apiErr := b.Recovery.UsePasswordReset(context.Background(), got)
+	require.Nil(t, apiErr)
+	require.True(t, used)
+
+	used, apiErr = b.Recovery.UsePasswordReset(context.Background(), got)
+	require.Nil(t, apiErr)
+	require.False(t, used, "a reset is used only once")
+
+	got, apiErr = b.Recovery.GetPasswordReset(context.Background(), second.TokenHash)
+	require.Nil(t, apiErr)
+	require.True(t, got.DateUsed.Valid, "using a reset invalidates the other ones of the user")
+
+	got, apiErr = b.Recovery.GetPasswordReset(context.Background(), unique("missing"))
+	require.Nil(t, apiErr)
+	require.Nil(t, got)
+}
+
+// testRevocationsRevokeTwice Logging out revokes the tokens of the session and the current one, which can be the same
+func testRevocationsRevokeTwice(t *testing.T, b *Backend) {
+	ctx := context.Background()
+	jti := unique("jti")
+	expiresAt := time.Now().Add(time.Hour)
+
+	require.NoError(t, b.Revocations.Revoke(ctx, jti, expiresAt))
+	require.NoError(t, b.Revocations.Revoke(ctx, jti, expiresAt), "revoking a jti again isn't an error")
+
+	revoked, err := b.Revocations.IsRevoked(ctx, jti)
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	revoked, err = b.Revocations.IsRevoked(ctx, unique("jti"))
+	require.NoError(t, err)
+	require.False(t, revoked)
+}
+
+// testMFARecoveryCodes The recovery codes are stored as the encoded hashes of the password hasher, which are much
+// longer than a plain digest
+func testMFARecoveryCodes(t *testing.T, b *Backend) {
+	if b.MFA == nil {
+		t.Skip("the backend doesn't implement the mfa repository")
+	}
+
+	ctx := context.Background()
+	user, _ := addUser(t, b)
+	cfg := &config.EnigmaConfig{
+		Keys:        &config.Keys{PasswordHashingKey: "key"},
+		ArgonParams: &config.ArgonParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 32, KeyLength: 32},
+	}
+
+	var hashes []string
+	for i := 0; i < 2; i++ {
+		code, err := encryption.GenerateRecoveryCode()
+		require.NoError(t, err)
+		hash, err := encryption.GenerateEncodedHash(encryption.NormalizeRecoveryCode(code), cfg)
+		require.NoError(t, err)
+		require.Greater(t, len(hash), 64)
+		hashes = append(hashes, hash)
+	}
+
+	require.NoError(t, b.MFA.SaveMFA(ctx, user.AuthId, "secret"))
+	require.NoError(t, b.MFA.ReplaceRecoveryCodes(ctx, user.AuthId, hashes))
+
+	codes, err := b.MFA.GetRecoveryCodes(ctx, user.AuthId)
+	require.NoError(t, err)
+	require.Len(t, codes, len(hashes))
+	for _, c := range codes {
+		require.Contains(t, hashes, c.CodeHash)
+	}
+
+	used, err := b.MFA.UseRecoveryCode(ctx, codes[0].RecoveryCodeId)
+	require.NoError(t, err)
+	require.True(t, used)
+
+	codes, err = b.MFA.GetRecoveryCodes(ctx, user.AuthId)
+	require.NoError(t, err)
+	require.Len(t, codes, len(hashes)-1)
+}
@@ -0,0 +1,35 @@
+package users
+
+import (
+	"context"
+	"errors"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+)
+
+var (
+	// ErrUserNotFound Returned by the lookups when no user matches
+	ErrUserNotFound = errors.New("user not found")
+	// ErrEmailNotFound Returned by GetEmail when the user has no email
+	ErrEmailNotFound = errors.New("email not found")
+)
+
+// UserStore Lookups of users and their emails shared by login, register and recovery, which depend on the part they
+// use. Usernames and emails are compared normalized, the way register stores them, and emails that were deleted are
+// never found. Any other error is the one of the database.
+type UserStore interface {
+	GetUser(ctx context.Context, userID int64) (*domain.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	// GetEmail Returns the first email the user added
+	GetEmail(ctx context.Context, userID int64) (*domain.UserEmail, error)
+	// UsernameExists Whether the username is taken
+	UsernameExists(ctx context.Context, username string) (bool, error)
+	// EmailExists Whether the email is taken, deleted ones included so nobody can register them again
+	EmailExists(ctx context.Context, email string) (bool, error)
+}
+
+// IsNotFound Whether the error means the user or their email don't exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrEmailNotFound)
+}
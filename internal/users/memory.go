@@ -0,0 +1,87 @@
+package users
+
+import (
+	"context"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage/memory"
+)
+
+type memoryStore struct {
+	store *memory.Store
+}
+
+// NewMemoryStore Returns a user store that looks the users up in store, along with the memory repositories of login,
+// register and recovery
+func NewMemoryStore(store *memory.Store) UserStore {
+	return &memoryStore{store: store}
+}
+
+func (m *memoryStore) GetUser(ctx context.Context, userID int64) (*domain.User, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	user, ok := m.store.Users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return &user, nil
+}
+
+func (m *memoryStore) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	user, ok := m.store.UserByUsername(username)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return &user, nil
+}
+
+func (m *memoryStore) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	userEmail, ok := m.store.EmailByNormalizedEmail(email)
+	if !ok || userEmail.DateDeleted.Valid {
+		return nil, ErrUserNotFound
+	}
+
+	user, ok := m.store.Users[userEmail.UserId]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return &user, nil
+}
+
+func (m *memoryStore) GetEmail(ctx context.Context, userID int64) (*domain.UserEmail, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	userEmail, ok := m.store.EmailByUserID(userID)
+	if !ok {
+		return nil, ErrEmailNotFound
+	}
+
+	return &userEmail, nil
+}
+
+func (m *memoryStore) UsernameExists(ctx context.Context, username string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	_, ok := m.store.UserByNormalizedUsername(username)
+	return ok, nil
+}
+
+func (m *memoryStore) EmailExists(ctx context.Context, email string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	_, ok := m.store.EmailByNormalizedEmail(email)
+	return ok, nil
+}
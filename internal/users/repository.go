@@ -0,0 +1,104 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+type userRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewRepository Returns a user store backed by the users and users_email tables, whose queries give up after timeout
+func NewRepository(db *sqlx.DB, timeout time.Duration) UserStore {
+	return &userRepository{db: db, timeout: timeout}
+}
+
+// GetUser Returns the user with the given ID
+func (u *userRepository) GetUser(ctx context.Context, userID int64) (*domain.User, error) {
+	return u.getUser(ctx, "SELECT * FROM users WHERE user_id = ?", userID)
+}
+
+// GetUserByUsername Returns the user with the given username, compared on the username column like login always did
+func (u *userRepository) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	return u.getUser(ctx, "SELECT * FROM users WHERE username = ?", username)
+}
+
+// GetUserByEmail Returns the user the given email belongs to
+func (u *userRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return u.getUser(ctx, "SELECT u.* FROM users u INNER JOIN users_email e ON e.user_id = u.user_id WHERE e.normalized_email = ? AND e.date_deleted IS NULL",
+		strings.ToUpper(email))
+}
+
+// getUser Runs a query that returns one user
+func (u *userRepository) getUser(ctx context.Context, query string, arg interface{}) (*domain.User, error) {
+	var user domain.User
+
+	ctx, cancel := storage.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	err := u.db.GetContext(ctx, &user, u.db.Rebind(query), arg)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetEmail Returns the first email the user added that wasn't deleted
+func (u *userRepository) GetEmail(ctx context.Context, userID int64) (*domain.UserEmail, error) {
+	var userEmail domain.UserEmail
+
+	ctx, cancel := storage.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	err := u.db.GetContext(ctx, &userEmail, u.db.Rebind("SELECT * FROM users_email WHERE user_id = ? AND date_deleted IS NULL ORDER BY user_email_id LIMIT 1"), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrEmailNotFound
+		}
+		return nil, err
+	}
+
+	return &userEmail, nil
+}
+
+// UsernameExists Whether a user has the username
+func (u *userRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+	var count int
+
+	ctx, cancel := storage.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	err := u.db.GetContext(ctx, &count, u.db.Rebind("SELECT count(*) FROM users WHERE normalized_username = ?"), strings.ToUpper(username))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// EmailExists Whether the email was added by any user
+func (u *userRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	var count int
+
+	ctx, cancel := storage.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	err := u.db.GetContext(ctx, &count, u.db.Rebind("SELECT count(*) FROM users_email WHERE normalized_email = ?"), strings.ToUpper(email))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
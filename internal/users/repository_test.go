@@ -0,0 +1,232 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_userRepository_GetUser(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+	user := &domain.User{AuthId: 123, Username: "test"}
+
+	tests := []struct {
+		name     string
+		query    string
+		arg      interface{}
+		lookup   func() (*domain.User, error)
+		expected *domain.User
+		wantErr  error
+		err      error
+	}{
+		{
+			name:     "user_id",
+			query:    "SELECT * FROM users WHERE user_id = ?",
+			arg:      123,
+			lookup:   func() (*domain.User, error) { return r.GetUser(context.Background(), 123) },
+			expected: user,
+		},
+		{
+			name:     "username",
+			query:    "SELECT * FROM users WHERE username = ?",
+			arg:      "Test",
+			lookup:   func() (*domain.User, error) { return r.GetUserByUsername(context.Background(), "Test") },
+			expected: user,
+		},
+		{
+			name:     "email",
+			query:    "SELECT u.* FROM users u INNER JOIN users_email e ON e.user_id = u.user_id WHERE e.normalized_email = ? AND e.date_deleted IS NULL",
+			arg:      "TEST@TEST.COM",
+			lookup:   func() (*domain.User, error) { return r.GetUserByEmail(context.Background(), "Test@test.com") },
+			expected: user,
+		},
+		{
+			name:    "not_found",
+			query:   "SELECT * FROM users WHERE user_id = ?",
+			arg:     123,
+			lookup:  func() (*domain.User, error) { return r.GetUser(context.Background(), 123) },
+			err:     sql.ErrNoRows,
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name:    "internal_error",
+			query:   "SELECT * FROM users WHERE username = ?",
+			arg:     "test",
+			lookup:  func() (*domain.User, error) { return r.GetUserByUsername(context.Background(), "test") },
+			err:     errors.New("internal_error"),
+			wantErr: errors.New("internal_error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err != nil {
+				mock.ExpectQuery(tt.query).WithArgs(tt.arg).WillReturnError(tt.err)
+			} else {
+				rows := sqlmock.NewRows([]string{"user_id", "username"}).AddRow(123, "test")
+				mock.ExpectQuery(tt.query).WithArgs(tt.arg).WillReturnRows(rows)
+			}
+
+			got, err := tt.lookup()
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("userRepository lookup error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("userRepository lookup got = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_userRepository_GetEmail(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "SELECT * FROM users_email WHERE user_id = ? AND date_deleted IS NULL ORDER BY user_email_id LIMIT 1"
+
+	tests := []struct {
+		name     string
+		expected *domain.UserEmail
+		wantErr  error
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: &domain.UserEmail{UserEmailId: 1, UserId: 123, Email: "test@test.com"},
+			mockFunc: func() {
+				rows := sqlmock.NewRows([]string{"user_email_id", "user_id", "email"}).AddRow(1, 123, "test@test.com")
+				mock.ExpectQuery(query).WithArgs(123).WillReturnRows(rows)
+			},
+		},
+		{
+			name:    "not_found",
+			wantErr: ErrEmailNotFound,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs(123).WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: errors.New("internal_error"),
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs(123).WillReturnError(errors.New("internal_error"))
+			},
+		},
+		{
+			name:    "timeout",
+			wantErr: sqlmock.ErrCancelled,
+			mockFunc: func() {
+				rows := sqlmock.NewRows([]string{"user_email_id"}).AddRow(1)
+				mock.ExpectQuery(query).WithArgs(123).WillDelayFor(time.Second).WillReturnRows(rows)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), 10*time.Millisecond)
+
+			got, err := r.GetEmail(context.Background(), 123)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("userRepository.GetEmail() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("userRepository.GetEmail() got = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_userRepository_Exists(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+	usernameQuery := "SELECT count(*) FROM users WHERE normalized_username = ?"
+	emailQuery := "SELECT count(*) FROM users_email WHERE normalized_email = ?"
+
+	tests := []struct {
+		name     string
+		query    string
+		arg      string
+		exists   func() (bool, error)
+		count    int
+		expected bool
+		wantErr  bool
+	}{
+		{
+			name:     "username_taken",
+			query:    usernameQuery,
+			arg:      "TEST",
+			exists:   func() (bool, error) { return r.UsernameExists(context.Background(), "Test") },
+			count:    1,
+			expected: true,
+		},
+		{
+			name:   "username_free",
+			query:  usernameQuery,
+			arg:    "TEST",
+			exists: func() (bool, error) { return r.UsernameExists(context.Background(), "test") },
+		},
+		{
+			name:     "email_taken",
+			query:    emailQuery,
+			arg:      "TEST@TEST.COM",
+			exists:   func() (bool, error) { return r.EmailExists(context.Background(), "Test@test.com") },
+			count:    1,
+			expected: true,
+		},
+		{
+			name:    "internal_error",
+			query:   emailQuery,
+			arg:     "TEST@TEST.COM",
+			exists:  func() (bool, error) { return r.EmailExists(context.Background(), "test@test.com") },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				mock.ExpectQuery(tt.query).WithArgs(tt.arg).WillReturnError(errors.New("internal_error"))
+			} else {
+				mock.ExpectQuery(tt.query).WithArgs(tt.arg).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.count))
+			}
+
+			got, err := tt.exists()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("userRepository exists error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.expected {
+				t.Errorf("userRepository exists got = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
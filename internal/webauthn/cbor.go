@@ -0,0 +1,130 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// WebAuthn only needs a small subset of CBOR (RFC 7049) to read attestation objects and COSE keys: integers, byte and
+// text strings, arrays, maps, tags and simple values, always with definite lengths.
+
+const maxCBORDepth = 16
+
+var errInvalidCBOR = errors.New("cbor inválido")
+
+// decodeCBOR Decodes the first item in b and returns how many bytes it took. Integers are returned as int64, maps as
+// map[interface{}]interface{} with int64 or string keys.
+func decodeCBOR(b []byte) (interface{}, int, error) {
+	return decodeCBORItem(b, 0)
+}
+
+func decodeCBORItem(b []byte, depth int) (interface{}, int, error) {
+	if depth > maxCBORDepth || len(b) == 0 {
+		return nil, 0, errInvalidCBOR
+	}
+
+	major, info := b[0]>>5, b[0]&0x1f
+	arg, n, err := cborArgument(b, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, 0, errInvalidCBOR
+		}
+		return int64(arg), n, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, 0, errInvalidCBOR
+		}
+		return -1 - int64(arg), n, nil
+	case 2, 3:
+		if arg > uint64(len(b)-n) {
+			return nil, 0, errInvalidCBOR
+		}
+		end := n + int(arg)
+		if major == 2 {
+			return append([]byte{}, b[n:end]...), end, nil
+		}
+		return string(b[n:end]), end, nil
+	case 4:
+		// Every item takes at least a byte, this keeps a forged length from allocating too much.
+		if arg > uint64(len(b)-n) {
+			return nil, 0, errInvalidCBOR
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, size, err := decodeCBORItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			n += size
+		}
+		return items, n, nil
+	case 5:
+		if arg > uint64(len(b)-n) {
+			return nil, 0, errInvalidCBOR
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, size, err := decodeCBORItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += size
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, errInvalidCBOR
+			}
+
+			value, size, err := decodeCBORItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += size
+			m[key] = value
+		}
+		return m, n, nil
+	case 6:
+		// Tags only add meaning to the next item, which is all we care about.
+		item, size, err := decodeCBORItem(b[n:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return item, n + size, nil
+	default:
+		switch info {
+		case 20:
+			return false, n, nil
+		case 21:
+			return true, n, nil
+		case 22, 23:
+			return nil, n, nil
+		}
+		return nil, 0, errInvalidCBOR
+	}
+}
+
+// cborArgument Returns the argument of the item header and the size of the header.
+func cborArgument(b []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24 && len(b) >= 2:
+		return uint64(b[1]), 2, nil
+	case info == 25 && len(b) >= 3:
+		return uint64(binary.BigEndian.Uint16(b[1:3])), 3, nil
+	case info == 26 && len(b) >= 5:
+		return uint64(binary.BigEndian.Uint32(b[1:5])), 5, nil
+	case info == 27 && len(b) >= 9:
+		return binary.BigEndian.Uint64(b[1:9]), 9, nil
+	}
+
+	// Indefinite lengths (31) aren't used by authenticators.
+	return 0, 0, errInvalidCBOR
+}
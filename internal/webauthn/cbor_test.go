@@ -0,0 +1,64 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// Examples from RFC 7049 appendix A.
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name    string
+		hex     string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "zero", hex: "00", want: int64(0)},
+		{name: "small_int", hex: "17", want: int64(23)},
+		{name: "uint8", hex: "1818", want: int64(24)},
+		{name: "uint16", hex: "190100", want: int64(256)},
+		{name: "uint64", hex: "1b000000e8d4a51000", want: int64(1000000000000)},
+		{name: "negative", hex: "3863", want: int64(-100)},
+		{name: "bytes", hex: "4401020304", want: []byte{1, 2, 3, 4}},
+		{name: "text", hex: "6449455446", want: "IETF"},
+		{name: "array", hex: "83010203", want: []interface{}{int64(1), int64(2), int64(3)}},
+		{name: "map", hex: "a201020304", want: map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{name: "text_keys", hex: "a26161016162820203", want: map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{name: "tag", hex: "c11a514b67b0", want: int64(1363896240)},
+		{name: "simple_values", hex: "f5", want: true},
+		{name: "truncated_header", hex: "1901", wantErr: true},
+		{name: "truncated_bytes", hex: "440102", wantErr: true},
+		{name: "indefinite_length", hex: "5f42010243030405ff", wantErr: true},
+		{name: "forged_array_length", hex: "9bffffffffffffffff", wantErr: true},
+		{name: "uint_overflow", hex: "1bffffffffffffffff", wantErr: true},
+		{name: "array_key", hex: "a1800102", wantErr: true},
+		{name: "too_deep", hex: "818181818181818181818181818181818101", wantErr: true},
+		{name: "empty", hex: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.hex)
+			got, size, err := decodeCBOR(b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeCBOR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if size != len(b) {
+				t.Errorf("decodeCBOR() size = %v, want %v", size, len(b))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCBOR() got = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCBOR_trailingData(t *testing.T) {
+	_, size, err := decodeCBOR([]byte{0x01, 0x02})
+	if err != nil || size != 1 {
+		t.Errorf("decodeCBOR() size = %v, err %v, want only the first item", size, err)
+	}
+}
@@ -0,0 +1,92 @@
+package webauthn
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/performance"
+	"github.com/CienciaArgentina/go-enigma/internal/auth"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type webauthnController struct {
+	svc Service
+}
+
+func NewController(s Service) Controller {
+	return &webauthnController{svc: s}
+}
+
+// RegistrationOptions Returns the options the browser needs to create a passkey for the user
+func (w *webauthnController) RegistrationOptions(c *gin.Context) {
+	info := middleware.GetContextInformation("WebAuthnRegistrationOptions", c)
+
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode)))
+		return
+	}
+
+	var options *domain.CredentialCreationOptions
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "WebAuthnRegistrationOptions", info, func() {
+		options, apierr = w.svc.RegistrationOptions(c.Request.Context(), claims, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, options)
+}
+
+// Register Stores the passkey created by the browser
+func (w *webauthnController) Register(c *gin.Context) {
+	var dto domain.RegistrationCredentialDTO
+	info := middleware.GetContextInformation("WebAuthnRegister", c)
+
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode)))
+		return
+	}
+
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)))
+		return
+	}
+
+	var credential *domain.WebAuthnCredential
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "WebAuthnRegister", info, func() {
+		credential, apierr = w.svc.Register(c.Request.Context(), claims, &dto, info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.JSON(http.StatusOK, credential)
+}
+
+// LoginOptions Returns the options the browser needs to log in with a passkey
+func (w *webauthnController) LoginOptions(c *gin.Context) {
+	info := middleware.GetContextInformation("WebAuthnLoginOptions", c)
+
+	var options *domain.CredentialRequestOptions
+	var apierr apierror.ApiError
+	performance.TrackTime(time.Now(), "WebAuthnLoginOptions", info, func() {
+		options, apierr = w.svc.LoginOptions(c.Request.Context(), info)
+	})
+	if apierr != nil {
+		c.JSON(apierr.Status(), apierr)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, options)
+}
@@ -0,0 +1,187 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-enigma/internal/auth"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/gin-gonic/gin"
+)
+
+type MockService struct {
+	CreationOptions *domain.CredentialCreationOptions
+	RequestOptions  *domain.CredentialRequestOptions
+	Credential      *domain.WebAuthnCredential
+	Error           apierror.ApiError
+}
+
+func (m *MockService) RegistrationOptions(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.CredentialCreationOptions, apierror.ApiError) {
+	return m.CreationOptions, m.Error
+}
+
+func (m *MockService) Register(ctx context.Context, claims *encryption.AccessTokenClaims, dto *domain.RegistrationCredentialDTO, info *middleware.ContextInformation) (*domain.WebAuthnCredential, apierror.ApiError) {
+	return m.Credential, m.Error
+}
+
+func (m *MockService) LoginOptions(ctx context.Context, info *middleware.ContextInformation) (*domain.CredentialRequestOptions, apierror.ApiError) {
+	return m.RequestOptions, m.Error
+}
+
+func (m *MockService) VerifyAssertion(ctx context.Context, dto *domain.AssertionCredentialDTO, info *middleware.ContextInformation) (int64, apierror.ApiError) {
+	return 0, m.Error
+}
+
+func marshal(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func Test_webauthnController_RegistrationOptions(t *testing.T) {
+	unauthorized := apierror.New(http.StatusUnauthorized, auth.ErrInvalidAccessToken, apierror.NewErrorCause(auth.ErrInvalidAccessToken, auth.ErrInvalidAccessTokenCode))
+	options := &domain.CredentialCreationOptions{Challenge: "challenge", RP: domain.RelyingParty{ID: testRPID}}
+
+	tests := []struct {
+		name           string
+		svc            *MockService
+		claims         *encryption.AccessTokenClaims
+		expectedStatus int
+		expectedBody   interface{}
+	}{
+		{
+			name:           "unauthorized",
+			svc:            &MockService{},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   unauthorized,
+		},
+		{
+			name:           "ok",
+			svc:            &MockService{CreationOptions: options},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			expectedStatus: http.StatusOK,
+			expectedBody:   options,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/users/webauthn/register/options", nil)
+			c.Request.Header.Set("Authorization", "Bearer token")
+			if tt.claims != nil {
+				auth.SetClaims(c, tt.claims)
+			}
+
+			NewController(tt.svc).RegistrationOptions(c)
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[RegistrationOptions] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body) // nolint
+			if body := buf.String(); body != marshal(tt.expectedBody) {
+				t.Errorf("[RegistrationOptions] Expected body = %v, got %v", marshal(tt.expectedBody), body)
+			}
+		})
+	}
+}
+
+func Test_webauthnController_Register(t *testing.T) {
+	invalid := apierror.New(http.StatusBadRequest, ErrInvalidCredential, apierror.NewErrorCause(ErrInvalidCredential, ErrInvalidCredentialCode))
+	credential := &domain.WebAuthnCredential{CredentialId: "id", Name: "Passkey"}
+	body := `{"id": "id", "rawId": "id", "type": "public-key", "response": {"clientDataJSON": "e30", "attestationObject": "oA"}}`
+
+	tests := []struct {
+		name           string
+		svc            *MockService
+		claims         *encryption.AccessTokenClaims
+		requestBody    string
+		expectedStatus int
+		expectedBody   interface{}
+	}{
+		{
+			name:           "bad_request",
+			svc:            &MockService{},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			requestBody:    `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   apierror.New(http.StatusBadRequest, domain.ErrInvalidBody, apierror.NewErrorCause(domain.ErrInvalidBody, domain.ErrInvalidBodyCode)),
+		},
+		{
+			name:           "invalid_credential",
+			svc:            &MockService{Error: invalid},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			requestBody:    body,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   invalid,
+		},
+		{
+			name:           "ok",
+			svc:            &MockService{Credential: credential},
+			claims:         &encryption.AccessTokenClaims{AuthId: 123},
+			requestBody:    body,
+			expectedStatus: http.StatusOK,
+			expectedBody:   credential,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/users/webauthn/register", strings.NewReader(tt.requestBody))
+			c.Request.Header.Set("Authorization", "Bearer token")
+			if tt.claims != nil {
+				auth.SetClaims(c, tt.claims)
+			}
+
+			NewController(tt.svc).Register(c)
+
+			response := w.Result()
+			if response.StatusCode != tt.expectedStatus {
+				t.Errorf("[Register] Expected status code = %v, got %v", tt.expectedStatus, response.StatusCode)
+				return
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(response.Body) // nolint
+			if body := buf.String(); body != marshal(tt.expectedBody) {
+				t.Errorf("[Register] Expected body = %v, got %v", marshal(tt.expectedBody), body)
+			}
+		})
+	}
+}
+
+func Test_webauthnController_LoginOptions(t *testing.T) {
+	options := &domain.CredentialRequestOptions{Challenge: "challenge", RPID: testRPID, AllowCredentials: []domain.CredentialDescriptor{}}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/users/login/webauthn/options", nil)
+
+	NewController(&MockService{RequestOptions: options}).LoginOptions(c)
+
+	response := w.Result()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("[LoginOptions] Expected status code = %v, got %v", http.StatusOK, response.StatusCode)
+	}
+	if response.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("[LoginOptions] Expected the options not to be cached")
+	}
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(response.Body) // nolint
+	if body := buf.String(); body != marshal(options) {
+		t.Errorf("[LoginOptions] Expected body = %v, got %v", marshal(options), body)
+	}
+}
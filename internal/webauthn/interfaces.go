@@ -0,0 +1,34 @@
+package webauthn
+
+import (
+	"context"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/gin-gonic/gin"
+)
+
+type Repository interface {
+	AddChallenge(ctx context.Context, challengeHash string, userID int64, ceremony string, expiryDate time.Time) error
+	ConsumeChallenge(ctx context.Context, challengeHash string, userID int64, ceremony string) (bool, error)
+	AddCredential(ctx context.Context, credential *domain.WebAuthnCredential) error
+	GetCredential(ctx context.Context, credentialID string) (*domain.WebAuthnCredential, error)
+	GetUserCredentials(ctx context.Context, userID int64) ([]domain.WebAuthnCredential, error)
+	UpdateSignCount(ctx context.Context, credentialID string, signCount int64) error
+}
+
+type Service interface {
+	RegistrationOptions(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.CredentialCreationOptions, apierror.ApiError)
+	Register(ctx context.Context, claims *encryption.AccessTokenClaims, dto *domain.RegistrationCredentialDTO, info *middleware.ContextInformation) (*domain.WebAuthnCredential, apierror.ApiError)
+	LoginOptions(ctx context.Context, info *middleware.ContextInformation) (*domain.CredentialRequestOptions, apierror.ApiError)
+	VerifyAssertion(ctx context.Context, dto *domain.AssertionCredentialDTO, info *middleware.ContextInformation) (int64, apierror.ApiError)
+}
+
+type Controller interface {
+	RegistrationOptions(c *gin.Context)
+	Register(c *gin.Context)
+	LoginOptions(c *gin.Context)
+}
@@ -0,0 +1,247 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+
+	// Authenticator data flags.
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+
+	// COSE algorithms, see https://www.iana.org/assignments/cose/cose.xhtml.
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+
+	// COSE key types and curves.
+	ktyOKP     = 1
+	ktyEC2     = 2
+	ktyRSA     = 3
+	crvP256    = 1
+	crvEd25519 = 6
+
+	// rpIdHash + flags + signCount
+	authDataMinLength = 37
+	// aaguid + credentialIdLength
+	attestedCredentialHeaderLength = 18
+)
+
+var (
+	errInvalidClientData        = errors.New("client data inválido")
+	errInvalidAuthenticatorData = errors.New("authenticator data inválido")
+	errInvalidAttestation       = errors.New("attestation object inválido")
+	errUnsupportedKey           = errors.New("clave pública no soportada")
+	errInvalidSignature         = errors.New("firma inválida")
+)
+
+// supportedAlgorithms In order of preference.
+var supportedAlgorithms = []int64{algES256, algEdDSA, algRS256}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	// Only present when the credential was just created
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// parseClientData Checks the ceremony type and origin, the challenge is returned to be checked against the stored ones.
+func parseClientData(raw []byte, ceremony string, origins []string) (*clientData, error) {
+	var c clientData
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, errInvalidClientData
+	}
+
+	if c.Type != ceremony || c.Challenge == "" {
+		return nil, errInvalidClientData
+	}
+
+	for _, origin := range origins {
+		if c.Origin == origin {
+			return &c, nil
+		}
+	}
+
+	return nil, errInvalidClientData
+}
+
+// parseAuthenticatorData https://www.w3.org/TR/webauthn-2/#sctn-authenticator-data
+func parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < authDataMinLength {
+		return nil, errInvalidAuthenticatorData
+	}
+
+	data := &authenticatorData{
+		RPIDHash:  b[:32],
+		Flags:     b[32],
+		SignCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+
+	if data.Flags&flagAttestedCredentialData == 0 {
+		return data, nil
+	}
+
+	rest := b[authDataMinLength:]
+	if len(rest) < attestedCredentialHeaderLength {
+		return nil, errInvalidAuthenticatorData
+	}
+
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[attestedCredentialHeaderLength:]
+	if len(rest) < idLength {
+		return nil, errInvalidAuthenticatorData
+	}
+	data.CredentialID, rest = rest[:idLength], rest[idLength:]
+
+	// The key is followed by the extensions, decoding it is the only way to know where it ends.
+	_, size, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, errInvalidAuthenticatorData
+	}
+	data.PublicKey = rest[:size]
+
+	return data, nil
+}
+
+// verifyAuthenticatorData Checks the data was generated for us and that the user was verified (PIN, biometrics...), which
+// makes a passkey enough to log in without a password or second factor.
+func verifyAuthenticatorData(data *authenticatorData, rpID string) error {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(data.RPIDHash, rpIDHash[:]) {
+		return errInvalidAuthenticatorData
+	}
+
+	if data.Flags&flagUserPresent == 0 || data.Flags&flagUserVerified == 0 {
+		return errInvalidAuthenticatorData
+	}
+
+	return nil
+}
+
+// parseAttestationObject Returns the authenticator data. We ask for no attestation so the statement isn't verified,
+// passkeys are trusted on first use like passwords are.
+func parseAttestationObject(b []byte) ([]byte, error) {
+	decoded, _, err := decodeCBOR(b)
+	if err != nil {
+		return nil, errInvalidAttestation
+	}
+
+	m, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, errInvalidAttestation
+	}
+
+	authData, ok := m["authData"].([]byte)
+	if !ok {
+		return nil, errInvalidAttestation
+	}
+
+	return authData, nil
+}
+
+// parseCOSEKey Returns the public key and its algorithm.
+func parseCOSEKey(b []byte) (crypto.PublicKey, int64, error) {
+	decoded, _, err := decodeCBOR(b)
+	if err != nil {
+		return nil, 0, errUnsupportedKey
+	}
+
+	m, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errUnsupportedKey
+	}
+
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	crv, _ := m[int64(-1)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == algES256 && crv == crvP256:
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if len(x) != 32 || len(y) != 32 || !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, 0, errUnsupportedKey
+		}
+		return key, alg, nil
+	case kty == ktyOKP && alg == algEdDSA && crv == crvEd25519:
+		x, _ := m[int64(-2)].([]byte)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, 0, errUnsupportedKey
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case kty == ktyRSA && alg == algRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+			return nil, 0, errUnsupportedKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, alg, nil
+	}
+
+	return nil, 0, errUnsupportedKey
+}
+
+// verifyAssertionSignature The authenticator signs its data followed by the hash of the client data.
+func verifyAssertionSignature(coseKey, authData, clientDataJSON, signature []byte) error {
+	key, _, err := parseCOSEKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		if ecdsa.VerifyASN1(k, digest[:], signature) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(k, signed, signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+
+	return errInvalidSignature
+}
+
+// decodeBase64URL Browsers don't pad, but some libraries do.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
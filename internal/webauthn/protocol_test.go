@@ -0,0 +1,345 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+)
+
+const (
+	testRPID   = "cienciaargentina.dev"
+	testOrigin = "https://cienciaargentina.dev"
+)
+
+// encodeCBOR Just enough CBOR to build what authenticators send.
+func encodeCBOR(v interface{}) []byte {
+	header := func(major byte, arg uint64) []byte {
+		switch {
+		case arg < 24:
+			return []byte{major<<5 | byte(arg)}
+		case arg < 1<<8:
+			return []byte{major<<5 | 24, byte(arg)}
+		case arg < 1<<16:
+			b := []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(b[1:], uint16(arg))
+			return b
+		}
+		b := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(arg))
+		return b
+	}
+
+	switch x := v.(type) {
+	case int:
+		if x < 0 {
+			return header(1, uint64(-1-x))
+		}
+		return header(0, uint64(x))
+	case []byte:
+		return append(header(2, uint64(len(x))), x...)
+	case string:
+		return append(header(3, uint64(len(x))), x...)
+	case [][2]interface{}:
+		// Maps as key value pairs to keep the order of the keys.
+		b := header(5, uint64(len(x)))
+		for _, pair := range x {
+			b = append(b, encodeCBOR(pair[0])...)
+			b = append(b, encodeCBOR(pair[1])...)
+		}
+		return b
+	}
+
+	panic("unsupported type")
+}
+
+// fakeAuthenticator Creates passkeys and signs logins like a browser and authenticator would.
+type fakeAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	flags        byte
+	rpID         string
+	origin       string
+}
+
+func newFakeAuthenticator(t *testing.T) *fakeAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &fakeAuthenticator{
+		key:          key,
+		credentialID: []byte("credential-id"),
+		userHandle:   []byte("123"),
+		flags:        flagUserPresent | flagUserVerified,
+		rpID:         testRPID,
+		origin:       testOrigin,
+	}
+}
+
+func (f *fakeAuthenticator) coseKey() []byte {
+	return encodeCBOR([][2]interface{}{
+		{1, ktyEC2},
+		{3, algES256},
+		{-1, crvP256},
+		{-2, padTo32(f.key.X.Bytes())},
+		{-3, padTo32(f.key.Y.Bytes())},
+	})
+}
+
+func (f *fakeAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(f.rpID))
+	b := append([]byte{}, rpIDHash[:]...)
+	flags := f.flags
+	if attested {
+		flags |= flagAttestedCredentialData
+	}
+	b = append(b, flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[33:37], f.signCount)
+
+	if attested {
+		b = append(b, make([]byte, 16)...)
+		b = append(b, byte(len(f.credentialID)>>8), byte(len(f.credentialID)))
+		b = append(b, f.credentialID...)
+		b = append(b, f.coseKey()...)
+	}
+
+	return b
+}
+
+func (f *fakeAuthenticator) clientData(ceremony, challenge string) []byte {
+	b, _ := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": f.origin})
+	return b
+}
+
+func (f *fakeAuthenticator) create(challenge string) *domain.RegistrationCredentialDTO {
+	attestation := encodeCBOR([][2]interface{}{
+		{"fmt", "none"},
+		{"attStmt", [][2]interface{}{}},
+		{"authData", f.authData(true)},
+	})
+
+	dto := &domain.RegistrationCredentialDTO{
+		ID:    encodeBase64URL(f.credentialID),
+		RawID: encodeBase64URL(f.credentialID),
+		Type:  credentialType,
+		Name:  "Test",
+	}
+	dto.Response.ClientDataJSON = encodeBase64URL(f.clientData(ceremonyCreate, challenge))
+	dto.Response.AttestationObject = encodeBase64URL(attestation)
+	return dto
+}
+
+func (f *fakeAuthenticator) get(t *testing.T, challenge string) *domain.AssertionCredentialDTO {
+	authData := f.authData(false)
+	clientDataJSON := f.clientData(ceremonyGet, challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, f.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dto := &domain.AssertionCredentialDTO{
+		ID:    encodeBase64URL(f.credentialID),
+		RawID: encodeBase64URL(f.credentialID),
+		Type:  credentialType,
+	}
+	dto.Response.ClientDataJSON = encodeBase64URL(clientDataJSON)
+	dto.Response.AuthenticatorData = encodeBase64URL(authData)
+	dto.Response.Signature = encodeBase64URL(signature)
+	dto.Response.UserHandle = encodeBase64URL(f.userHandle)
+	return dto
+}
+
+func padTo32(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+func TestParseClientData(t *testing.T) {
+	origins := []string{testOrigin}
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{name: "ok", raw: `{"type":"webauthn.get","challenge":"abc","origin":"https://cienciaargentina.dev"}`},
+		{name: "other_ceremony", raw: `{"type":"webauthn.create","challenge":"abc","origin":"https://cienciaargentina.dev"}`, wantErr: true},
+		{name: "other_origin", raw: `{"type":"webauthn.get","challenge":"abc","origin":"https://evil.dev"}`, wantErr: true},
+		{name: "no_challenge", raw: `{"type":"webauthn.get","origin":"https://cienciaargentina.dev"}`, wantErr: true},
+		{name: "invalid_json", raw: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClientData([]byte(tt.raw), ceremonyGet, origins)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseClientData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Challenge != "abc" {
+				t.Errorf("parseClientData() challenge = %v, want abc", got.Challenge)
+			}
+		})
+	}
+}
+
+func TestParseAttestationObject(t *testing.T) {
+	f := newFakeAuthenticator(t)
+	f.signCount = 7
+	dto := f.create("challenge")
+
+	raw, err := decodeBase64URL(dto.Response.AttestationObject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authData, err := parseAttestationObject(raw)
+	if err != nil {
+		t.Fatalf("parseAttestationObject() error = %v", err)
+	}
+
+	data, err := parseAuthenticatorData(authData)
+	if err != nil {
+		t.Fatalf("parseAuthenticatorData() error = %v", err)
+	}
+	if string(data.CredentialID) != "credential-id" || data.SignCount != 7 {
+		t.Errorf("parseAuthenticatorData() got = %+v", data)
+	}
+	if err := verifyAuthenticatorData(data, testRPID); err != nil {
+		t.Errorf("verifyAuthenticatorData() error = %v", err)
+	}
+
+	key, alg, err := parseCOSEKey(data.PublicKey)
+	if err != nil || alg != algES256 {
+		t.Fatalf("parseCOSEKey() alg = %v, error = %v", alg, err)
+	}
+	if !key.(*ecdsa.PublicKey).Equal(&f.key.PublicKey) {
+		t.Errorf("parseCOSEKey() returned another key")
+	}
+
+	if _, err := parseAttestationObject(encodeCBOR([][2]interface{}{{"fmt", "none"}})); err == nil {
+		t.Errorf("parseAttestationObject() without authData must fail")
+	}
+}
+
+func TestParseAuthenticatorData_invalid(t *testing.T) {
+	f := newFakeAuthenticator(t)
+	attested := f.authData(true)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "too_short", data: attested[:36]},
+		{name: "truncated_credential_header", data: attested[:40]},
+		{name: "truncated_credential_id", data: attested[:60]},
+		{name: "truncated_key", data: attested[:len(attested)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseAuthenticatorData(tt.data); err == nil {
+				t.Errorf("parseAuthenticatorData() expected error")
+			}
+		})
+	}
+}
+
+func TestVerifyAuthenticatorData(t *testing.T) {
+	tests := []struct {
+		name    string
+		rpID    string
+		flags   byte
+		wantErr bool
+	}{
+		{name: "ok", rpID: testRPID, flags: flagUserPresent | flagUserVerified},
+		{name: "other_rp", rpID: "evil.dev", flags: flagUserPresent | flagUserVerified, wantErr: true},
+		{name: "user_not_verified", rpID: testRPID, flags: flagUserPresent, wantErr: true},
+		{name: "user_not_present", rpID: testRPID, flags: flagUserVerified, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAuthenticator(t)
+			f.rpID, f.flags = tt.rpID, tt.flags
+			data, err := parseAuthenticatorData(f.authData(false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifyAuthenticatorData(data, testRPID); (err != nil) != tt.wantErr {
+				t.Errorf("verifyAuthenticatorData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCOSEKey(t *testing.T) {
+	edPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaCOSE := func(k *rsa.PrivateKey) []byte {
+		return encodeCBOR([][2]interface{}{{1, ktyRSA}, {3, algRS256}, {-1, k.N.Bytes()}, {-2, big.NewInt(int64(k.E)).Bytes()}})
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		wantAlg int64
+		wantErr bool
+	}{
+		{name: "es256", key: newFakeAuthenticator(t).coseKey(), wantAlg: algES256},
+		{name: "eddsa", key: encodeCBOR([][2]interface{}{{1, ktyOKP}, {3, algEdDSA}, {-1, crvEd25519}, {-2, []byte(edPublic)}}), wantAlg: algEdDSA},
+		{name: "rs256", key: rsaCOSE(rsaKey), wantAlg: algRS256},
+		{name: "small_rsa", key: rsaCOSE(smallRSAKey), wantErr: true},
+		{name: "point_not_on_curve", key: encodeCBOR([][2]interface{}{{1, ktyEC2}, {3, algES256}, {-1, crvP256}, {-2, make([]byte, 32)}, {-3, make([]byte, 32)}}), wantErr: true},
+		{name: "unknown_alg", key: encodeCBOR([][2]interface{}{{1, ktyEC2}, {3, -35}, {-1, 2}}), wantErr: true},
+		{name: "not_a_map", key: encodeCBOR("key"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, alg, err := parseCOSEKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCOSEKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if alg != tt.wantAlg {
+				t.Errorf("parseCOSEKey() alg = %v, want %v", alg, tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionSignature(t *testing.T) {
+	f := newFakeAuthenticator(t)
+	dto := f.get(t, "challenge")
+	authData, _ := decodeBase64URL(dto.Response.AuthenticatorData)
+	clientDataJSON, _ := decodeBase64URL(dto.Response.ClientDataJSON)
+	signature, _ := decodeBase64URL(dto.Response.Signature)
+
+	if err := verifyAssertionSignature(f.coseKey(), authData, clientDataJSON, signature); err != nil {
+		t.Errorf("verifyAssertionSignature() error = %v", err)
+	}
+
+	tampered := append([]byte{}, clientDataJSON...)
+	tampered[len(tampered)-2] = 'x'
+	if err := verifyAssertionSignature(f.coseKey(), authData, tampered, signature); err == nil {
+		t.Errorf("verifyAssertionSignature() accepted a tampered client data")
+	}
+
+	other := newFakeAuthenticator(t)
+	if err := verifyAssertionSignature(other.coseKey(), authData, clientDataJSON, signature); err == nil {
+		t.Errorf("verifyAssertionSignature() accepted the signature of another key")
+	}
+}
@@ -0,0 +1,108 @@
+package webauthn
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+type webauthnRepository struct {
+	db      *sqlx.DB
+	timeout time.Duration
+}
+
+// NewRepository Returns new webauthn repository, whose queries give up after timeout
+func NewRepository(db *sqlx.DB, timeout time.Duration) Repository {
+	return &webauthnRepository{db: db, timeout: timeout}
+}
+
+// AddChallenge Stores the challenge of a ceremony that just started, userID is 0 for logins since we don't know who is
+// logging in until the passkey is used. Challenges of abandoned ceremonies are purged along the way.
+func (w *webauthnRepository) AddChallenge(ctx context.Context, challengeHash string, userID int64, ceremony string, expiryDate time.Time) error {
+	ctx, cancel := storage.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	_, err := w.db.ExecContext(ctx, w.db.Rebind("INSERT INTO webauthn_challenge (challenge_hash, user_id, ceremony, expiry_date, date_created) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)"),
+		challengeHash, userID, ceremony, expiryDate)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.db.ExecContext(ctx, w.db.Rebind("DELETE FROM webauthn_challenge WHERE expiry_date < CURRENT_TIMESTAMP"))
+	return err
+}
+
+// ConsumeChallenge Deletes the challenge, returns false if it didn't exist, expired or was already used
+func (w *webauthnRepository) ConsumeChallenge(ctx context.Context, challengeHash string, userID int64, ceremony string) (bool, error) {
+	ctx, cancel := storage.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	res, err := w.db.ExecContext(ctx, w.db.Rebind("DELETE FROM webauthn_challenge WHERE challenge_hash = ? AND user_id = ? AND ceremony = ? AND expiry_date > CURRENT_TIMESTAMP"),
+		challengeHash, userID, ceremony)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// AddCredential Stores a new passkey of the user
+func (w *webauthnRepository) AddCredential(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	ctx, cancel := storage.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	_, err := w.db.ExecContext(ctx, w.db.Rebind("INSERT INTO users_webauthn_credential (credential_id, user_id, public_key, sign_count, name, date_created) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)"),
+		credential.CredentialId, credential.UserId, credential.PublicKey, credential.SignCount, credential.Name)
+	return err
+}
+
+// GetCredential Returns the passkey with the given ID, nil if it doesn't exist
+func (w *webauthnRepository) GetCredential(ctx context.Context, credentialID string) (*domain.WebAuthnCredential, error) {
+	ctx, cancel := storage.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	var credential domain.WebAuthnCredential
+
+	err := w.db.GetContext(ctx, &credential, w.db.Rebind("SELECT * FROM users_webauthn_credential WHERE credential_id = ?"), credentialID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+// GetUserCredentials Returns every passkey of the user
+func (w *webauthnRepository) GetUserCredentials(ctx context.Context, userID int64) ([]domain.WebAuthnCredential, error) {
+	ctx, cancel := storage.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	var credentials []domain.WebAuthnCredential
+
+	err := w.db.SelectContext(ctx, &credentials, w.db.Rebind("SELECT * FROM users_webauthn_credential WHERE user_id = ?"), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// UpdateSignCount Stores the counter of the last assertion of the passkey
+func (w *webauthnRepository) UpdateSignCount(ctx context.Context, credentialID string, signCount int64) error {
+	ctx, cancel := storage.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	_, err := w.db.ExecContext(ctx, w.db.Rebind("UPDATE users_webauthn_credential SET sign_count = ?, date_last_used = CURRENT_TIMESTAMP WHERE credential_id = ?"), signCount, credentialID)
+	return err
+}
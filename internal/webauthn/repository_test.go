@@ -0,0 +1,195 @@
+package webauthn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_webauthnRepository_AddChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	insert := "INSERT INTO webauthn_challenge (challenge_hash, user_id, ceremony, expiry_date, date_created) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)"
+	purge := "DELETE FROM webauthn_challenge WHERE expiry_date < CURRENT_TIMESTAMP"
+	expiry := time.Now().Add(ceremonyTimeout)
+
+	tests := []struct {
+		name     string
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name: "ok",
+			mockFunc: func() {
+				mock.ExpectExec(insert).WithArgs("hash", 123, ceremonyRegistration, expiry).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(purge).WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectExec(insert).WithArgs("hash", 123, ceremonyRegistration, expiry).WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			err := r.AddChallenge(context.Background(), "hash", 123, ceremonyRegistration, expiry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("webauthnRepository.AddChallenge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("webauthnRepository.AddChallenge() %v", err)
+			}
+		})
+	}
+}
+
+func Test_webauthnRepository_ConsumeChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "DELETE FROM webauthn_challenge WHERE challenge_hash = ? AND user_id = ? AND ceremony = ? AND expiry_date > CURRENT_TIMESTAMP"
+
+	tests := []struct {
+		name     string
+		expected bool
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs("hash", 0, ceremonyLogin).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "already_used",
+			expected: false,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs("hash", 0, ceremonyLogin).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectExec(query).WithArgs("hash", 0, ceremonyLogin).WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			got, err := r.ConsumeChallenge(context.Background(), "hash", 0, ceremonyLogin)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("webauthnRepository.ConsumeChallenge() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.expected {
+				t.Errorf("webauthnRepository.ConsumeChallenge() got = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_webauthnRepository_GetCredential(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "SELECT * FROM users_webauthn_credential WHERE credential_id = ?"
+
+	tests := []struct {
+		name     string
+		expected *domain.WebAuthnCredential
+		wantErr  bool
+		mockFunc func()
+	}{
+		{
+			name:     "ok",
+			expected: &domain.WebAuthnCredential{CredentialId: "id", UserId: 123, PublicKey: []byte("key"), SignCount: 5, Name: "Passkey"},
+			mockFunc: func() {
+				rows := sqlmock.NewRows([]string{"credential_id", "user_id", "public_key", "sign_count", "name"}).
+					AddRow("id", 123, []byte("key"), 5, "Passkey")
+				mock.ExpectQuery(query).WithArgs("id").WillReturnRows(rows)
+			},
+		},
+		{
+			name: "not_found",
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("id").WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:    "internal_error",
+			wantErr: true,
+			mockFunc: func() {
+				mock.ExpectQuery(query).WithArgs("id").WillReturnError(errors.New("internal_error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockFunc()
+
+			r := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second)
+
+			got, err := r.GetCredential(context.Background(), "id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("webauthnRepository.GetCredential() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("webauthnRepository.GetCredential() got = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_webauthnRepository_UpdateSignCount(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	query := "UPDATE users_webauthn_credential SET sign_count = ?, date_last_used = CURRENT_TIMESTAMP WHERE credential_id = ?"
+
+	mock.ExpectExec(query).WithArgs(6, "id").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := NewRepository(sqlx.NewDb(db, "sqlmock"), time.Second).UpdateSignCount(context.Background(), "id", 6); err != nil {
+		t.Errorf("webauthnRepository.UpdateSignCount() error = %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/clog"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/performance"
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+)
+
+const (
+	ErrInvalidCredential     = "No se pudo verificar la llave de acceso"
+	ErrInvalidCredentialCode = "invalid_credential"
+
+	ErrCredentialAlreadyRegistered     = "La llave de acceso ya está registrada"
+	ErrCredentialAlreadyRegisteredCode = "credential_already_registered"
+
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+	ceremonyTimeout      = 5 * time.Minute
+
+	credentialType          = "public-key"
+	challengeLength         = 32
+	defaultCredentialName   = "Passkey"
+	maxCredentialNameLength = 100
+)
+
+type webauthnService struct {
+	opts       *config.WebAuthnOptions
+	repository Repository
+}
+
+func NewService(cfg *config.EnigmaConfig, r Repository) Service {
+	return &webauthnService{opts: cfg.WebAuthnOptions, repository: r}
+}
+
+// RegistrationOptions Starts the creation of a passkey for the user
+func (w *webauthnService) RegistrationOptions(ctx context.Context, claims *encryption.AccessTokenClaims, info *middleware.ContextInformation) (*domain.CredentialCreationOptions, apierror.ApiError) {
+	challenge, apierr := w.newChallenge(ctx, claims.AuthId, ceremonyRegistration, info)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	var credentials []domain.WebAuthnCredential
+	var err error
+	performance.TrackTime(time.Now(), "GetUserCredentials", info, func() {
+		credentials, err = w.repository.GetUserCredentials(ctx, claims.AuthId)
+	})
+	if err != nil {
+		clog.Error("Error fetching passkeys", "webauthn-registration-options", err, map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	// The authenticator refuses to create a second passkey for an account it already has one for.
+	exclude := make([]domain.CredentialDescriptor, 0, len(credentials))
+	for _, c := range credentials {
+		exclude = append(exclude, domain.CredentialDescriptor{Type: credentialType, ID: c.CredentialId})
+	}
+
+	params := make([]domain.CredentialParameter, 0, len(supportedAlgorithms))
+	for _, alg := range supportedAlgorithms {
+		params = append(params, domain.CredentialParameter{Type: credentialType, Alg: alg})
+	}
+
+	return &domain.CredentialCreationOptions{
+		Challenge: challenge,
+		RP:        domain.RelyingParty{ID: w.opts.RPID, Name: w.opts.RPName},
+		User: domain.WebAuthnUser{
+			ID:          encodeBase64URL(userHandle(claims.AuthId)),
+			Name:        claims.Email,
+			DisplayName: claims.Email,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            ceremonyTimeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		// Passkeys: discoverable so the user doesn't have to type their username, verified so they replace the password.
+		AuthenticatorSelection: domain.AuthenticatorSelection{ResidentKey: "required", UserVerification: "required"},
+		Attestation:            "none",
+	}, nil
+}
+
+// Register Verifies the passkey the browser created and stores it
+func (w *webauthnService) Register(ctx context.Context, claims *encryption.AccessTokenClaims, dto *domain.RegistrationCredentialDTO, info *middleware.ContextInformation) (*domain.WebAuthnCredential, apierror.ApiError) {
+	invalid := apierror.New(http.StatusBadRequest, ErrInvalidCredential, apierror.NewErrorCause(ErrInvalidCredential, ErrInvalidCredentialCode))
+	tags := map[string]string{"auth_id": fmt.Sprintf("%d", claims.AuthId)}
+
+	if dto.Type != credentialType {
+		return nil, invalid
+	}
+
+	clientDataJSON, err := decodeBase64URL(dto.Response.ClientDataJSON)
+	if err != nil {
+		return nil, invalid
+	}
+
+	attestationObject, err := decodeBase64URL(dto.Response.AttestationObject)
+	if err != nil {
+		return nil, invalid
+	}
+
+	client, err := parseClientData(clientDataJSON, ceremonyCreate, w.opts.Origins)
+	if err != nil {
+		clog.Warn("Invalid passkey registration: "+err.Error(), "webauthn-register", tags)
+		return nil, invalid
+	}
+
+	if apierr := w.consumeChallenge(ctx, client.Challenge, claims.AuthId, ceremonyRegistration, invalid, info); apierr != nil {
+		return nil, apierr
+	}
+
+	rawAuthData, err := parseAttestationObject(attestationObject)
+	if err == nil {
+		var authData *authenticatorData
+		authData, err = parseAuthenticatorData(rawAuthData)
+		if err == nil {
+			err = w.verifyNewCredential(authData)
+		}
+		if err == nil {
+			return w.saveCredential(ctx, claims.AuthId, dto.Name, authData, info)
+		}
+	}
+
+	clog.Warn("Invalid passkey registration: "+err.Error(), "webauthn-register", tags)
+	return nil, invalid
+}
+
+// LoginOptions Starts a login with a passkey. No credentials are listed, the browser offers the passkeys it has for us.
+func (w *webauthnService) LoginOptions(ctx context.Context, info *middleware.ContextInformation) (*domain.CredentialRequestOptions, apierror.ApiError) {
+	challenge, apierr := w.newChallenge(ctx, 0, ceremonyLogin, info)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	return &domain.CredentialRequestOptions{
+		Challenge:        challenge,
+		RPID:             w.opts.RPID,
+		Timeout:          ceremonyTimeout.Milliseconds(),
+		AllowCredentials: []domain.CredentialDescriptor{},
+		UserVerification: "required",
+	}, nil
+}
+
+// VerifyAssertion Checks the passkey login and returns the ID of the user it belongs to
+func (w *webauthnService) VerifyAssertion(ctx context.Context, dto *domain.AssertionCredentialDTO, info *middleware.ContextInformation) (int64, apierror.ApiError) {
+	invalid := apierror.New(http.StatusUnauthorized, ErrInvalidCredential, apierror.NewErrorCause(ErrInvalidCredential, ErrInvalidCredentialCode))
+
+	if dto.Type != credentialType {
+		return 0, invalid
+	}
+
+	rawID, err1 := decodeBase64URL(dto.RawID)
+	clientDataJSON, err2 := decodeBase64URL(dto.Response.ClientDataJSON)
+	rawAuthData, err3 := decodeBase64URL(dto.Response.AuthenticatorData)
+	signature, err4 := decodeBase64URL(dto.Response.Signature)
+	handle, err5 := decodeBase64URL(dto.Response.UserHandle)
+	for _, err := range []error{err1, err2, err3, err4, err5} {
+		if err != nil {
+			return 0, invalid
+		}
+	}
+
+	credentialID := encodeBase64URL(rawID)
+	var credential *domain.WebAuthnCredential
+	var err error
+	performance.TrackTime(time.Now(), "GetCredential", info, func() {
+		credential, err = w.repository.GetCredential(ctx, credentialID)
+	})
+	if err != nil {
+		clog.Error("Error fetching passkey", "webauthn-login", err, nil)
+		return 0, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if credential == nil {
+		return 0, invalid
+	}
+
+	tags := map[string]string{"auth_id": fmt.Sprintf("%d", credential.UserId)}
+
+	if len(handle) > 0 && !bytes.Equal(handle, userHandle(credential.UserId)) {
+		clog.Warn("Passkey used with the user handle of another user", "webauthn-login", tags)
+		return 0, invalid
+	}
+
+	client, err := parseClientData(clientDataJSON, ceremonyGet, w.opts.Origins)
+	if err != nil {
+		clog.Warn("Invalid passkey login: "+err.Error(), "webauthn-login", tags)
+		return 0, invalid
+	}
+
+	if apierr := w.consumeChallenge(ctx, client.Challenge, 0, ceremonyLogin, invalid, info); apierr != nil {
+		return 0, apierr
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err == nil {
+		err = verifyAuthenticatorData(authData, w.opts.RPID)
+	}
+	if err == nil {
+		err = verifyAssertionSignature(credential.PublicKey, rawAuthData, clientDataJSON, signature)
+	}
+	if err != nil {
+		clog.Warn("Invalid passkey login: "+err.Error(), "webauthn-login", tags)
+		return 0, invalid
+	}
+
+	// Authenticators that keep a counter increase it on every use, a counter going back means the key was cloned.
+	// Synced passkeys always send 0.
+	signCount := int64(authData.SignCount)
+	if (signCount != 0 || credential.SignCount != 0) && signCount <= credential.SignCount {
+		clog.Warn("Passkey sign count didn't increase, it may have been cloned", "webauthn-login", tags)
+		return 0, invalid
+	}
+
+	performance.TrackTime(time.Now(), "UpdateSignCount", info, func() {
+		err = w.repository.UpdateSignCount(ctx, credentialID, signCount)
+	})
+	if err != nil {
+		clog.Error("Error updating passkey sign count", "webauthn-login", err, tags)
+		return 0, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	return credential.UserId, nil
+}
+
+func (w *webauthnService) verifyNewCredential(authData *authenticatorData) error {
+	if err := verifyAuthenticatorData(authData, w.opts.RPID); err != nil {
+		return err
+	}
+
+	if authData.CredentialID == nil {
+		return errInvalidAuthenticatorData
+	}
+
+	_, _, err := parseCOSEKey(authData.PublicKey)
+	return err
+}
+
+func (w *webauthnService) saveCredential(ctx context.Context, userID int64, name string, authData *authenticatorData, info *middleware.ContextInformation) (*domain.WebAuthnCredential, apierror.ApiError) {
+	credential := &domain.WebAuthnCredential{
+		CredentialId: encodeBase64URL(authData.CredentialID),
+		UserId:       userID,
+		PublicKey:    authData.PublicKey,
+		SignCount:    int64(authData.SignCount),
+		Name:         truncate(name, maxCredentialNameLength),
+	}
+	if credential.Name == "" {
+		credential.Name = defaultCredentialName
+	}
+
+	var existing *domain.WebAuthnCredential
+	var err error
+	performance.TrackTime(time.Now(), "GetCredential", info, func() {
+		existing, err = w.repository.GetCredential(ctx, credential.CredentialId)
+	})
+	if err != nil {
+		clog.Error("Error fetching passkey", "webauthn-register", err, map[string]string{"auth_id": fmt.Sprintf("%d", userID)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if existing != nil {
+		return nil, apierror.New(http.StatusBadRequest, ErrCredentialAlreadyRegistered, apierror.NewErrorCause(ErrCredentialAlreadyRegistered, ErrCredentialAlreadyRegisteredCode))
+	}
+
+	performance.TrackTime(time.Now(), "AddCredential", info, func() {
+		err = w.repository.AddCredential(ctx, credential)
+	})
+	if err != nil {
+		clog.Error("Error saving passkey", "webauthn-register", err, map[string]string{"auth_id": fmt.Sprintf("%d", userID)})
+		return nil, apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	return credential, nil
+}
+
+func (w *webauthnService) newChallenge(ctx context.Context, userID int64, ceremony string, info *middleware.ContextInformation) (string, apierror.ApiError) {
+	challenge, err := encryption.GenerateOpaqueToken(challengeLength)
+	if err != nil {
+		return "", apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	performance.TrackTime(time.Now(), "AddChallenge", info, func() {
+		err = w.repository.AddChallenge(ctx, encryption.HashOpaqueToken(challenge), userID, ceremony, time.Now().Add(ceremonyTimeout))
+	})
+	if err != nil {
+		clog.Error("Error saving webauthn challenge", "webauthn-challenge", err, map[string]string{"ceremony": ceremony})
+		return "", apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	return challenge, nil
+}
+
+// consumeChallenge Each challenge can be answered once, so a captured response can't be replayed.
+func (w *webauthnService) consumeChallenge(ctx context.Context, challenge string, userID int64, ceremony string, invalid apierror.ApiError, info *middleware.ContextInformation) apierror.ApiError {
+	var consumed bool
+	var err error
+	performance.TrackTime(time.Now(), "ConsumeChallenge", info, func() {
+		consumed, err = w.repository.ConsumeChallenge(ctx, encryption.HashOpaqueToken(challenge), userID, ceremony)
+	})
+	if err != nil {
+		clog.Error("Error consuming webauthn challenge", "webauthn-challenge", err, map[string]string{"ceremony": ceremony})
+		return apierror.NewInternalServerApiError(domain.ErrUnexpectedError, err, domain.ErrInternalCode)
+	}
+
+	if !consumed {
+		return invalid
+	}
+
+	return nil
+}
+
+// userHandle The user.id of the passkeys, the browser gives it back on login.
+func userHandle(userID int64) []byte {
+	return []byte(strconv.FormatInt(userID, 10))
+}
+
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	return s[:length]
+}
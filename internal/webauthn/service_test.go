@@ -0,0 +1,325 @@
+package webauthn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/CienciaArgentina/go-backend-commons/pkg/middleware"
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+)
+
+const (
+	AddChallengeMockID = iota
+	ConsumeChallengeMockID
+	AddCredentialMockID
+	GetCredentialMockID
+	GetUserCredentialsMockID
+	UpdateSignCountMockID
+)
+
+type MockRepository struct {
+	Responses map[int]interface{}
+	Errors    map[int]error
+
+	// Hashes of the challenges that weren't consumed yet, by ceremony
+	Challenges  map[string]string
+	Added       *domain.WebAuthnCredential
+	SignCount   int64
+	SignUpdates int
+}
+
+func (m *MockRepository) AddChallenge(ctx context.Context, challengeHash string, userID int64, ceremony string, expiryDate time.Time) error {
+	if m.Challenges == nil {
+		m.Challenges = map[string]string{}
+	}
+	m.Challenges[challengeHash] = ceremony
+	return m.Errors[AddChallengeMockID]
+}
+
+func (m *MockRepository) ConsumeChallenge(ctx context.Context, challengeHash string, userID int64, ceremony string) (bool, error) {
+	found := m.Challenges[challengeHash] == ceremony
+	delete(m.Challenges, challengeHash)
+	return found, m.Errors[ConsumeChallengeMockID]
+}
+
+func (m *MockRepository) AddCredential(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	m.Added = credential
+	return m.Errors[AddCredentialMockID]
+}
+
+func (m *MockRepository) GetCredential(ctx context.Context, credentialID string) (*domain.WebAuthnCredential, error) {
+	credential, _ := m.Responses[GetCredentialMockID].(*domain.WebAuthnCredential)
+	return credential, m.Errors[GetCredentialMockID]
+}
+
+func (m *MockRepository) GetUserCredentials(ctx context.Context, userID int64) ([]domain.WebAuthnCredential, error) {
+	credentials, _ := m.Responses[GetUserCredentialsMockID].([]domain.WebAuthnCredential)
+	return credentials, m.Errors[GetUserCredentialsMockID]
+}
+
+func (m *MockRepository) UpdateSignCount(ctx context.Context, credentialID string, signCount int64) error {
+	m.SignCount = signCount
+	m.SignUpdates++
+	return m.Errors[UpdateSignCountMockID]
+}
+
+func testConfig() *config.EnigmaConfig {
+	return &config.EnigmaConfig{
+		WebAuthnOptions: &config.WebAuthnOptions{RPID: testRPID, RPName: "Ciencia Argentina", Origins: []string{testOrigin}},
+	}
+}
+
+func Test_webauthnService_RegistrationOptions(t *testing.T) {
+	claims := &encryption.AccessTokenClaims{AuthId: 123, Email: "test@test.com"}
+	repository := &MockRepository{Responses: map[int]interface{}{
+		GetUserCredentialsMockID: []domain.WebAuthnCredential{{CredentialId: "existing"}},
+	}}
+
+	got, apierr := NewService(testConfig(), repository).RegistrationOptions(context.Background(), claims, &middleware.ContextInformation{})
+	if apierr != nil {
+		t.Fatalf("webauthnService.RegistrationOptions() unexpected error %v", apierr)
+	}
+
+	if got.User.ID != encodeBase64URL([]byte("123")) || got.User.Name != "test@test.com" || got.RP.ID != testRPID {
+		t.Errorf("webauthnService.RegistrationOptions() got = %+v", got)
+	}
+	if !reflect.DeepEqual(got.ExcludeCredentials, []domain.CredentialDescriptor{{Type: credentialType, ID: "existing"}}) {
+		t.Errorf("webauthnService.RegistrationOptions() exclude = %v", got.ExcludeCredentials)
+	}
+	if repository.Challenges[encryption.HashOpaqueToken(got.Challenge)] != ceremonyRegistration {
+		t.Errorf("webauthnService.RegistrationOptions() didn't store the challenge")
+	}
+
+	repository.Errors = map[int]error{AddChallengeMockID: errors.New("error")}
+	if _, apierr := NewService(testConfig(), repository).RegistrationOptions(context.Background(), claims, &middleware.ContextInformation{}); apierr == nil || apierr.Status() != http.StatusInternalServerError {
+		t.Errorf("webauthnService.RegistrationOptions() got1 = %v, want internal error", apierr)
+	}
+}
+
+func Test_webauthnService_Register(t *testing.T) {
+	claims := &encryption.AccessTokenClaims{AuthId: 123, Email: "test@test.com"}
+	invalid := apierror.New(http.StatusBadRequest, ErrInvalidCredential, apierror.NewErrorCause(ErrInvalidCredential, ErrInvalidCredentialCode))
+
+	tests := []struct {
+		name string
+		// Returns the credential the browser sends after getting the options
+		credential func(f *fakeAuthenticator, challenge string) *domain.RegistrationCredentialDTO
+		repository *MockRepository
+		want1      apierror.ApiError
+	}{
+		{
+			name: "ok",
+			credential: func(f *fakeAuthenticator, challenge string) *domain.RegistrationCredentialDTO {
+				return f.create(challenge)
+			},
+			repository: &MockRepository{},
+		},
+		{
+			name: "unknown_challenge",
+			credential: func(f *fakeAuthenticator, challenge string) *domain.RegistrationCredentialDTO {
+				return f.create("other")
+			},
+			repository: &MockRepository{},
+			want1:      invalid,
+		},
+		{
+			name: "other_origin",
+			credential: func(f *fakeAuthenticator, challenge string) *domain.RegistrationCredentialDTO {
+				f.origin = "https://evil.dev"
+				return f.create(challenge)
+			},
+			repository: &MockRepository{},
+			want1:      invalid,
+		},
+		{
+			name: "user_not_verified",
+			credential: func(f *fakeAuthenticator, challenge string) *domain.RegistrationCredentialDTO {
+				f.flags = flagUserPresent
+				return f.create(challenge)
+			},
+			repository: &MockRepository{},
+			want1:      invalid,
+		},
+		{
+			name: "invalid_attestation",
+			credential: func(f *fakeAuthenticator, challenge string) *domain.RegistrationCredentialDTO {
+				dto := f.create(challenge)
+				dto.Response.AttestationObject = encodeBase64URL([]byte{0xff})
+				return dto
+			},
+			repository: &MockRepository{},
+			want1:      invalid,
+		},
+		{
+			name: "already_registered",
+			credential: func(f *fakeAuthenticator, challenge string) *domain.RegistrationCredentialDTO {
+				return f.create(challenge)
+			},
+			repository: &MockRepository{Responses: map[int]interface{}{GetCredentialMockID: &domain.WebAuthnCredential{}}},
+			want1:      apierror.New(http.StatusBadRequest, ErrCredentialAlreadyRegistered, apierror.NewErrorCause(ErrCredentialAlreadyRegistered, ErrCredentialAlreadyRegisteredCode)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(testConfig(), tt.repository)
+			options, apierr := svc.RegistrationOptions(context.Background(), claims, &middleware.ContextInformation{})
+			if apierr != nil {
+				t.Fatal(apierr)
+			}
+
+			f := newFakeAuthenticator(t)
+			got, got1 := svc.Register(context.Background(), claims, tt.credential(f, options.Challenge), &middleware.ContextInformation{})
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Fatalf("webauthnService.Register() got1 = %v, want %v", got1, tt.want1)
+			}
+			if tt.want1 != nil {
+				if tt.repository.Added != nil {
+					t.Errorf("webauthnService.Register() stored an invalid credential")
+				}
+				return
+			}
+
+			if got.CredentialId != encodeBase64URL(f.credentialID) || got.UserId != 123 || got.Name != "Test" ||
+				!reflect.DeepEqual(got.PublicKey, f.coseKey()) || tt.repository.Added != got {
+				t.Errorf("webauthnService.Register() got = %+v", got)
+			}
+
+			// The challenge can't be used twice
+			if _, got1 := svc.Register(context.Background(), claims, tt.credential(f, options.Challenge), &middleware.ContextInformation{}); !reflect.DeepEqual(got1, invalid) {
+				t.Errorf("webauthnService.Register() replay got1 = %v, want %v", got1, invalid)
+			}
+		})
+	}
+}
+
+func Test_webauthnService_VerifyAssertion(t *testing.T) {
+	invalid := apierror.New(http.StatusUnauthorized, ErrInvalidCredential, apierror.NewErrorCause(ErrInvalidCredential, ErrInvalidCredentialCode))
+
+	tests := []struct {
+		name string
+		// Sets up the authenticator before the login and returns what it sends
+		assertion       func(t *testing.T, f *fakeAuthenticator, challenge string) *domain.AssertionCredentialDTO
+		storedSignCount int64
+		notFound        bool
+		want            int64
+		want1           apierror.ApiError
+		wantSignCount   int64
+	}{
+		{
+			name: "ok",
+			assertion: func(t *testing.T, f *fakeAuthenticator, challenge string) *domain.AssertionCredentialDTO {
+				f.signCount = 6
+				return f.get(t, challenge)
+			},
+			storedSignCount: 5,
+			want:            123,
+			wantSignCount:   6,
+		},
+		{
+			name: "synced_passkey_without_counter",
+			assertion: func(t *testing.T, f *fakeAuthenticator, challenge string) *domain.AssertionCredentialDTO {
+				return f.get(t, challenge)
+			},
+			want: 123,
+		},
+		{
+			name: "cloned_authenticator",
+			assertion: func(t *testing.T, f *fakeAuthenticator, challenge string) *domain.AssertionCredentialDTO {
+				f.signCount = 5
+				return f.get(t, challenge)
+			},
+			storedSignCount: 5,
+			want1:           invalid,
+		},
+		{
+			name: "unknown_credential",
+			assertion: func(t *testing.T, f *fakeAuthenticator, challenge string) *domain.AssertionCredentialDTO {
+				return f.get(t, challenge)
+			},
+			notFound: true,
+			want1:    invalid,
+		},
+		{
+			name: "other_user_handle",
+			assertion: func(t *testing.T, f *fakeAuthenticator, challenge string) *domain.AssertionCredentialDTO {
+				f.userHandle = []byte("456")
+				return f.get(t, challenge)
+			},
+			want1: invalid,
+		},
+		{
+			name: "unknown_challenge",
+			assertion: func(t *testing.T, f *fakeAuthenticator, challenge string) *domain.AssertionCredentialDTO {
+				return f.get(t, "other")
+			},
+			want1: invalid,
+		},
+		{
+			name: "other_rp",
+			assertion: func(t *testing.T, f *fakeAuthenticator, challenge string) *domain.AssertionCredentialDTO {
+				f.rpID = "evil.dev"
+				return f.get(t, challenge)
+			},
+			want1: invalid,
+		},
+		{
+			name: "invalid_signature",
+			assertion: func(t *testing.T, f *fakeAuthenticator, challenge string) *domain.AssertionCredentialDTO {
+				dto := f.get(t, challenge)
+				dto.Response.Signature = f.get(t, "other").Response.Signature
+				return dto
+			},
+			want1: invalid,
+		},
+		{
+			name: "invalid_encoding",
+			assertion: func(t *testing.T, f *fakeAuthenticator, challenge string) *domain.AssertionCredentialDTO {
+				dto := f.get(t, challenge)
+				dto.Response.AuthenticatorData = "%%%"
+				return dto
+			},
+			want1: invalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAuthenticator(t)
+			repository := &MockRepository{Responses: map[int]interface{}{}}
+			if !tt.notFound {
+				repository.Responses[GetCredentialMockID] = &domain.WebAuthnCredential{
+					CredentialId: encodeBase64URL(f.credentialID),
+					UserId:       123,
+					PublicKey:    f.coseKey(),
+					SignCount:    tt.storedSignCount,
+				}
+			}
+
+			svc := NewService(testConfig(), repository)
+			options, apierr := svc.LoginOptions(context.Background(), &middleware.ContextInformation{})
+			if apierr != nil {
+				t.Fatal(apierr)
+			}
+
+			got, got1 := svc.VerifyAssertion(context.Background(), tt.assertion(t, f, options.Challenge), &middleware.ContextInformation{})
+			if got != tt.want {
+				t.Errorf("webauthnService.VerifyAssertion() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("webauthnService.VerifyAssertion() got1 = %v, want %v", got1, tt.want1)
+			}
+			if tt.want1 == nil && (repository.SignUpdates != 1 || repository.SignCount != tt.wantSignCount) {
+				t.Errorf("webauthnService.VerifyAssertion() sign count = %v, updates = %v", repository.SignCount, repository.SignUpdates)
+			}
+			if tt.want1 != nil && repository.SignUpdates != 0 {
+				t.Errorf("webauthnService.VerifyAssertion() updated the sign count of a failed login")
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+package enigmaauth
+
+import "github.com/CienciaArgentina/go-enigma/pkg/jwteddsa"
+
+// SigningMethodEdDSA Ed25519 signatures (RFC 8037), jwt-go v3 doesn't ship it.
+var SigningMethodEdDSA = jwteddsa.SigningMethod
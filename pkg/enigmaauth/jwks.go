@@ -0,0 +1,174 @@
+package enigmaauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minJWKSRefreshInterval Tokens with unknown kids refresh the JWKS, but not more often than this.
+const minJWKSRefreshInterval = 10 * time.Second
+
+var errKeysUnavailable = errors.New("enigmaauth: can't fetch the JWKS")
+
+type publicKey struct {
+	alg string
+	key interface{}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwksCache struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]*publicKey
+	fetched   time.Time
+	attempted time.Time
+}
+
+func newJWKSCache(url string, client *http.Client, refreshInterval time.Duration) *jwksCache {
+	return &jwksCache{url: url, client: client, refreshInterval: refreshInterval, keys: map[string]*publicKey{}}
+}
+
+// key Returns the key with the given kid. If the JWKS can't be refreshed the cached keys keep being used.
+func (j *jwksCache) key(kid string) (*publicKey, error) {
+	j.mu.RLock()
+	key, ok := j.keys[kid]
+	fresh := time.Since(j.fetched) < j.refreshInterval
+	j.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	if err := j.refresh(); err != nil && !ok {
+		return nil, err
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, ErrInvalidToken
+}
+
+func (j *jwksCache) refresh() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if time.Since(j.attempted) < minJWKSRefreshInterval {
+		return nil
+	}
+	j.attempted = time.Now()
+
+	res, err := j.client.Get(j.url) // nolint
+	if err != nil {
+		return fmt.Errorf("%w: %v", errKeysUnavailable, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: status %d", errKeysUnavailable, res.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return fmt.Errorf("%w: %v", errKeysUnavailable, err)
+	}
+
+	keys := make(map[string]*publicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		// Keys we don't understand are skipped, they may be meant for other verifiers.
+		if key, err := parseJWK(jwk); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	j.keys = keys
+	j.fetched = time.Now()
+	return nil
+}
+
+func parseJWK(jwk jsonWebKey) (*publicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &publicKey{alg: jwk.Alg, key: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("enigmaauth: unsupported curve %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("enigmaauth: point is not on the curve")
+		}
+		return &publicKey{alg: jwk.Alg, key: &ecdsa.PublicKey{Curve: curve, X: x, Y: y}}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("enigmaauth: unsupported curve %s", jwk.Crv)
+		}
+		return &publicKey{alg: jwk.Alg, key: ed25519.PublicKey(x)}, nil
+	default:
+		return nil, fmt.Errorf("enigmaauth: unsupported key type %s", jwk.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
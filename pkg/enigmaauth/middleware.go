@@ -0,0 +1,110 @@
+package enigmaauth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/CienciaArgentina/go-backend-commons/pkg/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ErrUnauthorized      = "Necesitás estar logueado para realizar esta acción"
+	ErrUnauthorizedCode  = "invalid_access_token"
+	ErrRevokedCode       = "revoked_access_token"
+	ErrForbidden         = "No tenés permisos para realizar esta acción"
+	ErrVerificationError = "No se pudo verificar el token, intentá nuevamente"
+
+	principalKey = "enigmaauth_principal"
+	bearerPrefix = "Bearer "
+)
+
+// Middleware Requires a valid Enigma access token in the Authorization header. The principal is available to the
+// handlers through GetPrincipal.
+func Middleware(v *Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, bearerPrefix) {
+			abortUnauthorized(c, ErrUnauthorizedCode)
+			return
+		}
+
+		principal, err := v.Verify(strings.TrimPrefix(header, bearerPrefix))
+		switch {
+		case err == ErrInvalidToken:
+			abortUnauthorized(c, ErrUnauthorizedCode)
+			return
+		case err == ErrRevokedToken:
+			abortUnauthorized(c, ErrRevokedCode)
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, apierror.New(http.StatusServiceUnavailable, ErrVerificationError, apierror.NewErrorCause(err.Error(), "token_verification_failed")))
+			return
+		}
+
+		SetPrincipal(c, principal)
+		c.Next()
+	}
+}
+
+// SetPrincipal Stores the principal in the request context, useful to test handlers without signing tokens.
+func SetPrincipal(c *gin.Context, p *Principal) {
+	c.Set(principalKey, p)
+}
+
+// GetPrincipal Returns the principal stored by Middleware.
+func GetPrincipal(c *gin.Context) (*Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
+	}
+
+	p, ok := value.(*Principal)
+	return p, ok
+}
+
+// RequireRole Requires the user to have at least one of the roles. It must run after Middleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return require(func(p *Principal) bool {
+		for _, r := range roles {
+			if p.HasRole(r) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequireClaim Requires the user to have at least one of the claims through any of their roles. It must run after
+// Middleware.
+func RequireClaim(claims ...string) gin.HandlerFunc {
+	return require(func(p *Principal) bool {
+		for _, cl := range claims {
+			if p.HasClaim(cl) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func require(allowed func(p *Principal) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := GetPrincipal(c)
+		if !ok {
+			abortUnauthorized(c, ErrUnauthorizedCode)
+			return
+		}
+
+		if !allowed(p) {
+			c.AbortWithStatusJSON(http.StatusForbidden, apierror.NewForbiddenApiError(ErrForbidden))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func abortUnauthorized(c *gin.Context, code string) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, ErrUnauthorized, apierror.NewErrorCause(ErrUnauthorized, code)))
+}
@@ -0,0 +1,70 @@
+package enigmaauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CienciaArgentina/go-enigma/pkg/enigmaauth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	ring := keyRing(t, nil)
+	v, err := enigmaauth.NewVerifier(enigmaauth.Config{Secret: []byte("sign")})
+	require.NoError(t, err)
+	token := sign(t, ring, enigmaConfig(""))
+
+	tests := []struct {
+		name           string
+		header         string
+		handlers       []gin.HandlerFunc
+		expectedStatus int
+	}{
+		{name: "no_token", expectedStatus: http.StatusUnauthorized},
+		{name: "invalid_token", header: "Bearer invalid", expectedStatus: http.StatusUnauthorized},
+		{name: "ok", header: "Bearer " + token, expectedStatus: http.StatusOK},
+		{name: "has_role", header: "Bearer " + token, handlers: []gin.HandlerFunc{enigmaauth.RequireRole("editor", "admin")}, expectedStatus: http.StatusOK},
+		{name: "missing_role", header: "Bearer " + token, handlers: []gin.HandlerFunc{enigmaauth.RequireRole("editor")}, expectedStatus: http.StatusForbidden},
+		{name: "has_claim", header: "Bearer " + token, handlers: []gin.HandlerFunc{enigmaauth.RequireClaim("users:write")}, expectedStatus: http.StatusOK},
+		{name: "missing_claim", header: "Bearer " + token, handlers: []gin.HandlerFunc{enigmaauth.RequireClaim("users:delete")}, expectedStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers := append([]gin.HandlerFunc{enigmaauth.Middleware(v)}, tt.handlers...)
+			handlers = append(handlers, func(c *gin.Context) {
+				p, ok := enigmaauth.GetPrincipal(c)
+				require.True(t, ok)
+				require.Equal(t, int64(123), p.AuthID)
+				c.Status(http.StatusOK)
+			})
+
+			r := gin.New()
+			r.GET("/", handlers...)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestRequireRoleWithoutMiddleware(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	enigmaauth.RequireRole("admin")(c)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	enigmaauth.SetPrincipal(c, &enigmaauth.Principal{Roles: []enigmaauth.Role{{Description: "admin"}}})
+	enigmaauth.RequireRole("admin")(c)
+	require.False(t, c.IsAborted())
+}
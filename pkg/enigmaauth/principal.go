@@ -0,0 +1,54 @@
+package enigmaauth
+
+import (
+	"time"
+)
+
+// Claim A permission granted by a role.
+type Claim struct {
+	ID          int    `json:"id"`
+	Description string `json:"description"`
+}
+
+// Role A role assumed by the user, with the claims it grants.
+type Role struct {
+	ID          int     `json:"id"`
+	Description string  `json:"description"`
+	Claims      []Claim `json:"claims"`
+}
+
+// Principal The user an access token was issued to.
+type Principal struct {
+	AuthID int64
+	Email  string
+	// Login the token belongs to, revoking it revokes the token
+	SessionID string
+	// jti of the token
+	TokenID   string
+	ExpiresAt time.Time
+	Roles     []Role
+}
+
+// HasRole Returns true if the user has a role with the given description.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r.Description == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasClaim Returns true if any of the user's roles grants a claim with the given description.
+func (p *Principal) HasClaim(claim string) bool {
+	for _, r := range p.Roles {
+		for _, c := range r.Claims {
+			if c.Description == claim {
+				return true
+			}
+		}
+	}
+
+	return false
+}
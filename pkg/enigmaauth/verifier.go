@@ -0,0 +1,190 @@
+package enigmaauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	defaultJWKSRefreshInterval = 5 * time.Minute
+	defaultHTTPTimeout         = 10 * time.Second
+)
+
+var (
+	// ErrInvalidToken The token is malformed, expired, wasn't signed by Enigma or isn't meant for us.
+	ErrInvalidToken = errors.New("enigmaauth: invalid token")
+	// ErrRevokedToken The token is valid but it was revoked before expiring.
+	ErrRevokedToken = errors.New("enigmaauth: revoked token")
+	// ErrNoKeySource Neither Secret nor JWKSURL were configured.
+	ErrNoKeySource = errors.New("enigmaauth: either Secret or JWKSURL must be set")
+)
+
+// Claims The claims of the access tokens issued by Enigma.
+type Claims struct {
+	jwt.StandardClaims
+	AuthID    int64  `json:"auth_id"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid"`
+	Roles     []Role `json:"roles"`
+}
+
+// Config How tokens are verified. At least one of Secret or JWKSURL must be set, both can be set while Enigma moves from
+// the shared secret to asymmetric keys.
+type Config struct {
+	// Shared secret (Enigma's JWT_SIGN) that verifies HS256 tokens
+	Secret []byte
+	// Enigma's JWKS (ex. https://auth.cienciaargentina.dev/.well-known/jwks.json) that verifies RS256, ES256 and EdDSA tokens
+	JWKSURL string
+	// How long the JWKS is cached, 5 minutes by default. Unknown kids trigger a refresh before that
+	JWKSRefreshInterval time.Duration
+	// Expected iss and aud claims, they aren't checked when empty
+	Issuer   string
+	Audience string
+	// Optional revocation check, see RevocationChecker
+	IsRevoked func(jti string) (bool, error)
+	// Client used for the JWKS and the revocation checks, by default one with a 10 seconds timeout
+	HTTPClient *http.Client
+}
+
+// Verifier Verifies the access tokens issued by Enigma.
+type Verifier struct {
+	cfg  Config
+	jwks *jwksCache
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if len(cfg.Secret) == 0 && cfg.JWKSURL == "" {
+		return nil, ErrNoKeySource
+	}
+
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+
+	if cfg.JWKSRefreshInterval == 0 {
+		cfg.JWKSRefreshInterval = defaultJWKSRefreshInterval
+	}
+
+	v := &Verifier{cfg: cfg}
+	if cfg.JWKSURL != "" {
+		v.jwks = newJWKSCache(cfg.JWKSURL, cfg.HTTPClient, cfg.JWKSRefreshInterval)
+	}
+
+	return v, nil
+}
+
+// Verify Checks the signature and the standard claims of the token and returns who it was issued to. Errors other than
+// ErrInvalidToken and ErrRevokedToken mean the token couldn't be checked (ex. the JWKS is unreachable).
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, v.keyFunc)
+	if err != nil {
+		var ve *jwt.ValidationError
+		if errors.As(err, &ve) && ve.Inner != nil && errors.Is(ve.Inner, errKeysUnavailable) {
+			return nil, ve.Inner
+		}
+		return nil, ErrInvalidToken
+	}
+
+	// jwt-go only checks exp when it's present, ours always have it.
+	if claims.ExpiresAt == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	if v.cfg.Issuer != "" && !claims.VerifyIssuer(v.cfg.Issuer, true) {
+		return nil, ErrInvalidToken
+	}
+
+	if v.cfg.Audience != "" && !claims.VerifyAudience(v.cfg.Audience, true) {
+		return nil, ErrInvalidToken
+	}
+
+	if v.cfg.IsRevoked != nil {
+		revoked, err := v.cfg.IsRevoked(claims.Id)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrRevokedToken
+		}
+	}
+
+	authID := claims.AuthID
+	if authID == 0 {
+		authID, _ = strconv.ParseInt(claims.Subject, 10, 64)
+	}
+
+	return &Principal{
+		AuthID:    authID,
+		Email:     claims.Email,
+		SessionID: claims.SessionID,
+		TokenID:   claims.Id,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		Roles:     claims.Roles,
+	}, nil
+}
+
+// keyFunc The secret only verifies HS256 and the JWKS only asymmetric algorithms, otherwise a public key could be used as
+// an HMAC secret.
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method == jwt.SigningMethodHS256 {
+		if len(v.cfg.Secret) == 0 {
+			return nil, ErrInvalidToken
+		}
+		return v.cfg.Secret, nil
+	}
+
+	if v.jwks == nil {
+		return nil, ErrInvalidToken
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, err := v.jwks.key(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.alg != token.Method.Alg() {
+		return nil, ErrInvalidToken
+	}
+
+	return key.key, nil
+}
+
+// RevocationChecker Returns a Config.IsRevoked that asks Enigma (ex. https://auth.cienciaargentina.dev) whether a token
+// was revoked.
+func RevocationChecker(enigmaURL string, client *http.Client) func(jti string) (bool, error) {
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	base := strings.TrimSuffix(enigmaURL, "/")
+
+	return func(jti string) (bool, error) {
+		res, err := client.Get(base + "/tokens/revoked/" + url.PathEscape(jti)) // nolint
+		if err != nil {
+			return false, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return false, fmt.Errorf("enigmaauth: revocation check returned %d", res.StatusCode)
+		}
+
+		var body struct {
+			Revoked bool `json:"revoked"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			return false, err
+		}
+
+		return body.Revoked, nil
+	}
+}
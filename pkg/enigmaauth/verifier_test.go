@@ -0,0 +1,172 @@
+package enigmaauth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CienciaArgentina/go-enigma/config"
+	"github.com/CienciaArgentina/go-enigma/internal/domain"
+	"github.com/CienciaArgentina/go-enigma/internal/encryption"
+	"github.com/CienciaArgentina/go-enigma/pkg/enigmaauth"
+	"github.com/stretchr/testify/require"
+)
+
+func enigmaConfig(path string) *config.EnigmaConfig {
+	return &config.EnigmaConfig{
+		JwtSign:            "sign",
+		JwtSigningKeysPath: path,
+		TokenOptions: &config.TokenOptions{
+			Issuer:              "issuer",
+			Audience:            "audience",
+			AccessTokenDuration: time.Minute,
+		},
+	}
+}
+
+// keyRing Returns Enigma's key ring for a new key, or for the shared secret when private is nil.
+func keyRing(t *testing.T, private interface{}) *encryption.KeyRing {
+	path := ""
+	if private != nil {
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		require.NoError(t, err)
+		path = filepath.Join(t.TempDir(), "key.pem")
+		require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	}
+
+	ring, err := encryption.NewKeyRing(enigmaConfig(path))
+	require.NoError(t, err)
+	return ring
+}
+
+func sign(t *testing.T, ring *encryption.KeyRing, cfg *config.EnigmaConfig) string {
+	roles := []domain.Role{{ID: 1, Description: "admin", Claims: []domain.Claim{{ID: 2, Description: "users:write"}}}}
+	claims, err := encryption.NewAccessTokenClaims(123, "test@test.com", "session", roles, cfg)
+	require.NoError(t, err)
+	token, err := ring.Sign(claims)
+	require.NoError(t, err)
+	return token
+}
+
+func jwksServer(ring *encryption.KeyRing, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		_ = json.NewEncoder(w).Encode(ring.JWKS())
+	}))
+}
+
+func TestNewVerifierRequiresKeys(t *testing.T) {
+	_, err := enigmaauth.NewVerifier(enigmaauth.Config{})
+	require.Equal(t, enigmaauth.ErrNoKeySource, err)
+}
+
+func TestVerifySecret(t *testing.T) {
+	ring := keyRing(t, nil)
+	v, err := enigmaauth.NewVerifier(enigmaauth.Config{Secret: []byte("sign"), Issuer: "issuer", Audience: "audience"})
+	require.NoError(t, err)
+
+	p, err := v.Verify(sign(t, ring, enigmaConfig("")))
+	require.NoError(t, err)
+	require.Equal(t, int64(123), p.AuthID)
+	require.Equal(t, "test@test.com", p.Email)
+	require.Equal(t, "session", p.SessionID)
+	require.NotEmpty(t, p.TokenID)
+	require.True(t, p.HasRole("admin"))
+	require.True(t, p.HasClaim("users:write"))
+	require.False(t, p.HasClaim("users:delete"))
+
+	other, err := enigmaauth.NewVerifier(enigmaauth.Config{Secret: []byte("other")})
+	require.NoError(t, err)
+	_, err = other.Verify(sign(t, ring, enigmaConfig("")))
+	require.Equal(t, enigmaauth.ErrInvalidToken, err)
+
+	otherAudience := enigmaConfig("")
+	otherAudience.TokenOptions.Audience = "other"
+	_, err = v.Verify(sign(t, ring, otherAudience))
+	require.Equal(t, enigmaauth.ErrInvalidToken, err)
+
+	expired := enigmaConfig("")
+	expired.TokenOptions.AccessTokenDuration = -time.Minute
+	_, err = v.Verify(sign(t, ring, expired))
+	require.Equal(t, enigmaauth.ErrInvalidToken, err)
+}
+
+func TestVerifyJWKS(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for name, private := range map[string]interface{}{"EdDSA": edKey, "RS256": rsaKey} {
+		t.Run(name, func(t *testing.T) {
+			ring := keyRing(t, private)
+			requests := 0
+			server := jwksServer(ring, &requests)
+			defer server.Close()
+
+			v, err := enigmaauth.NewVerifier(enigmaauth.Config{JWKSURL: server.URL, Issuer: "issuer", Audience: "audience"})
+			require.NoError(t, err)
+
+			p, err := v.Verify(sign(t, ring, enigmaConfig("")))
+			require.NoError(t, err)
+			require.Equal(t, int64(123), p.AuthID)
+
+			// The keys are cached.
+			_, err = v.Verify(sign(t, ring, enigmaConfig("")))
+			require.NoError(t, err)
+			require.Equal(t, 1, requests)
+
+			// Without a secret configured HS256 tokens are rejected, even if signed with a published key.
+			_, err = v.Verify(sign(t, keyRing(t, nil), enigmaConfig("")))
+			require.Equal(t, enigmaauth.ErrInvalidToken, err)
+		})
+	}
+}
+
+func TestVerifyJWKSUnavailable(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ring := keyRing(t, edKey)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	v, err := enigmaauth.NewVerifier(enigmaauth.Config{JWKSURL: server.URL})
+	require.NoError(t, err)
+
+	_, err = v.Verify(sign(t, ring, enigmaConfig("")))
+	require.Error(t, err)
+	require.NotEqual(t, enigmaauth.ErrInvalidToken, err)
+}
+
+func TestVerifyRevoked(t *testing.T) {
+	ring := keyRing(t, nil)
+	revoked := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jti := filepath.Base(r.URL.Path)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jti": jti, "revoked": revoked[jti]})
+	}))
+	defer server.Close()
+
+	v, err := enigmaauth.NewVerifier(enigmaauth.Config{Secret: []byte("sign"), IsRevoked: enigmaauth.RevocationChecker(server.URL, nil)})
+	require.NoError(t, err)
+
+	token := sign(t, ring, enigmaConfig(""))
+	p, err := v.Verify(token)
+	require.NoError(t, err)
+
+	revoked[p.TokenID] = true
+	_, err = v.Verify(token)
+	require.Equal(t, enigmaauth.ErrRevokedToken, err)
+}
@@ -0,0 +1,51 @@
+// Package jwteddsa Adds Ed25519 signatures (RFC 8037) to jwt-go v3, which doesn't ship them. Enigma signs with it and
+// enigmaauth verifies with it, importing the package registers the "EdDSA" alg.
+package jwteddsa
+
+import (
+	"crypto/ed25519"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethod Ed25519 signatures, the private keys are ed25519.PrivateKey and the public ones ed25519.PublicKey.
+var SigningMethod = &signingMethodEdDSA{}
+
+type signingMethodEdDSA struct{}
+
+func init() { // nolint
+	jwt.RegisterSigningMethod(SigningMethod.Alg(), func() jwt.SigningMethod {
+		return SigningMethod
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+
+	return nil
+}